@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/goriiin/go-ab-service/internal/config"
 	"log"
@@ -13,6 +14,10 @@ import (
 
 	"github.com/goriiin/go-ab-service/internal/delivery"
 	"github.com/goriiin/go-ab-service/internal/platform/database"
+	"github.com/goriiin/go-ab-service/internal/platform/storage"
+	"github.com/goriiin/go-ab-service/internal/scheduler"
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+	"github.com/goriiin/go-ab-service/pkg/geoip"
 )
 
 func main() {
@@ -26,7 +31,36 @@ func main() {
 	defer dbPool.Close()
 
 	repo := database.NewRepository(dbPool)
-	handler := delivery.NewExperimentHandler(repo)
+	handler := delivery.NewExperimentHandler(repo, database.NewAssignmentStore(dbPool), config.NewEnvironments())
+	authCfg := config.NewAuthConfig()
+
+	idListCfg := config.NewIDListConfig()
+	if minioClient, err := storage.NewMinIOClient(idListCfg.MinIOEndpoint, idListCfg.MinIOAccessKey, idListCfg.MinIOSecretKey, idListCfg.MinIOUseSSL); err != nil {
+		log.Printf("WARN: ID list content storage is disabled: %v", err)
+	} else {
+		handler.WithIDListStorage(storage.NewBucketStore(minioClient, idListCfg.Bucket), idListCfg.MaxUploadBytes)
+	}
+
+	if geoCfg := config.NewGeoIPConfig(); geoCfg.DatabasePath != "" {
+		geoReader, err := geoip.Open(geoCfg.DatabasePath)
+		if err != nil {
+			log.Fatalf("FATAL: Invalid AB_GEOIP_DATABASE: %v", err)
+		}
+		handler.WithAttributeEnricher(geoip.NewEnricher(geoReader).Enrich)
+		log.Printf("INFO: GeoIP enrichment enabled (%s database).", geoReader.Metadata().DatabaseType)
+	}
+
+	if signingCfg := config.NewSigningConfig(); signingCfg.SigningKey != "" {
+		signingKey, err := ab_types.ParseEd25519PrivateKey(signingCfg.SigningKey)
+		if err != nil {
+			log.Fatalf("FATAL: Invalid SNAPSHOT_SIGNING_KEY: %v", err)
+		}
+		handler.WithSnapshotSigningKey(signingKey)
+	}
+
+	if rampCfg := config.NewRampSchedulerConfig(); rampCfg.Interval > 0 {
+		go scheduler.NewRampScheduler(repo, rampCfg.Interval).Run(context.Background())
+	}
 
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID, middleware.RealIP, middleware.Logger, middleware.Recoverer)
@@ -37,19 +71,83 @@ func main() {
 		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 	})
 
+	// Управление проектами и их API-ключами - по ключу администратора.
+	if authCfg.AdminKey != "" {
+		r.Route("/projects", func(r chi.Router) {
+			r.Use(delivery.AdminAuth(authCfg.AdminKey))
+			r.Post("/", handler.CreateProject)
+			r.Get("/", handler.ListProjects)
+			r.Post("/{projectID}/api-keys", handler.CreateAPIKey)
+			r.Get("/{projectID}/api-keys", handler.ListAPIKeys)
+			r.Delete("/{projectID}/api-keys/{keyID}", handler.DeleteAPIKey)
+		})
+	} else {
+		log.Println("WARN: AB_ADMIN_KEY is not set. Project management API is disabled.")
+	}
+
+	r.Group(func(r chi.Router) {
+		// Остальные эндпоинты работают с проектом API-ключа запроса.
+		r.Use(delivery.ProjectAuth(repo, authCfg.RequireAPIKey))
+		registerProjectRoutes(r, handler)
+	})
+
+	r.Handle("/metrics", promhttp.Handler())
+
+	log.Printf("INFO: Starting Central API Service on port %s", apiPort)
+	if err := http.ListenAndServe(apiPort, r); err != nil {
+		log.Fatalf("FATAL: Failed to start server: %v", err)
+	}
+}
+
+// registerProjectRoutes регистрирует эндпоинты, относящиеся к проекту запроса.
+func registerProjectRoutes(r chi.Router, handler *delivery.ExperimentHandler) {
 	r.Post("/decide", handler.Decide)
+	r.Get("/snapshot", handler.GetSnapshot)
 
 	r.Route("/experiments", func(r chi.Router) {
 		r.Post("/", handler.CreateExperiment)
 		r.Get("/{experimentID}", handler.GetExperiment)
 		r.Put("/{experimentID}", handler.UpdateExperiment)
 		r.Delete("/{experimentID}", handler.DeleteExperiment)
+
+		r.Get("/{experimentID}/ramp", handler.GetRamp)
+		r.Put("/{experimentID}/ramp", handler.PutRamp)
+		r.Post("/{experimentID}/ramp/pause", handler.PauseRamp)
+		r.Post("/{experimentID}/ramp/resume", handler.ResumeRamp)
+		r.Post("/{experimentID}/ramp/abort", handler.AbortRamp)
+
+		r.Post("/{experimentID}/promote", handler.PromoteExperiment)
+		r.Get("/{experimentID}/history", handler.GetExperimentHistory)
 	})
 
-	r.Handle("/metrics", promhttp.Handler())
+	r.Route("/flags", func(r chi.Router) {
+		r.Post("/", handler.CreateFlag)
+		r.Get("/", handler.ListFlags)
+		r.Get("/{flagKey}", handler.GetFlag)
+		r.Put("/{flagKey}", handler.UpdateFlag)
+		r.Put("/{flagKey}/environments/{environment}", handler.PutFlagEnvironment)
+		r.Delete("/{flagKey}", handler.DeleteFlag)
+	})
 
-	log.Printf("INFO: Starting Central API Service on port %s", apiPort)
-	if err := http.ListenAndServe(apiPort, r); err != nil {
-		log.Fatalf("FATAL: Failed to start server: %v", err)
-	}
+	r.Route("/segments", func(r chi.Router) {
+		r.Post("/", handler.CreateSegment)
+		r.Get("/", handler.ListSegments)
+		r.Get("/{segmentKey}", handler.GetSegment)
+		r.Put("/{segmentKey}", handler.UpdateSegment)
+		r.Delete("/{segmentKey}", handler.DeleteSegment)
+		r.Get("/{segmentKey}/versions", handler.GetSegmentVersions)
+	})
+	r.Route("/id-lists", func(r chi.Router) {
+		r.Post("/", handler.CreateIDList)
+		r.Get("/", handler.ListIDLists)
+		r.Get("/{listID}", handler.GetIDList)
+		r.Delete("/{listID}", handler.DeleteIDList)
+		r.Get("/{listID}/content", handler.GetIDListContent)
+		r.Put("/{listID}/content", handler.UploadIDListContent)
+	})
+	r.Route("/attributes", func(r chi.Router) {
+		r.Get("/", handler.ListAttributes)
+		r.Put("/{attributeName}", handler.PutAttribute)
+		r.Delete("/{attributeName}", handler.DeleteAttribute)
+	})
 }
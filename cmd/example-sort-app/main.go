@@ -5,26 +5,33 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"os"
 	"sort"
 	"time"
 
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
 	client_sdk "github.com/goriiin/go-ab-service/pkg/client-sdk"
 )
 
+// Значения параметра варианта "sort_order".
 const (
-	VariantAsc  = "variant-a-asc"
-	VariantDesc = "variant-b-desc"
+	SortOrderParam = "sort_order"
+	SortOrderAsc   = "asc"
+	SortOrderDesc  = "desc"
 )
 
 type SortRequest struct {
-	UserID  string `json:"user_id"`
-	Numbers []int  `json:"numbers"`
+	UserID string `json:"user_id"`
+	// ExperimentID - эксперимент сортировки; если не указан, берется из SORT_EXPERIMENT_ID.
+	ExperimentID string `json:"experiment_id"`
+	Numbers      []int  `json:"numbers"`
 }
 
 type SortResponse struct {
 	SortedNumbers []int  `json:"sorted_numbers"`
 	VariantUsed   string `json:"variant_used"`
 	Source        string `json:"source"`
+	Reason        string `json:"reason"`
 }
 
 func main() {
@@ -42,6 +49,33 @@ func main() {
 		AssignmentEventsTopic: "ab_assignment_events",
 	}
 
+	if encodedKey := os.Getenv("AB_SNAPSHOT_PUBLIC_KEY"); encodedKey != "" {
+		publicKey, err := ab_types.ParseEd25519PublicKey(encodedKey)
+		if err != nil {
+			log.Fatalf("FATAL: Invalid AB_SNAPSHOT_PUBLIC_KEY: %v", err)
+		}
+		sdkConfig.SnapshotPublicKey = publicKey
+	}
+
+	// Окружение, эксперименты которого использует приложение (по умолчанию production).
+	sdkConfig.Environment = os.Getenv("AB_ENVIRONMENT")
+	// Проект приложения (по умолчанию default): снэпшоты и дельты только этого проекта.
+	sdkConfig.Project = os.Getenv("AB_PROJECT")
+
+	// Режим без Kafka и MinIO: снэпшот опрашивается у central-api.
+	if snapshotURL := os.Getenv("AB_SNAPSHOT_URL"); snapshotURL != "" {
+		source := client_sdk.NewHTTPSnapshotSource(snapshotURL, &http.Client{Timeout: 10 * time.Second}).
+			WithAPIKey(os.Getenv("AB_API_KEY"))
+		sdkConfig.SnapshotSource = source
+		sdkConfig.DeltaSource = client_sdk.NewPollingDeltaSource(source, 5*time.Second)
+		sdkConfig.KafkaBrokers = nil
+	}
+
+	// Старт без ожидания конфигурации: до ее загрузки /sort отвечает вариантом по умолчанию.
+	if os.Getenv("AB_NON_BLOCKING_STARTUP") == "true" {
+		sdkConfig.NonBlockingStartup = true
+	}
+
 	initCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
@@ -51,12 +85,20 @@ func main() {
 	}
 	defer abClient.Close()
 
-	http.HandleFunc("/sort", sortHandler(abClient))
+	http.HandleFunc("/sort", sortHandler(abClient, os.Getenv("SORT_EXPERIMENT_ID")))
+	http.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		status := abClient.Status()
+		w.Header().Set("Content-Type", "application/json")
+		if !status.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(status)
+	})
 	log.Println("INFO: Server is listening on :8081")
 	log.Fatal(http.ListenAndServe(":8081", nil))
 }
 
-func sortHandler(abClient *client_sdk.Client) http.HandlerFunc {
+func sortHandler(abClient *client_sdk.Client, defaultExperimentID string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req SortRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -64,32 +106,36 @@ func sortHandler(abClient *client_sdk.Client) http.HandlerFunc {
 			return
 		}
 
-		attributes := map[string]any{"use_sort_test": true}
-		assignments := abClient.Decide(req.UserID, attributes)
+		experimentID := req.ExperimentID
+		if experimentID == "" {
+			experimentID = defaultExperimentID
+		}
 
-		variant := ""
-		if len(assignments) > 0 {
-			for _, v := range assignments {
-				variant = v
-				break
-			}
+		user := client_sdk.DecisionContext{
+			UserID:     req.UserID,
+			Attributes: map[string]any{"use_sort_test": true},
 		}
+		variant, reason := abClient.GetVariant(r.Context(), experimentID, user)
+		sortOrder := abClient.GetString(experimentID, user, SortOrderParam, SortOrderAsc)
 
 		resp := SortResponse{
 			SortedNumbers: req.Numbers,
+			Reason:        string(reason),
 		}
 
 		if variant != "" {
 			resp.Source = "A/B Experiment"
 			resp.VariantUsed = variant
-			if variant == VariantDesc {
-				sort.Sort(sort.Reverse(sort.IntSlice(resp.SortedNumbers)))
-			} else {
-				sort.Ints(resp.SortedNumbers)
-			}
+			// Пользователь видит результат сортировки варианта - это и есть экспозиция.
+			abClient.LogExposure(experimentID, user, variant)
 		} else {
 			resp.Source = "Default"
 			resp.VariantUsed = "default"
+		}
+
+		if sortOrder == SortOrderDesc {
+			sort.Sort(sort.Reverse(sort.IntSlice(resp.SortedNumbers)))
+		} else {
 			sort.Ints(resp.SortedNumbers)
 		}
 
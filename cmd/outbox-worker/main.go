@@ -3,23 +3,54 @@ package main
 import (
 	"context"
 	"log"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/goriiin/go-ab-service/internal/config"
 	"github.com/goriiin/go-ab-service/internal/platform/database"
 	"github.com/goriiin/go-ab-service/internal/platform/queue"
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/segmentio/kafka-go"
 )
 
 type OutboxEvent struct {
 	EventID     uuid.UUID `json:"event_id"`
 	AggregateID string    `json:"aggregate_id"`
+	EventType   string    `json:"event_type"`
 	Payload     []byte    `json:"payload"`
+	Seq         int64     `json:"seq"`
+	Environment string    `json:"environment"`
+	ProjectID   string    `json:"project_id"`
+}
+
+// producers - продюсеры топиков дельт проектов, создаваемые при первом событии проекта.
+type producers struct {
+	brokers []string
+	byTopic map[string]*queue.Producer
+}
+
+// forProject возвращает продюсер топика дельт проекта.
+func (p *producers) forProject(project string) *queue.Producer {
+	topic := ab_types.ProjectDeltasTopic(project)
+	producer, ok := p.byTopic[topic]
+	if !ok {
+		producer = queue.NewAutoCreateProducer(p.brokers, topic)
+		p.byTopic[topic] = producer
+	}
+	return producer
+}
+
+func (p *producers) Close() {
+	for topic, producer := range p.byTopic {
+		if err := producer.Close(); err != nil {
+			log.Printf("WARN: Failed to close producer for topic %s: %v", topic, err)
+		}
+	}
 }
 
 func main() {
-	const deltasTopic = "ab_deltas"
 	kafkaBrokers := []string{"kafka:9092"}
 
 	dbCfg := config.NewDBConfig()
@@ -30,7 +61,8 @@ func main() {
 	defer dbPool.Close()
 	log.Println("INFO: Outbox worker connected to PostgreSQL")
 
-	producer := queue.NewProducer(kafkaBrokers, deltasTopic)
+	// Дельты каждого проекта публикуются в свой топик, чтобы SDK получал только свой проект.
+	producer := &producers{brokers: kafkaBrokers, byTopic: make(map[string]*queue.Producer)}
 	defer producer.Close()
 	log.Println("INFO: Outbox worker connected to Kafka")
 
@@ -43,7 +75,7 @@ func main() {
 	}
 }
 
-func processEvents(ctx context.Context, pool *pgxpool.Pool, producer *queue.Producer) {
+func processEvents(ctx context.Context, pool *pgxpool.Pool, producer *producers) {
 	tx, err := pool.Begin(ctx)
 	if err != nil {
 		log.Printf("ERROR: could not begin transaction: %v", err)
@@ -52,10 +84,10 @@ func processEvents(ctx context.Context, pool *pgxpool.Pool, producer *queue.Prod
 	defer tx.Rollback(ctx)
 
 	query := `
-		SELECT event_id, aggregate_id, payload
+		SELECT event_id, aggregate_id, event_type, payload, seq, environment, project_id
 		FROM outbox
 		WHERE processing_state = 'PENDING'
-		ORDER BY created_at
+		ORDER BY project_id, seq
 		LIMIT 10
 		FOR UPDATE SKIP LOCKED`
 
@@ -70,7 +102,7 @@ func processEvents(ctx context.Context, pool *pgxpool.Pool, producer *queue.Prod
 
 	for rows.Next() {
 		var event OutboxEvent
-		if err := rows.Scan(&event.EventID, &event.AggregateID, &event.Payload); err != nil {
+		if err := rows.Scan(&event.EventID, &event.AggregateID, &event.EventType, &event.Payload, &event.Seq, &event.Environment, &event.ProjectID); err != nil {
 			log.Printf("ERROR: failed to scan outbox event: %v", err)
 			continue
 		}
@@ -86,12 +118,21 @@ func processEvents(ctx context.Context, pool *pgxpool.Pool, producer *queue.Prod
 	log.Printf("INFO: Locked %d events for processing.", len(eventsToProcess))
 
 	for _, event := range eventsToProcess {
-		err = producer.Publish(ctx, []byte(event.AggregateID), event.Payload)
+		// Номер изменения позволяет SDK отбросить дельты, уже учтенные в снэпшоте.
+		headers := []kafka.Header{
+			{Key: ab_types.DeltaHeaderSeq, Value: []byte(strconv.FormatInt(event.Seq, 10))},
+			{Key: ab_types.DeltaHeaderEventType, Value: []byte(event.EventType)},
+		}
+		// Окружение позволяет SDK пропускать изменения чужих окружений, не теряя номер изменения.
+		if event.Environment != "" {
+			headers = append(headers, kafka.Header{Key: ab_types.DeltaHeaderEnvironment, Value: []byte(event.Environment)})
+		}
+		err = producer.forProject(event.ProjectID).Publish(ctx, []byte(event.AggregateID), event.Payload, headers...)
 		if err != nil {
 			log.Printf("ERROR: Failed to publish event %s to Kafka: %v. Transaction will be rolled back.", event.EventID, err)
 			return
 		}
-		log.Printf("INFO: Successfully published event for aggregate %s.", event.AggregateID)
+		log.Printf("INFO: Successfully published event for aggregate %s of project %s.", event.AggregateID, event.ProjectID)
 	}
 
 	deleteQuery := "DELETE FROM outbox WHERE event_id = ANY($1)"
@@ -1,34 +1,27 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
 	"log"
-	"time"
+	"net/http"
+	"os/signal"
+	"syscall"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/goriiin/go-ab-service/internal/config"
 	"github.com/goriiin/go-ab-service/internal/platform/database"
 	"github.com/goriiin/go-ab-service/internal/platform/queue"
 	"github.com/goriiin/go-ab-service/internal/platform/storage"
+	"github.com/goriiin/go-ab-service/internal/snapshot"
 	"github.com/goriiin/go-ab-service/pkg/ab_types"
 )
 
-type SnapshotMeta struct {
-	SnapshotVersion string `json:"snapshot_version"`
-	Path            string `json:"path"`
-	CreatedAt       string `json:"created_at"`
-}
-
 func main() {
-	const (
-		snapshotsTopic = "ab_snapshots_meta"
-		minioEndpoint  = "minio:9000"
-		minioAccessKey = "minioadmin"
-		minioSecretKey = "minioadmin"
-		snapshotBucket = "ab-snapshots"
-	)
-	kafkaBrokers := []string{"kafka:9092"}
+	cfg := config.NewSnapshotConfig()
 
 	dbCfg := config.NewDBConfig()
 	dbPool, err := database.NewPostgresConnection(dbCfg.ConnectionString())
@@ -37,80 +30,107 @@ func main() {
 	}
 	defer dbPool.Close()
 
-	minioClient, err := storage.NewMinIOClient(minioEndpoint, minioAccessKey, minioSecretKey, false)
+	minioClient, err := storage.NewMinIOClient(cfg.MinIOEndpoint, cfg.MinIOAccessKey, cfg.MinIOSecretKey, cfg.MinIOUseSSL)
 	if err != nil {
 		log.Fatalf("FATAL: Cannot connect to MinIO: %v", err)
 	}
 
-	producer := queue.NewProducer(kafkaBrokers, snapshotsTopic)
+	producer := queue.NewProducer(cfg.KafkaBrokers, cfg.MetaTopic)
 	defer producer.Close()
 
-	log.Println("INFO: Starting snapshot generation process...")
-
-	query := `
-		SELECT id, layer_id, config_version, end_time, salt, status, targeting_rules, override_lists, variants
-		FROM experiments WHERE status = $1`
-
-	rows, err := dbPool.Query(context.Background(), query, ab_types.StatusActive)
-	if err != nil {
-		log.Fatalf("FATAL: Failed to query active experiments: %v", err)
+	generatorCfg := snapshot.GeneratorConfig{
+		Bucket: cfg.SnapshotBucket,
+		Format: ab_types.SnapshotFormat{
+			Encoding:    ab_types.SnapshotEncoding(cfg.Encoding),
+			Compression: ab_types.SnapshotCompression(cfg.Compression),
+		},
+		Retention: snapshot.RetentionPolicy{KeepLast: cfg.RetainCount, KeepNewerThan: cfg.RetainMaxAge},
 	}
-	defer rows.Close()
-
-	var experiments []ab_types.Experiment
-	var latestVersion string
-
-	for rows.Next() {
-		var exp ab_types.Experiment
-		err := rows.Scan(
-			&exp.ID, &exp.LayerID, &exp.ConfigVersion, &exp.EndTime, &exp.Salt, &exp.Status,
-			&exp.TargetingRules, &exp.OverrideLists, &exp.Variants,
-		)
+	if err := generatorCfg.Format.Validate(); err != nil {
+		log.Fatalf("FATAL: Invalid snapshot format: %v", err)
+	}
+	if cfg.SigningKey != "" {
+		signingKey, err := ab_types.ParseEd25519PrivateKey(cfg.SigningKey)
 		if err != nil {
-			log.Fatalf("FATAL: Failed to scan experiment row: %v", err)
-		}
-
-		experiments = append(experiments, exp)
-
-		if exp.ConfigVersion > latestVersion {
-			latestVersion = exp.ConfigVersion
+			log.Fatalf("FATAL: Invalid SNAPSHOT_SIGNING_KEY: %v", err)
 		}
+		generatorCfg.SigningKey = signingKey
+		publicKey := signingKey.Public().(ed25519.PublicKey)
+		log.Printf("INFO: Snapshot manifests will be signed. Public key: %s", base64.StdEncoding.EncodeToString(publicKey))
+	} else {
+		log.Println("WARN: SNAPSHOT_SIGNING_KEY is not set. Snapshot manifests will not be signed.")
 	}
 
-	if err := rows.Err(); err != nil {
-		log.Fatalf("FATAL: Failed to iterate over experiments: %w", err)
+	// Для каждой пары (проект, окружение) - свой генератор со своим префиксом в бакете.
+	repo := database.NewRepository(dbPool)
+	partitions := snapshot.NewPartitions(repo, cfg.Environments, generatorCfg, func(cfg snapshot.GeneratorConfig) *snapshot.Generator {
+		return snapshot.NewGenerator(repo, minioClient, producer, cfg)
+	})
+	log.Printf("INFO: Generating snapshots of all projects for environments: %v", cfg.Environments)
+
+	switch cfg.Mode {
+	case config.SnapshotModeOnce:
+		runOnce(partitions)
+	case config.SnapshotModeDaemon:
+		runDaemon(cfg, partitions)
+	default:
+		log.Fatalf("FATAL: Unknown SNAPSHOT_MODE %q (expected %q or %q)", cfg.Mode, config.SnapshotModeOnce, config.SnapshotModeDaemon)
 	}
+}
 
-	if len(experiments) == 0 {
-		log.Println("INFO: No active experiments found. Snapshot not generated.")
-		return
+func runOnce(partitions *snapshot.Partitions) {
+	log.Println("INFO: Starting snapshot generation process...")
+	// Ошибки отдельных проектов не прерывают запуск: процесс завершается с ошибкой после всех генераций.
+	if err := partitions.GenerateAll(context.Background()); err != nil {
+		log.Fatalf("FATAL: %v", err)
 	}
-	log.Printf("INFO: Found %d active experiments to include in snapshot.", len(experiments))
+	log.Println("INFO: Snapshot generation process completed successfully.")
+}
 
-	snapshotData, err := json.Marshal(experiments)
-	if err != nil {
-		log.Fatalf("FATAL: Failed to marshal experiments to JSON: %v", err)
-	}
+func runDaemon(cfg *config.SnapshotConfig, partitions *snapshot.Partitions) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	service := snapshot.NewService(partitions, snapshot.ServiceConfig{
+		Interval:          cfg.Interval,
+		DeltaThreshold:    cfg.DeltaThreshold,
+		GenerationTimeout: cfg.GenerationTimeout,
+		KafkaBrokers:      cfg.KafkaBrokers,
+		DeltasGroupID:     cfg.DeltasGroupID,
+	})
+	defer service.Close()
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	metricsServer := &http.Server{Addr: cfg.MetricsAddr, Handler: mux}
+	go func() {
+		log.Printf("INFO: Serving snapshot metrics on %s", cfg.MetricsAddr)
+		if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("ERROR: Metrics server failed: %v", err)
+		}
+	}()
 
-	objectName := "snapshot-" + latestVersion + ".json"
-	_, err = minioClient.Upload(context.Background(), snapshotBucket, objectName, "application/json", bytes.NewReader(snapshotData), int64(len(snapshotData)))
-	if err != nil {
-		log.Fatalf("FATAL: Failed to upload snapshot to MinIO: %v", err)
-	}
-	log.Printf("INFO: Successfully uploaded snapshot '%s' to bucket '%s'.", objectName, snapshotBucket)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := service.Run(ctx); err != nil {
+			log.Printf("ERROR: Snapshot service stopped with error: %v", err)
+		}
+	}()
 
-	meta := SnapshotMeta{
-		SnapshotVersion: latestVersion,
-		Path:            objectName,
-		CreatedAt:       time.Now().UTC().Format(time.RFC3339),
-	}
-	metaData, _ := json.Marshal(meta)
+	<-ctx.Done()
+	log.Println("INFO: Shutdown signal received. Waiting for in-flight generation to finish...")
 
-	err = producer.Publish(context.Background(), []byte(latestVersion), metaData)
-	if err != nil {
-		log.Fatalf("FATAL: Failed to publish snapshot metadata to Kafka: %v", err)
-	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
 
-	log.Printf("INFO: Successfully published snapshot metadata for version %s.", latestVersion)
-	log.Println("INFO: Snapshot generation process completed successfully.")
+	select {
+	case <-done:
+	case <-shutdownCtx.Done():
+		log.Println("WARN: Snapshot service did not stop within shutdown timeout.")
+	}
+	if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("WARN: Failed to shut down metrics server: %v", err)
+	}
+	log.Println("INFO: Snapshot generator stopped.")
 }
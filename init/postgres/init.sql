@@ -1,3 +1,28 @@
+-- Скрипт идемпотентен: на новой базе его выполняет образ postgres, а существующую базу
+-- он доводит до текущей схемы при повторном запуске (make migrate). Колонки, добавленные
+-- после создания таблицы, дублируются в ALTER TABLE ... ADD COLUMN IF NOT EXISTS:
+-- CREATE TABLE IF NOT EXISTS не меняет уже существующую таблицу.
+
+-- Проекты (пространства имен) продуктовых групп. Эксперименты, слои и флаги принадлежат проекту.
+CREATE TABLE IF NOT EXISTS projects (
+                                        id TEXT PRIMARY KEY,
+                                        name TEXT NOT NULL,
+                                        created_at TIMESTAMPTZ NOT NULL
+);
+
+INSERT INTO projects (id, name, created_at) VALUES ('default', 'Default', NOW()) ON CONFLICT (id) DO NOTHING;
+
+-- API-ключи проектов. Хранится только SHA-256 ключа.
+CREATE TABLE IF NOT EXISTS api_keys (
+                                        id TEXT PRIMARY KEY,
+                                        project_id TEXT NOT NULL REFERENCES projects (id) ON DELETE CASCADE,
+                                        name TEXT NOT NULL DEFAULT '',
+                                        key_hash TEXT NOT NULL UNIQUE,
+                                        created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_project ON api_keys (project_id);
+
 CREATE TABLE IF NOT EXISTS experiments (
                                            id TEXT PRIMARY KEY,
                                            layer_id TEXT NOT NULL,
@@ -7,11 +32,155 @@ CREATE TABLE IF NOT EXISTS experiments (
                                            status TEXT NOT NULL,
                                            targeting_rules JSONB,
                                            override_lists JSONB,
-                                           variants JSONB
+                                           variants JSONB,
+                                           parameter_schema JSONB, -- схема параметров вариантов
+                                           sticky BOOLEAN NOT NULL DEFAULT FALSE,
+                                           bucket_by TEXT NOT NULL DEFAULT '', -- пусто означает user_id
+                                           bucket_resolution INT NOT NULL DEFAULT 0, -- 0 означает 1000 бакетов
+                                           bucketing_version INT NOT NULL DEFAULT 0, -- 0 означает устаревшую схему (конкатенация)
+                                           ramp JSONB, -- план постепенного раскатывания варианта
+                                           environment TEXT NOT NULL DEFAULT 'production',
+                                           project_id TEXT NOT NULL DEFAULT 'default' REFERENCES projects (id)
 );
 
+ALTER TABLE experiments ADD COLUMN IF NOT EXISTS parameter_schema JSONB;
+ALTER TABLE experiments ADD COLUMN IF NOT EXISTS sticky BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE experiments ADD COLUMN IF NOT EXISTS bucket_by TEXT NOT NULL DEFAULT '';
+ALTER TABLE experiments ADD COLUMN IF NOT EXISTS bucket_resolution INT NOT NULL DEFAULT 0;
+-- Существующие эксперименты остаются на устаревшей схеме хеширования, и пользователи не перемешиваются.
+ALTER TABLE experiments ADD COLUMN IF NOT EXISTS bucketing_version INT NOT NULL DEFAULT 0;
+ALTER TABLE experiments ADD COLUMN IF NOT EXISTS ramp JSONB;
+ALTER TABLE experiments ADD COLUMN IF NOT EXISTS environment TEXT NOT NULL DEFAULT 'production';
+ALTER TABLE experiments ADD COLUMN IF NOT EXISTS project_id TEXT NOT NULL DEFAULT 'default' REFERENCES projects (id);
+
 -- Индекс для быстрого поиска экспериментов по статусу (например, 'ACTIVE')
 CREATE INDEX IF NOT EXISTS idx_experiments_status ON experiments (status);
+DROP INDEX IF EXISTS idx_experiments_environment; -- заменен индексом по (project_id, environment)
+CREATE INDEX IF NOT EXISTS idx_experiments_project_environment ON experiments (project_id, environment);
+
+-- Закрепленные назначения sticky-экспериментов: пользователь сохраняет вариант,
+-- даже если бакеты или таргетинг эксперимента изменились.
+CREATE TABLE IF NOT EXISTS sticky_assignments (
+                                                  experiment_id TEXT NOT NULL REFERENCES experiments (id) ON DELETE CASCADE,
+                                                  user_id TEXT NOT NULL,
+                                                  variant_name TEXT NOT NULL,
+                                                  assigned_at TIMESTAMPTZ NOT NULL,
+                                                  PRIMARY KEY (experiment_id, user_id)
+);
+
+-- История экспериментов: переносы конфигурации между окружениями (promote).
+-- Записи не удаляются вместе с экспериментом, чтобы история переносов сохранялась.
+CREATE TABLE IF NOT EXISTS experiment_history (
+                                                  id BIGSERIAL PRIMARY KEY,
+                                                  experiment_id TEXT NOT NULL,
+                                                  environment TEXT NOT NULL,
+                                                  action TEXT NOT NULL,
+                                                  source_experiment_id TEXT NOT NULL DEFAULT '',
+                                                  source_environment TEXT NOT NULL DEFAULT '',
+                                                  config_version TEXT NOT NULL,
+                                                  experiment JSONB NOT NULL, -- конфигурация после изменения
+                                                  created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_experiment_history_experiment ON experiment_history (experiment_id);
+CREATE INDEX IF NOT EXISTS idx_experiment_history_source ON experiment_history (source_experiment_id, environment);
+
+-- Фиче-флаги. Состояние по окружениям (включен ли флаг, таргетинг, доля раскатки) хранится в environments.
+CREATE TABLE IF NOT EXISTS flags (
+                                     project_id TEXT NOT NULL DEFAULT 'default' REFERENCES projects (id),
+                                     key TEXT NOT NULL,
+                                     description TEXT NOT NULL DEFAULT '',
+                                     default_value BOOLEAN NOT NULL DEFAULT FALSE,
+                                     bucket_by TEXT NOT NULL DEFAULT '',
+                                     salt TEXT NOT NULL,
+                                     config_version TEXT NOT NULL,
+                                     environments JSONB NOT NULL DEFAULT '{}',
+                                     PRIMARY KEY (project_id, key)
+);
+
+-- Флаги, созданные до появления проектов, имели первичный ключ key.
+ALTER TABLE flags ADD COLUMN IF NOT EXISTS project_id TEXT NOT NULL DEFAULT 'default' REFERENCES projects (id);
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.key_column_usage
+                   WHERE table_name = 'flags' AND constraint_name = 'flags_pkey' AND column_name = 'project_id') THEN
+        ALTER TABLE flags DROP CONSTRAINT flags_pkey;
+        ALTER TABLE flags ADD PRIMARY KEY (project_id, key);
+    END IF;
+END $$;
+
+-- Сегменты аудитории: именованные наборы правил таргетинга, на которые ссылаются
+-- правила экспериментов и флагов (операторы IN_SEGMENT/NOT_IN_SEGMENT).
+CREATE TABLE IF NOT EXISTS segments (
+                                        project_id TEXT NOT NULL DEFAULT 'default' REFERENCES projects (id),
+                                        key TEXT NOT NULL,
+                                        description TEXT NOT NULL DEFAULT '',
+                                        rules JSONB NOT NULL DEFAULT '[]',
+                                        version INT NOT NULL,
+                                        config_version TEXT NOT NULL,
+                                        PRIMARY KEY (project_id, key)
+);
+
+-- Все версии сегментов. Записи удаляются вместе с сегментом.
+CREATE TABLE IF NOT EXISTS segment_versions (
+                                                project_id TEXT NOT NULL,
+                                                key TEXT NOT NULL,
+                                                version INT NOT NULL,
+                                                description TEXT NOT NULL DEFAULT '',
+                                                rules JSONB NOT NULL DEFAULT '[]',
+                                                config_version TEXT NOT NULL,
+                                                created_at TIMESTAMPTZ NOT NULL,
+                                                PRIMARY KEY (project_id, key, version),
+                                                FOREIGN KEY (project_id, key) REFERENCES segments (project_id, key) ON DELETE CASCADE
+);
+
+-- Списки идентификаторов для таргетинга (IN_ID_LIST/NOT_IN_ID_LIST) и оверрайдов.
+-- Здесь хранятся только метаданные; содержимое - объект object_key в бакете снэпшотов.
+CREATE TABLE IF NOT EXISTS id_lists (
+                                        project_id TEXT NOT NULL DEFAULT 'default' REFERENCES projects (id),
+                                        id TEXT NOT NULL,
+                                        name TEXT NOT NULL,
+                                        description TEXT NOT NULL DEFAULT '',
+                                        size INT NOT NULL DEFAULT 0,
+                                        checksum TEXT NOT NULL DEFAULT '',
+                                        object_key TEXT NOT NULL DEFAULT '', -- пусто, пока содержимое не загружено
+                                        config_version TEXT NOT NULL,
+                                        created_at TIMESTAMPTZ NOT NULL,
+                                        updated_at TIMESTAMPTZ NOT NULL,
+                                        PRIMARY KEY (project_id, id)
+);
+
+-- Схема атрибутов проекта: объявленный тип атрибута, по которому API проверяет правила таргетинга.
+CREATE TABLE IF NOT EXISTS attributes (
+                                          project_id TEXT NOT NULL DEFAULT 'default' REFERENCES projects (id),
+                                          name TEXT NOT NULL,
+                                          type TEXT NOT NULL,
+                                          description TEXT NOT NULL DEFAULT '',
+                                          updated_at TIMESTAMPTZ NOT NULL,
+                                          PRIMARY KEY (project_id, name)
+);
+
+-- Счетчики изменений конфигурации проектов. Строка проекта увеличивается в каждой
+-- транзакции записи в проект, поэтому порядок seq совпадает с порядком коммитов,
+-- а дельты каждого проекта (в своем топике) идут без пропусков номеров.
+CREATE TABLE IF NOT EXISTS config_state (
+                                            project_id TEXT PRIMARY KEY REFERENCES projects (id) ON DELETE CASCADE,
+                                            seq BIGINT NOT NULL
+);
+
+-- До появления проектов config_state хранила единственную строку id = 1; ее счетчик
+-- переходит к проекту default.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'config_state' AND column_name = 'id') THEN
+        ALTER TABLE config_state ADD COLUMN project_id TEXT NOT NULL DEFAULT 'default' REFERENCES projects (id) ON DELETE CASCADE;
+        ALTER TABLE config_state DROP COLUMN id;
+        ALTER TABLE config_state ALTER COLUMN project_id DROP DEFAULT;
+        ALTER TABLE config_state ADD PRIMARY KEY (project_id);
+    END IF;
+END $$;
+
+INSERT INTO config_state (project_id, seq) VALUES ('default', 0) ON CONFLICT (project_id) DO NOTHING;
 
 CREATE TABLE IF NOT EXISTS outbox (
                                       event_id UUID PRIMARY KEY,
@@ -19,8 +188,17 @@ CREATE TABLE IF NOT EXISTS outbox (
                                       event_type TEXT NOT NULL,
                                       payload JSONB NOT NULL,
                                       created_at TIMESTAMPTZ NOT NULL,
-                                      processing_state TEXT NOT NULL -- e.g., PENDING, LOCKED
+                                      processing_state TEXT NOT NULL, -- e.g., PENDING, LOCKED
+                                      seq BIGINT NOT NULL, -- значение config_state.seq на момент изменения
+                                      environment TEXT NOT NULL DEFAULT '', -- пусто для событий всех окружений (флаги, сегменты, списки)
+                                      project_id TEXT NOT NULL DEFAULT 'default' -- определяет топик дельт
 );
 
+-- У событий, записанных до введения seq, номера нет: SDK сравнивает версии конфигурации дельт с seq = 0.
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS seq BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS environment TEXT NOT NULL DEFAULT '';
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS project_id TEXT NOT NULL DEFAULT 'default';
+
 -- Индекс для быстрого поиска событий, ожидающих обработки
 CREATE INDEX IF NOT EXISTS idx_outbox_processing_state ON outbox (processing_state);
+CREATE INDEX IF NOT EXISTS idx_outbox_seq ON outbox (seq);
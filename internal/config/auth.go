@@ -0,0 +1,18 @@
+package config
+
+// AuthConfig содержит параметры доступа к central-api.
+type AuthConfig struct {
+	// RequireAPIKey - запросы без X-API-Key отклоняются. Если false, они относятся
+	// к проекту по умолчанию, как до появления проектов.
+	RequireAPIKey bool
+	// AdminKey - ключ управления проектами (заголовок X-Admin-Key). Пусто отключает /projects.
+	AdminKey string
+}
+
+// NewAuthConfig создает конфигурацию доступа из переменных окружения.
+func NewAuthConfig() *AuthConfig {
+	return &AuthConfig{
+		RequireAPIKey: getEnvBool("AB_REQUIRE_API_KEY", false),
+		AdminKey:      getEnv("AB_ADMIN_KEY", ""),
+	}
+}
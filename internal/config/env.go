@@ -0,0 +1,75 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// getEnv - вспомогательная функция для чтения переменной окружения с fallback-значением.
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+// getEnvInt читает целочисленную переменную окружения.
+// При некорректном значении используется fallback, а проблема логируется.
+func getEnvInt(key string, fallback int) int {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("WARN: Invalid integer in %s=%q, using default %d", key, value, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+// getEnvDuration читает переменную окружения в формате time.ParseDuration (например, "5m").
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("WARN: Invalid duration in %s=%q, using default %v", key, value, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+// getEnvList читает список значений, разделенных запятыми.
+func getEnvList(key string, fallback []string) []string {
+	value, ok := os.LookupEnv(key)
+	if !ok || strings.TrimSpace(value) == "" {
+		return fallback
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getEnvBool читает логическую переменную окружения в формате strconv.ParseBool.
+func getEnvBool(key string, fallback bool) bool {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("WARN: Invalid boolean in %s=%q, using default %t", key, value, fallback)
+		return fallback
+	}
+	return parsed
+}
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"log"
+	"slices"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+// defaultEnvironments - окружения развертывания по умолчанию.
+var defaultEnvironments = []string{ab_types.DefaultEnvironment, "staging", "development"}
+
+// NewEnvironments возвращает список окружений развертывания из AB_ENVIRONMENTS
+// (через запятую). Некорректные имена пропускаются, DefaultEnvironment добавляется всегда:
+// к нему относятся эксперименты, созданные до появления окружений.
+func NewEnvironments() []string {
+	var environments []string
+	for _, name := range getEnvList("AB_ENVIRONMENTS", defaultEnvironments) {
+		if err := ab_types.ValidateEnvironmentName(name); err != nil {
+			log.Printf("WARN: Ignoring environment from AB_ENVIRONMENTS: %v", err)
+			continue
+		}
+		if !slices.Contains(environments, name) {
+			environments = append(environments, name)
+		}
+	}
+	if !slices.Contains(environments, ab_types.DefaultEnvironment) {
+		environments = append(environments, ab_types.DefaultEnvironment)
+	}
+	return environments
+}
@@ -0,0 +1,15 @@
+package config
+
+// GeoIPConfig содержит параметры определения местоположения по IP-адресу в central-api.
+type GeoIPConfig struct {
+	// DatabasePath - файл базы в формате MaxMind DB (GeoLite2/GeoIP2 Country или City).
+	// Пусто отключает обогащение атрибутов /decide местоположением.
+	DatabasePath string
+}
+
+// NewGeoIPConfig создает конфигурацию GeoIP из переменных окружения.
+func NewGeoIPConfig() *GeoIPConfig {
+	return &GeoIPConfig{
+		DatabasePath: getEnv("AB_GEOIP_DATABASE", ""),
+	}
+}
@@ -0,0 +1,26 @@
+package config
+
+// IDListConfig содержит параметры хранения содержимого списков идентификаторов в central-api.
+type IDListConfig struct {
+	MinIOEndpoint  string
+	MinIOAccessKey string
+	MinIOSecretKey string
+	MinIOUseSSL    bool
+	// Bucket - бакет снэпшотов: списки лежат в нем, чтобы клиенты SDK читали их
+	// с теми же правами, что и снэпшоты.
+	Bucket string
+	// MaxUploadBytes - максимальный размер загружаемого содержимого списка.
+	MaxUploadBytes int64
+}
+
+// NewIDListConfig создает конфигурацию списков идентификаторов из переменных окружения.
+func NewIDListConfig() *IDListConfig {
+	return &IDListConfig{
+		MinIOEndpoint:  getEnv("MINIO_ENDPOINT", "minio:9000"),
+		MinIOAccessKey: getEnv("MINIO_ACCESS_KEY", "minioadmin"),
+		MinIOSecretKey: getEnv("MINIO_SECRET_KEY", "minioadmin"),
+		MinIOUseSSL:    getEnvBool("MINIO_USE_SSL", false),
+		Bucket:         getEnv("SNAPSHOT_BUCKET", "ab-snapshots"),
+		MaxUploadBytes: int64(getEnvInt("AB_ID_LIST_MAX_BYTES", 64<<20)),
+	}
+}
@@ -2,7 +2,6 @@ package config
 
 import (
 	"fmt"
-	"os"
 )
 
 // DBConfig содержит параметры подключения к базе данных PostgreSQL.
@@ -33,11 +32,3 @@ func (c *DBConfig) ConnectionString() string {
 	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s",
 		c.User, c.Password, c.Host, c.Port, c.DBName, c.SSLMode)
 }
-
-// getEnv - вспомогательная функция для чтения переменной окружения с fallback-значением.
-func getEnv(key, fallback string) string {
-	if value, ok := os.LookupEnv(key); ok {
-		return value
-	}
-	return fallback
-}
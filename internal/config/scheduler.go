@@ -0,0 +1,16 @@
+package config
+
+import "time"
+
+// RampSchedulerConfig содержит параметры планировщика раскатки в central-api.
+type RampSchedulerConfig struct {
+	// Interval - период проверки наступивших шагов раскатки. 0 отключает планировщик.
+	Interval time.Duration
+}
+
+// NewRampSchedulerConfig создает конфигурацию планировщика из переменных окружения.
+func NewRampSchedulerConfig() *RampSchedulerConfig {
+	return &RampSchedulerConfig{
+		Interval: getEnvDuration("RAMP_SCHEDULER_INTERVAL", 30*time.Second),
+	}
+}
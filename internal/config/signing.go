@@ -0,0 +1,16 @@
+package config
+
+// SigningConfig содержит ключ подписи манифестов снэпшотов, которые central-api отдает
+// через GET /snapshot.
+type SigningConfig struct {
+	// SigningKey - base64-представление приватного ключа Ed25519, как SnapshotConfig.SigningKey.
+	// Пусто - манифесты не подписываются.
+	SigningKey string
+}
+
+// NewSigningConfig создает конфигурацию подписи из переменных окружения.
+func NewSigningConfig() *SigningConfig {
+	return &SigningConfig{
+		SigningKey: getEnv("SNAPSHOT_SIGNING_KEY", ""),
+	}
+}
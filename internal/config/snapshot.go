@@ -0,0 +1,87 @@
+package config
+
+import "time"
+
+const (
+	// SnapshotModeOnce - однократная генерация снэпшота с последующим завершением процесса.
+	SnapshotModeOnce = "once"
+	// SnapshotModeDaemon - долгоживущий сервис, перегенерирующий снэпшоты по триггерам.
+	SnapshotModeDaemon = "daemon"
+)
+
+// SnapshotConfig содержит параметры работы snapshot-generator.
+type SnapshotConfig struct {
+	// Mode - режим работы: SnapshotModeOnce или SnapshotModeDaemon.
+	Mode string
+
+	// Interval - период плановой перегенерации снэпшота в режиме daemon.
+	Interval time.Duration
+	// DeltaThreshold - количество опубликованных дельт с момента последнего снэпшота,
+	// после которого снэпшот перегенерируется досрочно. 0 отключает триггер.
+	DeltaThreshold int
+	// GenerationTimeout - максимальная длительность одной генерации.
+	GenerationTimeout time.Duration
+	// ShutdownTimeout - время на завершение текущей генерации и остановку HTTP-сервера.
+	ShutdownTimeout time.Duration
+	// MetricsAddr - адрес HTTP-сервера с метриками Prometheus.
+	MetricsAddr string
+
+	KafkaBrokers  []string
+	MetaTopic     string
+	DeltasGroupID string
+
+	MinIOEndpoint  string
+	MinIOAccessKey string
+	MinIOSecretKey string
+	MinIOUseSSL    bool
+	SnapshotBucket string
+
+	// Encoding - сериализация снэпшота: "json" или "gob".
+	Encoding string
+	// Compression - сжатие снэпшота: "none", "gzip" или "zstd".
+	Compression string
+
+	// RetainCount - сколько последних снэпшотов хранить всегда. 0 отключает удаление.
+	RetainCount int
+	// RetainMaxAge - снэпшоты моложе этого возраста не удаляются, даже если их больше RetainCount.
+	RetainMaxAge time.Duration
+
+	// Environments - окружения, для каждого из которых генерируется отдельный снэпшот (AB_ENVIRONMENTS).
+	Environments []string
+
+	// SigningKey - base64-представление приватного ключа Ed25519 (seed или полный ключ)
+	// для подписи манифестов. Пустое значение отключает подпись.
+	SigningKey string
+}
+
+// NewSnapshotConfig создает конфигурацию snapshot-generator из переменных окружения.
+func NewSnapshotConfig() *SnapshotConfig {
+	return &SnapshotConfig{
+		Mode:              getEnv("SNAPSHOT_MODE", SnapshotModeOnce),
+		Interval:          getEnvDuration("SNAPSHOT_INTERVAL", 5*time.Minute),
+		DeltaThreshold:    getEnvInt("SNAPSHOT_DELTA_THRESHOLD", 100),
+		GenerationTimeout: getEnvDuration("SNAPSHOT_GENERATION_TIMEOUT", time.Minute),
+		ShutdownTimeout:   getEnvDuration("SNAPSHOT_SHUTDOWN_TIMEOUT", 30*time.Second),
+		MetricsAddr:       getEnv("SNAPSHOT_METRICS_ADDR", ":9102"),
+
+		KafkaBrokers:  getEnvList("KAFKA_BROKERS", []string{"kafka:9092"}),
+		MetaTopic:     getEnv("SNAPSHOT_META_TOPIC", "ab_snapshots_meta"),
+		DeltasGroupID: getEnv("SNAPSHOT_DELTAS_GROUP_ID", "snapshot-generator"),
+
+		MinIOEndpoint:  getEnv("MINIO_ENDPOINT", "minio:9000"),
+		MinIOAccessKey: getEnv("MINIO_ACCESS_KEY", "minioadmin"),
+		MinIOSecretKey: getEnv("MINIO_SECRET_KEY", "minioadmin"),
+		MinIOUseSSL:    getEnv("MINIO_USE_SSL", "false") == "true",
+		SnapshotBucket: getEnv("SNAPSHOT_BUCKET", "ab-snapshots"),
+
+		Encoding:    getEnv("SNAPSHOT_ENCODING", "json"),
+		Compression: getEnv("SNAPSHOT_COMPRESSION", "none"),
+
+		RetainCount:  getEnvInt("SNAPSHOT_RETAIN_COUNT", 10),
+		RetainMaxAge: getEnvDuration("SNAPSHOT_RETAIN_MAX_AGE", 24*time.Hour),
+
+		Environments: NewEnvironments(),
+
+		SigningKey: getEnv("SNAPSHOT_SIGNING_KEY", ""),
+	}
+}
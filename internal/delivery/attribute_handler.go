@@ -0,0 +1,92 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+// attributeNotFound - текст ошибки Repository для отсутствующего атрибута.
+func attributeNotFound(name string) string {
+	return "attribute " + name + " not found"
+}
+
+// ListAttributes возвращает схему атрибутов проекта.
+func (h *ExperimentHandler) ListAttributes(w http.ResponseWriter, r *http.Request) {
+	definitions, err := h.repo.FindAttributes(r.Context(), projectFromContext(r.Context()))
+	if err != nil {
+		log.Printf("ERROR: Failed to list attributes: %v", err)
+		http.Error(w, "Failed to retrieve attributes", http.StatusInternalServerError)
+		return
+	}
+	if definitions == nil {
+		definitions = []ab_types.AttributeDefinition{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(definitions)
+}
+
+// PutAttribute объявляет атрибут проекта или меняет его тип. Если правила существующих
+// экспериментов, флагов или сегментов не соответствуют новому типу, отвечает 409.
+func (h *ExperimentHandler) PutAttribute(w http.ResponseWriter, r *http.Request) {
+	var definition ab_types.AttributeDefinition
+	if err := json.NewDecoder(r.Body).Decode(&definition); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	definition.Name = chi.URLParam(r, "attributeName")
+	if err := definition.Validate(); err != nil {
+		http.Error(w, "Invalid attribute: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	project := projectFromContext(r.Context())
+	if definition.ProjectID != "" && definition.ProjectID != project {
+		http.Error(w, "project_id does not match the API key", http.StatusBadRequest)
+		return
+	}
+	definition.ProjectID = project
+	definition.UpdatedAt = time.Now().UTC()
+
+	if err := h.repo.UpsertAttribute(r.Context(), &definition); err != nil {
+		if strings.Contains(err.Error(), " conflicts with ") {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		log.Printf("ERROR: Failed to save attribute %s: %v", definition.Name, err)
+		http.Error(w, "Failed to save attribute", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(definition)
+}
+
+// DeleteAttribute удаляет объявление атрибута проекта.
+func (h *ExperimentHandler) DeleteAttribute(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "attributeName")
+	if err := h.repo.DeleteAttribute(r.Context(), projectFromContext(r.Context()), name); err != nil {
+		if err.Error() == attributeNotFound(name) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		log.Printf("ERROR: Failed to delete attribute %s: %v", name, err)
+		http.Error(w, "Failed to delete attribute", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// projectAttributeSchema возвращает схему атрибутов проекта.
+func (h *ExperimentHandler) projectAttributeSchema(ctx context.Context, project string) (ab_types.AttributeSchema, error) {
+	definitions, err := h.repo.FindAttributes(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	return ab_types.NewAttributeSchema(definitions), nil
+}
@@ -0,0 +1,106 @@
+package delivery
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+// AdminKeyHeader - заголовок с ключом управления проектами.
+// Заголовок с API-ключом проекта - ab_types.APIKeyHeader.
+const AdminKeyHeader = "X-Admin-Key"
+
+// ProjectKeyResolver находит проект по хешу API-ключа.
+type ProjectKeyResolver interface {
+	FindProjectByAPIKey(ctx context.Context, keyHash string) (string, error)
+}
+
+type projectContextKey struct{}
+
+// ProjectAuth определяет проект запроса по заголовку X-API-Key и сохраняет его в контексте.
+// Неизвестный ключ отклоняется с 401. Запрос без ключа относится к DefaultProject,
+// если requireKey равен false, и отклоняется иначе.
+func ProjectAuth(keys ProjectKeyResolver, requireKey bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(ab_types.APIKeyHeader)
+			if key == "" {
+				if requireKey {
+					http.Error(w, ab_types.APIKeyHeader+" header is required", http.StatusUnauthorized)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			project, err := keys.FindProjectByAPIKey(r.Context(), hashAPIKey(key))
+			if err != nil {
+				if err.Error() == "api key not found" {
+					http.Error(w, "Invalid API key", http.StatusUnauthorized)
+					return
+				}
+				log.Printf("ERROR: Failed to resolve API key: %v", err)
+				http.Error(w, "Failed to resolve API key", http.StatusInternalServerError)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), projectContextKey{}, project)))
+		})
+	}
+}
+
+// AdminAuth пропускает только запросы с ключом управления adminKey в заголовке X-Admin-Key.
+func AdminAuth(adminKey string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get(AdminKeyHeader)), []byte(adminKey)) != 1 {
+				http.Error(w, "Invalid admin key", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// projectFromContext возвращает проект запроса, определенный ProjectAuth.
+func projectFromContext(ctx context.Context) string {
+	if project, ok := ctx.Value(projectContextKey{}).(string); ok {
+		return project
+	}
+	return ab_types.DefaultProject
+}
+
+// hashAPIKey возвращает хеш ключа, под которым он хранится в базе.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// findExperiment находит эксперимент проекта запроса.
+// Эксперимент другого проекта не отличается от несуществующего.
+func (h *ExperimentHandler) findExperiment(ctx context.Context, id string) (*ab_types.Experiment, error) {
+	exp, err := h.repo.FindExperimentByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if exp.ProjectOrDefault() != projectFromContext(ctx) {
+		return nil, errors.New(experimentNotFound(id))
+	}
+	return exp, nil
+}
+
+// modifyExperiment применяет modify к эксперименту проекта запроса (см. Repository.ModifyExperiment).
+func (h *ExperimentHandler) modifyExperiment(ctx context.Context, id string, modify func(exp *ab_types.Experiment) (bool, error)) (*ab_types.Experiment, error) {
+	project := projectFromContext(ctx)
+	return h.repo.ModifyExperiment(ctx, id, func(exp *ab_types.Experiment) (bool, error) {
+		if exp.ProjectOrDefault() != project {
+			return false, errors.New(experimentNotFound(id))
+		}
+		return modify(exp)
+	})
+}
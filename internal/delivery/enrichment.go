@@ -0,0 +1,39 @@
+package delivery
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+// AttributeEnricher дополняет атрибуты пользователя по его IP-адресу, например, страной
+// и регионом (geoip.Enricher.Enrich). Атрибуты, переданные клиентом, не перезаписываются.
+type AttributeEnricher func(ip string, attributes map[string]any)
+
+// WithAttributeEnricher подключает обогащение атрибутов /decide по DecisionRequest.IP.
+func (h *ExperimentHandler) WithAttributeEnricher(enrich AttributeEnricher) *ExperimentHandler {
+	h.enrichAttributes = enrich
+	return h
+}
+
+// enrichRequest добавляет в атрибуты запроса IP-адрес и, если настроен AttributeEnricher,
+// атрибуты местоположения. Запрос без IP не изменяется.
+func (h *ExperimentHandler) enrichRequest(req *DecisionRequest) error {
+	if req.IP == "" {
+		return nil
+	}
+	if _, err := netip.ParseAddr(req.IP); err != nil {
+		return fmt.Errorf("invalid ip %q", req.IP)
+	}
+	if req.Attributes == nil {
+		req.Attributes = make(map[string]any)
+	}
+	if _, ok := req.Attributes[ab_types.IPAttribute]; !ok {
+		req.Attributes[ab_types.IPAttribute] = req.IP
+	}
+	if h.enrichAttributes != nil {
+		h.enrichAttributes(req.IP, req.Attributes)
+	}
+	return nil
+}
@@ -1,17 +1,18 @@
 package delivery
 
 import (
+	"context"
+	"crypto/ed25519"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"slices"
-	"strconv"
+	"strings"
 	"time"
 
 	"github.com/goriiin/go-ab-service/pkg/ab_types"
 
-	"github.com/cespare/xxhash/v2"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/hashicorp/go-version"
@@ -19,45 +20,167 @@ import (
 
 // DecisionRequest определяет тело запроса для эндпоинта /decide.
 type DecisionRequest struct {
-	UserID     string         `json:"user_id"`
-	Attributes map[string]any `json:"attributes"`
+	UserID string `json:"user_id"`
+	// Identifiers - дополнительные идентификаторы для экспериментов с bucket_by (device_id, org_id...).
+	Identifiers map[string]string `json:"identifiers,omitempty"`
+	Attributes  map[string]any    `json:"attributes"`
+	// Environment - окружение, эксперименты которого вычисляются (по умолчанию production).
+	Environment string `json:"environment,omitempty"`
+	// IP - IP-адрес пользователя. Попадает в атрибут ab_types.IPAttribute (для правил IP_IN_CIDR)
+	// и, если настроен AttributeEnricher, дополняет атрибуты местоположением.
+	IP string `json:"ip,omitempty"`
+	// CoercionMode - сравнение атрибутов со значениями правил разных типов, как Config.CoercionMode
+	// в SDK: "lenient" (по умолчанию) или "strict".
+	CoercionMode string `json:"coercion_mode,omitempty"`
+
+	// coercion - разобранный CoercionMode.
+	coercion ab_types.CoercionMode
 }
 
 type Repository interface {
 	CreateExperiment(exp *ab_types.Experiment) error
 	FindExperimentByID(id string) (*ab_types.Experiment, error)
-	FindAllActiveExperiments() ([]ab_types.Experiment, error)
+	FindAllActiveExperiments(project, environment string) ([]ab_types.Experiment, error)
 	UpdateExperiment(exp *ab_types.Experiment) error
-	DeleteExperiment(id string) error
+	// ModifyExperiment применяет modify к заблокированному эксперименту и сохраняет результат,
+	// если modify вернул true.
+	ModifyExperiment(ctx context.Context, id string, modify func(exp *ab_types.Experiment) (bool, error)) (*ab_types.Experiment, error)
+	DeleteExperiment(project, id string) error
+	ExportSnapshot(ctx context.Context, project, environment string) (*ab_types.Snapshot, error)
+	CurrentSeq(ctx context.Context, project string) (int64, error)
+	// PromoteExperiment переносит конфигурацию эксперимента в другое окружение и записывает перенос в историю.
+	PromoteExperiment(ctx context.Context, sourceID, targetEnv string, build func(source, target *ab_types.Experiment) (*ab_types.Experiment, error)) (*ab_types.Experiment, error)
+	FindExperimentHistory(ctx context.Context, experimentID string) ([]ab_types.HistoryEntry, error)
+
+	CreateFlag(ctx context.Context, flag *ab_types.Flag) error
+	FindFlagByKey(ctx context.Context, project, key string) (*ab_types.Flag, error)
+	FindAllFlags(ctx context.Context, project string) ([]ab_types.Flag, error)
+	ModifyFlag(ctx context.Context, project, key string, modify func(flag *ab_types.Flag) (bool, error)) (*ab_types.Flag, error)
+	DeleteFlag(ctx context.Context, project, key string) error
+
+	CreateSegment(ctx context.Context, segment *ab_types.Segment) error
+	FindSegmentByKey(ctx context.Context, project, key string) (*ab_types.Segment, error)
+	FindAllSegments(ctx context.Context, project string) ([]ab_types.Segment, error)
+	// ModifySegment применяет modify к заблокированному сегменту и сохраняет результат
+	// как следующую версию, если modify вернул true.
+	ModifySegment(ctx context.Context, project, key string, modify func(segment *ab_types.Segment) (bool, error)) (*ab_types.Segment, error)
+	DeleteSegment(ctx context.Context, project, key string) error
+	FindSegmentVersions(ctx context.Context, project, key string) ([]ab_types.SegmentVersion, error)
+
+	CreateIDList(ctx context.Context, list *ab_types.IDList) error
+	FindIDList(ctx context.Context, project, id string) (*ab_types.IDList, error)
+	FindAllIDLists(ctx context.Context, project string) ([]ab_types.IDList, error)
+	ModifyIDList(ctx context.Context, project, id string, modify func(list *ab_types.IDList) (bool, error)) (*ab_types.IDList, error)
+	DeleteIDList(ctx context.Context, project, id string) error
+
+	UpsertAttribute(ctx context.Context, definition *ab_types.AttributeDefinition) error
+	FindAttributes(ctx context.Context, project string) ([]ab_types.AttributeDefinition, error)
+	DeleteAttribute(ctx context.Context, project, name string) error
+
+	CreateProject(ctx context.Context, project *ab_types.Project) error
+	FindAllProjects(ctx context.Context) ([]ab_types.Project, error)
+	CreateAPIKey(ctx context.Context, key *ab_types.APIKey, keyHash string) error
+	FindAPIKeys(ctx context.Context, projectID string) ([]ab_types.APIKey, error)
+	DeleteAPIKey(ctx context.Context, projectID, id string) error
+}
+
+// IDListStorage хранит содержимое списков идентификаторов.
+type IDListStorage interface {
+	Put(ctx context.Context, name, contentType string, data []byte) error
+	Get(ctx context.Context, name string) ([]byte, error)
+	DeletePrefix(ctx context.Context, prefix string) error
+}
+
+// AssignmentStore хранит закрепленные назначения экспериментов с Sticky.
+type AssignmentStore interface {
+	Get(ctx context.Context, experimentID, userID string) (variantName string, ok bool, err error)
+	Save(ctx context.Context, experimentID, userID, variantName string) error
 }
 
 type ExperimentHandler struct {
 	repo Repository
+	// store - хранилище sticky-назначений; nil отключает закрепление.
+	store AssignmentStore
+	// environments - окружения развертывания, в которых можно создавать эксперименты.
+	environments []string
+	// idListStorage - хранилище содержимого списков идентификаторов; nil отключает загрузку списков.
+	idListStorage  IDListStorage
+	maxIDListBytes int64
+	idListContent  *idListCache
+	ruleValues     *ruleValueCache
+	// enrichAttributes дополняет атрибуты /decide по IP-адресу; nil отключает обогащение.
+	enrichAttributes AttributeEnricher
+	// snapshotSigningKey подписывает манифесты GET /snapshot; nil - манифест без подписи.
+	snapshotSigningKey ed25519.PrivateKey
 }
 
-func NewExperimentHandler(r Repository) *ExperimentHandler {
-	return &ExperimentHandler{repo: r}
+func NewExperimentHandler(r Repository, store AssignmentStore, environments []string) *ExperimentHandler {
+	return &ExperimentHandler{repo: r, store: store, environments: environments, idListContent: newIDListCache(), ruleValues: newRuleValueCache()}
+}
+
+// WithIDListStorage подключает хранилище содержимого списков идентификаторов.
+// maxUploadBytes ограничивает размер загружаемого содержимого (0 - ограничение по умолчанию).
+func (h *ExperimentHandler) WithIDListStorage(storage IDListStorage, maxUploadBytes int64) *ExperimentHandler {
+	h.idListStorage = storage
+	h.maxIDListBytes = maxUploadBytes
+	return h
+}
+
+// resolveEnvironment возвращает окружение запроса (DefaultEnvironment, если оно не указано)
+// и проверяет, что оно входит в список окружений развертывания.
+func (h *ExperimentHandler) resolveEnvironment(environment string) (string, error) {
+	if environment == "" {
+		return ab_types.DefaultEnvironment, nil
+	}
+	if !slices.Contains(h.environments, environment) {
+		return "", fmt.Errorf("unknown environment %q (configured: %v)", environment, h.environments)
+	}
+	return environment, nil
 }
 
 // Decide обрабатывает запрос на получение назначений для пользователя.
+// Вычисляются только эксперименты проекта API-ключа.
 func (h *ExperimentHandler) Decide(w http.ResponseWriter, r *http.Request) {
 	var req DecisionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-	if req.UserID == "" {
-		http.Error(w, "user_id is required", http.StatusBadRequest)
+	if req.UserID == "" && len(req.Identifiers) == 0 {
+		http.Error(w, "user_id or identifiers is required", http.StatusBadRequest)
+		return
+	}
+	coercion, err := ab_types.ParseCoercionMode(req.CoercionMode)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.coercion = coercion
+	if err := h.enrichRequest(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	activeExperiments, err := h.repo.FindAllActiveExperiments()
+	environment, err := h.resolveEnvironment(req.Environment)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	project := projectFromContext(r.Context())
+	activeExperiments, err := h.repo.FindAllActiveExperiments(project, environment)
 	if err != nil {
 		http.Error(w, "Failed to fetch experiments", http.StatusInternalServerError)
 		return
 	}
+	refs, err := h.loadRuleRefs(r.Context(), project, activeExperiments)
+	if err != nil {
+		log.Printf("ERROR: Failed to load segments and id lists of project %s: %v", project, err)
+		http.Error(w, "Failed to fetch segments and id lists", http.StatusInternalServerError)
+		return
+	}
 
-	assignments := evaluateUserAssignments(&req, activeExperiments)
+	assignments := evaluateUserAssignments(r.Context(), &req, activeExperiments, refs, h.store)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -65,7 +188,9 @@ func (h *ExperimentHandler) Decide(w http.ResponseWriter, r *http.Request) {
 }
 
 // evaluateUserAssignments инкапсулирует логику назначения пользователя в эксперименты.
-func evaluateUserAssignments(req *DecisionRequest, experiments []ab_types.Experiment) map[string]string {
+// refs - сегменты и списки идентификаторов, на которые ссылаются правила и оверрайды.
+// Назначения sticky-экспериментов по бакетам сохраняются в store (если он задан).
+func evaluateUserAssignments(ctx context.Context, req *DecisionRequest, experiments []ab_types.Experiment, refs *ruleRefs, store AssignmentStore) map[string]string {
 	assignments := make(map[string]string)
 	layers := make(map[string][]ab_types.Experiment)
 
@@ -77,9 +202,15 @@ func evaluateUserAssignments(req *DecisionRequest, experiments []ab_types.Experi
 	// Итерация по каждому слою для обеспечения взаимного исключения
 	for _, expsInLayer := range layers {
 		for _, exp := range expsInLayer {
-			isAssigned, variantName := evaluateSingleExperiment(req, &exp)
-			if isAssigned {
+			variantName, bucketed := evaluateSingleExperiment(ctx, req, &exp, refs, store)
+			if variantName != "" {
 				assignments[exp.ID] = variantName
+				unitID, _ := ab_types.BucketKey(exp.BucketBy, req.UserID, req.Identifiers, req.Attributes)
+				if bucketed && exp.Sticky && store != nil {
+					if err := store.Save(ctx, exp.ID, unitID, variantName); err != nil {
+						log.Printf("WARN: Failed to save sticky assignment for experiment %s: %v", exp.ID, err)
+					}
+				}
 				break // Пользователь назначен в один эксперимент в слое, переходим к следующему слою.
 			}
 		}
@@ -95,105 +226,242 @@ func evaluateUserAssignments(req *DecisionRequest, experiments []ab_types.Experi
 // 1. Фильтрация по статусу и времени.
 // 2. Принудительное исключение (ForceExclude).
 // 3. Принудительное включение в конкретный вариант (ForceInclude).
-// 4. Проверка правил таргетинга (TargetingRules).
-// 5. Процентное распределение (бакетирование).
-func evaluateSingleExperiment(req *DecisionRequest, exp *ab_types.Experiment) (bool, string) {
+// 4. Закрепленное назначение (Sticky).
+// 5. Проверка правил таргетинга (TargetingRules).
+// 6. Процентное распределение (бакетирование).
+// Возвращает вариант ("" - не назначен) и признак того, что вариант получен бакетированием.
+func evaluateSingleExperiment(ctx context.Context, req *DecisionRequest, exp *ab_types.Experiment, refs *ruleRefs, store AssignmentStore) (string, bool) {
 	if exp.Status != ab_types.StatusActive || (exp.EndTime != nil && exp.EndTime.Before(time.Now())) {
-		return false, ""
+		return "", false
 	}
 
-	if slices.Contains(exp.OverrideLists.ForceExclude, req.UserID) {
-		return false, ""
+	// Единица рандомизации (bucket_by): без ее идентификатора пользователь в эксперимент не попадает.
+	unitID, ok := ab_types.BucketKey(exp.BucketBy, req.UserID, req.Identifiers, req.Attributes)
+	if !ok {
+		return "", false
 	}
 
-	if exp.OverrideLists.ForceInclude != nil {
-		for variantName, userList := range exp.OverrideLists.ForceInclude {
-			if slices.Contains(userList, req.UserID) {
-				return true, variantName
-			}
+	overrides := refs.overrideSet(exp)
+	if overrides.Excluded(unitID) || refs.inAnyIDList(exp.OverrideLists.ForceExcludeLists, unitID) {
+		return "", false
+	}
+
+	if variantName, ok := overrides.IncludedVariant(unitID); ok {
+		return variantName, false
+	}
+	for variantName, listIDs := range exp.OverrideLists.ForceIncludeLists {
+		if refs.inAnyIDList(listIDs, unitID) {
+			return variantName, false
 		}
 	}
 
-	if !checkTargetingRules(req, exp.TargetingRules) {
-		return false, ""
+	if exp.Sticky && store != nil {
+		variantName, ok, err := store.Get(ctx, exp.ID, unitID)
+		if err != nil {
+			log.Printf("WARN: Failed to read sticky assignment for experiment %s: %v", exp.ID, err)
+		} else if ok && exp.HasVariant(variantName) {
+			return variantName, false
+		}
 	}
 
-	hashKey := []byte(req.UserID + exp.Salt)
-	bucket := xxhash.Sum64(hashKey) % 1000
+	if !checkTargetingRules(req, exp.TargetingRules, refs) {
+		return "", false
+	}
 
-	for _, variant := range exp.Variants {
-		if bucket >= uint64(variant.BucketRange[0]) && bucket <= uint64(variant.BucketRange[1]) {
-			return true, variant.Name
-		}
+	if variant := exp.VariantForBucket(exp.Bucket(unitID)); variant != nil {
+		return variant.Name, true
 	}
 
-	return false, ""
+	return "", false
 }
 
 // checkTargetingRules проверяет, удовлетворяет ли пользователь ВСЕМ правилам таргетинга.
-func checkTargetingRules(req *DecisionRequest, rules []ab_types.TargetingRule) bool {
-	for _, rule := range rules {
-		if !evaluateRule(req, &rule) {
-			return false
+// Правила с несравнимыми типами (RuleUnknown) не пропускают пользователя.
+func checkTargetingRules(req *DecisionRequest, rules []ab_types.TargetingRule, refs *ruleRefs) bool {
+	return evaluateRules(req, rules, refs).Passed()
+}
+
+// evaluateRules вычисляет конъюнкцию правил в трехзначной логике: RuleFalse, если
+// хотя бы одно правило ложно, иначе RuleUnknown, если хотя бы одно несравнимо.
+func evaluateRules(req *DecisionRequest, rules []ab_types.TargetingRule, refs *ruleRefs) ab_types.RuleResult {
+	result := ab_types.RuleTrue
+	for i := range rules {
+		switch evaluateRule(req, &rules[i], refs) {
+		case ab_types.RuleFalse:
+			return ab_types.RuleFalse
+		case ab_types.RuleUnknown:
+			result = ab_types.RuleUnknown
 		}
 	}
-	return true
+	return result
 }
 
-// evaluateRule - ядро логики, проверяющее одно конкретное правило.
-func evaluateRule(req *DecisionRequest, rule *ab_types.TargetingRule) bool {
+// evaluateRule - ядро логики, проверяющее одно конкретное правило. Типы сравниваются
+// в режиме req.coercion, как в SDK. Отсутствующий атрибут и неизвестный оператор дают
+// RuleFalse, несравнимые типы - RuleUnknown.
+func evaluateRule(req *DecisionRequest, rule *ab_types.TargetingRule, refs *ruleRefs) ab_types.RuleResult {
+	if rule.IsGroup() {
+		return evaluateRuleGroup(req, rule, refs)
+	}
+	if key, ok := rule.SegmentKey(); ok {
+		return evaluateSegmentRule(req, rule.Operator, refs, key)
+	}
+	if listID, ok := rule.IDListKey(); ok {
+		return ab_types.RuleResultOf(evaluateIDListRule(req, rule, refs, listID))
+	}
 	userValue, ok := req.Attributes[rule.Attribute]
 	if !ok {
-		return false
+		return ab_types.RuleFalse
 	}
+	mode := req.coercion
 	switch rule.Operator {
 	case ab_types.OpEquals:
-		return fmt.Sprintf("%v", userValue) == fmt.Sprintf("%v", rule.Value)
+		equal, ok := mode.Equal(userValue, rule.Value)
+		if !ok {
+			return ab_types.RuleUnknown
+		}
+		return ab_types.RuleResultOf(equal)
 	case ab_types.OpGreaterThan:
-		userNum, ok1 := toFloat64(userValue)
-		ruleNum, ok2 := toFloat64(rule.Value)
-		return ok1 && ok2 && userNum > ruleNum
+		userNum, ok1 := mode.Number(userValue)
+		ruleNum, ok2 := ab_types.ToFloat64(rule.Value)
+		if !ok1 || !ok2 {
+			return ab_types.RuleUnknown
+		}
+		return ab_types.RuleResultOf(userNum > ruleNum)
 	case ab_types.OpInList:
-		userStr := fmt.Sprintf("%v", userValue)
-		ruleList, ok2 := rule.Value.([]interface{})
-		if !ok2 {
-			return false
+		ruleList, ok := rule.Value.([]any)
+		if !ok {
+			return ab_types.RuleUnknown
 		}
+		comparable := len(ruleList) == 0
 		for _, item := range ruleList {
-			if strItem, ok := item.(string); ok && strItem == userStr {
-				return true
+			equal, ok := mode.Equal(userValue, item)
+			if equal {
+				return ab_types.RuleTrue
 			}
+			comparable = comparable || ok
 		}
-		return false
+		if !comparable {
+			return ab_types.RuleUnknown
+		}
+		return ab_types.RuleFalse
 	case ab_types.OpVersionGreaterThan:
-		userVerStr, ok1 := userValue.(string)
+		userVerStr, ok1 := mode.String(userValue)
 		ruleVerStr, ok2 := rule.Value.(string)
 		if !ok1 || !ok2 {
-			return false
+			return ab_types.RuleUnknown
 		}
 		userV, err1 := version.NewVersion(userVerStr)
 		ruleV, err2 := version.NewVersion(ruleVerStr)
-		return err1 == nil && err2 == nil && userV.GreaterThan(ruleV)
+		if err1 != nil || err2 != nil {
+			return ab_types.RuleUnknown
+		}
+		return ab_types.RuleResultOf(userV.GreaterThan(ruleV))
+	case ab_types.OpMatchesRegex:
+		userStr, ok1 := mode.String(userValue)
+		pattern, ok2 := rule.RegexPattern()
+		if !ok1 || !ok2 {
+			return ab_types.RuleUnknown
+		}
+		re := refs.regexp(pattern)
+		return ab_types.RuleResultOf(re != nil && re.MatchString(userStr))
+	case ab_types.OpStartsWith, ab_types.OpEndsWith:
+		userStr, ok1 := mode.String(userValue)
+		ruleStr, ok2 := rule.Value.(string)
+		if !ok1 || !ok2 {
+			return ab_types.RuleUnknown
+		}
+		if rule.Operator == ab_types.OpStartsWith {
+			return ab_types.RuleResultOf(strings.HasPrefix(userStr, ruleStr))
+		}
+		return ab_types.RuleResultOf(strings.HasSuffix(userStr, ruleStr))
+	case ab_types.OpDateBefore, ab_types.OpDateAfter:
+		userTime, ok1 := ab_types.ParseRuleTime(userValue)
+		ruleTime, ok2 := ab_types.ParseRuleTime(rule.Value)
+		if !ok1 || !ok2 {
+			return ab_types.RuleUnknown
+		}
+		if rule.Operator == ab_types.OpDateBefore {
+			return ab_types.RuleResultOf(userTime.Before(ruleTime))
+		}
+		return ab_types.RuleResultOf(userTime.After(ruleTime))
+	case ab_types.OpIPInCIDR:
+		userIP, ok1 := userValue.(string)
+		prefixes, ok2 := refs.cidrPrefixes(rule)
+		if !ok1 || !ok2 {
+			return ab_types.RuleUnknown
+		}
+		return ab_types.RuleResultOf(ab_types.IPInCIDRs(userIP, prefixes))
+	case ab_types.OpWithinLastDays:
+		userTime, ok1 := ab_types.ParseRuleTime(userValue)
+		window, ok2 := ab_types.WithinLastDaysWindow(rule.Value)
+		if !ok1 || !ok2 {
+			return ab_types.RuleUnknown
+		}
+		age := time.Since(userTime)
+		return ab_types.RuleResultOf(age >= 0 && age <= window)
 	default:
 		log.Printf("WARN: Unknown operator used: %s", rule.Operator)
-		return false
+		return ab_types.RuleFalse
 	}
 }
 
-func toFloat64(v any) (float64, bool) {
-	switch i := v.(type) {
-	case float64:
-		return i, true
-	case int:
-		return float64(i), true
-	case string:
-		f, err := strconv.ParseFloat(i, 64)
-		return f, err == nil
+// evaluateRuleGroup вычисляет группу правил All, Any или Not.
+// Any истинна, если истинно хотя бы одно правило, иначе RuleUnknown, если хотя бы одно несравнимо.
+func evaluateRuleGroup(req *DecisionRequest, rule *ab_types.TargetingRule, refs *ruleRefs) ab_types.RuleResult {
+	switch {
+	case rule.Not != nil:
+		return evaluateRule(req, rule.Not, refs).Not()
+	case rule.Any != nil:
+		result := ab_types.RuleFalse
+		for i := range rule.Any {
+			switch evaluateRule(req, &rule.Any[i], refs) {
+			case ab_types.RuleTrue:
+				return ab_types.RuleTrue
+			case ab_types.RuleUnknown:
+				result = ab_types.RuleUnknown
+			}
+		}
+		return result
 	default:
-		return 0, false
+		return evaluateRules(req, rule.All, refs)
 	}
 }
 
+// evaluateSegmentRule проверяет вхождение пользователя в сегмент. Правила сегмента
+// не ссылаются на другие сегменты. Неизвестный сегмент не пропускает пользователя
+// ни для IN_SEGMENT, ни для NOT_IN_SEGMENT.
+func evaluateSegmentRule(req *DecisionRequest, operator ab_types.Operator, refs *ruleRefs, key string) ab_types.RuleResult {
+	segment := refs.segment(key)
+	if segment == nil {
+		return ab_types.RuleFalse
+	}
+	in := evaluateRules(req, segment.Rules, refs)
+	if operator == ab_types.OpNotInSegment {
+		return in.Not()
+	}
+	return in
+}
+
+// evaluateIDListRule проверяет вхождение идентификатора пользователя (rule.Attribute,
+// как BucketBy) в список. Пользователь без идентификатора и неизвестный или
+// не загруженный список не проходят ни IN_ID_LIST, ни NOT_IN_ID_LIST.
+func evaluateIDListRule(req *DecisionRequest, rule *ab_types.TargetingRule, refs *ruleRefs, listID string) bool {
+	members, ok := refs.idList(listID)
+	if !ok {
+		return false
+	}
+	unitID, ok := ab_types.BucketKey(rule.Attribute, req.UserID, req.Identifiers, req.Attributes)
+	if !ok {
+		return false
+	}
+	_, in := members[unitID]
+	if rule.Operator == ab_types.OpNotInIDList {
+		return !in
+	}
+	return in
+}
+
 // CreateExperiment обрабатывает запрос на создание эксперимента.
 func (h *ExperimentHandler) CreateExperiment(w http.ResponseWriter, r *http.Request) {
 	var exp ab_types.Experiment
@@ -202,9 +470,43 @@ func (h *ExperimentHandler) CreateExperiment(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	if err := exp.ApplyPercentAllocation(); err != nil {
+		http.Error(w, "Invalid variant allocation: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := exp.ValidateBuckets(); err != nil {
+		http.Error(w, "Invalid variant allocation: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := exp.ValidateParameters(); err != nil {
+		http.Error(w, "Invalid variant parameters: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	environment, err := h.resolveEnvironment(exp.Environment)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	exp.Environment = environment
+	project := projectFromContext(r.Context())
+	if exp.ProjectID != "" && exp.ProjectID != project {
+		http.Error(w, "project_id does not match the API key", http.StatusBadRequest)
+		return
+	}
+	exp.ProjectID = project
+	if err := h.validateExperimentReferences(r.Context(), &exp); err != nil {
+		writeModifyError(w, err, "", "create experiment")
+		return
+	}
+	// План раскатки задается только через /ramp.
+	exp.Ramp = nil
+
 	if exp.Salt == "" {
 		exp.Salt = uuid.NewString()
 	}
+	if exp.BucketingVersion == 0 {
+		exp.BucketingVersion = ab_types.LatestBucketingVersion
+	}
 
 	exp.ID = uuid.NewString()
 
@@ -233,9 +535,9 @@ func (h *ExperimentHandler) CreateExperiment(w http.ResponseWriter, r *http.Requ
 // GetExperiment обрабатывает запрос на получение эксперимента.
 func (h *ExperimentHandler) GetExperiment(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "experimentID")
-	exp, err := h.repo.FindExperimentByID(id)
+	exp, err := h.findExperiment(r.Context(), id)
 	if err != nil {
-		if err.Error() == "experiment with id "+id+" not found" {
+		if err.Error() == experimentNotFound(id) {
 			http.Error(w, err.Error(), http.StatusNotFound)
 		} else {
 			http.Error(w, "Failed to retrieve experiment", http.StatusInternalServerError)
@@ -248,35 +550,90 @@ func (h *ExperimentHandler) GetExperiment(w http.ResponseWriter, r *http.Request
 }
 
 // UpdateExperiment обрабатывает обновление эксперимента.
+// Изменение выполняется под блокировкой строки, чтобы не затереть шаг раскатки,
+// примененный планировщиком параллельно.
 func (h *ExperimentHandler) UpdateExperiment(w http.ResponseWriter, r *http.Request) {
 	experimentID := chi.URLParam(r, "experimentID")
-	existingExp, err := h.repo.FindExperimentByID(experimentID)
-	if err != nil {
-		http.Error(w, "Failed to retrieve experiment for update", http.StatusInternalServerError)
-		return
-	}
 	var updatedExp ab_types.Experiment
 	if err := json.NewDecoder(r.Body).Decode(&updatedExp); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-	updatedExp.ID = existingExp.ID
-	updatedExp.Salt = existingExp.Salt
 
-	v7, err := uuid.NewV7()
+	exp, err := h.modifyExperiment(r.Context(), experimentID, func(existingExp *ab_types.Experiment) (bool, error) {
+		if updatedExp.Environment != "" && updatedExp.Environment != existingExp.EnvironmentOrDefault() {
+			return false, badRequest("environment cannot be changed; use POST /experiments/%s/promote", experimentID)
+		}
+		if err := mergeExperimentUpdate(existingExp, &updatedExp); err != nil {
+			return false, err
+		}
+		if err := h.validateExperimentReferences(r.Context(), &updatedExp); err != nil {
+			return false, err
+		}
+		*existingExp = updatedExp
+		return true, nil
+	})
 	if err != nil {
-		http.Error(w, "Failed to generate config version", http.StatusInternalServerError)
-		return
-	}
-	updatedExp.ConfigVersion = v7.String()
-
-	if err := h.repo.UpdateExperiment(&updatedExp); err != nil {
-		http.Error(w, "Failed to update experiment in database", http.StatusInternalServerError)
+		writeModifyError(w, err, experimentNotFound(experimentID), "update experiment")
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(updatedExp)
+	json.NewEncoder(w).Encode(exp)
+}
+
+// newConfigVersion возвращает версию конфигурации для очередного изменения (UUIDv7).
+func newConfigVersion() (string, error) {
+	v7, err := uuid.NewV7()
+	if err != nil {
+		return "", err
+	}
+	return v7.String(), nil
+}
+
+// mergeExperimentUpdate готовит updated к замене existing: переносит неизменяемые поля
+// (ID, соль, проект, окружение, схему бакетирования, план раскатки) и проверяет конфигурацию.
+// Ошибки конфигурации возвращаются как requestError.
+func mergeExperimentUpdate(existing, updated *ab_types.Experiment) error {
+	// Смена разрешения перераспределяет пользователей, поэтому без явного значения оно сохраняется.
+	if updated.BucketResolution == 0 {
+		updated.BucketResolution = existing.BucketResolution
+	}
+	// Схема бакетирования фиксируется при создании по той же причине.
+	updated.BucketingVersion = existing.BucketingVersion
+	if err := updated.ApplyPercentAllocation(); err != nil {
+		return badRequest("Invalid variant allocation: %v", err)
+	}
+	// План раскатки меняется только через /ramp, а диапазоном раскатываемого варианта
+	// управляет план, поэтому оба значения переносятся из сохраненного эксперимента.
+	updated.Ramp = existing.Ramp
+	if plan := existing.Ramp; plan != nil && isRampInProgress(plan) {
+		if updated.BucketResolution != existing.BucketResolution {
+			return conflict("bucket_resolution cannot change while variant %q is being ramped", plan.Variant)
+		}
+		target := updated.FindVariant(plan.Variant)
+		if target == nil {
+			return conflict("variant %q cannot be removed while it is being ramped", plan.Variant)
+		}
+		target.BucketRange = existing.FindVariant(plan.Variant).BucketRange
+	}
+	if err := updated.ValidateBuckets(); err != nil {
+		return badRequest("Invalid variant allocation: %v", err)
+	}
+	if err := updated.ValidateParameters(); err != nil {
+		return badRequest("Invalid variant parameters: %v", err)
+	}
+	updated.ID = existing.ID
+	updated.Salt = existing.Salt
+	updated.ProjectID = existing.ProjectOrDefault()
+	updated.Environment = existing.EnvironmentOrDefault()
+
+	configVersion, err := newConfigVersion()
+	if err != nil {
+		return fmt.Errorf("failed to generate config version: %w", err)
+	}
+	updated.ConfigVersion = configVersion
+	return nil
 }
 
 // DeleteExperiment обрабатывает физическое удаление эксперимента.
@@ -287,7 +644,7 @@ func (h *ExperimentHandler) DeleteExperiment(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	if err := h.repo.DeleteExperiment(experimentID); err != nil {
+	if err := h.repo.DeleteExperiment(projectFromContext(r.Context()), experimentID); err != nil {
 		if err.Error() == "experiment not found" {
 			http.Error(w, "Experiment not found", http.StatusNotFound)
 			return
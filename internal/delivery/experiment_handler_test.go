@@ -0,0 +1,99 @@
+package delivery
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+func TestCheckTargetingRulesCoercion(t *testing.T) {
+	equalsAge := ab_types.TargetingRule{Attribute: "age", Operator: ab_types.OpEquals, Value: float64(30)}
+	isPro := ab_types.TargetingRule{Attribute: "plan", Operator: ab_types.OpEquals, Value: "pro"}
+	refs := &ruleRefs{segments: map[string]*ab_types.Segment{
+		"thirty": {Key: "thirty", Rules: []ab_types.TargetingRule{equalsAge}},
+	}}
+
+	tests := []struct {
+		name     string
+		coercion ab_types.CoercionMode
+		rule     ab_types.TargetingRule
+		want     bool
+	}{
+		{"lenient compares numeric string", ab_types.CoercionLenient, equalsAge, true},
+		{"strict rejects numeric string", ab_types.CoercionStrict, equalsAge, false},
+		{"lenient not of match", ab_types.CoercionLenient, ab_types.TargetingRule{Not: &equalsAge}, false},
+		{"strict not of mismatch", ab_types.CoercionStrict, ab_types.TargetingRule{Not: &equalsAge}, false},
+		{"strict not of not of mismatch", ab_types.CoercionStrict, ab_types.TargetingRule{Not: &ab_types.TargetingRule{Not: &equalsAge}}, false},
+		{"strict any with true rule", ab_types.CoercionStrict, ab_types.TargetingRule{Any: []ab_types.TargetingRule{equalsAge, isPro}}, true},
+		{"strict any without true rule", ab_types.CoercionStrict, ab_types.TargetingRule{Not: &ab_types.TargetingRule{Any: []ab_types.TargetingRule{equalsAge}}}, false},
+		{"strict all with false rule", ab_types.CoercionStrict, ab_types.TargetingRule{Not: &ab_types.TargetingRule{All: []ab_types.TargetingRule{equalsAge, {Attribute: "plan", Operator: ab_types.OpEquals, Value: "free"}}}}, true},
+		{"strict not in segment with mismatch", ab_types.CoercionStrict, ab_types.TargetingRule{Operator: ab_types.OpNotInSegment, Value: "thirty"}, false},
+		{"lenient not in segment", ab_types.CoercionLenient, ab_types.TargetingRule{Operator: ab_types.OpNotInSegment, Value: "thirty"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &DecisionRequest{
+				UserID:     "user-1",
+				Attributes: map[string]any{"age": "30", "plan": "pro"},
+				coercion:   tt.coercion,
+			}
+			if got := checkTargetingRules(req, []ab_types.TargetingRule{tt.rule}, refs); got != tt.want {
+				t.Errorf("checkTargetingRules() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecideRejectsUnknownCoercionMode(t *testing.T) {
+	handler := NewExperimentHandler(nil, nil, []string{ab_types.DefaultEnvironment})
+	req := httptest.NewRequest(http.MethodPost, "/decide", strings.NewReader(`{"user_id":"user-1","coercion_mode":"loose"}`))
+	rec := httptest.NewRecorder()
+	handler.Decide(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if !strings.Contains(rec.Body.String(), `unknown coercion mode "loose"`) {
+		t.Errorf("body = %q, want unknown coercion mode error", rec.Body.String())
+	}
+}
+
+func TestEvaluateSingleExperimentOverrides(t *testing.T) {
+	exp := ab_types.Experiment{
+		ID:       "exp",
+		Status:   ab_types.StatusActive,
+		Variants: []ab_types.Variant{{Name: "control", BucketRange: [2]int{0, 999}}},
+		OverrideLists: ab_types.OverrideLists{
+			ForceInclude: map[string][]string{"treatment": {"user-in"}},
+			ForceExclude: []string{"user-out"},
+		},
+	}
+	withSets := &ruleRefs{overrides: map[string]ab_types.OverrideSet{exp.ID: ab_types.NewOverrideSet(&exp.OverrideLists)}}
+
+	tests := []struct {
+		name         string
+		refs         *ruleRefs
+		userID       string
+		wantVariant  string
+		wantBucketed bool
+	}{
+		{"include", withSets, "user-in", "treatment", false},
+		{"exclude", withSets, "user-out", "", false},
+		{"no override", withSets, "user-1", "control", true},
+		{"include without loaded refs", nil, "user-in", "treatment", false},
+		{"exclude without loaded refs", nil, "user-out", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &DecisionRequest{UserID: tt.userID}
+			variantName, bucketed := evaluateSingleExperiment(context.Background(), req, &exp, tt.refs, nil)
+			if variantName != tt.wantVariant || bucketed != tt.wantBucketed {
+				t.Errorf("evaluateSingleExperiment() = %q, %v, want %q, %v", variantName, bucketed, tt.wantVariant, tt.wantBucketed)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package delivery
+
+import (
+	"encoding/json"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+// flagNotFound - текст ошибки Repository для отсутствующего флага.
+func flagNotFound(key string) string {
+	return "flag with key " + key + " not found"
+}
+
+// checkFlagEnvironments проверяет, что все окружения флага входят в список окружений развертывания.
+func (h *ExperimentHandler) checkFlagEnvironments(flag *ab_types.Flag) error {
+	for _, environment := range slices.Sorted(maps.Keys(flag.Environments)) {
+		if _, err := h.resolveEnvironment(environment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateFlag обрабатывает запрос на создание флага. Ключи environments должны входить
+// в список окружений развертывания, иначе ответ 400.
+func (h *ExperimentHandler) CreateFlag(w http.ResponseWriter, r *http.Request) {
+	var flag ab_types.Flag
+	if err := json.NewDecoder(r.Body).Decode(&flag); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := flag.Validate(); err != nil {
+		http.Error(w, "Invalid flag: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.checkFlagEnvironments(&flag); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if flag.Salt == "" {
+		flag.Salt = uuid.NewString()
+	}
+	if flag.Environments == nil {
+		flag.Environments = make(map[string]ab_types.FlagEnvironment)
+	}
+	configVersion, err := newConfigVersion()
+	if err != nil {
+		http.Error(w, "Failed to generate config version", http.StatusInternalServerError)
+		return
+	}
+	flag.ConfigVersion = configVersion
+	flag.ProjectID = projectFromContext(r.Context())
+	if err := h.validateTargetingRules(r.Context(), flag.ProjectID, flag.TargetingRules()); err != nil {
+		writeModifyError(w, err, "", "create flag")
+		return
+	}
+
+	if err := h.repo.CreateFlag(r.Context(), &flag); err != nil {
+		if strings.HasSuffix(err.Error(), "already exists") {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		log.Printf("ERROR: Failed to create flag %s: %v", flag.Key, err)
+		http.Error(w, "Failed to create flag in database", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(flag)
+}
+
+// ListFlags возвращает все флаги проекта.
+func (h *ExperimentHandler) ListFlags(w http.ResponseWriter, r *http.Request) {
+	flags, err := h.repo.FindAllFlags(r.Context(), projectFromContext(r.Context()))
+	if err != nil {
+		log.Printf("ERROR: Failed to list flags: %v", err)
+		http.Error(w, "Failed to retrieve flags", http.StatusInternalServerError)
+		return
+	}
+	if flags == nil {
+		flags = []ab_types.Flag{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(flags)
+}
+
+// GetFlag обрабатывает запрос на получение флага.
+func (h *ExperimentHandler) GetFlag(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "flagKey")
+	flag, err := h.repo.FindFlagByKey(r.Context(), projectFromContext(r.Context()), key)
+	if err != nil {
+		if err.Error() == flagNotFound(key) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to retrieve flag", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(flag)
+}
+
+// UpdateFlag заменяет описание, значение по умолчанию и состояние флага во всех окружениях.
+// Соль сохраняется, чтобы пользователи не перераспределились между включенными и выключенными.
+func (h *ExperimentHandler) UpdateFlag(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "flagKey")
+	var updated ab_types.Flag
+	if err := json.NewDecoder(r.Body).Decode(&updated); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	updated.Key = key
+	if err := updated.Validate(); err != nil {
+		http.Error(w, "Invalid flag: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.checkFlagEnvironments(&updated); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if updated.Environments == nil {
+		updated.Environments = make(map[string]ab_types.FlagEnvironment)
+	}
+
+	h.modifyFlag(w, r, "update flag", func(flag *ab_types.Flag) error {
+		updated.Salt = flag.Salt
+		updated.ProjectID = flag.ProjectID
+		*flag = updated
+		return h.validateTargetingRules(r.Context(), flag.ProjectOrDefault(), flag.TargetingRules())
+	})
+}
+
+// PutFlagEnvironment задает состояние флага в одном окружении, не затрагивая остальные.
+// Используется для быстрого включения и выключения (kill switch) и изменения доли раскатки.
+// Окружение должно входить в список окружений развертывания, иначе ответ 400.
+func (h *ExperimentHandler) PutFlagEnvironment(w http.ResponseWriter, r *http.Request) {
+	environment, err := h.resolveEnvironment(chi.URLParam(r, "environment"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var state ab_types.FlagEnvironment
+	if err := json.NewDecoder(r.Body).Decode(&state); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.modifyFlag(w, r, "update flag environment", func(flag *ab_types.Flag) error {
+		if flag.Environments == nil {
+			flag.Environments = make(map[string]ab_types.FlagEnvironment)
+		}
+		flag.Environments[environment] = state
+		if err := flag.Validate(); err != nil {
+			return badRequest("Invalid flag: %v", err)
+		}
+		return h.validateTargetingRules(r.Context(), flag.ProjectOrDefault(), state.TargetingRules)
+	})
+}
+
+// modifyFlag атомарно применяет change к флагу, выдает новую версию конфигурации
+// и возвращает клиенту получившийся флаг.
+func (h *ExperimentHandler) modifyFlag(w http.ResponseWriter, r *http.Request, action string, change func(flag *ab_types.Flag) error) {
+	key := chi.URLParam(r, "flagKey")
+	flag, err := h.repo.ModifyFlag(r.Context(), projectFromContext(r.Context()), key, func(flag *ab_types.Flag) (bool, error) {
+		if err := change(flag); err != nil {
+			return false, err
+		}
+		configVersion, err := newConfigVersion()
+		if err != nil {
+			return false, err
+		}
+		flag.ConfigVersion = configVersion
+		return true, nil
+	})
+	if err != nil {
+		writeModifyError(w, err, flagNotFound(key), action)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(flag)
+}
+
+// DeleteFlag обрабатывает удаление флага.
+func (h *ExperimentHandler) DeleteFlag(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "flagKey")
+	if err := h.repo.DeleteFlag(r.Context(), projectFromContext(r.Context()), key); err != nil {
+		if err.Error() == flagNotFound(key) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		log.Printf("ERROR: Failed to delete flag %s: %v", key, err)
+		http.Error(w, "Failed to delete flag", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
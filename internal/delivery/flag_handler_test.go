@@ -0,0 +1,47 @@
+package delivery
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestFlagHandlersRejectUnknownEnvironment(t *testing.T) {
+	// Неизвестное окружение отклоняется до обращения к Repository.
+	handler := NewExperimentHandler(nil, nil, []string{"production", "staging"})
+
+	tests := []struct {
+		name        string
+		handle      http.HandlerFunc
+		environment string
+		body        string
+		wantError   string
+	}{
+		{"put environment", handler.PutFlagEnvironment, "prod", `{"enabled":true}`, `unknown environment "prod"`},
+		{"create", handler.CreateFlag, "", `{"key":"new-checkout","environments":{"production":{"enabled":true},"prod":{"enabled":true}}}`, `unknown environment "prod"`},
+		{"update", handler.UpdateFlag, "", `{"environments":{"dev":{"enabled":true}}}`, `unknown environment "dev"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routeCtx := chi.NewRouteContext()
+			routeCtx.URLParams.Add("flagKey", "new-checkout")
+			routeCtx.URLParams.Add("environment", tt.environment)
+			req := httptest.NewRequest(http.MethodPut, "/flags/new-checkout", strings.NewReader(tt.body))
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, routeCtx))
+
+			rec := httptest.NewRecorder()
+			tt.handle(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantError) {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.wantError)
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+// defaultMaxIDListUploadBytes - ограничение размера загружаемого содержимого списка по умолчанию.
+const defaultMaxIDListUploadBytes = 64 << 20
+
+// idListNotFound - текст ошибки Repository для отсутствующего списка идентификаторов.
+func idListNotFound(id string) string {
+	return "id list with id " + id + " not found"
+}
+
+// CreateIDList создает пустой список идентификаторов проекта. Содержимое загружается
+// отдельно через PUT /id-lists/{listID}/content.
+func (h *ExperimentHandler) CreateIDList(w http.ResponseWriter, r *http.Request) {
+	var list ab_types.IDList
+	if err := json.NewDecoder(r.Body).Decode(&list); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(list.Name) == "" {
+		http.Error(w, "Invalid id list: name is required", http.StatusBadRequest)
+		return
+	}
+	project := projectFromContext(r.Context())
+	if list.ProjectID != "" && list.ProjectID != project {
+		http.Error(w, "project_id does not match the API key", http.StatusBadRequest)
+		return
+	}
+	configVersion, err := newConfigVersion()
+	if err != nil {
+		http.Error(w, "Failed to generate config version", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now().UTC()
+	list = ab_types.IDList{
+		ID:            uuid.NewString(),
+		ProjectID:     project,
+		Name:          list.Name,
+		Description:   list.Description,
+		ConfigVersion: configVersion,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	if err := h.repo.CreateIDList(r.Context(), &list); err != nil {
+		writeModifyError(w, err, "", "create id list")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(list)
+}
+
+// ListIDLists возвращает метаданные всех списков идентификаторов проекта.
+func (h *ExperimentHandler) ListIDLists(w http.ResponseWriter, r *http.Request) {
+	lists, err := h.repo.FindAllIDLists(r.Context(), projectFromContext(r.Context()))
+	if err != nil {
+		log.Printf("ERROR: Failed to list id lists: %v", err)
+		http.Error(w, "Failed to retrieve id lists", http.StatusInternalServerError)
+		return
+	}
+	if lists == nil {
+		lists = []ab_types.IDList{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lists)
+}
+
+// GetIDList возвращает метаданные списка идентификаторов.
+func (h *ExperimentHandler) GetIDList(w http.ResponseWriter, r *http.Request) {
+	list, ok := h.findIDList(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// UploadIDListContent заменяет содержимое списка. Тело - идентификаторы по одному на строку
+// или CSV (Content-Type: text/csv), из которого берется первый столбец; ?header=true
+// пропускает строку заголовка. Каждая загрузка сохраняется в новый объект хранилища.
+func (h *ExperimentHandler) UploadIDListContent(w http.ResponseWriter, r *http.Request) {
+	if h.idListStorage == nil {
+		http.Error(w, "ID list storage is not configured", http.StatusServiceUnavailable)
+		return
+	}
+	id := chi.URLParam(r, "listID")
+	project := projectFromContext(r.Context())
+	if _, ok := h.findIDList(w, r); !ok {
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxIDListUploadBytes()))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("ID list content exceeds %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	ids, err := parseIDListUpload(body, r.Header.Get("Content-Type"), r.URL.Query().Get("header") == "true")
+	if err != nil {
+		http.Error(w, "Invalid id list content: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	data := ab_types.EncodeIDs(ids)
+
+	configVersion, err := newConfigVersion()
+	if err != nil {
+		http.Error(w, "Failed to generate config version", http.StatusInternalServerError)
+		return
+	}
+	objectKey := ab_types.IDListObjectKey(project, id, configVersion)
+	if err := h.idListStorage.Put(r.Context(), objectKey, "text/plain", data); err != nil {
+		log.Printf("ERROR: Failed to upload content of id list %s: %v", id, err)
+		http.Error(w, "Failed to store id list content", http.StatusInternalServerError)
+		return
+	}
+
+	list, err := h.repo.ModifyIDList(r.Context(), project, id, func(list *ab_types.IDList) (bool, error) {
+		list.Size = bytes.Count(data, []byte{'\n'})
+		list.Checksum = ab_types.IDListChecksum(data)
+		list.ObjectKey = objectKey
+		list.ConfigVersion = configVersion
+		list.UpdatedAt = time.Now().UTC()
+		return true, nil
+	})
+	if err != nil {
+		writeModifyError(w, err, idListNotFound(id), "update id list")
+		return
+	}
+	log.Printf("INFO: Uploaded %d ids to id list %s (%s)", list.Size, id, objectKey)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// GetIDListContent возвращает текущее содержимое списка, по одному идентификатору на строку.
+func (h *ExperimentHandler) GetIDListContent(w http.ResponseWriter, r *http.Request) {
+	list, ok := h.findIDList(w, r)
+	if !ok {
+		return
+	}
+	var data []byte
+	if list.ObjectKey != "" {
+		if h.idListStorage == nil {
+			http.Error(w, "ID list storage is not configured", http.StatusServiceUnavailable)
+			return
+		}
+		var err error
+		data, err = h.idListStorage.Get(r.Context(), list.ObjectKey)
+		if err != nil {
+			log.Printf("ERROR: Failed to read content of id list %s: %v", list.ID, err)
+			http.Error(w, "Failed to retrieve id list content", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Config-Version", list.ConfigVersion)
+	w.Write(data)
+}
+
+// DeleteIDList удаляет список идентификаторов и его содержимое. Список, на который
+// ссылаются эксперименты, флаги или сегменты проекта, не удаляется (409).
+func (h *ExperimentHandler) DeleteIDList(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "listID")
+	project := projectFromContext(r.Context())
+	if err := h.repo.DeleteIDList(r.Context(), project, id); err != nil {
+		switch {
+		case err.Error() == idListNotFound(id):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case strings.Contains(err.Error(), " is referenced by "):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			log.Printf("ERROR: Failed to delete id list %s: %v", id, err)
+			http.Error(w, "Failed to delete id list", http.StatusInternalServerError)
+		}
+		return
+	}
+	h.idListContent.forget(project, id)
+	if h.idListStorage != nil {
+		// Метаданные уже удалены, поэтому оставшиеся объекты ни на что не влияют.
+		if err := h.idListStorage.DeletePrefix(r.Context(), ab_types.IDListObjectPrefix(project, id)); err != nil {
+			log.Printf("WARN: Failed to delete content of id list %s: %v", id, err)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// findIDList загружает список из URL запроса и при ошибке отвечает клиенту.
+func (h *ExperimentHandler) findIDList(w http.ResponseWriter, r *http.Request) (*ab_types.IDList, bool) {
+	id := chi.URLParam(r, "listID")
+	list, err := h.repo.FindIDList(r.Context(), projectFromContext(r.Context()), id)
+	if err != nil {
+		if err.Error() == idListNotFound(id) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			log.Printf("ERROR: Failed to find id list %s: %v", id, err)
+			http.Error(w, "Failed to retrieve id list", http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+	return list, true
+}
+
+func (h *ExperimentHandler) maxIDListUploadBytes() int64 {
+	if h.maxIDListBytes > 0 {
+		return h.maxIDListBytes
+	}
+	return defaultMaxIDListUploadBytes
+}
+
+// parseIDListUpload разбирает загружаемое содержимое списка.
+func parseIDListUpload(body []byte, contentType string, skipHeader bool) ([]string, error) {
+	if !strings.HasPrefix(contentType, "text/csv") {
+		ids := ab_types.ParseIDs(body)
+		if skipHeader && len(ids) > 0 {
+			ids = ids[1:]
+		}
+		return ids, nil
+	}
+
+	reader := csv.NewReader(bytes.NewReader(body))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	var ids []string
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return ids, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if first && skipHeader {
+			continue
+		}
+		if id := strings.TrimSpace(record[0]); id != "" {
+			ids = append(ids, id)
+		}
+	}
+}
+
+// idListCache хранит содержимое загруженных списков идентификаторов. Объект содержимого
+// не меняется после записи, поэтому запись кэша действительна, пока совпадает ObjectKey.
+type idListCache struct {
+	mu      sync.Mutex
+	entries map[string]idListEntry
+}
+
+type idListEntry struct {
+	objectKey string
+	members   idSet
+}
+
+func newIDListCache() *idListCache {
+	return &idListCache{entries: make(map[string]idListEntry)}
+}
+
+// forget удаляет из кэша содержимое удаленного списка.
+func (c *idListCache) forget(project, id string) {
+	c.mu.Lock()
+	delete(c.entries, project+"/"+id)
+	c.mu.Unlock()
+}
+
+// members возвращает содержимое текущей версии списка, загружая его из storage при промахе.
+func (c *idListCache) members(ctx context.Context, storage IDListStorage, list *ab_types.IDList) (idSet, error) {
+	if list.ObjectKey == "" {
+		return idSet{}, nil
+	}
+	cacheKey := list.ProjectOrDefault() + "/" + list.ID
+	c.mu.Lock()
+	entry, ok := c.entries[cacheKey]
+	c.mu.Unlock()
+	if ok && entry.objectKey == list.ObjectKey {
+		return entry.members, nil
+	}
+
+	if storage == nil {
+		return nil, errors.New("id list storage is not configured")
+	}
+	data, err := storage.Get(ctx, list.ObjectKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", list.ObjectKey, err)
+	}
+	if err := list.Verify(data); err != nil {
+		return nil, err
+	}
+	ids := ab_types.ParseIDs(data)
+	members := make(idSet, len(ids))
+	for _, id := range ids {
+		members[id] = struct{}{}
+	}
+
+	c.mu.Lock()
+	c.entries[cacheKey] = idListEntry{objectKey: list.ObjectKey, members: members}
+	c.mu.Unlock()
+	return members, nil
+}
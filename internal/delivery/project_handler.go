@@ -0,0 +1,132 @@
+package delivery
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+// apiKeyPrefix отличает API-ключи сервиса от других секретов (например, при поиске утечек).
+const apiKeyPrefix = "abk_"
+
+// CreateProject обрабатывает запрос на создание проекта.
+func (h *ExperimentHandler) CreateProject(w http.ResponseWriter, r *http.Request) {
+	var project ab_types.Project
+	if err := json.NewDecoder(r.Body).Decode(&project); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := ab_types.ValidateProjectID(project.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if project.Name == "" {
+		project.Name = project.ID
+	}
+	project.CreatedAt = time.Now().UTC()
+
+	if err := h.repo.CreateProject(r.Context(), &project); err != nil {
+		if strings.HasSuffix(err.Error(), "already exists") {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		log.Printf("ERROR: Failed to create project %s: %v", project.ID, err)
+		http.Error(w, "Failed to create project in database", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("INFO: Created project %s", project.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(project)
+}
+
+// ListProjects возвращает все проекты.
+func (h *ExperimentHandler) ListProjects(w http.ResponseWriter, r *http.Request) {
+	projects, err := h.repo.FindAllProjects(r.Context())
+	if err != nil {
+		log.Printf("ERROR: Failed to list projects: %v", err)
+		http.Error(w, "Failed to retrieve projects", http.StatusInternalServerError)
+		return
+	}
+	if projects == nil {
+		projects = []ab_types.Project{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(projects)
+}
+
+// CreateAPIKey выпускает API-ключ проекта. Открытое значение ключа возвращается только в этом ответе.
+func (h *ExperimentHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "projectID")
+	var key ab_types.APIKey
+	if err := json.NewDecoder(r.Body).Decode(&key); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		http.Error(w, "Failed to generate API key", http.StatusInternalServerError)
+		return
+	}
+	key.ID = uuid.NewString()
+	key.ProjectID = projectID
+	key.Key = apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	key.CreatedAt = time.Now().UTC()
+
+	if err := h.repo.CreateAPIKey(r.Context(), &key, hashAPIKey(key.Key)); err != nil {
+		if err.Error() == "project with id "+projectID+" not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		log.Printf("ERROR: Failed to create API key for project %s: %v", projectID, err)
+		http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("INFO: Created API key %s for project %s", key.ID, projectID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(key)
+}
+
+// ListAPIKeys возвращает ключи проекта без открытых значений.
+func (h *ExperimentHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "projectID")
+	keys, err := h.repo.FindAPIKeys(r.Context(), projectID)
+	if err != nil {
+		log.Printf("ERROR: Failed to list API keys of project %s: %v", projectID, err)
+		http.Error(w, "Failed to retrieve API keys", http.StatusInternalServerError)
+		return
+	}
+	if keys == nil {
+		keys = []ab_types.APIKey{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// DeleteAPIKey отзывает API-ключ проекта.
+func (h *ExperimentHandler) DeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "projectID")
+	keyID := chi.URLParam(r, "keyID")
+	if err := h.repo.DeleteAPIKey(r.Context(), projectID, keyID); err != nil {
+		if err.Error() == "api key "+keyID+" not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		log.Printf("ERROR: Failed to delete API key %s: %v", keyID, err)
+		http.Error(w, "Failed to delete API key", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("INFO: Revoked API key %s of project %s", keyID, projectID)
+	w.WriteHeader(http.StatusNoContent)
+}
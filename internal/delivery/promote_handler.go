@@ -0,0 +1,110 @@
+package delivery
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+// PromoteRequest определяет тело запроса POST /experiments/{id}/promote.
+type PromoteRequest struct {
+	TargetEnvironment string `json:"target_environment"`
+}
+
+// PromoteExperiment копирует конфигурацию эксперимента (таргетинг, оверрайды, варианты,
+// параметры, бакетирование) в другое окружение. Повторный перенос обновляет ранее созданную
+// копию по тем же правилам, что и PUT; первый создает ее в статусе DRAFT. Статус, соль
+// и план раскатки копии не переносятся: запуск в целевом окружении - отдельное решение.
+// Каждый перенос записывается в историю.
+func (h *ExperimentHandler) PromoteExperiment(w http.ResponseWriter, r *http.Request) {
+	experimentID := chi.URLParam(r, "experimentID")
+	var req PromoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.TargetEnvironment == "" {
+		http.Error(w, "target_environment is required", http.StatusBadRequest)
+		return
+	}
+	targetEnv, err := h.resolveEnvironment(req.TargetEnvironment)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	project := projectFromContext(r.Context())
+	exp, err := h.repo.PromoteExperiment(r.Context(), experimentID, targetEnv, func(source, target *ab_types.Experiment) (*ab_types.Experiment, error) {
+		if source.ProjectOrDefault() != project {
+			return nil, errors.New(experimentNotFound(experimentID))
+		}
+		if source.EnvironmentOrDefault() == targetEnv {
+			return nil, badRequest("experiment %s is already in environment %s", source.ID, targetEnv)
+		}
+		promoted := *source
+		promoted.Ramp = nil
+		promoted.Variants = slices.Clone(source.Variants)
+		// Диапазоны уже рассчитаны в источнике; повторный расчет из percent не нужен.
+		for i := range promoted.Variants {
+			promoted.Variants[i].Percent = nil
+		}
+
+		if target != nil {
+			promoted.Status = target.Status
+			promoted.EndTime = target.EndTime
+			if err := mergeExperimentUpdate(target, &promoted); err != nil {
+				return nil, err
+			}
+			return &promoted, nil
+		}
+
+		promoted.ID = uuid.NewString()
+		promoted.Salt = uuid.NewString()
+		promoted.Environment = targetEnv
+		promoted.Status = ab_types.StatusDraft
+		promoted.BucketingVersion = ab_types.LatestBucketingVersion
+		configVersion, err := newConfigVersion()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate config version: %w", err)
+		}
+		promoted.ConfigVersion = configVersion
+		return &promoted, nil
+	})
+	if err != nil {
+		writeModifyError(w, err, experimentNotFound(experimentID), "promote experiment")
+		return
+	}
+
+	log.Printf("INFO: Promoted experiment %s to environment %s as %s", experimentID, targetEnv, exp.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(exp)
+}
+
+// GetExperimentHistory возвращает историю переносов эксперимента между окружениями.
+// Записи о экспериментах других проектов не возвращаются.
+func (h *ExperimentHandler) GetExperimentHistory(w http.ResponseWriter, r *http.Request) {
+	experimentID := chi.URLParam(r, "experimentID")
+	entries, err := h.repo.FindExperimentHistory(r.Context(), experimentID)
+	if err != nil {
+		log.Printf("ERROR: Failed to read history of experiment %s: %v", experimentID, err)
+		http.Error(w, "Failed to retrieve experiment history", http.StatusInternalServerError)
+		return
+	}
+	project := projectFromContext(r.Context())
+	entries = slices.DeleteFunc(entries, func(entry ab_types.HistoryEntry) bool {
+		return entry.Experiment.ProjectOrDefault() != project
+	})
+	if entries == nil {
+		entries = []ab_types.HistoryEntry{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
@@ -0,0 +1,169 @@
+package delivery
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+// RampRequest определяет тело запроса PUT /experiments/{id}/ramp.
+type RampRequest struct {
+	Variant string              `json:"variant"`
+	Steps   []ab_types.RampStep `json:"steps"`
+}
+
+// requestError - ошибка, вызванная содержимым запроса, а не сбоем хранилища.
+type requestError struct {
+	status int
+	err    error
+}
+
+func (e *requestError) Error() string { return e.err.Error() }
+
+func badRequest(format string, args ...any) error {
+	return &requestError{status: http.StatusBadRequest, err: fmt.Errorf(format, args...)}
+}
+
+func conflict(format string, args ...any) error {
+	return &requestError{status: http.StatusConflict, err: fmt.Errorf(format, args...)}
+}
+
+// writeModifyError отвечает клиенту ошибкой, полученной из Repository.ModifyExperiment
+// или Repository.ModifyFlag. notFound - текст ошибки хранилища об отсутствии записи.
+func writeModifyError(w http.ResponseWriter, err error, notFound, action string) {
+	var reqErr *requestError
+	switch {
+	case errors.As(err, &reqErr):
+		http.Error(w, reqErr.Error(), reqErr.status)
+	case err.Error() == notFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		log.Printf("ERROR: Failed to %s: %v", action, err)
+		http.Error(w, "Failed to "+action, http.StatusInternalServerError)
+	}
+}
+
+// experimentNotFound - текст ошибки Repository для отсутствующего эксперимента.
+func experimentNotFound(id string) string {
+	return "experiment with id " + id + " not found"
+}
+
+// GetRamp возвращает план раскатки эксперимента с отметкой примененного шага.
+func (h *ExperimentHandler) GetRamp(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "experimentID")
+	exp, err := h.findExperiment(r.Context(), id)
+	if err != nil {
+		if err.Error() == experimentNotFound(id) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to retrieve experiment", http.StatusInternalServerError)
+		}
+		return
+	}
+	if exp.Ramp == nil {
+		http.Error(w, "Experiment has no ramp plan", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(exp.Ramp)
+}
+
+// PutRamp задает (или заменяет) план раскатки. Наступившие шаги применяются сразу,
+// остальные - планировщиком. Новый план не может уменьшить уже выставленную долю варианта.
+func (h *ExperimentHandler) PutRamp(w http.ResponseWriter, r *http.Request) {
+	var req RampRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.modifyRamp(w, r, "set ramp plan", func(exp *ab_types.Experiment) error {
+		if exp.Ramp != nil && exp.Ramp.Variant != req.Variant && isRampInProgress(exp.Ramp) {
+			return conflict("variant %q is already being ramped", exp.Ramp.Variant)
+		}
+		plan, err := exp.NewRampPlan(req.Variant, req.Steps, exp.Ramp)
+		if err != nil {
+			return badRequest("invalid ramp plan: %v", err)
+		}
+		exp.Ramp = plan
+		if _, err := exp.AdvanceRamp(time.Now()); err != nil {
+			return badRequest("invalid ramp plan: %v", err)
+		}
+		return nil
+	})
+}
+
+// PauseRamp замораживает раскатку: вариант сохраняет текущую долю трафика.
+func (h *ExperimentHandler) PauseRamp(w http.ResponseWriter, r *http.Request) {
+	h.modifyRamp(w, r, "pause ramp", func(exp *ab_types.Experiment) error {
+		if exp.Ramp == nil || exp.Ramp.State != ab_types.RampActive {
+			return conflict("ramp is not active")
+		}
+		exp.Ramp.State = ab_types.RampPaused
+		return nil
+	})
+}
+
+// ResumeRamp продолжает приостановленную раскатку, сразу применяя наступившие шаги.
+func (h *ExperimentHandler) ResumeRamp(w http.ResponseWriter, r *http.Request) {
+	h.modifyRamp(w, r, "resume ramp", func(exp *ab_types.Experiment) error {
+		if exp.Ramp == nil || exp.Ramp.State != ab_types.RampPaused {
+			return conflict("ramp is not paused")
+		}
+		exp.Ramp.State = ab_types.RampActive
+		if _, err := exp.AdvanceRamp(time.Now()); err != nil {
+			return conflict("cannot apply ramp step: %v", err)
+		}
+		return nil
+	})
+}
+
+// AbortRamp останавливает раскатку и убирает из варианта весь трафик.
+func (h *ExperimentHandler) AbortRamp(w http.ResponseWriter, r *http.Request) {
+	h.modifyRamp(w, r, "abort ramp", func(exp *ab_types.Experiment) error {
+		if exp.Ramp == nil || !isRampInProgress(exp.Ramp) {
+			return conflict("ramp is not in progress")
+		}
+		if err := exp.AbortRamp(); err != nil {
+			return conflict("cannot abort ramp: %v", err)
+		}
+		return nil
+	})
+}
+
+// modifyRamp атомарно применяет change к эксперименту, выдает новую версию конфигурации
+// и возвращает клиенту получившийся план.
+func (h *ExperimentHandler) modifyRamp(w http.ResponseWriter, r *http.Request, action string, change func(exp *ab_types.Experiment) error) {
+	experimentID := chi.URLParam(r, "experimentID")
+	exp, err := h.modifyExperiment(r.Context(), experimentID, func(exp *ab_types.Experiment) (bool, error) {
+		if err := change(exp); err != nil {
+			return false, err
+		}
+		v7, err := uuid.NewV7()
+		if err != nil {
+			return false, fmt.Errorf("failed to generate config version: %w", err)
+		}
+		exp.ConfigVersion = v7.String()
+		return true, nil
+	})
+	if err != nil {
+		writeModifyError(w, err, experimentNotFound(experimentID), action)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(exp.Ramp)
+}
+
+// isRampInProgress сообщает, управляет ли план диапазоном варианта (активен или на паузе).
+func isRampInProgress(plan *ab_types.RampPlan) bool {
+	return plan.State == ab_types.RampActive || plan.State == ab_types.RampPaused
+}
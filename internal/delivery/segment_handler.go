@@ -0,0 +1,192 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+// segmentNotFound - текст ошибки Repository для отсутствующего сегмента.
+func segmentNotFound(key string) string {
+	return "segment with key " + key + " not found"
+}
+
+// CreateSegment обрабатывает запрос на создание сегмента проекта.
+func (h *ExperimentHandler) CreateSegment(w http.ResponseWriter, r *http.Request) {
+	var segment ab_types.Segment
+	if err := json.NewDecoder(r.Body).Decode(&segment); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := segment.Validate(); err != nil {
+		http.Error(w, "Invalid segment: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	project := projectFromContext(r.Context())
+	if segment.ProjectID != "" && segment.ProjectID != project {
+		http.Error(w, "project_id does not match the API key", http.StatusBadRequest)
+		return
+	}
+	segment.ProjectID = project
+	if err := h.validateTargetingRules(r.Context(), project, segment.Rules); err != nil {
+		writeModifyError(w, err, "", "create segment")
+		return
+	}
+	if segment.Rules == nil {
+		segment.Rules = []ab_types.TargetingRule{}
+	}
+	configVersion, err := newConfigVersion()
+	if err != nil {
+		http.Error(w, "Failed to generate config version", http.StatusInternalServerError)
+		return
+	}
+	segment.ConfigVersion = configVersion
+
+	if err := h.repo.CreateSegment(r.Context(), &segment); err != nil {
+		if strings.HasSuffix(err.Error(), "already exists") {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		log.Printf("ERROR: Failed to create segment %s: %v", segment.Key, err)
+		http.Error(w, "Failed to create segment in database", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(segment)
+}
+
+// ListSegments возвращает все сегменты проекта.
+func (h *ExperimentHandler) ListSegments(w http.ResponseWriter, r *http.Request) {
+	segments, err := h.repo.FindAllSegments(r.Context(), projectFromContext(r.Context()))
+	if err != nil {
+		log.Printf("ERROR: Failed to list segments: %v", err)
+		http.Error(w, "Failed to retrieve segments", http.StatusInternalServerError)
+		return
+	}
+	if segments == nil {
+		segments = []ab_types.Segment{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(segments)
+}
+
+// GetSegment обрабатывает запрос на получение текущей версии сегмента.
+func (h *ExperimentHandler) GetSegment(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "segmentKey")
+	segment, err := h.repo.FindSegmentByKey(r.Context(), projectFromContext(r.Context()), key)
+	if err != nil {
+		if err.Error() == segmentNotFound(key) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to retrieve segment", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(segment)
+}
+
+// UpdateSegment заменяет описание и правила сегмента, сохраняя предыдущую версию в истории.
+func (h *ExperimentHandler) UpdateSegment(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "segmentKey")
+	var updated ab_types.Segment
+	if err := json.NewDecoder(r.Body).Decode(&updated); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	updated.Key = key
+	if err := updated.Validate(); err != nil {
+		http.Error(w, "Invalid segment: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	project := projectFromContext(r.Context())
+	if err := h.validateTargetingRules(r.Context(), project, updated.Rules); err != nil {
+		writeModifyError(w, err, "", "update segment")
+		return
+	}
+	if updated.Rules == nil {
+		updated.Rules = []ab_types.TargetingRule{}
+	}
+
+	segment, err := h.repo.ModifySegment(r.Context(), project, key, func(segment *ab_types.Segment) (bool, error) {
+		configVersion, err := newConfigVersion()
+		if err != nil {
+			return false, err
+		}
+		segment.Description = updated.Description
+		segment.Rules = updated.Rules
+		segment.ConfigVersion = configVersion
+		return true, nil
+	})
+	if err != nil {
+		writeModifyError(w, err, segmentNotFound(key), "update segment")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(segment)
+}
+
+// GetSegmentVersions возвращает все версии сегмента, от старых к новым.
+func (h *ExperimentHandler) GetSegmentVersions(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "segmentKey")
+	project := projectFromContext(r.Context())
+	if _, err := h.repo.FindSegmentByKey(r.Context(), project, key); err != nil {
+		if err.Error() == segmentNotFound(key) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to retrieve segment", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	versions, err := h.repo.FindSegmentVersions(r.Context(), project, key)
+	if err != nil {
+		log.Printf("ERROR: Failed to read versions of segment %s: %v", key, err)
+		http.Error(w, "Failed to retrieve segment versions", http.StatusInternalServerError)
+		return
+	}
+	if versions == nil {
+		versions = []ab_types.SegmentVersion{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+}
+
+// DeleteSegment обрабатывает удаление сегмента. Сегмент, на который ссылаются
+// эксперименты или флаги проекта, не удаляется (409).
+func (h *ExperimentHandler) DeleteSegment(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "segmentKey")
+	if err := h.repo.DeleteSegment(r.Context(), projectFromContext(r.Context()), key); err != nil {
+		switch {
+		case err.Error() == segmentNotFound(key):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case strings.Contains(err.Error(), " is referenced by "):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			log.Printf("ERROR: Failed to delete segment %s: %v", key, err)
+			http.Error(w, "Failed to delete segment", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// projectSegments возвращает сегменты проекта по ключу.
+func (h *ExperimentHandler) projectSegments(ctx context.Context, project string) (map[string]*ab_types.Segment, error) {
+	list, err := h.repo.FindAllSegments(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	segments := make(map[string]*ab_types.Segment, len(list))
+	for i := range list {
+		segments[list[i].Key] = &list[i]
+	}
+	return segments, nil
+}
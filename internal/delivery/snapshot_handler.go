@@ -0,0 +1,90 @@
+package delivery
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+// WithSnapshotSigningKey задает ключ, которым подписываются манифесты GET /snapshot
+// (тот же SNAPSHOT_SIGNING_KEY, что и у snapshot-generator).
+func (h *ExperimentHandler) WithSnapshotSigningKey(key ed25519.PrivateKey) *ExperimentHandler {
+	h.snapshotSigningKey = key
+	return h
+}
+
+// GetSnapshot отдает согласованный снэпшот экспериментов окружения (параметр environment,
+// по умолчанию production) проекта API-ключа для SDK (HTTPSnapshotSource).
+// ETag равен номеру изменения (seq): клиент, передавший актуальный If-None-Match, получает 304
+// без выгрузки конфигурации. Манифест снэпшота передается в заголовке X-Snapshot-Manifest.
+func (h *ExperimentHandler) GetSnapshot(w http.ResponseWriter, r *http.Request) {
+	environment, err := h.resolveEnvironment(r.URL.Query().Get("environment"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	project := projectFromContext(r.Context())
+
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		seq, err := h.repo.CurrentSeq(r.Context(), project)
+		if err != nil {
+			log.Printf("ERROR: Failed to read config seq: %v", err)
+			http.Error(w, "Failed to export snapshot", http.StatusInternalServerError)
+			return
+		}
+		if etag := snapshotETag(seq); ifNoneMatch == etag {
+			w.Header().Set("ETag", etag)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	snapshot, err := h.repo.ExportSnapshot(r.Context(), project, environment)
+	if err != nil {
+		log.Printf("ERROR: Failed to export snapshot: %v", err)
+		http.Error(w, "Failed to export snapshot", http.StatusInternalServerError)
+		return
+	}
+	version, err := newConfigVersion()
+	if err != nil {
+		http.Error(w, "Failed to generate snapshot version", http.StatusInternalServerError)
+		return
+	}
+	snapshot.Version = version
+	snapshot.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	format := ab_types.DefaultSnapshotFormat
+	data, err := ab_types.EncodeSnapshot(snapshot, format)
+	if err != nil {
+		log.Printf("ERROR: Failed to encode snapshot: %v", err)
+		http.Error(w, "Failed to encode snapshot", http.StatusInternalServerError)
+		return
+	}
+
+	manifest := ab_types.NewSnapshotManifest(snapshot, "", format.ContentType(), data)
+	if h.snapshotSigningKey != nil {
+		manifest.Sign(h.snapshotSigningKey)
+	}
+	manifestData, err := json.Marshal(manifest)
+	if err != nil {
+		log.Printf("ERROR: Failed to marshal snapshot manifest: %v", err)
+		http.Error(w, "Failed to encode snapshot", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", snapshotETag(snapshot.Seq))
+	w.Header().Set(ab_types.SnapshotManifestHeader, string(manifestData))
+	w.Header().Set("Content-Type", format.ContentType())
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// snapshotETag возвращает ETag снэпшота с номером изменения seq.
+func snapshotETag(seq int64) string {
+	return fmt.Sprintf(`"%d"`, seq)
+}
@@ -0,0 +1,260 @@
+package delivery
+
+import (
+	"context"
+	"log"
+	"net/netip"
+	"regexp"
+	"slices"
+	"sync"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+// idSet - содержимое списка идентификаторов.
+type idSet map[string]struct{}
+
+// ruleRefs - сегменты и списки идентификаторов проекта, на которые ссылаются правила
+// таргетинга и оверрайды вычисляемых экспериментов. nil означает, что ссылок нет.
+type ruleRefs struct {
+	segments map[string]*ab_types.Segment
+	idLists  map[string]idSet
+	// regexps - скомпилированные шаблоны MATCHES_REGEX вычисляемых правил.
+	regexps ab_types.RuleRegexps
+	// cidrs - разобранные диапазоны IP_IN_CIDR вычисляемых правил.
+	cidrs ab_types.RuleCIDRs
+	// overrides - inline-оверрайды вычисляемых экспериментов в виде множеств, индексированные по ID.
+	overrides map[string]ab_types.OverrideSet
+}
+
+func (refs *ruleRefs) segment(key string) *ab_types.Segment {
+	if refs == nil {
+		return nil
+	}
+	return refs.segments[key]
+}
+
+func (refs *ruleRefs) idList(id string) (idSet, bool) {
+	if refs == nil {
+		return nil, false
+	}
+	members, ok := refs.idLists[id]
+	return members, ok
+}
+
+func (refs *ruleRefs) regexp(pattern string) *regexp.Regexp {
+	if refs == nil {
+		return nil
+	}
+	return refs.regexps[pattern]
+}
+
+// cidrPrefixes возвращает диапазоны правила IP_IN_CIDR (см. ab_types.RuleCIDRs.Prefixes).
+func (refs *ruleRefs) cidrPrefixes(rule *ab_types.TargetingRule) ([]netip.Prefix, bool) {
+	if refs == nil {
+		return ab_types.ParseCIDRs(rule.Value)
+	}
+	return refs.cidrs.Prefixes(rule)
+}
+
+// overrideSet возвращает inline-оверрайды эксперимента в виде множеств
+// (для эксперимента без загруженных ссылок они строятся на месте).
+func (refs *ruleRefs) overrideSet(exp *ab_types.Experiment) ab_types.OverrideSet {
+	if refs != nil {
+		if overrides, ok := refs.overrides[exp.ID]; ok {
+			return overrides
+		}
+	}
+	return ab_types.NewOverrideSet(&exp.OverrideLists)
+}
+
+// inAnyIDList сообщает, входит ли unitID хотя бы в один из списков listIDs.
+func (refs *ruleRefs) inAnyIDList(listIDs []string, unitID string) bool {
+	for _, id := range listIDs {
+		if members, ok := refs.idList(id); ok {
+			if _, in := members[unitID]; in {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// loadRuleRefs загружает сегменты проекта и содержимое списков идентификаторов,
+// на которые ссылаются эксперименты и сегменты, и строит множества inline-оверрайдов
+// экспериментов. Список, содержимое которого не удалось загрузить, пропускается:
+// ссылающиеся на него правила не пропускают пользователей.
+func (h *ExperimentHandler) loadRuleRefs(ctx context.Context, project string, experiments []ab_types.Experiment) (*ruleRefs, error) {
+	segments, err := h.projectSegments(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	refs := &ruleRefs{
+		segments:  segments,
+		idLists:   make(map[string]idSet),
+		regexps:   make(ab_types.RuleRegexps),
+		cidrs:     make(ab_types.RuleCIDRs),
+		overrides: make(map[string]ab_types.OverrideSet, len(experiments)),
+	}
+
+	var listIDs []string
+	for i := range experiments {
+		listIDs = append(listIDs, experiments[i].OverrideLists.OverrideIDLists()...)
+		ids, _ := ab_types.ReferencedIDLists(experiments[i].TargetingRules)
+		listIDs = append(listIDs, ids...)
+		h.ruleValues.collect(experiments[i].TargetingRules, refs)
+		refs.overrides[experiments[i].ID] = ab_types.NewOverrideSet(&experiments[i].OverrideLists)
+	}
+	for _, segment := range segments {
+		ids, _ := ab_types.ReferencedIDLists(segment.Rules)
+		listIDs = append(listIDs, ids...)
+		h.ruleValues.collect(segment.Rules, refs)
+	}
+	if len(listIDs) == 0 {
+		return refs, nil
+	}
+	slices.Sort(listIDs)
+	listIDs = slices.Compact(listIDs)
+
+	lists, err := h.repo.FindAllIDLists(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	for i := range lists {
+		list := &lists[i]
+		if _, found := slices.BinarySearch(listIDs, list.ID); !found {
+			continue
+		}
+		members, err := h.idListContent.members(ctx, h.idListStorage, list)
+		if err != nil {
+			log.Printf("WARN: Failed to load content of id list %s: %v", list.ID, err)
+			continue
+		}
+		refs.idLists[list.ID] = members
+	}
+	return refs, nil
+}
+
+// maxCachedRuleValues ограничивает число значений каждого вида в ruleValueCache;
+// при превышении они очищаются.
+const maxCachedRuleValues = 1024
+
+// ruleValueCache хранит скомпилированные шаблоны MATCHES_REGEX и разобранные диапазоны
+// IP_IN_CIDR между запросами /decide, чтобы значение правила разбиралось один раз,
+// а не при каждом его вычислении.
+type ruleValueCache struct {
+	mu      sync.Mutex
+	regexps ab_types.RuleRegexps
+	cidrs   ab_types.RuleCIDRs
+}
+
+func newRuleValueCache() *ruleValueCache {
+	return &ruleValueCache{regexps: make(ab_types.RuleRegexps), cidrs: make(ab_types.RuleCIDRs)}
+}
+
+// collect добавляет в refs скомпилированные значения правил rules.
+// Некорректное значение (правила проверяются при сохранении) пропускается.
+func (c *ruleValueCache) collect(rules []ab_types.TargetingRule, refs *ruleRefs) {
+	patterns := ab_types.RegexPatterns(rules)
+	cidrKeys := ab_types.CIDRKeys(rules)
+	if len(patterns) == 0 && len(cidrKeys) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.regexps) > maxCachedRuleValues {
+		c.regexps = make(ab_types.RuleRegexps)
+	}
+	if len(c.cidrs) > maxCachedRuleValues {
+		c.cidrs = make(ab_types.RuleCIDRs)
+	}
+	if err := c.regexps.Compile(rules); err != nil {
+		log.Printf("WARN: Skipping targeting rule: %v", err)
+	}
+	if err := c.cidrs.Compile(rules); err != nil {
+		log.Printf("WARN: Skipping targeting rule: %v", err)
+	}
+	for _, pattern := range patterns {
+		if re, ok := c.regexps[pattern]; ok {
+			refs.regexps[pattern] = re
+		}
+	}
+	for _, key := range cidrKeys {
+		if prefixes, ok := c.cidrs[key]; ok {
+			refs.cidrs[key] = prefixes
+		}
+	}
+}
+
+// validateTargetingRules проверяет структуру дерева правил и то, что все сегменты и списки
+// идентификаторов, на которые ссылаются правила, существуют в проекте, а сравнения
+// с объявленными атрибутами соответствуют схеме атрибутов проекта.
+// Ошибки правил возвращаются как requestError.
+func (h *ExperimentHandler) validateTargetingRules(ctx context.Context, project string, rules []ab_types.TargetingRule) error {
+	if err := ab_types.ValidateTargetingRules(rules); err != nil {
+		return badRequest("Invalid targeting rules: %v", err)
+	}
+	keys, err := ab_types.ReferencedSegments(rules)
+	if err != nil {
+		return badRequest("Invalid targeting rules: %v", err)
+	}
+	if len(keys) > 0 {
+		segments, err := h.projectSegments(ctx, project)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if _, ok := segments[key]; !ok {
+				return badRequest("Invalid targeting rules: unknown segment %q", key)
+			}
+		}
+	}
+
+	listIDs, err := ab_types.ReferencedIDLists(rules)
+	if err != nil {
+		return badRequest("Invalid targeting rules: %v", err)
+	}
+	if err := h.validateIDLists(ctx, project, listIDs, "targeting rules"); err != nil {
+		return err
+	}
+
+	schema, err := h.projectAttributeSchema(ctx, project)
+	if err != nil {
+		return err
+	}
+	if err := schema.ValidateRules(rules); err != nil {
+		return badRequest("Invalid targeting rules: %v", err)
+	}
+	return nil
+}
+
+// validateExperimentReferences проверяет правила эксперимента и списки идентификаторов его оверрайдов.
+func (h *ExperimentHandler) validateExperimentReferences(ctx context.Context, exp *ab_types.Experiment) error {
+	if err := h.validateTargetingRules(ctx, exp.ProjectOrDefault(), exp.TargetingRules); err != nil {
+		return err
+	}
+	for variant := range exp.OverrideLists.ForceIncludeLists {
+		if !exp.HasVariant(variant) {
+			return badRequest("Invalid override lists: unknown variant %q", variant)
+		}
+	}
+	return h.validateIDLists(ctx, exp.ProjectOrDefault(), exp.OverrideLists.OverrideIDLists(), "override lists")
+}
+
+// validateIDLists проверяет, что списки идентификаторов listIDs существуют в проекте.
+// what описывает место ссылок в тексте ошибки.
+func (h *ExperimentHandler) validateIDLists(ctx context.Context, project string, listIDs []string, what string) error {
+	if len(listIDs) == 0 {
+		return nil
+	}
+	lists, err := h.repo.FindAllIDLists(ctx, project)
+	if err != nil {
+		return err
+	}
+	for _, id := range listIDs {
+		if !slices.ContainsFunc(lists, func(list ab_types.IDList) bool { return list.ID == id }) {
+			return badRequest("Invalid %s: unknown id list %q", what, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// AssignmentStore хранит закрепленные назначения sticky-экспериментов в таблице sticky_assignments.
+// Строки удаляются каскадно вместе с экспериментом.
+type AssignmentStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewAssignmentStore(p *pgxpool.Pool) *AssignmentStore {
+	return &AssignmentStore{pool: p}
+}
+
+// Get возвращает сохраненный вариант пользователя в эксперименте.
+func (s *AssignmentStore) Get(ctx context.Context, experimentID, userID string) (string, bool, error) {
+	var variantName string
+	err := s.pool.QueryRow(ctx,
+		`SELECT variant_name FROM sticky_assignments WHERE experiment_id = $1 AND user_id = $2`,
+		experimentID, userID).Scan(&variantName)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("failed to read sticky assignment: %w", err)
+	}
+	return variantName, true, nil
+}
+
+// Save сохраняет вариант пользователя. Уже сохраненное назначение не перезаписывается.
+func (s *AssignmentStore) Save(ctx context.Context, experimentID, userID, variantName string) error {
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO sticky_assignments (experiment_id, user_id, variant_name, assigned_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (experiment_id, user_id) DO NOTHING`,
+		experimentID, userID, variantName)
+	if err != nil {
+		return fmt.Errorf("failed to save sticky assignment: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+const attributeColumns = `name, type, description, updated_at, project_id`
+
+// UpsertAttribute создает или изменяет объявление атрибута проекта. Объявление, которому
+// противоречат правила существующих экспериментов, флагов или сегментов, не сохраняется.
+// Схема атрибутов не входит в конфигурацию клиентов, поэтому событие в outbox не пишется.
+func (r *Repository) UpsertAttribute(ctx context.Context, definition *ab_types.AttributeDefinition) error {
+	project := definition.ProjectOrDefault()
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Блокируем схему проекта, чтобы параллельные изменения проверялись по одной версии.
+	if _, err := tx.Exec(ctx, `SELECT name FROM attributes WHERE project_id = $1 FOR UPDATE`, project); err != nil {
+		return fmt.Errorf("failed to lock attributes: %w", err)
+	}
+
+	config, err := loadProjectRules(ctx, tx, project)
+	if err != nil {
+		return err
+	}
+	schema := ab_types.AttributeSchema{definition.Name: definition.Type}
+	for _, exp := range config.experiments {
+		if err := schema.ValidateRules(exp.TargetingRules); err != nil {
+			return fmt.Errorf("attribute %s conflicts with experiment %s: %w", definition.Name, exp.ID, err)
+		}
+	}
+	for _, flag := range config.flags {
+		if err := schema.ValidateRules(flag.TargetingRules()); err != nil {
+			return fmt.Errorf("attribute %s conflicts with flag %s: %w", definition.Name, flag.Key, err)
+		}
+	}
+	for _, segment := range config.segments {
+		if err := schema.ValidateRules(segment.Rules); err != nil {
+			return fmt.Errorf("attribute %s conflicts with segment %s: %w", definition.Name, segment.Key, err)
+		}
+	}
+
+	query := `
+		INSERT INTO attributes (` + attributeColumns + `) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (project_id, name) DO UPDATE
+		SET type = EXCLUDED.type, description = EXCLUDED.description, updated_at = EXCLUDED.updated_at`
+	if _, err := tx.Exec(ctx, query, definition.Name, definition.Type, definition.Description, definition.UpdatedAt, project); err != nil {
+		return fmt.Errorf("failed to upsert attribute: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+// FindAttributes возвращает объявления атрибутов проекта.
+func (r *Repository) FindAttributes(ctx context.Context, project string) ([]ab_types.AttributeDefinition, error) {
+	rows, err := r.pool.Query(ctx, `SELECT `+attributeColumns+` FROM attributes WHERE project_id = $1 ORDER BY name`, project)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query attributes: %w", err)
+	}
+	defer rows.Close()
+
+	var definitions []ab_types.AttributeDefinition
+	for rows.Next() {
+		var definition ab_types.AttributeDefinition
+		if err := rows.Scan(&definition.Name, &definition.Type, &definition.Description, &definition.UpdatedAt, &definition.ProjectID); err != nil {
+			return nil, fmt.Errorf("failed to scan attribute row: %w", err)
+		}
+		definitions = append(definitions, definition)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over attributes: %w", err)
+	}
+	return definitions, nil
+}
+
+// DeleteAttribute удаляет объявление атрибута; правила с ним перестают проверяться.
+func (r *Repository) DeleteAttribute(ctx context.Context, project, name string) error {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM attributes WHERE project_id = $1 AND name = $2`, project, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete attribute: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("attribute %s not found", name)
+	}
+	return nil
+}
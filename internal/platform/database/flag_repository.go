@@ -0,0 +1,170 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+	"github.com/jackc/pgx/v5"
+)
+
+const flagColumns = `key, description, default_value, bucket_by, salt, config_version, environments, project_id`
+
+// CreateFlag сохраняет новый флаг проекта и событие в outbox в одной транзакции.
+func (r *Repository) CreateFlag(ctx context.Context, flag *ab_types.Flag) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `INSERT INTO flags (` + flagColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) ON CONFLICT (project_id, key) DO NOTHING`
+	tag, err := tx.Exec(ctx, query, flagValues(flag)...)
+	if err != nil {
+		return fmt.Errorf("failed to insert flag: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("flag with key %s already exists", flag.Key)
+	}
+
+	if err := insertFlagUpsertEvent(ctx, tx, flag); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// FindFlagByKey находит флаг проекта по ключу.
+func (r *Repository) FindFlagByKey(ctx context.Context, project, key string) (*ab_types.Flag, error) {
+	var flag ab_types.Flag
+	query := `SELECT ` + flagColumns + ` FROM flags WHERE project_id = $1 AND key = $2`
+	if err := r.pool.QueryRow(ctx, query, project, key).Scan(flagScanTargets(&flag)...); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("flag with key %s not found", key)
+		}
+		return nil, fmt.Errorf("failed to find flag: %w", err)
+	}
+	return &flag, nil
+}
+
+// FindAllFlags возвращает все флаги проекта, упорядоченные по ключу.
+func (r *Repository) FindAllFlags(ctx context.Context, project string) ([]ab_types.Flag, error) {
+	return queryFlags(ctx, r.pool, `SELECT `+flagColumns+` FROM flags WHERE project_id = $1 ORDER BY key`, project)
+}
+
+// ModifyFlag читает флаг с блокировкой строки, применяет к нему modify
+// и, если modify сообщил об изменении, сохраняет результат вместе с событием в outbox.
+func (r *Repository) ModifyFlag(ctx context.Context, project, key string, modify func(flag *ab_types.Flag) (bool, error)) (*ab_types.Flag, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var flag ab_types.Flag
+	query := `SELECT ` + flagColumns + ` FROM flags WHERE project_id = $1 AND key = $2 FOR UPDATE`
+	if err := tx.QueryRow(ctx, query, project, key).Scan(flagScanTargets(&flag)...); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("flag with key %s not found", key)
+		}
+		return nil, fmt.Errorf("failed to lock flag: %w", err)
+	}
+
+	changed, err := modify(&flag)
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		return &flag, nil
+	}
+
+	updateQuery := `
+		UPDATE flags
+		SET description = $2, default_value = $3, bucket_by = $4, salt = $5, config_version = $6, environments = $7
+		WHERE key = $1 AND project_id = $8`
+	if _, err := tx.Exec(ctx, updateQuery, flagValues(&flag)...); err != nil {
+		return nil, fmt.Errorf("failed to update flag: %w", err)
+	}
+	if err := insertFlagUpsertEvent(ctx, tx, &flag); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit flag modification: %w", err)
+	}
+	return &flag, nil
+}
+
+// DeleteFlag удаляет флаг проекта и записывает событие в outbox в одной транзакции.
+func (r *Repository) DeleteFlag(ctx context.Context, project, key string) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `DELETE FROM flags WHERE project_id = $1 AND key = $2`, project, key)
+	if err != nil {
+		return fmt.Errorf("failed to execute delete on flag: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("flag with key %s not found", key)
+	}
+
+	payload, err := json.Marshal(ab_types.FlagDeletePayload{Key: key})
+	if err != nil {
+		return fmt.Errorf("failed to marshal flag delete payload: %w", err)
+	}
+	if err := insertOutboxEvent(ctx, tx, project, ab_types.FlagAggregateID(key), "", ab_types.EventFlagDelete, payload); err != nil {
+		return fmt.Errorf("failed to insert flag delete event into outbox: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+// insertFlagUpsertEvent записывает полное состояние флага в outbox.
+func insertFlagUpsertEvent(ctx context.Context, tx pgx.Tx, flag *ab_types.Flag) error {
+	payload, err := json.Marshal(flag)
+	if err != nil {
+		return fmt.Errorf("failed to marshal flag payload: %w", err)
+	}
+	if err := insertOutboxEvent(ctx, tx, flag.ProjectOrDefault(), ab_types.FlagAggregateID(flag.Key), "", ab_types.EventFlagUpsert, payload); err != nil {
+		return fmt.Errorf("failed to insert flag event into outbox: %w", err)
+	}
+	return nil
+}
+
+// querier - общий интерфейс пула и транзакции для чтения флагов и сегментов.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// queryFlags выполняет запрос, возвращающий колонки flagColumns.
+func queryFlags(ctx context.Context, q querier, query string, args ...any) ([]ab_types.Flag, error) {
+	rows, err := q.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query flags: %w", err)
+	}
+	defer rows.Close()
+
+	var flags []ab_types.Flag
+	for rows.Next() {
+		var flag ab_types.Flag
+		if err := rows.Scan(flagScanTargets(&flag)...); err != nil {
+			return nil, fmt.Errorf("failed to scan flag row: %w", err)
+		}
+		flags = append(flags, flag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over flags: %w", err)
+	}
+	return flags, nil
+}
+
+// flagValues возвращает значения полей флага в порядке flagColumns.
+func flagValues(flag *ab_types.Flag) []any {
+	return []any{flag.Key, flag.Description, flag.Default, flag.BucketBy, flag.Salt, flag.ConfigVersion, flag.Environments, flag.ProjectOrDefault()}
+}
+
+// flagScanTargets возвращает указатели на поля флага в порядке flagColumns.
+func flagScanTargets(flag *ab_types.Flag) []any {
+	return []any{&flag.Key, &flag.Description, &flag.Default, &flag.BucketBy, &flag.Salt, &flag.ConfigVersion, &flag.Environments, &flag.ProjectID}
+}
@@ -0,0 +1,138 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+	"github.com/jackc/pgx/v5"
+)
+
+// PromoteExperiment переносит конфигурацию эксперимента sourceID в окружение targetEnv.
+// Если эксперимент уже переносился в это окружение и его копия существует, она обновляется;
+// иначе создается новый эксперимент. build получает источник и текущую копию (nil, если ее нет)
+// и возвращает итоговый эксперимент. Изменение, событие outbox и запись истории
+// сохраняются в одной транзакции.
+func (r *Repository) PromoteExperiment(ctx context.Context, sourceID, targetEnv string, build func(source, target *ab_types.Experiment) (*ab_types.Experiment, error)) (*ab_types.Experiment, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var source ab_types.Experiment
+	query := `SELECT ` + experimentColumns + ` FROM experiments WHERE id = $1 FOR SHARE`
+	if err := tx.QueryRow(ctx, query, sourceID).Scan(experimentScanTargets(&source)...); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("experiment with id %s not found", sourceID)
+		}
+		return nil, fmt.Errorf("failed to lock source experiment: %w", err)
+	}
+
+	target, err := findPromotionTarget(ctx, tx, sourceID, targetEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := build(&source, target)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		err = insertExperiment(ctx, tx, result)
+	} else {
+		err = updateExperiment(ctx, tx, result)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entry := ab_types.HistoryEntry{
+		ExperimentID:       result.ID,
+		Environment:        result.EnvironmentOrDefault(),
+		Action:             ab_types.HistoryPromote,
+		SourceExperimentID: source.ID,
+		SourceEnvironment:  source.EnvironmentOrDefault(),
+		ConfigVersion:      result.ConfigVersion,
+		Experiment:         *result,
+	}
+	if err := insertHistoryEntry(ctx, tx, &entry); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit promotion: %w", err)
+	}
+	return result, nil
+}
+
+// findPromotionTarget находит и блокирует копию источника, созданную прошлым переносом
+// в окружение targetEnv. Возвращает nil, если переноса не было или копия удалена.
+func findPromotionTarget(ctx context.Context, tx pgx.Tx, sourceID, targetEnv string) (*ab_types.Experiment, error) {
+	var targetID string
+	err := tx.QueryRow(ctx, `
+		SELECT experiment_id FROM experiment_history
+		WHERE source_experiment_id = $1 AND environment = $2 AND action = $3
+		ORDER BY id DESC LIMIT 1`, sourceID, targetEnv, ab_types.HistoryPromote).Scan(&targetID)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up previous promotion: %w", err)
+	}
+
+	var target ab_types.Experiment
+	query := `SELECT ` + experimentColumns + ` FROM experiments WHERE id = $1 FOR UPDATE`
+	err = tx.QueryRow(ctx, query, targetID).Scan(experimentScanTargets(&target)...)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock promotion target: %w", err)
+	}
+	return &target, nil
+}
+
+// insertHistoryEntry записывает событие в историю экспериментов.
+func insertHistoryEntry(ctx context.Context, tx pgx.Tx, entry *ab_types.HistoryEntry) error {
+	entry.CreatedAt = time.Now().UTC()
+	err := tx.QueryRow(ctx, `
+		INSERT INTO experiment_history (experiment_id, environment, action, source_experiment_id, source_environment, config_version, experiment, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id`,
+		entry.ExperimentID, entry.Environment, entry.Action, entry.SourceExperimentID, entry.SourceEnvironment,
+		entry.ConfigVersion, entry.Experiment, entry.CreatedAt).Scan(&entry.ID)
+	if err != nil {
+		return fmt.Errorf("failed to insert history entry: %w", err)
+	}
+	return nil
+}
+
+// FindExperimentHistory возвращает записи истории, в которых эксперимент был изменен
+// или служил источником переноса, от старых к новым.
+func (r *Repository) FindExperimentHistory(ctx context.Context, experimentID string) ([]ab_types.HistoryEntry, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, experiment_id, environment, action, source_experiment_id, source_environment, config_version, experiment, created_at
+		FROM experiment_history
+		WHERE experiment_id = $1 OR source_experiment_id = $1
+		ORDER BY id`, experimentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query experiment history: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []ab_types.HistoryEntry
+	for rows.Next() {
+		var entry ab_types.HistoryEntry
+		if err := rows.Scan(&entry.ID, &entry.ExperimentID, &entry.Environment, &entry.Action, &entry.SourceExperimentID,
+			&entry.SourceEnvironment, &entry.ConfigVersion, &entry.Experiment, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan history entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over experiment history: %w", err)
+	}
+	return entries, nil
+}
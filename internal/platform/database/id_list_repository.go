@@ -0,0 +1,213 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+	"github.com/jackc/pgx/v5"
+)
+
+const idListColumns = `id, name, description, size, checksum, object_key, config_version, created_at, updated_at, project_id`
+
+// CreateIDList сохраняет метаданные нового списка идентификаторов и событие в outbox.
+func (r *Repository) CreateIDList(ctx context.Context, list *ab_types.IDList) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `INSERT INTO id_lists (` + idListColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) ON CONFLICT (project_id, id) DO NOTHING`
+	tag, err := tx.Exec(ctx, query, idListValues(list)...)
+	if err != nil {
+		return fmt.Errorf("failed to insert id list: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("id list with id %s already exists", list.ID)
+	}
+
+	if err := insertIDListUpsertEvent(ctx, tx, list); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// FindIDList находит метаданные списка идентификаторов проекта.
+func (r *Repository) FindIDList(ctx context.Context, project, id string) (*ab_types.IDList, error) {
+	var list ab_types.IDList
+	query := `SELECT ` + idListColumns + ` FROM id_lists WHERE project_id = $1 AND id = $2`
+	if err := r.pool.QueryRow(ctx, query, project, id).Scan(idListScanTargets(&list)...); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("id list with id %s not found", id)
+		}
+		return nil, fmt.Errorf("failed to find id list: %w", err)
+	}
+	return &list, nil
+}
+
+// FindAllIDLists возвращает метаданные всех списков идентификаторов проекта.
+func (r *Repository) FindAllIDLists(ctx context.Context, project string) ([]ab_types.IDList, error) {
+	return queryIDLists(ctx, r.pool, `SELECT `+idListColumns+` FROM id_lists WHERE project_id = $1 ORDER BY id`, project)
+}
+
+// ModifyIDList читает метаданные списка с блокировкой строки, применяет к ним modify
+// и, если modify сообщил об изменении, сохраняет результат вместе с событием в outbox.
+func (r *Repository) ModifyIDList(ctx context.Context, project, id string, modify func(list *ab_types.IDList) (bool, error)) (*ab_types.IDList, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var list ab_types.IDList
+	query := `SELECT ` + idListColumns + ` FROM id_lists WHERE project_id = $1 AND id = $2 FOR UPDATE`
+	if err := tx.QueryRow(ctx, query, project, id).Scan(idListScanTargets(&list)...); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("id list with id %s not found", id)
+		}
+		return nil, fmt.Errorf("failed to lock id list: %w", err)
+	}
+
+	changed, err := modify(&list)
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		return &list, nil
+	}
+
+	updateQuery := `
+		UPDATE id_lists
+		SET name = $2, description = $3, size = $4, checksum = $5, object_key = $6, config_version = $7, updated_at = $9
+		WHERE id = $1 AND project_id = $10`
+	if _, err := tx.Exec(ctx, updateQuery, idListValues(&list)...); err != nil {
+		return nil, fmt.Errorf("failed to update id list: %w", err)
+	}
+	if err := insertIDListUpsertEvent(ctx, tx, &list); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit id list modification: %w", err)
+	}
+	return &list, nil
+}
+
+// DeleteIDList удаляет метаданные списка и записывает событие в outbox. Список, на который
+// ссылаются правила или оверрайды экспериментов, флаги или сегменты проекта, не удаляется.
+func (r *Repository) DeleteIDList(ctx context.Context, project, id string) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var locked string
+	err = tx.QueryRow(ctx, `SELECT id FROM id_lists WHERE project_id = $1 AND id = $2 FOR UPDATE`, project, id).Scan(&locked)
+	if err == pgx.ErrNoRows {
+		return fmt.Errorf("id list with id %s not found", id)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock id list: %w", err)
+	}
+
+	users, err := idListUsers(ctx, tx, project, id)
+	if err != nil {
+		return err
+	}
+	if len(users) > 0 {
+		return fmt.Errorf("id list %s is referenced by %s", id, strings.Join(users, ", "))
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM id_lists WHERE project_id = $1 AND id = $2`, project, id); err != nil {
+		return fmt.Errorf("failed to execute delete on id list: %w", err)
+	}
+
+	payload, err := json.Marshal(ab_types.IDListDeletePayload{ID: id})
+	if err != nil {
+		return fmt.Errorf("failed to marshal id list delete payload: %w", err)
+	}
+	if err := insertOutboxEvent(ctx, tx, project, ab_types.IDListAggregateID(id), "", ab_types.EventIDListDelete, payload); err != nil {
+		return fmt.Errorf("failed to insert id list delete event into outbox: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+// idListUsers возвращает эксперименты, флаги и сегменты проекта, ссылающиеся на список id.
+func idListUsers(ctx context.Context, tx pgx.Tx, project, id string) ([]string, error) {
+	config, err := loadProjectRules(ctx, tx, project)
+	if err != nil {
+		return nil, err
+	}
+
+	references := func(rules []ab_types.TargetingRule) bool {
+		ids, _ := ab_types.ReferencedIDLists(rules)
+		return slices.Contains(ids, id)
+	}
+	var users []string
+	for _, exp := range config.experiments {
+		if exp.ReferencesIDList(id) {
+			users = append(users, "experiment "+exp.ID)
+		}
+	}
+	for _, flag := range config.flags {
+		if references(flag.TargetingRules()) {
+			users = append(users, "flag "+flag.Key)
+		}
+	}
+	for _, segment := range config.segments {
+		if references(segment.Rules) {
+			users = append(users, "segment "+segment.Key)
+		}
+	}
+	return users, nil
+}
+
+// insertIDListUpsertEvent записывает метаданные списка в outbox.
+func insertIDListUpsertEvent(ctx context.Context, tx pgx.Tx, list *ab_types.IDList) error {
+	payload, err := json.Marshal(list)
+	if err != nil {
+		return fmt.Errorf("failed to marshal id list payload: %w", err)
+	}
+	if err := insertOutboxEvent(ctx, tx, list.ProjectOrDefault(), ab_types.IDListAggregateID(list.ID), "", ab_types.EventIDListUpsert, payload); err != nil {
+		return fmt.Errorf("failed to insert id list event into outbox: %w", err)
+	}
+	return nil
+}
+
+// queryIDLists выполняет запрос, возвращающий колонки idListColumns.
+func queryIDLists(ctx context.Context, q querier, query string, args ...any) ([]ab_types.IDList, error) {
+	rows, err := q.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query id lists: %w", err)
+	}
+	defer rows.Close()
+
+	var lists []ab_types.IDList
+	for rows.Next() {
+		var list ab_types.IDList
+		if err := rows.Scan(idListScanTargets(&list)...); err != nil {
+			return nil, fmt.Errorf("failed to scan id list row: %w", err)
+		}
+		lists = append(lists, list)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over id lists: %w", err)
+	}
+	return lists, nil
+}
+
+// idListValues возвращает значения полей списка в порядке idListColumns.
+func idListValues(list *ab_types.IDList) []any {
+	return []any{list.ID, list.Name, list.Description, list.Size, list.Checksum, list.ObjectKey,
+		list.ConfigVersion, list.CreatedAt, list.UpdatedAt, list.ProjectOrDefault()}
+}
+
+// idListScanTargets возвращает указатели на поля списка в порядке idListColumns.
+func idListScanTargets(list *ab_types.IDList) []any {
+	return []any{&list.ID, &list.Name, &list.Description, &list.Size, &list.Checksum, &list.ObjectKey,
+		&list.ConfigVersion, &list.CreatedAt, &list.UpdatedAt, &list.ProjectID}
+}
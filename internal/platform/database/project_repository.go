@@ -0,0 +1,107 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+	"github.com/jackc/pgx/v5"
+)
+
+// CreateProject сохраняет новый проект вместе с его счетчиком изменений.
+func (r *Repository) CreateProject(ctx context.Context, project *ab_types.Project) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `INSERT INTO projects (id, name, created_at) VALUES ($1, $2, $3) ON CONFLICT (id) DO NOTHING`
+	tag, err := tx.Exec(ctx, query, project.ID, project.Name, project.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert project: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("project with id %s already exists", project.ID)
+	}
+
+	if _, err := tx.Exec(ctx, `INSERT INTO config_state (project_id, seq) VALUES ($1, 0) ON CONFLICT (project_id) DO NOTHING`, project.ID); err != nil {
+		return fmt.Errorf("failed to initialize project config sequence: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+// FindAllProjects возвращает все проекты, упорядоченные по ID.
+func (r *Repository) FindAllProjects(ctx context.Context) ([]ab_types.Project, error) {
+	rows, err := r.pool.Query(ctx, `SELECT id, name, created_at FROM projects ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query projects: %w", err)
+	}
+	projects, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (ab_types.Project, error) {
+		var project ab_types.Project
+		err := row.Scan(&project.ID, &project.Name, &project.CreatedAt)
+		return project, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error iterating over projects: %w", err)
+	}
+	return projects, nil
+}
+
+// CreateAPIKey сохраняет ключ проекта key.ProjectID. Хранится только keyHash.
+func (r *Repository) CreateAPIKey(ctx context.Context, key *ab_types.APIKey, keyHash string) error {
+	query := `
+		INSERT INTO api_keys (id, project_id, name, key_hash, created_at)
+		SELECT $1, id, $3, $4, $5 FROM projects WHERE id = $2`
+	tag, err := r.pool.Exec(ctx, query, key.ID, key.ProjectID, key.Name, keyHash, key.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert api key: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("project with id %s not found", key.ProjectID)
+	}
+	return nil
+}
+
+// FindAPIKeys возвращает ключи проекта (без открытых значений).
+func (r *Repository) FindAPIKeys(ctx context.Context, projectID string) ([]ab_types.APIKey, error) {
+	query := `SELECT id, project_id, name, created_at FROM api_keys WHERE project_id = $1 ORDER BY created_at`
+	rows, err := r.pool.Query(ctx, query, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query api keys: %w", err)
+	}
+	keys, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (ab_types.APIKey, error) {
+		var key ab_types.APIKey
+		err := row.Scan(&key.ID, &key.ProjectID, &key.Name, &key.CreatedAt)
+		return key, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error iterating over api keys: %w", err)
+	}
+	return keys, nil
+}
+
+// DeleteAPIKey отзывает ключ проекта.
+func (r *Repository) DeleteAPIKey(ctx context.Context, projectID, id string) error {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM api_keys WHERE project_id = $1 AND id = $2`, projectID, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete api key: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("api key %s not found", id)
+	}
+	return nil
+}
+
+// FindProjectByAPIKey возвращает проект ключа по его хешу.
+func (r *Repository) FindProjectByAPIKey(ctx context.Context, keyHash string) (string, error) {
+	var projectID string
+	err := r.pool.QueryRow(ctx, `SELECT project_id FROM api_keys WHERE key_hash = $1`, keyHash).Scan(&projectID)
+	if err == pgx.ErrNoRows {
+		return "", fmt.Errorf("api key not found")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to find api key: %w", err)
+	}
+	return projectID, nil
+}
@@ -12,6 +12,8 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+const experimentColumns = `id, layer_id, config_version, end_time, salt, status, targeting_rules, override_lists, variants, parameter_schema, sticky, bucket_by, bucket_resolution, bucketing_version, ramp, environment, project_id`
+
 type Repository struct {
 	pool *pgxpool.Pool
 }
@@ -22,34 +24,14 @@ func NewRepository(p *pgxpool.Pool) *Repository {
 
 // CreateExperiment сохраняет новый эксперимент и событие в outbox в одной транзакции.
 func (r *Repository) CreateExperiment(exp *ab_types.Experiment) error {
-	fullPayload, err := json.Marshal(exp)
-	if err != nil {
-		return fmt.Errorf("failed to marshal full experiment payload: %w", err)
-	}
-
 	tx, err := r.pool.Begin(context.Background())
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback(context.Background())
 
-	expQuery := `
-		INSERT INTO experiments (id, layer_id, config_version, end_time, salt, status, targeting_rules, override_lists, variants)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
-	_, err = tx.Exec(context.Background(), expQuery,
-		exp.ID, exp.LayerID, exp.ConfigVersion, exp.EndTime, exp.Salt, exp.Status,
-		exp.TargetingRules, exp.OverrideLists, exp.Variants)
-	if err != nil {
-		return fmt.Errorf("failed to insert experiment: %w", err)
-	}
-
-	outboxQuery := `
-		INSERT INTO outbox (event_id, aggregate_id, event_type, payload, created_at, processing_state)
-		VALUES ($1, $2, $3, $4, $5, 'PENDING')`
-	_, err = tx.Exec(context.Background(), outboxQuery,
-		uuid.New(), exp.ID, "UPSERT", fullPayload, time.Now().UTC())
-	if err != nil {
-		return fmt.Errorf("failed to insert outbox event: %w", err)
+	if err := insertExperiment(context.Background(), tx, exp); err != nil {
+		return err
 	}
 
 	return tx.Commit(context.Background())
@@ -59,13 +41,9 @@ func (r *Repository) CreateExperiment(exp *ab_types.Experiment) error {
 func (r *Repository) FindExperimentByID(id string) (*ab_types.Experiment, error) {
 	var exp ab_types.Experiment
 
-	query := `
-		SELECT id, layer_id, config_version, end_time, salt, status, targeting_rules, override_lists, variants
-		FROM experiments WHERE id = $1 LIMIT 1`
+	query := `SELECT ` + experimentColumns + ` FROM experiments WHERE id = $1 LIMIT 1`
 
-	err := r.pool.QueryRow(context.Background(), query, id).Scan(
-		&exp.ID, &exp.LayerID, &exp.ConfigVersion, &exp.EndTime, &exp.Salt, &exp.Status,
-		&exp.TargetingRules, &exp.OverrideLists, &exp.Variants)
+	err := r.pool.QueryRow(context.Background(), query, id).Scan(experimentScanTargets(&exp)...)
 
 	if err != nil {
 		if err == pgx.ErrNoRows {
@@ -77,104 +55,274 @@ func (r *Repository) FindExperimentByID(id string) (*ab_types.Experiment, error)
 	return &exp, nil
 }
 
-// FindAllActiveExperiments находит все активные эксперименты.
-func (r *Repository) FindAllActiveExperiments() ([]ab_types.Experiment, error) {
-	var experiments []ab_types.Experiment
-	query := `
-		SELECT id, layer_id, config_version, end_time, salt, status, targeting_rules, override_lists, variants
-		FROM experiments WHERE status = $1`
+// FindAllActiveExperiments находит все активные эксперименты окружения проекта.
+func (r *Repository) FindAllActiveExperiments(project, environment string) ([]ab_types.Experiment, error) {
+	query := `SELECT ` + experimentColumns + ` FROM experiments WHERE status = $1 AND project_id = $2 AND environment = $3`
 
-	rows, err := r.pool.Query(context.Background(), query, ab_types.StatusActive)
+	rows, err := r.pool.Query(context.Background(), query, ab_types.StatusActive, project, environment)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query active experiments: %w", err)
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var exp ab_types.Experiment
-		err := rows.Scan(
-			&exp.ID, &exp.LayerID, &exp.ConfigVersion, &exp.EndTime, &exp.Salt, &exp.Status,
-			&exp.TargetingRules, &exp.OverrideLists, &exp.Variants)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan experiment row: %w", err)
-		}
-		experiments = append(experiments, exp)
-	}
-
-	if err := rows.Err(); err != nil {
+	experiments, err := scanExperiments(rows)
+	if err != nil {
 		return nil, fmt.Errorf("error iterating over active experiments: %w", err)
 	}
-
 	return experiments, nil
 }
 
-// UpdateExperiment обновляет существующий эксперимент и событие в outbox в одной транзакции.
-func (r *Repository) UpdateExperiment(exp *ab_types.Experiment) error {
-	fullPayload, err := json.Marshal(exp)
+// currentSeqQuery читает номер последнего изменения проекта. Строки счетчика нет,
+// пока в проекте не было ни одного изменения.
+const currentSeqQuery = `SELECT COALESCE((SELECT seq FROM config_state WHERE project_id = $1), 0)`
+
+// CurrentSeq возвращает номер последнего изменения конфигурации проекта без выгрузки
+// самой конфигурации. Совпадает с Snapshot.Seq снэпшота, выгруженного в тот же момент.
+func (r *Repository) CurrentSeq(ctx context.Context, project string) (int64, error) {
+	var seq int64
+	if err := r.pool.QueryRow(ctx, currentSeqQuery, project).Scan(&seq); err != nil {
+		return 0, fmt.Errorf("failed to read config high-water mark: %w", err)
+	}
+	return seq, nil
+}
+
+// ExportSnapshot выгружает согласованный срез конфигурации окружения проекта: все его эксперименты
+// (в любом статусе), флаги, сегменты и метаданные списков идентификаторов проекта и номер
+// изменения проекта, которому этот срез соответствует.
+// Чтение выполняется в одной REPEATABLE READ транзакции, поэтому эксперименты и seq
+// относятся к одному и тому же моменту времени.
+func (r *Repository) ExportSnapshot(ctx context.Context, project, environment string) (*ab_types.Snapshot, error) {
+	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
 	if err != nil {
-		return fmt.Errorf("failed to marshal full experiment payload: %w", err)
+		return nil, fmt.Errorf("failed to begin snapshot transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	snapshot := &ab_types.Snapshot{SchemaVersion: ab_types.SnapshotSchemaVersion, Project: project, Environment: environment}
+	if err := tx.QueryRow(ctx, currentSeqQuery, project).Scan(&snapshot.Seq); err != nil {
+		return nil, fmt.Errorf("failed to read config high-water mark: %w", err)
 	}
 
+	rows, err := tx.Query(ctx, `SELECT `+experimentColumns+` FROM experiments WHERE project_id = $1 AND environment = $2 ORDER BY id`, project, environment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query experiments: %w", err)
+	}
+	snapshot.Experiments, err = scanExperiments(rows)
+	if err != nil {
+		return nil, fmt.Errorf("error iterating over experiments: %w", err)
+	}
+	snapshot.Flags, err = queryFlags(ctx, tx, `SELECT `+flagColumns+` FROM flags WHERE project_id = $1 ORDER BY key`, project)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.Segments, err = querySegments(ctx, tx, `SELECT `+segmentColumns+` FROM segments WHERE project_id = $1 ORDER BY key`, project)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.IDLists, err = queryIDLists(ctx, tx, `SELECT `+idListColumns+` FROM id_lists WHERE project_id = $1 ORDER BY id`, project)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit snapshot transaction: %w", err)
+	}
+	return snapshot, nil
+}
+
+// UpdateExperiment обновляет существующий эксперимент и событие в outbox в одной транзакции.
+func (r *Repository) UpdateExperiment(exp *ab_types.Experiment) error {
 	tx, err := r.pool.Begin(context.Background())
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback(context.Background())
 
-	expQuery := `
-		UPDATE experiments
-		SET layer_id = $1, config_version = $2, end_time = $3, salt = $4, status = $5,
-		    targeting_rules = $6, override_lists = $7, variants = $8
-		WHERE id = $9`
-	_, err = tx.Exec(context.Background(), expQuery,
-		exp.LayerID, exp.ConfigVersion, exp.EndTime, exp.Salt, exp.Status,
-		exp.TargetingRules, exp.OverrideLists, exp.Variants, exp.ID)
+	if err := updateExperiment(context.Background(), tx, exp); err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
+}
+
+// ModifyExperiment читает эксперимент с блокировкой строки, применяет к нему modify
+// и, если modify сообщил об изменении, сохраняет результат вместе с событием в outbox.
+// Блокировка не дает параллельным изменениям (API и планировщику раскатки) затереть друг друга.
+func (r *Repository) ModifyExperiment(ctx context.Context, id string, modify func(exp *ab_types.Experiment) (bool, error)) (*ab_types.Experiment, error) {
+	tx, err := r.pool.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to update experiment: %w", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback(ctx)
 
-	outboxQuery := `
-		INSERT INTO outbox (event_id, aggregate_id, event_type, payload, created_at, processing_state)
-		VALUES ($1, $2, $3, $4, $5, 'PENDING')`
-	_, err = tx.Exec(context.Background(), outboxQuery,
-		uuid.New(), exp.ID, "UPSERT", fullPayload, time.Now().UTC())
+	var exp ab_types.Experiment
+	query := `SELECT ` + experimentColumns + ` FROM experiments WHERE id = $1 FOR UPDATE`
+	if err := tx.QueryRow(ctx, query, id).Scan(experimentScanTargets(&exp)...); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("experiment with id %s not found", id)
+		}
+		return nil, fmt.Errorf("failed to lock experiment: %w", err)
+	}
+
+	changed, err := modify(&exp)
 	if err != nil {
-		return fmt.Errorf("failed to insert outbox event for update: %w", err)
+		return nil, err
+	}
+	if !changed {
+		return &exp, nil
 	}
 
-	return tx.Commit(context.Background())
+	if err := updateExperiment(ctx, tx, &exp); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit experiment modification: %w", err)
+	}
+	return &exp, nil
+}
+
+// FindRampingExperimentIDs возвращает ID экспериментов с активным планом раскатки.
+func (r *Repository) FindRampingExperimentIDs(ctx context.Context) ([]string, error) {
+	rows, err := r.pool.Query(ctx, `SELECT id FROM experiments WHERE ramp->>'state' = $1`, ab_types.RampActive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ramping experiments: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("error iterating over ramping experiments: %w", err)
+	}
+	return ids, nil
 }
 
-// DeleteExperiment удаляет эксперимент и записывает событие в outbox в одной транзакции.
-func (r *Repository) DeleteExperiment(id string) error {
+// DeleteExperiment удаляет эксперимент проекта и записывает событие в outbox в одной транзакции.
+// Эксперимент другого проекта не удаляется и считается ненайденным.
+func (r *Repository) DeleteExperiment(project, id string) error {
 	tx, err := r.pool.Begin(context.Background())
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback(context.Background())
 
-	tag, err := tx.Exec(context.Background(), `DELETE FROM experiments WHERE id = $1`, id)
+	var environment string
+	err = tx.QueryRow(context.Background(), `DELETE FROM experiments WHERE id = $1 AND project_id = $2 RETURNING environment`, id, project).Scan(&environment)
+	if err == pgx.ErrNoRows {
+		return fmt.Errorf("experiment not found")
+	}
 	if err != nil {
 		return fmt.Errorf("failed to execute delete on experiment: %w", err)
 	}
 
-	if tag.RowsAffected() == 0 {
-		return fmt.Errorf("experiment not found")
+	deleteEventPayload, err := json.Marshal(ab_types.DeletePayload{ID: id})
+	if err != nil {
+		return fmt.Errorf("failed to marshal delete event payload: %w", err)
 	}
 
-	deleteEventPayload, err := json.Marshal(map[string]string{"id": id})
+	if err := insertOutboxEvent(context.Background(), tx, project, id, environment, ab_types.EventDelete, deleteEventPayload); err != nil {
+		return fmt.Errorf("failed to insert delete event into outbox: %w", err)
+	}
+
+	return tx.Commit(context.Background())
+}
+
+// insertExperiment добавляет эксперимент и событие в outbox в рамках tx.
+func insertExperiment(ctx context.Context, tx pgx.Tx, exp *ab_types.Experiment) error {
+	fullPayload, err := json.Marshal(exp)
 	if err != nil {
-		return fmt.Errorf("failed to marshal delete event payload: %w", err)
+		return fmt.Errorf("failed to marshal full experiment payload: %w", err)
+	}
+
+	expQuery := `
+		INSERT INTO experiments (` + experimentColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)`
+	_, err = tx.Exec(ctx, expQuery, experimentValues(exp)...)
+	if err != nil {
+		return fmt.Errorf("failed to insert experiment: %w", err)
+	}
+
+	return insertOutboxEvent(ctx, tx, exp.ProjectOrDefault(), exp.ID, exp.EnvironmentOrDefault(), ab_types.EventUpsert, fullPayload)
+}
+
+// updateExperiment перезаписывает эксперимент и добавляет событие в outbox в рамках tx.
+func updateExperiment(ctx context.Context, tx pgx.Tx, exp *ab_types.Experiment) error {
+	fullPayload, err := json.Marshal(exp)
+	if err != nil {
+		return fmt.Errorf("failed to marshal full experiment payload: %w", err)
+	}
+
+	expQuery := `
+		UPDATE experiments
+		SET layer_id = $2, config_version = $3, end_time = $4, salt = $5, status = $6,
+		    targeting_rules = $7, override_lists = $8, variants = $9, parameter_schema = $10, sticky = $11, bucket_by = $12, bucket_resolution = $13, bucketing_version = $14, ramp = $15, environment = $16, project_id = $17
+		WHERE id = $1`
+	tag, err := tx.Exec(ctx, expQuery, experimentValues(exp)...)
+	if err != nil {
+		return fmt.Errorf("failed to update experiment: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("experiment with id %s not found", exp.ID)
+	}
+
+	if err := insertOutboxEvent(ctx, tx, exp.ProjectOrDefault(), exp.ID, exp.EnvironmentOrDefault(), ab_types.EventUpsert, fullPayload); err != nil {
+		return fmt.Errorf("failed to insert outbox event for update: %w", err)
+	}
+	return nil
+}
+
+// insertOutboxEvent увеличивает счетчик изменений проекта и записывает событие в outbox
+// с полученным номером. Блокировка строки config_state сериализует пишущие транзакции проекта,
+// поэтому номера его событий идут в порядке коммитов и без пропусков.
+// environment - окружение изменения; пусто для событий, относящихся ко всем окружениям.
+func insertOutboxEvent(ctx context.Context, tx pgx.Tx, project, aggregateID, environment, eventType string, payload []byte) error {
+	var seq int64
+	seqQuery := `
+		INSERT INTO config_state (project_id, seq) VALUES ($1, 1)
+		ON CONFLICT (project_id) DO UPDATE SET seq = config_state.seq + 1
+		RETURNING seq`
+	if err := tx.QueryRow(ctx, seqQuery, project).Scan(&seq); err != nil {
+		return fmt.Errorf("failed to advance config sequence: %w", err)
 	}
 
 	outboxQuery := `
-		INSERT INTO outbox (event_id, aggregate_id, event_type, payload, created_at, processing_state)
-		VALUES ($1, $2, $3, $4, $5, 'PENDING')`
-	_, err = tx.Exec(context.Background(), outboxQuery,
-		uuid.New(), id, "DELETE", deleteEventPayload, time.Now().UTC())
+		INSERT INTO outbox (event_id, aggregate_id, event_type, payload, created_at, processing_state, seq, environment, project_id)
+		VALUES ($1, $2, $3, $4, $5, 'PENDING', $6, $7, $8)`
+	_, err := tx.Exec(ctx, outboxQuery,
+		uuid.New(), aggregateID, eventType, payload, time.Now().UTC(), seq, environment, project)
 	if err != nil {
-		return fmt.Errorf("failed to insert delete event into outbox: %w", err)
+		return fmt.Errorf("failed to insert outbox event: %w", err)
 	}
+	return nil
+}
 
-	return tx.Commit(context.Background())
+// scanExperiments читает строки с колонками experimentColumns и закрывает rows.
+func scanExperiments(rows pgx.Rows) ([]ab_types.Experiment, error) {
+	defer rows.Close()
+
+	var experiments []ab_types.Experiment
+	for rows.Next() {
+		var exp ab_types.Experiment
+		if err := rows.Scan(experimentScanTargets(&exp)...); err != nil {
+			return nil, fmt.Errorf("failed to scan experiment row: %w", err)
+		}
+		experiments = append(experiments, exp)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return experiments, nil
+}
+
+// experimentValues возвращает значения полей эксперимента в порядке experimentColumns.
+func experimentValues(exp *ab_types.Experiment) []any {
+	return []any{
+		exp.ID, exp.LayerID, exp.ConfigVersion, exp.EndTime, exp.Salt, exp.Status,
+		exp.TargetingRules, exp.OverrideLists, exp.Variants, exp.ParameterSchema, exp.Sticky, exp.BucketBy, exp.BucketResolution, exp.BucketingVersion, exp.Ramp, exp.EnvironmentOrDefault(), exp.ProjectOrDefault(),
+	}
+}
+
+// experimentScanTargets возвращает указатели на поля эксперимента в порядке experimentColumns.
+func experimentScanTargets(exp *ab_types.Experiment) []any {
+	return []any{
+		&exp.ID, &exp.LayerID, &exp.ConfigVersion, &exp.EndTime, &exp.Salt, &exp.Status,
+		&exp.TargetingRules, &exp.OverrideLists, &exp.Variants, &exp.ParameterSchema, &exp.Sticky, &exp.BucketBy, &exp.BucketResolution, &exp.BucketingVersion, &exp.Ramp, &exp.Environment, &exp.ProjectID,
+	}
 }
@@ -0,0 +1,271 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+	"github.com/jackc/pgx/v5"
+)
+
+const segmentColumns = `key, description, rules, version, config_version, project_id`
+
+// CreateSegment сохраняет новый сегмент проекта (версия 1), его первую версию
+// и событие в outbox в одной транзакции.
+func (r *Repository) CreateSegment(ctx context.Context, segment *ab_types.Segment) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	segment.Version = 1
+	query := `INSERT INTO segments (` + segmentColumns + `) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (project_id, key) DO NOTHING`
+	tag, err := tx.Exec(ctx, query, segmentValues(segment)...)
+	if err != nil {
+		return fmt.Errorf("failed to insert segment: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("segment with key %s already exists", segment.Key)
+	}
+
+	if err := insertSegmentVersion(ctx, tx, segment); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// FindSegmentByKey находит сегмент проекта по ключу.
+func (r *Repository) FindSegmentByKey(ctx context.Context, project, key string) (*ab_types.Segment, error) {
+	var segment ab_types.Segment
+	query := `SELECT ` + segmentColumns + ` FROM segments WHERE project_id = $1 AND key = $2`
+	if err := r.pool.QueryRow(ctx, query, project, key).Scan(segmentScanTargets(&segment)...); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("segment with key %s not found", key)
+		}
+		return nil, fmt.Errorf("failed to find segment: %w", err)
+	}
+	return &segment, nil
+}
+
+// FindAllSegments возвращает все сегменты проекта, упорядоченные по ключу.
+func (r *Repository) FindAllSegments(ctx context.Context, project string) ([]ab_types.Segment, error) {
+	return querySegments(ctx, r.pool, `SELECT `+segmentColumns+` FROM segments WHERE project_id = $1 ORDER BY key`, project)
+}
+
+// ModifySegment читает сегмент с блокировкой строки, применяет к нему modify и, если modify
+// сообщил об изменении, сохраняет результат как следующую версию вместе с событием в outbox.
+func (r *Repository) ModifySegment(ctx context.Context, project, key string, modify func(segment *ab_types.Segment) (bool, error)) (*ab_types.Segment, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var segment ab_types.Segment
+	query := `SELECT ` + segmentColumns + ` FROM segments WHERE project_id = $1 AND key = $2 FOR UPDATE`
+	if err := tx.QueryRow(ctx, query, project, key).Scan(segmentScanTargets(&segment)...); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("segment with key %s not found", key)
+		}
+		return nil, fmt.Errorf("failed to lock segment: %w", err)
+	}
+
+	changed, err := modify(&segment)
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		return &segment, nil
+	}
+	segment.Version++
+
+	updateQuery := `
+		UPDATE segments
+		SET description = $2, rules = $3, version = $4, config_version = $5
+		WHERE key = $1 AND project_id = $6`
+	if _, err := tx.Exec(ctx, updateQuery, segmentValues(&segment)...); err != nil {
+		return nil, fmt.Errorf("failed to update segment: %w", err)
+	}
+	if err := insertSegmentVersion(ctx, tx, &segment); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit segment modification: %w", err)
+	}
+	return &segment, nil
+}
+
+// DeleteSegment удаляет сегмент проекта вместе с его версиями и записывает событие в outbox.
+// Сегмент, на который ссылаются правила экспериментов или флагов проекта, не удаляется.
+func (r *Repository) DeleteSegment(ctx context.Context, project, key string) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var locked string
+	err = tx.QueryRow(ctx, `SELECT key FROM segments WHERE project_id = $1 AND key = $2 FOR UPDATE`, project, key).Scan(&locked)
+	if err == pgx.ErrNoRows {
+		return fmt.Errorf("segment with key %s not found", key)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock segment: %w", err)
+	}
+
+	users, err := segmentUsers(ctx, tx, project, key)
+	if err != nil {
+		return err
+	}
+	if len(users) > 0 {
+		return fmt.Errorf("segment %s is referenced by %s", key, strings.Join(users, ", "))
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM segments WHERE project_id = $1 AND key = $2`, project, key); err != nil {
+		return fmt.Errorf("failed to execute delete on segment: %w", err)
+	}
+
+	payload, err := json.Marshal(ab_types.SegmentDeletePayload{Key: key})
+	if err != nil {
+		return fmt.Errorf("failed to marshal segment delete payload: %w", err)
+	}
+	if err := insertOutboxEvent(ctx, tx, project, ab_types.SegmentAggregateID(key), "", ab_types.EventSegmentDelete, payload); err != nil {
+		return fmt.Errorf("failed to insert segment delete event into outbox: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+// FindSegmentVersions возвращает все версии сегмента проекта, от старых к новым.
+func (r *Repository) FindSegmentVersions(ctx context.Context, project, key string) ([]ab_types.SegmentVersion, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT version, description, rules, config_version, created_at
+		FROM segment_versions
+		WHERE project_id = $1 AND key = $2
+		ORDER BY version`, project, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query segment versions: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []ab_types.SegmentVersion
+	for rows.Next() {
+		var v ab_types.SegmentVersion
+		if err := rows.Scan(&v.Version, &v.Description, &v.Rules, &v.ConfigVersion, &v.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan segment version: %w", err)
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over segment versions: %w", err)
+	}
+	return versions, nil
+}
+
+// segmentUsers возвращает эксперименты ("experiment <id>") и флаги ("flag <key>") проекта,
+// правила которых ссылаются на сегмент key.
+func segmentUsers(ctx context.Context, tx pgx.Tx, project, key string) ([]string, error) {
+	config, err := loadProjectRules(ctx, tx, project)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []string
+	for _, exp := range config.experiments {
+		if ab_types.ReferencesSegment(exp.TargetingRules, key) {
+			users = append(users, "experiment "+exp.ID)
+		}
+	}
+	for _, flag := range config.flags {
+		if ab_types.ReferencesSegment(flag.TargetingRules(), key) {
+			users = append(users, "flag "+flag.Key)
+		}
+	}
+	return users, nil
+}
+
+// projectRules - конфигурация проекта, правила которой могут ссылаться на сегменты и списки.
+type projectRules struct {
+	experiments []ab_types.Experiment
+	flags       []ab_types.Flag
+	segments    []ab_types.Segment
+}
+
+// loadProjectRules читает все эксперименты, флаги и сегменты проекта в рамках tx.
+func loadProjectRules(ctx context.Context, tx pgx.Tx, project string) (*projectRules, error) {
+	rows, err := tx.Query(ctx, `SELECT `+experimentColumns+` FROM experiments WHERE project_id = $1 ORDER BY id`, project)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query experiments: %w", err)
+	}
+	var config projectRules
+	config.experiments, err = scanExperiments(rows)
+	if err != nil {
+		return nil, fmt.Errorf("error iterating over experiments: %w", err)
+	}
+	config.flags, err = queryFlags(ctx, tx, `SELECT `+flagColumns+` FROM flags WHERE project_id = $1 ORDER BY key`, project)
+	if err != nil {
+		return nil, err
+	}
+	config.segments, err = querySegments(ctx, tx, `SELECT `+segmentColumns+` FROM segments WHERE project_id = $1 ORDER BY key`, project)
+	if err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// insertSegmentVersion сохраняет текущее состояние сегмента как версию
+// и записывает его в outbox.
+func insertSegmentVersion(ctx context.Context, tx pgx.Tx, segment *ab_types.Segment) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO segment_versions (project_id, key, version, description, rules, config_version, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		segment.ProjectOrDefault(), segment.Key, segment.Version, segment.Description, segment.Rules,
+		segment.ConfigVersion, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to insert segment version: %w", err)
+	}
+
+	payload, err := json.Marshal(segment)
+	if err != nil {
+		return fmt.Errorf("failed to marshal segment payload: %w", err)
+	}
+	if err := insertOutboxEvent(ctx, tx, segment.ProjectOrDefault(), ab_types.SegmentAggregateID(segment.Key), "", ab_types.EventSegmentUpsert, payload); err != nil {
+		return fmt.Errorf("failed to insert segment event into outbox: %w", err)
+	}
+	return nil
+}
+
+// querySegments выполняет запрос, возвращающий колонки segmentColumns.
+func querySegments(ctx context.Context, q querier, query string, args ...any) ([]ab_types.Segment, error) {
+	rows, err := q.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query segments: %w", err)
+	}
+	defer rows.Close()
+
+	var segments []ab_types.Segment
+	for rows.Next() {
+		var segment ab_types.Segment
+		if err := rows.Scan(segmentScanTargets(&segment)...); err != nil {
+			return nil, fmt.Errorf("failed to scan segment row: %w", err)
+		}
+		segments = append(segments, segment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over segments: %w", err)
+	}
+	return segments, nil
+}
+
+// segmentValues возвращает значения полей сегмента в порядке segmentColumns.
+func segmentValues(segment *ab_types.Segment) []any {
+	return []any{segment.Key, segment.Description, segment.Rules, segment.Version, segment.ConfigVersion, segment.ProjectOrDefault()}
+}
+
+// segmentScanTargets возвращает указатели на поля сегмента в порядке segmentColumns.
+func segmentScanTargets(segment *ab_types.Segment) []any {
+	return []any{&segment.Key, &segment.Description, &segment.Rules, &segment.Version, &segment.ConfigVersion, &segment.ProjectID}
+}
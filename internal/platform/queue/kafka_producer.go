@@ -20,10 +20,19 @@ func NewProducer(brokers []string, topic string) *Producer {
 	return &Producer{writer: w}
 }
 
-func (p *Producer) Publish(ctx context.Context, key, value []byte) error {
+// NewAutoCreateProducer создает продюсер, который создает топик при первой записи, если его нет.
+// Используется для топиков, появляющихся во время работы (например, топиков дельт новых проектов).
+func NewAutoCreateProducer(brokers []string, topic string) *Producer {
+	producer := NewProducer(brokers, topic)
+	producer.writer.AllowAutoTopicCreation = true
+	return producer
+}
+
+func (p *Producer) Publish(ctx context.Context, key, value []byte, headers ...kafka.Header) error {
 	err := p.writer.WriteMessages(ctx, kafka.Message{
-		Key:   key,
-		Value: value,
+		Key:     key,
+		Value:   value,
+		Headers: headers,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to write kafka message: %w", err)
@@ -31,6 +40,14 @@ func (p *Producer) Publish(ctx context.Context, key, value []byte) error {
 	return nil
 }
 
+// PublishBatch записывает несколько сообщений одним вызовом.
+func (p *Producer) PublishBatch(ctx context.Context, messages ...kafka.Message) error {
+	if err := p.writer.WriteMessages(ctx, messages...); err != nil {
+		return fmt.Errorf("failed to write kafka batch of %d messages: %w", len(messages), err)
+	}
+	return nil
+}
+
 func (p *Producer) Close() error {
 	return p.writer.Close()
 }
@@ -1,7 +1,9 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 
@@ -33,3 +35,87 @@ func (c *MinIOClient) Upload(ctx context.Context, bucketName, objectName, conten
 	}
 	return info, nil
 }
+
+// List возвращает все объекты бакета с заданным префиксом.
+func (c *MinIOClient) List(ctx context.Context, bucketName, prefix string) ([]minio.ObjectInfo, error) {
+	var objects []minio.ObjectInfo
+	for object := range c.client.ListObjects(ctx, bucketName, minio.ListObjectsOptions{Prefix: prefix}) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", object.Err)
+		}
+		objects = append(objects, object)
+	}
+	return objects, nil
+}
+
+// Delete удаляет объект из бакета.
+func (c *MinIOClient) Delete(ctx context.Context, bucketName, objectName string) error {
+	if err := c.client.RemoveObject(ctx, bucketName, objectName, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to delete object %s: %w", objectName, err)
+	}
+	return nil
+}
+
+// Download читает объект целиком.
+func (c *MinIOClient) Download(ctx context.Context, bucketName, objectName string) ([]byte, error) {
+	obj, err := c.client.GetObject(ctx, bucketName, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object %s: %w", objectName, err)
+	}
+	defer obj.Close()
+
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object %s: %w", objectName, err)
+	}
+	return data, nil
+}
+
+// UpdatePointer перезаписывает небольшой JSON-объект, указывающий на актуальные данные
+// (например, latest.json для снэпшотов).
+func (c *MinIOClient) UpdatePointer(ctx context.Context, bucketName, pointerName string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pointer %s: %w", pointerName, err)
+	}
+	if _, err := c.Upload(ctx, bucketName, pointerName, "application/json", bytes.NewReader(data), int64(len(data))); err != nil {
+		return fmt.Errorf("failed to update pointer %s: %w", pointerName, err)
+	}
+	return nil
+}
+
+// BucketStore - объекты одного бакета (например, содержимое списков идентификаторов).
+type BucketStore struct {
+	client *MinIOClient
+	bucket string
+}
+
+// NewBucketStore создает хранилище объектов бакета bucket.
+func NewBucketStore(client *MinIOClient, bucket string) *BucketStore {
+	return &BucketStore{client: client, bucket: bucket}
+}
+
+// Put записывает объект целиком.
+func (s *BucketStore) Put(ctx context.Context, objectName, contentType string, data []byte) error {
+	_, err := s.client.Upload(ctx, s.bucket, objectName, contentType, bytes.NewReader(data), int64(len(data)))
+	return err
+}
+
+// Get читает объект целиком.
+func (s *BucketStore) Get(ctx context.Context, objectName string) ([]byte, error) {
+	return s.client.Download(ctx, s.bucket, objectName)
+}
+
+// DeletePrefix удаляет все объекты с префиксом prefix.
+func (s *BucketStore) DeletePrefix(ctx context.Context, prefix string) error {
+	objects, err := s.client.List(ctx, s.bucket, prefix)
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		if err := s.client.Delete(ctx, s.bucket, object.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
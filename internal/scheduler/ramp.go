@@ -0,0 +1,98 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+var rampStepsApplied = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "ab_ramp_steps_applied_total",
+	Help: "Number of ramp steps applied by the scheduler, by result.",
+}, []string{"result"})
+
+// RampRepository - операции хранилища, нужные планировщику раскатки.
+type RampRepository interface {
+	FindRampingExperimentIDs(ctx context.Context) ([]string, error)
+	ModifyExperiment(ctx context.Context, id string, modify func(exp *ab_types.Experiment) (bool, error)) (*ab_types.Experiment, error)
+}
+
+// RampScheduler периодически применяет наступившие шаги активных планов раскатки.
+// Каждое применение проходит через outbox, поэтому SDK получают новый диапазон обычной дельтой.
+type RampScheduler struct {
+	repo     RampRepository
+	interval time.Duration
+	now      func() time.Time
+}
+
+func NewRampScheduler(repo RampRepository, interval time.Duration) *RampScheduler {
+	return &RampScheduler{repo: repo, interval: interval, now: time.Now}
+}
+
+// Run выполняет проверки с заданным периодом до отмены ctx.
+func (s *RampScheduler) Run(ctx context.Context) {
+	log.Printf("INFO: Ramp scheduler started with interval %v", s.interval)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.Tick(ctx)
+		select {
+		case <-ctx.Done():
+			log.Println("INFO: Ramp scheduler stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Tick применяет наступившие шаги всех активных планов. Ошибка одного эксперимента
+// не мешает остальным: шаг будет повторен на следующей проверке.
+func (s *RampScheduler) Tick(ctx context.Context) {
+	ids, err := s.repo.FindRampingExperimentIDs(ctx)
+	if err != nil {
+		log.Printf("ERROR: Failed to list ramping experiments: %v", err)
+		return
+	}
+	for _, id := range ids {
+		if err := s.advance(ctx, id); err != nil {
+			rampStepsApplied.WithLabelValues("error").Inc()
+			log.Printf("ERROR: Failed to advance ramp for experiment %s: %v", id, err)
+		}
+	}
+}
+
+// advance применяет шаг плана под блокировкой строки эксперимента. Состояние плана
+// перечитывается внутри транзакции, поэтому пауза или отмена через API не будут перезаписаны.
+func (s *RampScheduler) advance(ctx context.Context, id string) error {
+	applied := false
+	exp, err := s.repo.ModifyExperiment(ctx, id, func(exp *ab_types.Experiment) (bool, error) {
+		changed, err := exp.AdvanceRamp(s.now())
+		if err != nil || !changed {
+			return false, err
+		}
+		v7, err := uuid.NewV7()
+		if err != nil {
+			return false, fmt.Errorf("failed to generate config version: %w", err)
+		}
+		exp.ConfigVersion = v7.String()
+		applied = true
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	if applied {
+		rampStepsApplied.WithLabelValues("applied").Inc()
+		log.Printf("INFO: Ramp of variant %s in experiment %s advanced to step %d (%v%%), state %s",
+			exp.Ramp.Variant, id, exp.Ramp.AppliedStep, exp.Ramp.CurrentPercent(), exp.Ramp.State)
+	}
+	return nil
+}
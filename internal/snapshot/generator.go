@@ -0,0 +1,262 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/segmentio/kafka-go"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+// Repository - операции хранилища конфигурации, нужные генератору снэпшотов.
+type Repository interface {
+	ExportSnapshot(ctx context.Context, project, environment string) (*ab_types.Snapshot, error)
+	FindAllProjects(ctx context.Context) ([]ab_types.Project, error)
+}
+
+// ObjectStorage - операции с бакетом снэпшотов.
+type ObjectStorage interface {
+	Upload(ctx context.Context, bucketName, objectName, contentType string, reader io.Reader, size int64) (minio.UploadInfo, error)
+	Download(ctx context.Context, bucketName, objectName string) ([]byte, error)
+	UpdatePointer(ctx context.Context, bucketName, pointerName string, value any) error
+	List(ctx context.Context, bucketName, prefix string) ([]minio.ObjectInfo, error)
+	Delete(ctx context.Context, bucketName, objectName string) error
+}
+
+// MetaPublisher публикует метаданные загруженных снэпшотов.
+type MetaPublisher interface {
+	Publish(ctx context.Context, key, value []byte, headers ...kafka.Header) error
+}
+
+// Result описывает итог одного запуска генерации.
+type Result struct {
+	// Project - проект снэпшота.
+	Project string
+	// Environment - окружение снэпшота.
+	Environment string
+	// Version - версия снэпшота (UUIDv7 момента генерации).
+	Version string
+	// Seq - номер изменения проекта, которому соответствует снэпшот.
+	Seq int64
+	// ObjectName - имя объекта в MinIO.
+	ObjectName string
+	// Size - размер снэпшота в байтах.
+	Size int
+	// ExperimentCount - количество экспериментов в снэпшоте.
+	ExperimentCount int
+	// Skipped - true, если снэпшот не загружался, т.к. конфигурация не изменилась.
+	Skipped bool
+}
+
+// Generator формирует согласованный снэпшот экспериментов одного окружения проекта, загружает его
+// в MinIO под префиксом проекта и окружения (ab_types.SnapshotPrefix), обновляет указатель latest.json,
+// публикует метаданные в Kafka и удаляет устаревшие снэпшоты.
+type Generator struct {
+	repo        Repository
+	project     string
+	environment string
+	// prefix - префикс всех объектов проекта и окружения в бакете.
+	prefix     string
+	storage    ObjectStorage
+	producer   MetaPublisher
+	bucket     string
+	format     ab_types.SnapshotFormat
+	retention  RetentionPolicy
+	signingKey ed25519.PrivateKey
+
+	// mu сериализует генерации и защищает last.
+	mu sync.Mutex
+	// last - метаданные последнего загруженного снэпшота. Если Seq не изменился,
+	// генерация пропускается. При старте восстанавливается из latest.json.
+	last *ab_types.SnapshotMeta
+}
+
+// GeneratorConfig - параметры Generator.
+type GeneratorConfig struct {
+	Bucket string
+	// Project - проект снэпшотов (пусто означает ab_types.DefaultProject).
+	Project string
+	// Environment - окружение снэпшотов (пусто означает ab_types.DefaultEnvironment).
+	Environment string
+	// Format - формат сериализации и сжатия загружаемых снэпшотов.
+	Format    ab_types.SnapshotFormat
+	Retention RetentionPolicy
+	// SigningKey - ключ Ed25519 для подписи манифестов. Если nil, манифест не подписывается.
+	SigningKey ed25519.PrivateKey
+}
+
+func NewGenerator(repo Repository, storage ObjectStorage, producer MetaPublisher, cfg GeneratorConfig) *Generator {
+	project := cfg.Project
+	if project == "" {
+		project = ab_types.DefaultProject
+	}
+	environment := cfg.Environment
+	if environment == "" {
+		environment = ab_types.DefaultEnvironment
+	}
+	return &Generator{
+		repo:        repo,
+		project:     project,
+		environment: environment,
+		prefix:      ab_types.SnapshotPrefix(project, environment),
+		storage:     storage,
+		producer:    producer,
+		bucket:      cfg.Bucket,
+		format:      cfg.Format,
+		retention:   cfg.Retention,
+		signingKey:  cfg.SigningKey,
+	}
+}
+
+// Generate выполняет одну генерацию снэпшота.
+// Если с момента последней загрузки не было ни одного изменения (seq не вырос), а формат
+// и ключ подписи те же, снэпшот не загружается.
+func (g *Generator) Generate(ctx context.Context) (*Result, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.last == nil {
+		g.last = g.loadLatestMeta(ctx)
+	}
+
+	snapshot, err := g.repo.ExportSnapshot(ctx, g.project, g.environment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export snapshot of project %s, environment %s: %w", g.project, g.environment, err)
+	}
+
+	// Снэпшот перезагружается и без изменений конфигурации, если сменились формат или ключ
+	// подписи: иначе после включения подписи latest.json указывал бы на неподписанный манифест.
+	if g.last != nil && g.last.Seq == snapshot.Seq && g.last.Format() == g.format &&
+		g.last.SigningKeyID == ab_types.SigningKeyID(g.signingKey) {
+		log.Printf("INFO: Configuration has not changed since snapshot %s (seq %d). Skipping upload.", g.last.Path, snapshot.Seq)
+		g.runRetention(ctx, g.last.Path)
+		return &Result{
+			Project:         g.project,
+			Environment:     g.environment,
+			Version:         g.last.SnapshotVersion,
+			Seq:             snapshot.Seq,
+			ObjectName:      g.last.Path,
+			ExperimentCount: len(snapshot.Experiments),
+			Skipped:         true,
+		}, nil
+	}
+
+	version, err := uuid.NewV7()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate snapshot version: %w", err)
+	}
+	snapshot.Version = version.String()
+	snapshot.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	log.Printf("INFO: Exported %d experiments of project %s, environment %s at seq %d.", len(snapshot.Experiments), g.project, g.environment, snapshot.Seq)
+
+	snapshotData, err := ab_types.EncodeSnapshot(snapshot, g.format)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		Project:         g.project,
+		Environment:     g.environment,
+		Version:         snapshot.Version,
+		Seq:             snapshot.Seq,
+		ObjectName:      g.prefix + ab_types.SnapshotObjectPrefix + snapshot.Version + g.format.FileExtension(),
+		Size:            len(snapshotData),
+		ExperimentCount: len(snapshot.Experiments),
+	}
+
+	contentType := g.format.ContentType()
+	_, err = g.storage.Upload(ctx, g.bucket, result.ObjectName, contentType, bytes.NewReader(snapshotData), int64(len(snapshotData)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload snapshot to MinIO: %w", err)
+	}
+	log.Printf("INFO: Successfully uploaded snapshot '%s' (%s, %d bytes) to bucket '%s'.", result.ObjectName, contentType, result.Size, g.bucket)
+
+	manifestPath, err := g.uploadManifest(ctx, snapshot, result.ObjectName, snapshotData)
+	if err != nil {
+		return nil, err
+	}
+
+	// Указатель обновляется последним, чтобы SDK никогда не увидели снэпшот без манифеста.
+	meta := ab_types.SnapshotMeta{
+		SnapshotVersion: snapshot.Version,
+		Seq:             snapshot.Seq,
+		Path:            result.ObjectName,
+		ManifestPath:    manifestPath,
+		CreatedAt:       snapshot.CreatedAt,
+		Project:         g.project,
+		Environment:     g.environment,
+		Encoding:        g.format.Encoding,
+		Compression:     g.format.Compression,
+		ContentType:     contentType,
+		SigningKeyID:    ab_types.SigningKeyID(g.signingKey),
+	}
+	if err := g.storage.UpdatePointer(ctx, g.bucket, g.prefix+ab_types.LatestSnapshotPointer, meta); err != nil {
+		return nil, err
+	}
+
+	metaData, err := json.Marshal(meta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal snapshot metadata: %w", err)
+	}
+
+	if err := g.producer.Publish(ctx, []byte(snapshot.Version), metaData); err != nil {
+		return nil, fmt.Errorf("failed to publish snapshot metadata to Kafka: %w", err)
+	}
+	log.Printf("INFO: Successfully published snapshot metadata for version %s (seq %d).", snapshot.Version, snapshot.Seq)
+
+	g.last = &meta
+	g.runRetention(ctx, result.ObjectName)
+	return result, nil
+}
+
+// loadLatestMeta читает latest.json, чтобы после перезапуска не загружать снэпшот повторно.
+func (g *Generator) loadLatestMeta(ctx context.Context) *ab_types.SnapshotMeta {
+	pointer := g.prefix + ab_types.LatestSnapshotPointer
+	data, err := g.storage.Download(ctx, g.bucket, pointer)
+	if err != nil {
+		return nil
+	}
+	var meta ab_types.SnapshotMeta
+	if err := json.Unmarshal(data, &meta); err != nil || meta.Path == "" {
+		log.Printf("WARN: Ignoring unreadable %s: %v", pointer, err)
+		return nil
+	}
+	return &meta
+}
+
+// uploadManifest формирует, подписывает и загружает манифест снэпшота.
+func (g *Generator) uploadManifest(ctx context.Context, snapshot *ab_types.Snapshot, objectName string, snapshotData []byte) (string, error) {
+	manifest := ab_types.NewSnapshotManifest(snapshot, objectName, g.format.ContentType(), snapshotData)
+	if g.signingKey != nil {
+		manifest.Sign(g.signingKey)
+	}
+
+	manifestPath := ab_types.ManifestPathFor(objectName)
+	manifestData, err := json.Marshal(manifest)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal snapshot manifest: %w", err)
+	}
+	_, err = g.storage.Upload(ctx, g.bucket, manifestPath, "application/json", bytes.NewReader(manifestData), int64(len(manifestData)))
+	if err != nil {
+		return "", fmt.Errorf("failed to upload snapshot manifest: %w", err)
+	}
+	return manifestPath, nil
+}
+
+// runRetention запускает сборку мусора. Ошибка не влияет на результат генерации:
+// снэпшот уже загружен, а удаление повторится при следующем запуске.
+func (g *Generator) runRetention(ctx context.Context, protected string) {
+	if err := g.collectGarbage(ctx, protected); err != nil {
+		log.Printf("WARN: Snapshot retention failed: %v", err)
+	}
+}
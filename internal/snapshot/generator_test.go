@@ -0,0 +1,228 @@
+package snapshot
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/segmentio/kafka-go"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+// fakeRepository отдает пустые снэпшоты с заданным номером изменения для каждого проекта.
+type fakeRepository struct {
+	mu       sync.Mutex
+	projects []string
+	seq      map[string]int64
+	// failing - проекты, экспорт которых завершается ошибкой.
+	failing map[string]bool
+	exports int
+}
+
+func newFakeRepository(projects ...string) *fakeRepository {
+	repo := &fakeRepository{projects: projects, seq: make(map[string]int64), failing: make(map[string]bool)}
+	for _, project := range projects {
+		repo.seq[project] = 1
+	}
+	return repo
+}
+
+func (r *fakeRepository) setSeq(project string, seq int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seq[project] = seq
+}
+
+func (r *fakeRepository) exportCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.exports
+}
+
+func (r *fakeRepository) ExportSnapshot(_ context.Context, project, environment string) (*ab_types.Snapshot, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.exports++
+	if r.failing[project] {
+		return nil, errors.New("database is unavailable")
+	}
+	return &ab_types.Snapshot{
+		SchemaVersion: ab_types.SnapshotSchemaVersion,
+		Seq:           r.seq[project],
+		Project:       project,
+		Environment:   environment,
+	}, nil
+}
+
+func (r *fakeRepository) FindAllProjects(context.Context) ([]ab_types.Project, error) {
+	projects := make([]ab_types.Project, len(r.projects))
+	for i, id := range r.projects {
+		projects[i] = ab_types.Project{ID: id}
+	}
+	return projects, nil
+}
+
+// fakeStorage хранит объекты бакета в памяти.
+type fakeStorage struct {
+	mu      sync.Mutex
+	objects map[string]minio.ObjectInfo
+	data    map[string][]byte
+	uploads int
+}
+
+func newFakeStorage() *fakeStorage {
+	return &fakeStorage{objects: make(map[string]minio.ObjectInfo), data: make(map[string][]byte)}
+}
+
+func (s *fakeStorage) put(name string, data []byte, modified time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[name] = minio.ObjectInfo{Key: name, Size: int64(len(data)), LastModified: modified}
+	s.data[name] = data
+}
+
+// snapshotUploads возвращает число загруженных объектов снэпшотов (без манифестов и указателей).
+func (s *fakeStorage) snapshotUploads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.uploads
+}
+
+func (s *fakeStorage) Upload(_ context.Context, _, objectName, _ string, reader io.Reader, _ int64) (minio.UploadInfo, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return minio.UploadInfo{}, err
+	}
+	s.put(objectName, data, time.Now())
+	if strings.Contains(objectName, ab_types.SnapshotObjectPrefix) {
+		s.mu.Lock()
+		s.uploads++
+		s.mu.Unlock()
+	}
+	return minio.UploadInfo{Key: objectName, Size: int64(len(data))}, nil
+}
+
+func (s *fakeStorage) Download(_ context.Context, _, objectName string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.data[objectName]
+	if !ok {
+		return nil, fmt.Errorf("object %s not found", objectName)
+	}
+	return data, nil
+}
+
+func (s *fakeStorage) UpdatePointer(_ context.Context, _, pointerName string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	s.put(pointerName, data, time.Now())
+	return nil
+}
+
+func (s *fakeStorage) List(_ context.Context, _, prefix string) ([]minio.ObjectInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var objects []minio.ObjectInfo
+	for name, object := range s.objects {
+		if strings.HasPrefix(name, prefix) {
+			objects = append(objects, object)
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+func (s *fakeStorage) Delete(_ context.Context, _, objectName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, objectName)
+	delete(s.data, objectName)
+	return nil
+}
+
+// fakePublisher отбрасывает метаданные снэпшотов.
+type fakePublisher struct{}
+
+func (fakePublisher) Publish(context.Context, []byte, []byte, ...kafka.Header) error { return nil }
+
+func TestGeneratorSkipsUnchangedSnapshot(t *testing.T) {
+	otherKey := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	base := GeneratorConfig{Bucket: "snapshots", Format: ab_types.DefaultSnapshotFormat}
+
+	tests := []struct {
+		name string
+		// restart - второй запуск выполняет новый генератор, восстанавливающий состояние из latest.json.
+		restart bool
+		// config изменяет параметры генератора второго запуска.
+		config   func(cfg *GeneratorConfig)
+		seq      int64
+		wantSkip bool
+	}{
+		{name: "unchanged", seq: 1, wantSkip: true},
+		{name: "unchanged after restart", restart: true, seq: 1, wantSkip: true},
+		{name: "new changes", seq: 2},
+		{
+			name:    "format changed",
+			restart: true,
+			config: func(cfg *GeneratorConfig) {
+				cfg.Format = ab_types.SnapshotFormat{Encoding: ab_types.EncodingGob, Compression: ab_types.CompressionZstd}
+			},
+			seq: 1,
+		},
+		{
+			name:    "signing key changed",
+			restart: true,
+			config:  func(cfg *GeneratorConfig) { cfg.SigningKey = otherKey },
+			seq:     1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, store := newFakeRepository(ab_types.DefaultProject), newFakeStorage()
+			generator := NewGenerator(repo, store, fakePublisher{}, base)
+			first, err := generator.Generate(context.Background())
+			if err != nil {
+				t.Fatalf("first Generate() error = %v", err)
+			}
+
+			if tt.restart {
+				cfg := base
+				if tt.config != nil {
+					tt.config(&cfg)
+				}
+				generator = NewGenerator(repo, store, fakePublisher{}, cfg)
+			}
+			repo.setSeq(ab_types.DefaultProject, tt.seq)
+			second, err := generator.Generate(context.Background())
+			if err != nil {
+				t.Fatalf("second Generate() error = %v", err)
+			}
+
+			if second.Skipped != tt.wantSkip {
+				t.Errorf("Skipped = %v, want %v", second.Skipped, tt.wantSkip)
+			}
+			wantUploads := 2
+			if tt.wantSkip {
+				wantUploads = 1
+				if second.ObjectName != first.ObjectName {
+					t.Errorf("skipped generation reports %s, want the existing %s", second.ObjectName, first.ObjectName)
+				}
+			}
+			if got := store.snapshotUploads(); got != wantUploads {
+				t.Errorf("snapshot uploads = %d, want %d", got, wantUploads)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package snapshot
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+type serviceMetrics struct {
+	// lastSuccessUnix - время последней успешной генерации (Unix, секунды), читается GaugeFunc.
+	lastSuccessUnix atomic.Int64
+
+	size          *prometheus.GaugeVec
+	experiments   *prometheus.GaugeVec
+	pendingDeltas prometheus.Gauge
+	duration      prometheus.Histogram
+	generations   *prometheus.CounterVec
+}
+
+func registerMetrics() *serviceMetrics {
+	return newMetrics(promauto.With(prometheus.DefaultRegisterer))
+}
+
+// newMetrics создает метрики сервиса через factory (в тестах - без регистрации).
+func newMetrics(factory promauto.Factory) *serviceMetrics {
+	m := &serviceMetrics{
+		size: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "ab_snapshot_size_bytes",
+			Help: "Size in bytes of the latest uploaded snapshot, partitioned by project and environment.",
+		}, []string{"project", "environment"}),
+		experiments: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "ab_snapshot_experiments",
+			Help: "Number of experiments in the latest uploaded snapshot, partitioned by project and environment.",
+		}, []string{"project", "environment"}),
+		pendingDeltas: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "ab_snapshot_pending_deltas",
+			Help: "Number of deltas published since the latest snapshot generation.",
+		}),
+		duration: factory.NewHistogram(prometheus.HistogramOpts{
+			Name:    "ab_snapshot_generation_duration_seconds",
+			Help:    "Duration of snapshot generation runs.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		generations: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "ab_snapshot_generations_total",
+			Help: "Total number of snapshot generation runs, partitioned by trigger and result.",
+		}, []string{"trigger", "result"}),
+	}
+
+	factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "ab_snapshot_age_seconds",
+		Help: "Seconds since the latest successful snapshot generation (or -1 if none yet).",
+	}, func() float64 {
+		last := m.lastSuccessUnix.Load()
+		if last == 0 {
+			return -1
+		}
+		return time.Since(time.Unix(last, 0)).Seconds()
+	})
+
+	return m
+}
+
+// observe фиксирует результат одной генерации.
+func (m *serviceMetrics) observe(trigger string, result *Result, err error, elapsed time.Duration) {
+	m.duration.Observe(elapsed.Seconds())
+
+	switch {
+	case err != nil:
+		m.generations.WithLabelValues(trigger, "failed").Inc()
+		return
+	case result.Skipped:
+		m.generations.WithLabelValues(trigger, "skipped").Inc()
+	default:
+		m.generations.WithLabelValues(trigger, "uploaded").Inc()
+		m.size.WithLabelValues(result.Project, result.Environment).Set(float64(result.Size))
+		m.experiments.WithLabelValues(result.Project, result.Environment).Set(float64(result.ExperimentCount))
+	}
+	// Пропуск тоже означает, что в хранилище лежит актуальный снэпшот.
+	m.lastSuccessUnix.Store(time.Now().Unix())
+}
@@ -0,0 +1,90 @@
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Partitions - генераторы снэпшотов всех пар (проект, окружение).
+// Проекты создаются через API во время работы сервиса, поэтому список проектов
+// перечитывается перед каждой генерацией, а генераторы новых пар создаются по мере появления.
+type Partitions struct {
+	repo         Repository
+	environments []string
+	// config - общие параметры генераторов; Project и Environment задаются для каждой пары.
+	config       GeneratorConfig
+	newGenerator func(cfg GeneratorConfig) *Generator
+
+	mu         sync.Mutex
+	generators map[partitionKey]*Generator
+}
+
+type partitionKey struct {
+	project     string
+	environment string
+}
+
+// NewPartitions создает набор генераторов. newGenerator создает генератор одной пары
+// (обычно - замыкание над NewGenerator с общими хранилищем и продюсером).
+func NewPartitions(repo Repository, environments []string, cfg GeneratorConfig, newGenerator func(cfg GeneratorConfig) *Generator) *Partitions {
+	return &Partitions{
+		repo:         repo,
+		environments: environments,
+		config:       cfg,
+		newGenerator: newGenerator,
+		generators:   make(map[partitionKey]*Generator),
+	}
+}
+
+// Generators возвращает генераторы всех текущих проектов во всех окружениях.
+// Генераторы переиспользуются между вызовами, чтобы сохранять метаданные последней загрузки.
+func (p *Partitions) Generators(ctx context.Context) ([]*Generator, error) {
+	projects, err := p.repo.FindAllProjects(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list projects: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	generators := make([]*Generator, 0, len(projects)*len(p.environments))
+	for _, project := range projects {
+		for _, environment := range p.environments {
+			key := partitionKey{project: project.ID, environment: environment}
+			generator, ok := p.generators[key]
+			if !ok {
+				cfg := p.config
+				cfg.Project = project.ID
+				cfg.Environment = environment
+				generator = p.newGenerator(cfg)
+				p.generators[key] = generator
+			}
+			generators = append(generators, generator)
+		}
+	}
+	return generators, nil
+}
+
+// GenerateAll однократно генерирует снэпшоты всех проектов во всех окружениях.
+// Ошибка одной пары не прерывает генерацию остальных: все ошибки возвращаются вместе.
+func (p *Partitions) GenerateAll(ctx context.Context) error {
+	generators, err := p.Generators(ctx)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, generator := range generators {
+		if _, err := generator.Generate(ctx); err != nil {
+			err = fmt.Errorf("project %s, environment %s: %w", generator.project, generator.environment, err)
+			log.Printf("ERROR: Snapshot generation failed: %v", err)
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d snapshot generations failed: %w", len(errs), len(generators), errors.Join(errs...))
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package snapshot
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+func newTestPartitions(repo *fakeRepository, store *fakeStorage, environments ...string) *Partitions {
+	cfg := GeneratorConfig{Bucket: "snapshots", Format: ab_types.DefaultSnapshotFormat}
+	return NewPartitions(repo, environments, cfg, func(cfg GeneratorConfig) *Generator {
+		return NewGenerator(repo, store, fakePublisher{}, cfg)
+	})
+}
+
+func TestPartitionsGenerateAll(t *testing.T) {
+	tests := []struct {
+		name        string
+		failing     []string
+		wantUploads int
+		wantErrs    []string
+	}{
+		{name: "all projects", wantUploads: 6},
+		{
+			// Ошибка проекта не прерывает генерацию следующих за ним.
+			name:        "failing project",
+			failing:     []string{"alpha"},
+			wantUploads: 4,
+			wantErrs:    []string{"project alpha, environment production", "project alpha, environment staging"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, store := newFakeRepository("alpha", "beta", "gamma"), newFakeStorage()
+			for _, project := range tt.failing {
+				repo.failing[project] = true
+			}
+			err := newTestPartitions(repo, store, "production", "staging").GenerateAll(context.Background())
+
+			if got := store.snapshotUploads(); got != tt.wantUploads {
+				t.Errorf("snapshot uploads = %d, want %d", got, tt.wantUploads)
+			}
+			if len(tt.wantErrs) == 0 {
+				if err != nil {
+					t.Errorf("GenerateAll() error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("GenerateAll() error = nil, want an error")
+			}
+			for _, want := range tt.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("GenerateAll() error = %q, want it to mention %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+// RetentionPolicy определяет, какие снэпшоты хранить в бакете.
+// Снэпшот сохраняется, если он входит в KeepLast последних ИЛИ моложе KeepNewerThan.
+// Остальные удаляются.
+type RetentionPolicy struct {
+	// KeepLast - количество последних снэпшотов, которые хранятся всегда.
+	// Значение <= 0 отключает сборку мусора.
+	KeepLast int
+	// KeepNewerThan - снэпшоты моложе этого возраста хранятся независимо от KeepLast.
+	KeepNewerThan time.Duration
+}
+
+// Enabled сообщает, включена ли сборка мусора.
+func (p RetentionPolicy) Enabled() bool {
+	return p.KeepLast > 0
+}
+
+// expired возвращает имена снэпшотов с префиксом prefix, подлежащих удалению.
+// Объект protected (на который указывает latest.json) не удаляется никогда.
+func (p RetentionPolicy) expired(objects []minio.ObjectInfo, prefix, protected string, now time.Time) []string {
+	snapshots := make([]minio.ObjectInfo, 0, len(objects))
+	for _, object := range objects {
+		if strings.HasPrefix(object.Key, prefix) {
+			snapshots = append(snapshots, object)
+		}
+	}
+
+	// Версия - UUIDv7, поэтому лексикографический порядок имен совпадает с хронологическим.
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Key > snapshots[j].Key })
+
+	var expired []string
+	for i, object := range snapshots {
+		if i < p.KeepLast || object.Key == protected {
+			continue
+		}
+		if p.KeepNewerThan > 0 && now.Sub(object.LastModified) < p.KeepNewerThan {
+			continue
+		}
+		expired = append(expired, object.Key)
+	}
+	return expired
+}
+
+// collectGarbage удаляет снэпшоты окружения проекта, не попадающие под политику хранения.
+func (g *Generator) collectGarbage(ctx context.Context, protected string) error {
+	if !g.retention.Enabled() {
+		return nil
+	}
+
+	prefix := g.prefix + ab_types.SnapshotObjectPrefix
+	objects, err := g.storage.List(ctx, g.bucket, prefix)
+	if err != nil {
+		return fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	expired := g.retention.expired(objects, prefix, protected, time.Now())
+	for _, name := range expired {
+		// Сначала удаляется снэпшот: манифест без снэпшота безвреден, а наоборот - нет.
+		if err := g.storage.Delete(ctx, g.bucket, name); err != nil {
+			return err
+		}
+		if err := g.storage.Delete(ctx, g.bucket, ab_types.ManifestPathFor(name)); err != nil {
+			return err
+		}
+	}
+	if len(expired) > 0 {
+		log.Printf("INFO: Removed %d expired snapshots of project %s, environment %s from bucket '%s'.", len(expired), g.project, g.environment, g.bucket)
+	}
+	return nil
+}
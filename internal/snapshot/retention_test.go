@@ -0,0 +1,86 @@
+package snapshot
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+func TestRetentionPolicyExpired(t *testing.T) {
+	now := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+	const prefix = "staging/" + ab_types.SnapshotObjectPrefix
+	name := func(i int) string { return fmt.Sprintf("%sv%d.json", prefix, i) }
+
+	// Снэпшоты v1..v5 загружены раз в час; v5 - самый новый.
+	var objects []minio.ObjectInfo
+	for i := 1; i <= 5; i++ {
+		objects = append(objects, minio.ObjectInfo{Key: name(i), LastModified: now.Add(-time.Duration(5-i) * time.Hour)})
+	}
+	// Объекты других окружений и манифесты политикой не затрагиваются.
+	objects = append(objects,
+		minio.ObjectInfo{Key: ab_types.SnapshotObjectPrefix + "v0.json", LastModified: now.Add(-time.Hour * 24 * 30)},
+		minio.ObjectInfo{Key: "staging/" + ab_types.ManifestObjectPrefix + "v1.json", LastModified: now.Add(-4 * time.Hour)},
+	)
+
+	tests := []struct {
+		name      string
+		policy    RetentionPolicy
+		protected string
+		want      []string
+	}{
+		{
+			name:      "keep last N",
+			policy:    RetentionPolicy{KeepLast: 2},
+			protected: name(5),
+			want:      []string{name(3), name(2), name(1)},
+		},
+		{
+			name:      "N covers all snapshots",
+			policy:    RetentionPolicy{KeepLast: 5},
+			protected: name(5),
+		},
+		{
+			name:      "N one short of all snapshots",
+			policy:    RetentionPolicy{KeepLast: 4},
+			protected: name(5),
+			want:      []string{name(1)},
+		},
+		{
+			// v3 загружен ровно 2 часа назад: он уже не моложе KeepNewerThan.
+			name:      "T boundary",
+			policy:    RetentionPolicy{KeepLast: 1, KeepNewerThan: 2 * time.Hour},
+			protected: name(5),
+			want:      []string{name(3), name(2), name(1)},
+		},
+		{
+			name:      "T just above boundary",
+			policy:    RetentionPolicy{KeepLast: 1, KeepNewerThan: 2*time.Hour + time.Second},
+			protected: name(5),
+			want:      []string{name(2), name(1)},
+		},
+		{
+			// latest.json указывает на старый снэпшот (например, после отката): он не удаляется,
+			// хотя не входит ни в последние N, ни в окно T.
+			name:      "latest.json target is never deleted",
+			policy:    RetentionPolicy{KeepLast: 1, KeepNewerThan: time.Hour},
+			protected: name(1),
+			want:      []string{name(4), name(3), name(2)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.policy.expired(objects, prefix, tt.protected, now)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expired() = %v, want %v", got, tt.want)
+			}
+			if slices.Contains(got, tt.protected) {
+				t.Errorf("expired() contains the latest.json target %s", tt.protected)
+			}
+		})
+	}
+}
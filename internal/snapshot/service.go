@@ -0,0 +1,212 @@
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	triggerStartup  = "startup"
+	triggerSchedule = "schedule"
+	triggerDeltas   = "deltas"
+)
+
+// deltaReadRetryInterval - пауза перед повторным чтением топика дельт после ошибки.
+const deltaReadRetryInterval = 5 * time.Second
+
+// deltaReader читает топик дельт проекта (*kafka.Reader).
+type deltaReader interface {
+	ReadMessage(ctx context.Context) (kafka.Message, error)
+	Close() error
+}
+
+// Service - долгоживущий режим snapshot-generator.
+// Перегенерирует снэпшоты всех проектов и окружений по расписанию и после публикации
+// заданного числа дельт в топики всех проектов.
+type Service struct {
+	partitions        *Partitions
+	interval          time.Duration
+	deltaThreshold    int
+	generationTimeout time.Duration
+
+	// newDeltaReader создает читателя топика дельт проекта.
+	newDeltaReader func(topic string) deltaReader
+	pendingDeltas  atomic.Int64
+
+	// readersMu защищает deltaReaders. Читатели топиков дельт (ab_types.ProjectDeltasTopic)
+	// нужны только для подсчета опубликованных изменений и создаются для новых проектов
+	// при каждой генерации.
+	readersMu    sync.Mutex
+	deltaReaders map[string]deltaReader
+	closed       bool
+	// watchCtx и trigger задает Run; читатели сигнализируют через trigger о достижении порога.
+	watchCtx context.Context
+	trigger  chan struct{}
+
+	metrics *serviceMetrics
+}
+
+// ServiceConfig - параметры Service.
+type ServiceConfig struct {
+	Interval          time.Duration
+	DeltaThreshold    int
+	GenerationTimeout time.Duration
+
+	KafkaBrokers []string
+	// DeltasGroupID - группа потребителей топиков дельт всех проектов.
+	DeltasGroupID string
+}
+
+func NewService(partitions *Partitions, cfg ServiceConfig) *Service {
+	return &Service{
+		partitions:        partitions,
+		interval:          cfg.Interval,
+		deltaThreshold:    cfg.DeltaThreshold,
+		generationTimeout: cfg.GenerationTimeout,
+		newDeltaReader: func(topic string) deltaReader {
+			return kafka.NewReader(kafka.ReaderConfig{
+				Brokers:  cfg.KafkaBrokers,
+				GroupID:  cfg.DeltasGroupID,
+				Topic:    topic,
+				MinBytes: 1,
+				MaxBytes: 10e6, // 10MB
+			})
+		},
+		deltaReaders: make(map[string]deltaReader),
+		metrics:      registerMetrics(),
+	}
+}
+
+// Run выполняет генерации до отмены ctx.
+// Начатая генерация при отмене ctx не прерывается, а завершается в пределах generationTimeout.
+func (s *Service) Run(ctx context.Context) error {
+	trigger := make(chan struct{}, 1)
+	s.readersMu.Lock()
+	s.watchCtx, s.trigger = ctx, trigger
+	s.readersMu.Unlock()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	log.Printf("INFO: Snapshot service started (interval: %v, delta threshold: %d).", s.interval, s.deltaThreshold)
+	s.generate(ctx, triggerStartup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("INFO: Snapshot service shutting down.")
+			return nil
+		case <-ticker.C:
+			s.generate(ctx, triggerSchedule)
+		case <-trigger:
+			s.generate(ctx, triggerDeltas)
+			// Сдвигаем плановую генерацию, чтобы не делать лишнюю работу сразу после триггера.
+			ticker.Reset(s.interval)
+		}
+	}
+}
+
+// Close освобождает ресурсы сервиса.
+func (s *Service) Close() error {
+	s.readersMu.Lock()
+	defer s.readersMu.Unlock()
+	s.closed = true
+	var errs []error
+	for _, reader := range s.deltaReaders {
+		errs = append(errs, reader.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Service) generate(ctx context.Context, trigger string) {
+	// Генерация не должна прерываться сигналом остановки на середине загрузки.
+	genCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.generationTimeout)
+	defer cancel()
+
+	// Обнуляем счетчик до генерации: дельты, пришедшие во время нее, учтутся в следующей.
+	s.pendingDeltas.Store(0)
+	s.metrics.pendingDeltas.Set(0)
+
+	generators, err := s.partitions.Generators(genCtx)
+	if err != nil {
+		s.metrics.observe(trigger, nil, err, 0)
+		log.Printf("ERROR: Snapshot generation (trigger: %s) failed: %v", trigger, err)
+		return
+	}
+
+	s.watchProjects(generators)
+
+	// Проекты и окружения генерируются по очереди: ошибка одного не мешает остальным.
+	for _, generator := range generators {
+		start := time.Now()
+		result, err := generator.Generate(genCtx)
+		s.metrics.observe(trigger, result, err, time.Since(start))
+		if err != nil {
+			log.Printf("ERROR: Snapshot generation (trigger: %s) failed: %v", trigger, err)
+			continue
+		}
+		if !result.Skipped {
+			log.Printf("INFO: Snapshot %s of project %s, environment %s generated (trigger: %s, size: %d bytes, took %v).",
+				result.Version, result.Project, result.Environment, trigger, result.Size, time.Since(start))
+		}
+	}
+}
+
+// watchProjects запускает подсчет дельт в топиках проектов, для которых он еще не запущен.
+func (s *Service) watchProjects(generators []*Generator) {
+	if s.deltaThreshold <= 0 {
+		return
+	}
+	s.readersMu.Lock()
+	defer s.readersMu.Unlock()
+	if s.closed || s.watchCtx == nil {
+		return
+	}
+	for _, generator := range generators {
+		project := generator.project
+		if _, ok := s.deltaReaders[project]; ok {
+			continue
+		}
+		topic := ab_types.ProjectDeltasTopic(project)
+		reader := s.newDeltaReader(topic)
+		s.deltaReaders[project] = reader
+		go s.watchDeltas(s.watchCtx, topic, reader, s.trigger)
+	}
+}
+
+// watchDeltas считает сообщения в топике дельт проекта и сигнализирует о достижении
+// общего для всех проектов порога.
+func (s *Service) watchDeltas(ctx context.Context, topic string, reader deltaReader, trigger chan<- struct{}) {
+	for {
+		_, err := reader.ReadMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, io.EOF) {
+				return // Сервис остановлен или читатель закрыт
+			}
+			log.Printf("ERROR: Failed to read delta message from Kafka topic %s: %v", topic, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(deltaReadRetryInterval):
+			}
+			continue
+		}
+
+		pending := s.pendingDeltas.Add(1)
+		s.metrics.pendingDeltas.Set(float64(pending))
+		if pending >= int64(s.deltaThreshold) {
+			select {
+			case trigger <- struct{}{}:
+			default: // Генерация уже запрошена
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package snapshot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/segmentio/kafka-go"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+// fakeDeltaReader выдает сообщения, отправленные в messages.
+type fakeDeltaReader struct {
+	messages chan kafka.Message
+}
+
+func (r *fakeDeltaReader) ReadMessage(ctx context.Context) (kafka.Message, error) {
+	select {
+	case message := <-r.messages:
+		return message, nil
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	}
+}
+
+func (r *fakeDeltaReader) Close() error { return nil }
+
+// waitFor ждет выполнения условия не дольше секунды.
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestServiceGeneratesAfterDeltaThreshold(t *testing.T) {
+	repo, store := newFakeRepository(ab_types.DefaultProject), newFakeStorage()
+	reader := &fakeDeltaReader{messages: make(chan kafka.Message)}
+	service := &Service{
+		partitions:        newTestPartitions(repo, store, ab_types.DefaultEnvironment),
+		interval:          time.Hour,
+		deltaThreshold:    3,
+		generationTimeout: time.Second,
+		newDeltaReader:    func(string) deltaReader { return reader },
+		deltaReaders:      make(map[string]deltaReader),
+		metrics:           newMetrics(promauto.With(nil)),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		service.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	waitFor(t, "the startup generation", func() bool { return repo.exportCount() == 1 })
+
+	repo.setSeq(ab_types.DefaultProject, 4)
+	for i := 0; i < 2; i++ {
+		reader.messages <- kafka.Message{}
+	}
+	// Пока порог не достигнут, генерация не запускается.
+	time.Sleep(20 * time.Millisecond)
+	if got := repo.exportCount(); got != 1 {
+		t.Fatalf("generations = %d below the delta threshold, want 1", got)
+	}
+
+	reader.messages <- kafka.Message{}
+	waitFor(t, "the generation triggered by deltas", func() bool { return store.snapshotUploads() == 2 })
+	if pending := service.pendingDeltas.Load(); pending != 0 {
+		t.Errorf("pending deltas = %d after generation, want 0", pending)
+	}
+}
@@ -0,0 +1,189 @@
+package ab_types
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/hashicorp/go-version"
+)
+
+// AttributeType - объявленный тип атрибута пользователя.
+type AttributeType string
+
+const (
+	AttributeString   AttributeType = "string"
+	AttributeNumber   AttributeType = "number"
+	AttributeBoolean  AttributeType = "boolean"
+	AttributeSemver   AttributeType = "semver"
+	AttributeDatetime AttributeType = "datetime" // см. ParseRuleTime
+	AttributeIP       AttributeType = "ip"
+)
+
+// AttributeDefinition - объявление атрибута в схеме атрибутов проекта.
+type AttributeDefinition struct {
+	Name string `json:"name"`
+	// ProjectID - проект атрибута. Пусто означает DefaultProject.
+	ProjectID   string        `json:"project_id,omitempty"`
+	Type        AttributeType `json:"type"`
+	Description string        `json:"description,omitempty"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+}
+
+// ProjectOrDefault возвращает проект атрибута.
+func (d *AttributeDefinition) ProjectOrDefault() string {
+	return projectOrDefault(d.ProjectID)
+}
+
+// Validate проверяет имя и тип атрибута.
+func (d *AttributeDefinition) Validate() error {
+	if d.Name == "" {
+		return errors.New("name is required")
+	}
+	switch d.Type {
+	case AttributeString, AttributeNumber, AttributeBoolean, AttributeSemver, AttributeDatetime, AttributeIP:
+		return nil
+	default:
+		return fmt.Errorf("unknown type %q", d.Type)
+	}
+}
+
+// AttributeSchema - типы объявленных атрибутов проекта по имени.
+type AttributeSchema map[string]AttributeType
+
+// NewAttributeSchema собирает схему из объявлений атрибутов.
+func NewAttributeSchema(definitions []AttributeDefinition) AttributeSchema {
+	schema := make(AttributeSchema, len(definitions))
+	for _, definition := range definitions {
+		schema[definition.Name] = definition.Type
+	}
+	return schema
+}
+
+// operatorTypes - типы атрибутов, с которыми работает оператор. Операторы, которых нет
+// в карте (EQUALS, IN_LIST и их отрицания), применимы к атрибуту любого типа.
+var operatorTypes = map[Operator][]AttributeType{
+	OpContains:           {AttributeString},
+	OpNotContains:        {AttributeString},
+	OpMatchesRegex:       {AttributeString},
+	OpStartsWith:         {AttributeString},
+	OpEndsWith:           {AttributeString},
+	OpGreaterThan:        {AttributeNumber},
+	OpLessThan:           {AttributeNumber},
+	OpGreaterThanOrEqual: {AttributeNumber},
+	OpLessThanOrEqual:    {AttributeNumber},
+	OpVersionGreaterThan: {AttributeSemver},
+	OpVersionLessThan:    {AttributeSemver},
+	OpVersionEquals:      {AttributeSemver},
+	OpDateBefore:         {AttributeDatetime},
+	OpDateAfter:          {AttributeDatetime},
+	OpWithinLastDays:     {AttributeDatetime},
+	OpIPInCIDR:           {AttributeIP},
+}
+
+// ValidateRules проверяет, что сравнения правил с объявленными атрибутами используют
+// подходящие оператор и тип значения. Необъявленные атрибуты не проверяются; правила
+// сегментов и списков идентификаторов ссылаются не на атрибуты и тоже пропускаются.
+func (s AttributeSchema) ValidateRules(rules []TargetingRule) error {
+	if len(s) == 0 {
+		return nil
+	}
+	var err error
+	walkRuleLeaves(rules, func(rule *TargetingRule) {
+		if err != nil {
+			return
+		}
+		if _, ok := rule.SegmentKey(); ok {
+			return
+		}
+		if _, ok := rule.IDListKey(); ok {
+			return
+		}
+		attrType, declared := s[rule.Attribute]
+		if !declared {
+			return
+		}
+		if ruleErr := checkRuleType(rule, attrType); ruleErr != nil {
+			err = fmt.Errorf("attribute %q (%s): %w", rule.Attribute, attrType, ruleErr)
+		}
+	})
+	return err
+}
+
+func checkRuleType(rule *TargetingRule, attrType AttributeType) error {
+	if allowed, ok := operatorTypes[rule.Operator]; ok {
+		for _, t := range allowed {
+			if t == attrType {
+				// Значения операторов с фиксированным типом проверяет ValidateTargetingRules,
+				// кроме чисел и версий.
+				return checkOperandType(rule, attrType)
+			}
+		}
+		return fmt.Errorf("operator %s cannot be applied to a %s attribute", rule.Operator, attrType)
+	}
+
+	switch rule.Operator {
+	case OpInList, OpNotInList:
+		items, ok := rule.Value.([]any)
+		if !ok {
+			return fmt.Errorf("operator %s requires a list as value", rule.Operator)
+		}
+		for i, item := range items {
+			if !valueHasType(item, attrType) {
+				return fmt.Errorf("value[%d] %v is not a %s", i, item, attrType)
+			}
+		}
+		return nil
+	default:
+		if !valueHasType(rule.Value, attrType) {
+			return fmt.Errorf("value %v is not a %s", rule.Value, attrType)
+		}
+		return nil
+	}
+}
+
+// checkOperandType проверяет значение операторов с фиксированным типом операнда.
+func checkOperandType(rule *TargetingRule, attrType AttributeType) error {
+	switch attrType {
+	case AttributeNumber, AttributeSemver:
+		if !valueHasType(rule.Value, attrType) {
+			return fmt.Errorf("value %v is not a %s", rule.Value, attrType)
+		}
+	}
+	return nil
+}
+
+// valueHasType сообщает, является ли значение правила значением типа attrType.
+func valueHasType(v any, attrType AttributeType) bool {
+	switch attrType {
+	case AttributeString:
+		_, ok := v.(string)
+		return ok
+	case AttributeNumber:
+		_, ok := ToFloat64(v)
+		return ok
+	case AttributeBoolean:
+		_, ok := v.(bool)
+		return ok
+	case AttributeSemver:
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+		_, err := version.NewVersion(s)
+		return err == nil
+	case AttributeDatetime:
+		_, ok := ParseRuleTime(v)
+		return ok
+	case AttributeIP:
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+		_, err := netip.ParseAddr(s)
+		return err == nil
+	default:
+		return false
+	}
+}
@@ -0,0 +1,69 @@
+package ab_types
+
+import "testing"
+
+func TestAttributeDefinitionValidate(t *testing.T) {
+	tests := []struct {
+		definition AttributeDefinition
+		wantErr    bool
+	}{
+		{AttributeDefinition{Name: "age", Type: AttributeNumber}, false},
+		{AttributeDefinition{Name: "ip", Type: AttributeIP}, false},
+		{AttributeDefinition{Type: AttributeString}, true},
+		{AttributeDefinition{Name: "age", Type: "integer"}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.definition.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%+v) error = %v, wantErr %v", tt.definition, err, tt.wantErr)
+		}
+	}
+}
+
+func TestAttributeSchemaValidateRules(t *testing.T) {
+	schema := NewAttributeSchema([]AttributeDefinition{
+		{Name: "age", Type: AttributeNumber},
+		{Name: "plan", Type: AttributeString},
+		{Name: "beta", Type: AttributeBoolean},
+		{Name: "app_version", Type: AttributeSemver},
+		{Name: "signup_date", Type: AttributeDatetime},
+		{Name: "ip", Type: AttributeIP},
+	})
+
+	tests := []struct {
+		name    string
+		rule    TargetingRule
+		wantErr bool
+	}{
+		{"number comparison", TargetingRule{Attribute: "age", Operator: OpGreaterThan, Value: float64(18)}, false},
+		{"number compared with string", TargetingRule{Attribute: "age", Operator: OpGreaterThan, Value: "18"}, true},
+		{"string operator on number", TargetingRule{Attribute: "age", Operator: OpStartsWith, Value: "1"}, true},
+		{"number operator on string", TargetingRule{Attribute: "plan", Operator: OpGreaterThan, Value: float64(1)}, true},
+		{"equals with matching type", TargetingRule{Attribute: "beta", Operator: OpEquals, Value: true}, false},
+		{"equals with other type", TargetingRule{Attribute: "beta", Operator: OpEquals, Value: "true"}, true},
+		{"in list with matching types", TargetingRule{Attribute: "plan", Operator: OpInList, Value: []any{"pro", "team"}}, false},
+		{"in list with other type", TargetingRule{Attribute: "plan", Operator: OpInList, Value: []any{"pro", float64(1)}}, true},
+		{"in list without list", TargetingRule{Attribute: "plan", Operator: OpInList, Value: "pro"}, true},
+		{"semver comparison", TargetingRule{Attribute: "app_version", Operator: OpVersionGreaterThan, Value: "5.2.0"}, false},
+		{"invalid semver", TargetingRule{Attribute: "app_version", Operator: OpVersionGreaterThan, Value: "five"}, true},
+		{"date operator", TargetingRule{Attribute: "signup_date", Operator: OpWithinLastDays, Value: float64(30)}, false},
+		{"cidr operator", TargetingRule{Attribute: "ip", Operator: OpIPInCIDR, Value: "10.0.0.0/8"}, false},
+		{"cidr operator on string", TargetingRule{Attribute: "plan", Operator: OpIPInCIDR, Value: "10.0.0.0/8"}, true},
+		{"undeclared attribute", TargetingRule{Attribute: "country", Operator: OpGreaterThan, Value: "DE"}, false},
+		{"segment reference", TargetingRule{Operator: OpInSegment, Value: "beta-users"}, false},
+		{"nested mismatch", TargetingRule{Not: &TargetingRule{Any: []TargetingRule{{Attribute: "age", Operator: OpEquals, Value: "18"}}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := schema.ValidateRules([]TargetingRule{tt.rule}); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEmptyAttributeSchemaAcceptsAnyRules(t *testing.T) {
+	rules := []TargetingRule{{Attribute: "age", Operator: OpGreaterThan, Value: "eighteen"}}
+	if err := NewAttributeSchema(nil).ValidateRules(rules); err != nil {
+		t.Errorf("ValidateRules() error = %v, want nil", err)
+	}
+}
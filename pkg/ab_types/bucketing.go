@@ -0,0 +1,193 @@
+package ab_types
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// DefaultBucketBy - единица рандомизации по умолчанию.
+const DefaultBucketBy = "user_id"
+
+// BucketByOrDefault возвращает единицу рандомизации эксперимента.
+func (e *Experiment) BucketByOrDefault() string {
+	if e.BucketBy == "" {
+		return DefaultBucketBy
+	}
+	return e.BucketBy
+}
+
+// BucketKey возвращает идентификатор единицы рандомизации bucketBy: user_id берется из userID,
+// остальные единицы - из identifiers, а затем из строковых attributes.
+// Возвращает false, если идентификатор не передан.
+func BucketKey(bucketBy, userID string, identifiers map[string]string, attributes map[string]any) (string, bool) {
+	if bucketBy == "" {
+		bucketBy = DefaultBucketBy
+	}
+	if bucketBy == DefaultBucketBy && userID != "" {
+		return userID, true
+	}
+	if id := identifiers[bucketBy]; id != "" {
+		return id, true
+	}
+	if id, ok := attributes[bucketBy].(string); ok && id != "" {
+		return id, true
+	}
+	return "", false
+}
+
+// LegacyBucketResolution - число бакетов экспериментов без BucketResolution.
+// Сохраняется для уже созданных экспериментов, чтобы пользователи не перераспределились.
+const LegacyBucketResolution = 1000
+
+// MaxBucketResolution - максимально допустимое число бакетов.
+const MaxBucketResolution = 1000000
+
+// Resolution возвращает число бакетов эксперимента.
+func (e *Experiment) Resolution() int {
+	if e.BucketResolution <= 0 {
+		return LegacyBucketResolution
+	}
+	return e.BucketResolution
+}
+
+// Версии схемы бакетирования (Experiment.BucketingVersion).
+const (
+	// BucketingLegacy - хеш от конкатенации ключа и соли без разделителя.
+	// Неоднозначна: ключ "ab" с солью "c" и ключ "a" с солью "bc" попадают в один бакет.
+	// Версия 0 (не задана) означает эту схему.
+	BucketingLegacy = 1
+	// BucketingLengthPrefixed - хеш от полей с префиксом длины: однозначное кодирование.
+	BucketingLengthPrefixed = 2
+	// LatestBucketingVersion назначается новым экспериментам.
+	LatestBucketingVersion = BucketingLengthPrefixed
+)
+
+// bucketingVersion возвращает схему бакетирования эксперимента.
+func (e *Experiment) bucketingVersion() int {
+	if e.BucketingVersion == 0 {
+		return BucketingLegacy
+	}
+	return e.BucketingVersion
+}
+
+// Bucket возвращает бакет ключа рандомизации в диапазоне [0, Resolution()).
+func (e *Experiment) Bucket(bucketKey string) int {
+	return int(BucketHash(e.bucketingVersion(), bucketKey, e.Salt) % uint64(e.Resolution()))
+}
+
+// BucketHash возвращает хеш пары (ключ, соль) по схеме version.
+func BucketHash(version int, bucketKey, salt string) uint64 {
+	if version != BucketingLengthPrefixed {
+		return xxhash.Sum64String(bucketKey + salt)
+	}
+
+	// Каждое поле кодируется как uvarint(длина) + байты, поэтому границы полей однозначны.
+	buf := make([]byte, 0, 2*binary.MaxVarintLen64+len(bucketKey)+len(salt))
+	buf = binary.AppendUvarint(buf, uint64(len(salt)))
+	buf = append(buf, salt...)
+	buf = binary.AppendUvarint(buf, uint64(len(bucketKey)))
+	buf = append(buf, bucketKey...)
+	return xxhash.Sum64(buf)
+}
+
+// VariantForBucket возвращает вариант, диапазон которого содержит bucket, или nil.
+func (e *Experiment) VariantForBucket(bucket int) *Variant {
+	for i := range e.Variants {
+		if e.Variants[i].Contains(bucket) {
+			return &e.Variants[i]
+		}
+	}
+	return nil
+}
+
+// Contains сообщает, входит ли bucket в диапазон варианта.
+// Диапазон с концом меньше начала (например, [0, -1] у варианта с 0%) пуст.
+func (v *Variant) Contains(bucket int) bool {
+	return !v.emptyRange() && bucket >= v.BucketRange[0] && bucket <= v.BucketRange[1]
+}
+
+func (v *Variant) emptyRange() bool {
+	return v.BucketRange[1] < v.BucketRange[0]
+}
+
+// ApplyPercentAllocation переводит Percent вариантов в диапазоны бакетов.
+// Варианты с Percent идут подряд с бакета 0 в порядке объявления; границы округляются
+// от накопленной доли, поэтому ошибки округления не накапливаются.
+// Если ни у одного варианта нет Percent, диапазоны не меняются.
+func (e *Experiment) ApplyPercentAllocation() error {
+	hasPercent := false
+	for _, variant := range e.Variants {
+		if variant.Percent != nil {
+			hasPercent = true
+		}
+	}
+	if !hasPercent {
+		return nil
+	}
+
+	resolution := e.Resolution()
+	var cumulative float64
+	start := 0
+	for i := range e.Variants {
+		variant := &e.Variants[i]
+		if variant.Percent == nil {
+			return fmt.Errorf("variant %q: percent must be set for all variants or none", variant.Name)
+		}
+		percent := *variant.Percent
+		if _, err := percentBuckets(percent, resolution); err != nil {
+			return fmt.Errorf("variant %q: %w", variant.Name, err)
+		}
+
+		cumulative += percent
+		if cumulative > 100+1e-9 {
+			return fmt.Errorf("variant percents sum to more than 100")
+		}
+		end := int(math.Round(cumulative * float64(resolution) / 100))
+		variant.BucketRange = [2]int{start, end - 1}
+		start = end
+	}
+	return nil
+}
+
+// percentBuckets переводит долю трафика в число бакетов при заданном разрешении.
+func percentBuckets(percent float64, resolution int) (int, error) {
+	if percent < 0 || percent > 100 {
+		return 0, fmt.Errorf("percent %v is out of range [0, 100]", percent)
+	}
+	buckets := percent * float64(resolution) / 100
+	if math.Abs(buckets-math.Round(buckets)) > 1e-6 {
+		return 0, fmt.Errorf("%v%% is not a whole number of buckets at resolution %d", percent, resolution)
+	}
+	return int(math.Round(buckets)), nil
+}
+
+// ValidateBuckets проверяет разрешение и диапазоны бакетов: диапазоны лежат в [0, Resolution())
+// и непустые диапазоны не пересекаются.
+func (e *Experiment) ValidateBuckets() error {
+	switch e.BucketingVersion {
+	case 0, BucketingLegacy, BucketingLengthPrefixed:
+	default:
+		return fmt.Errorf("unknown bucketing_version %d", e.BucketingVersion)
+	}
+	if e.BucketResolution < 0 || e.BucketResolution > MaxBucketResolution {
+		return fmt.Errorf("bucket_resolution must be 0 (default) or between 1 and %d", MaxBucketResolution)
+	}
+	resolution := e.Resolution()
+	for i, variant := range e.Variants {
+		if variant.emptyRange() {
+			continue
+		}
+		if variant.BucketRange[0] < 0 || variant.BucketRange[1] >= resolution {
+			return fmt.Errorf("variant %q: bucket range %v is outside [0, %d]", variant.Name, variant.BucketRange, resolution-1)
+		}
+		for _, other := range e.Variants[:i] {
+			if !other.emptyRange() && variant.BucketRange[0] <= other.BucketRange[1] && other.BucketRange[0] <= variant.BucketRange[1] {
+				return fmt.Errorf("variants %q and %q have overlapping bucket ranges", other.Name, variant.Name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,356 @@
+package ab_types
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"testing"
+)
+
+// Параметры статистических проверок бакетирования. Ключи пользователей фиксированы,
+// поэтому результат детерминирован; alpha - уровень значимости критериев хи-квадрат.
+const (
+	bucketingTestUsers = 1000000
+	bucketingTestAlpha = 0.001
+	uniformityBins     = 100
+	independenceBins   = 10
+)
+
+func bucketingTestKeys() []string {
+	keys := make([]string, bucketingTestUsers)
+	for i := range keys {
+		keys[i] = "user-" + strconv.Itoa(i)
+	}
+	return keys
+}
+
+func TestBucketUniformity(t *testing.T) {
+	keys := bucketingTestKeys()
+	for _, resolution := range []int{1000, 10000, 100000} {
+		t.Run(strconv.Itoa(resolution), func(t *testing.T) {
+			exp := &Experiment{Salt: "salt-uniformity", BucketResolution: resolution, BucketingVersion: LatestBucketingVersion}
+			chi2, df := uniformity(exp, keys)
+			if p := chiSquarePValue(chi2, df); p < bucketingTestAlpha {
+				t.Errorf("buckets are not uniform: chi2 = %.1f, df = %d, p = %.5f", chi2, df, p)
+			}
+		})
+	}
+}
+
+func TestBucketIndependence(t *testing.T) {
+	keys := bucketingTestKeys()
+	// Соли с общими префиксами и суффиксами - худший случай для конкатенации.
+	for _, salts := range [][2]string{{"a", "b"}, {"exp", "exp1"}, {"1", "11"}} {
+		t.Run(fmt.Sprintf("%s-%s", salts[0], salts[1]), func(t *testing.T) {
+			first := &Experiment{Salt: salts[0], BucketingVersion: LatestBucketingVersion}
+			second := &Experiment{Salt: salts[1], BucketingVersion: LatestBucketingVersion}
+			chi2, df := independence(first, second, keys)
+			if p := chiSquarePValue(chi2, df); p < bucketingTestAlpha {
+				t.Errorf("buckets are dependent: chi2 = %.1f, df = %d, p = %.5f", chi2, df, p)
+			}
+		})
+	}
+}
+
+func TestBucketHashUnambiguous(t *testing.T) {
+	tests := []struct {
+		version  int
+		collides bool
+	}{
+		{BucketingLegacy, true},
+		{BucketingLengthPrefixed, false},
+	}
+	for _, tt := range tests {
+		collides := BucketHash(tt.version, "ab", "c") == BucketHash(tt.version, "a", "bc")
+		if collides != tt.collides {
+			t.Errorf("version %d: key \"ab\"+salt \"c\" collides with key \"a\"+salt \"bc\" = %v, want %v", tt.version, collides, tt.collides)
+		}
+	}
+}
+
+// TestBucketHashStable фиксирует значения хеша: их изменение перераспределит пользователей
+// во всех запущенных экспериментах.
+func TestBucketHashStable(t *testing.T) {
+	tests := []struct {
+		version   int
+		key, salt string
+		want      uint64
+	}{
+		{BucketingLegacy, "user-1", "salt", 13066132163862559553},
+		{BucketingLegacy, "", "", 17241709254077376921},
+		{BucketingLengthPrefixed, "user-1", "salt", 15107991660812885856},
+		{BucketingLengthPrefixed, "ab", "c", 11406851383364747967},
+		{BucketingLengthPrefixed, "a", "bc", 3245985933102876100},
+		{BucketingLengthPrefixed, "", "", 11145182160106660097},
+	}
+	for _, tt := range tests {
+		if got := BucketHash(tt.version, tt.key, tt.salt); got != tt.want {
+			t.Errorf("BucketHash(%d, %q, %q) = %d, want %d", tt.version, tt.key, tt.salt, got, tt.want)
+		}
+	}
+}
+
+func TestBucketKey(t *testing.T) {
+	identifiers := map[string]string{"device_id": "device-1"}
+	attributes := map[string]any{"org_id": "org-1", "seats": float64(10)}
+
+	tests := []struct {
+		bucketBy, userID string
+		want             string
+		ok               bool
+	}{
+		{"", "user-1", "user-1", true},
+		{"user_id", "user-1", "user-1", true},
+		{"user_id", "", "", false},
+		{"device_id", "user-1", "device-1", true},
+		{"org_id", "user-1", "org-1", true},
+		{"seats", "user-1", "", false},
+		{"session_id", "user-1", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := BucketKey(tt.bucketBy, tt.userID, identifiers, attributes)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("BucketKey(%q, %q) = %q, %v, want %q, %v", tt.bucketBy, tt.userID, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestBucketUsesLegacySchemeByDefault(t *testing.T) {
+	unversioned := &Experiment{Salt: "exp-salt"}
+	legacy := &Experiment{Salt: "exp-salt", BucketingVersion: BucketingLegacy}
+	for i := 0; i < 100; i++ {
+		key := "user-" + strconv.Itoa(i)
+		if got, want := unversioned.Bucket(key), legacy.Bucket(key); got != want {
+			t.Fatalf("Bucket(%q) = %d, want legacy bucket %d", key, got, want)
+		}
+		if bucket := unversioned.Bucket(key); bucket < 0 || bucket >= LegacyBucketResolution {
+			t.Fatalf("Bucket(%q) = %d, want [0, %d)", key, bucket, LegacyBucketResolution)
+		}
+	}
+}
+
+func TestVariantForBucket(t *testing.T) {
+	exp := &Experiment{Variants: []Variant{
+		{Name: "control", BucketRange: [2]int{0, 499}},
+		{Name: "off", BucketRange: [2]int{0, -1}},
+		{Name: "treatment", BucketRange: [2]int{500, 899}},
+	}}
+	tests := []struct {
+		bucket int
+		want   string
+	}{
+		{0, "control"},
+		{499, "control"},
+		{500, "treatment"},
+		{899, "treatment"},
+		{900, ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if variant := exp.VariantForBucket(tt.bucket); variant != nil {
+			got = variant.Name
+		}
+		if got != tt.want {
+			t.Errorf("VariantForBucket(%d) = %q, want %q", tt.bucket, got, tt.want)
+		}
+	}
+}
+
+func TestApplyPercentAllocation(t *testing.T) {
+	percent := func(p float64) *float64 { return &p }
+
+	tests := []struct {
+		name       string
+		resolution int
+		variants   []Variant
+		want       [][2]int
+		wantErr    bool
+	}{
+		{
+			name:     "halves",
+			variants: []Variant{{Name: "control", Percent: percent(50)}, {Name: "treatment", Percent: percent(50)}},
+			want:     [][2]int{{0, 499}, {500, 999}},
+		},
+		{
+			name:     "zero percent variant",
+			variants: []Variant{{Name: "control", Percent: percent(10)}, {Name: "off", Percent: percent(0)}, {Name: "treatment", Percent: percent(10)}},
+			want:     [][2]int{{0, 99}, {100, 99}, {100, 199}},
+		},
+		{
+			name:       "thirds at fine resolution",
+			resolution: 100000,
+			variants:   []Variant{{Name: "a", Percent: percent(33.333)}, {Name: "b", Percent: percent(33.333)}, {Name: "c", Percent: percent(33.334)}},
+			want:       [][2]int{{0, 33332}, {33333, 66665}, {66666, 99999}},
+		},
+		{
+			name:     "no percents keeps ranges",
+			variants: []Variant{{Name: "control", BucketRange: [2]int{10, 20}}},
+			want:     [][2]int{{10, 20}},
+		},
+		{
+			name:     "not a whole number of buckets",
+			variants: []Variant{{Name: "control", Percent: percent(0.05)}},
+			wantErr:  true,
+		},
+		{
+			name:     "sum over 100",
+			variants: []Variant{{Name: "control", Percent: percent(60)}, {Name: "treatment", Percent: percent(50)}},
+			wantErr:  true,
+		},
+		{
+			name:     "mixed percents and ranges",
+			variants: []Variant{{Name: "control", Percent: percent(50)}, {Name: "treatment", BucketRange: [2]int{500, 999}}},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exp := &Experiment{BucketResolution: tt.resolution, Variants: tt.variants}
+			err := exp.ApplyPercentAllocation()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ApplyPercentAllocation() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			for i, variant := range exp.Variants {
+				if variant.BucketRange != tt.want[i] {
+					t.Errorf("variant %q: BucketRange = %v, want %v", variant.Name, variant.BucketRange, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestValidateBuckets(t *testing.T) {
+	tests := []struct {
+		name    string
+		exp     Experiment
+		wantErr bool
+	}{
+		{"legacy resolution", Experiment{Variants: []Variant{{Name: "a", BucketRange: [2]int{0, 499}}, {Name: "b", BucketRange: [2]int{500, 999}}}}, false},
+		{"fine resolution", Experiment{BucketResolution: 100000, Variants: []Variant{{Name: "a", BucketRange: [2]int{0, 99999}}}}, false},
+		{"empty ranges may overlap", Experiment{Variants: []Variant{{Name: "a", BucketRange: [2]int{0, 999}}, {Name: "b", BucketRange: [2]int{0, -1}}}}, false},
+		{"outside resolution", Experiment{Variants: []Variant{{Name: "a", BucketRange: [2]int{0, 1000}}}}, true},
+		{"negative start", Experiment{Variants: []Variant{{Name: "a", BucketRange: [2]int{-1, 10}}}}, true},
+		{"overlapping ranges", Experiment{Variants: []Variant{{Name: "a", BucketRange: [2]int{0, 500}}, {Name: "b", BucketRange: [2]int{500, 999}}}}, true},
+		{"default resolution", Experiment{BucketResolution: 0, Variants: []Variant{{Name: "a", BucketRange: [2]int{0, LegacyBucketResolution - 1}}}}, false},
+		{"negative resolution", Experiment{BucketResolution: -1}, true},
+		{"resolution too large", Experiment{BucketResolution: MaxBucketResolution + 1}, true},
+		{"unknown bucketing version", Experiment{BucketingVersion: 3}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.exp.ValidateBuckets(); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateBuckets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// uniformity считает статистику хи-квадрат для распределения пользователей по интервалам бакетов.
+func uniformity(exp *Experiment, keys []string) (float64, int) {
+	counts := make([]float64, uniformityBins)
+	for _, key := range keys {
+		counts[exp.Bucket(key)*uniformityBins/exp.Resolution()]++
+	}
+	expected := float64(len(keys)) / uniformityBins
+	var chi2 float64
+	for _, observed := range counts {
+		chi2 += (observed - expected) * (observed - expected) / expected
+	}
+	return chi2, uniformityBins - 1
+}
+
+// independence считает статистику хи-квадрат для таблицы сопряженности бакетов
+// одного пользователя в двух экспериментах.
+func independence(first, second *Experiment, keys []string) (float64, int) {
+	var table [independenceBins][independenceBins]float64
+	var rows, cols [independenceBins]float64
+	for _, key := range keys {
+		i := first.Bucket(key) * independenceBins / first.Resolution()
+		j := second.Bucket(key) * independenceBins / second.Resolution()
+		table[i][j]++
+		rows[i]++
+		cols[j]++
+	}
+	total := float64(len(keys))
+	var chi2 float64
+	for i := range table {
+		for j := range table[i] {
+			expected := rows[i] * cols[j] / total
+			chi2 += (table[i][j] - expected) * (table[i][j] - expected) / expected
+		}
+	}
+	return chi2, (independenceBins - 1) * (independenceBins - 1)
+}
+
+// chiSquarePValue возвращает P(X >= chi2) для распределения хи-квадрат с df степенями свободы.
+func chiSquarePValue(chi2 float64, df int) float64 {
+	return upperIncompleteGamma(float64(df)/2, chi2/2)
+}
+
+// upperIncompleteGamma - регуляризованная верхняя неполная гамма-функция Q(a, x):
+// ряд при x < a+1, иначе цепная дробь (метод Лентца).
+func upperIncompleteGamma(a, x float64) float64 {
+	if x <= 0 {
+		return 1
+	}
+	lgamma, _ := math.Lgamma(a)
+	prefix := math.Exp(-x + a*math.Log(x) - lgamma)
+
+	if x < a+1 {
+		sum, term := 1/a, 1/a
+		for n := 1; n < 1000; n++ {
+			term *= x / (a + float64(n))
+			sum += term
+			if math.Abs(term) < math.Abs(sum)*1e-15 {
+				break
+			}
+		}
+		return 1 - sum*prefix
+	}
+
+	const tiny = 1e-300
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+	for n := 1; n < 1000; n++ {
+		an := -float64(n) * (float64(n) - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < 1e-15 {
+			break
+		}
+	}
+	return prefix * h
+}
+
+func TestChiSquarePValue(t *testing.T) {
+	// Табличные критические значения хи-квадрат.
+	tests := []struct {
+		chi2 float64
+		df   int
+		want float64
+	}{
+		{3.841, 1, 0.05},
+		{18.307, 10, 0.05},
+		{148.230, 99, 0.001},
+	}
+	for _, tt := range tests {
+		if got := chiSquarePValue(tt.chi2, tt.df); math.Abs(got-tt.want) > tt.want*0.01 {
+			t.Errorf("chiSquarePValue(%v, %d) = %.5f, want %.5f", tt.chi2, tt.df, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package ab_types
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// CoercionMode определяет, как вычислители сравнивают атрибут пользователя со значением
+// правила разных типов.
+type CoercionMode string
+
+const (
+	// CoercionLenient приводит типы: числа сравниваются численно ("1.0" == 1), логические
+	// значения - как bool ("true" == true), остальное - как строки.
+	CoercionLenient CoercionMode = "lenient"
+	// CoercionStrict требует совпадения типов: строка со строкой, число с числом,
+	// bool с bool. Несовпадение типов - ошибка сравнения, а не false.
+	CoercionStrict CoercionMode = "strict"
+)
+
+// ParseCoercionMode разбирает имя режима; пустая строка означает CoercionLenient.
+func ParseCoercionMode(name string) (CoercionMode, error) {
+	switch CoercionMode(name) {
+	case "", CoercionLenient:
+		return CoercionLenient, nil
+	case CoercionStrict:
+		return CoercionStrict, nil
+	default:
+		return "", fmt.Errorf("unknown coercion mode %q (expected %q or %q)", name, CoercionLenient, CoercionStrict)
+	}
+}
+
+// ToFloat64 возвращает значение числового типа (включая json.Number) как float64.
+// Строки не разбираются: это делает CoercionMode.Number в нестрогом режиме.
+func ToFloat64(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// Number приводит значение к числу. ok == false означает несовпадение типов.
+func (m CoercionMode) Number(v any) (float64, bool) {
+	if f, ok := ToFloat64(v); ok {
+		return f, true
+	}
+	if s, ok := v.(string); ok && m != CoercionStrict {
+		f, err := strconv.ParseFloat(s, 64)
+		return f, err == nil && !math.IsNaN(f)
+	}
+	return 0, false
+}
+
+// String приводит значение к строке. В строгом режиме принимаются только строки,
+// в нестрогом - также числа и логические значения.
+func (m CoercionMode) String(v any) (string, bool) {
+	if s, ok := v.(string); ok {
+		return s, true
+	}
+	if m == CoercionStrict {
+		return "", false
+	}
+	if f, ok := ToFloat64(v); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64), true
+	}
+	if b, ok := v.(bool); ok {
+		return strconv.FormatBool(b), true
+	}
+	return "", false
+}
+
+// Equal сравнивает атрибут пользователя со значением правила. ok == false означает,
+// что значения несравнимы (в строгом режиме - разные типы).
+func (m CoercionMode) Equal(user, rule any) (equal, ok bool) {
+	userNum, userIsNum := ToFloat64(user)
+	ruleNum, ruleIsNum := ToFloat64(rule)
+	userBool, userIsBool := user.(bool)
+	ruleBool, ruleIsBool := rule.(bool)
+	userStr, userIsStr := user.(string)
+	ruleStr, ruleIsStr := rule.(string)
+
+	switch {
+	case userIsNum && ruleIsNum:
+		return userNum == ruleNum, true
+	case userIsBool && ruleIsBool:
+		return userBool == ruleBool, true
+	case userIsStr && ruleIsStr:
+		return userStr == ruleStr, true
+	case m == CoercionStrict:
+		return false, false
+	case userIsNum || ruleIsNum:
+		// Одно из значений - число: сравниваем численно, если второе - числовая строка.
+		u, ok1 := m.Number(user)
+		r, ok2 := m.Number(rule)
+		if ok1 && ok2 {
+			return u == r, true
+		}
+	case userIsBool || ruleIsBool:
+		u, ok1 := parseBoolValue(user)
+		r, ok2 := parseBoolValue(rule)
+		if ok1 && ok2 {
+			return u == r, true
+		}
+	}
+	u, ok1 := m.String(user)
+	r, ok2 := m.String(rule)
+	if !ok1 || !ok2 {
+		return false, false
+	}
+	return u == r, true
+}
+
+func parseBoolValue(v any) (bool, bool) {
+	switch b := v.(type) {
+	case bool:
+		return b, true
+	case string:
+		parsed, err := strconv.ParseBool(b)
+		return parsed, err == nil
+	default:
+		return false, false
+	}
+}
@@ -0,0 +1,130 @@
+package ab_types
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseCoercionMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    CoercionMode
+		wantErr bool
+	}{
+		{"", CoercionLenient, false},
+		{"lenient", CoercionLenient, false},
+		{"strict", CoercionStrict, false},
+		{"Strict", "", true},
+		{"loose", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseCoercionMode(tt.name)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseCoercionMode(%q) = %q, %v, want %q, wantErr %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestToFloat64(t *testing.T) {
+	tests := []struct {
+		value any
+		want  float64
+		ok    bool
+	}{
+		{float64(1.5), 1.5, true},
+		{float32(2.5), 2.5, true},
+		{int(3), 3, true},
+		{int8(-4), -4, true},
+		{int64(5), 5, true},
+		{uint16(6), 6, true},
+		{uint64(7), 7, true},
+		{json.Number("8.25"), 8.25, true},
+		{json.Number("abc"), 0, false},
+		{"9", 0, false},
+		{true, 0, false},
+		{nil, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := ToFloat64(tt.value)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ToFloat64(%#v) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCoercionModeNumber(t *testing.T) {
+	tests := []struct {
+		mode  CoercionMode
+		value any
+		want  float64
+		ok    bool
+	}{
+		{CoercionLenient, float64(1), 1, true},
+		{CoercionLenient, "1.5", 1.5, true},
+		{CoercionLenient, "NaN", 0, false},
+		{CoercionLenient, "abc", 0, false},
+		{CoercionLenient, true, 0, false},
+		{CoercionStrict, float64(1), 1, true},
+		{CoercionStrict, "1.5", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := tt.mode.Number(tt.value)
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("%s.Number(%#v) = %v, %v, want %v, %v", tt.mode, tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCoercionModeString(t *testing.T) {
+	tests := []struct {
+		mode  CoercionMode
+		value any
+		want  string
+		ok    bool
+	}{
+		{CoercionLenient, "a", "a", true},
+		{CoercionLenient, float64(1.5), "1.5", true},
+		{CoercionLenient, int(10), "10", true},
+		{CoercionLenient, true, "true", true},
+		{CoercionLenient, []any{"a"}, "", false},
+		{CoercionStrict, "a", "a", true},
+		{CoercionStrict, float64(1.5), "", false},
+		{CoercionStrict, true, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := tt.mode.String(tt.value)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s.String(%#v) = %q, %v, want %q, %v", tt.mode, tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCoercionModeEqual(t *testing.T) {
+	tests := []struct {
+		name       string
+		user, rule any
+		lenient    [2]bool // equal, ok
+		strict     [2]bool
+	}{
+		{"same strings", "pro", "pro", [2]bool{true, true}, [2]bool{true, true}},
+		{"different strings", "pro", "free", [2]bool{false, true}, [2]bool{false, true}},
+		{"float and int", float64(1), int(1), [2]bool{true, true}, [2]bool{true, true}},
+		{"json number", json.Number("2.0"), float64(2), [2]bool{true, true}, [2]bool{true, true}},
+		{"numeric string", "1.0", float64(1), [2]bool{true, true}, [2]bool{false, false}},
+		{"number and numeric string", float64(1), "1", [2]bool{true, true}, [2]bool{false, false}},
+		{"number and text", float64(1), "one", [2]bool{false, true}, [2]bool{false, false}},
+		{"bools", true, true, [2]bool{true, true}, [2]bool{true, true}},
+		{"bool and string", "true", true, [2]bool{true, true}, [2]bool{false, false}},
+		{"bool and non-bool string", "yes", true, [2]bool{false, true}, [2]bool{false, false}},
+		{"list", []any{"a"}, "a", [2]bool{false, false}, [2]bool{false, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for mode, want := range map[CoercionMode][2]bool{CoercionLenient: tt.lenient, CoercionStrict: tt.strict} {
+				if equal, ok := mode.Equal(tt.user, tt.rule); equal != want[0] || ok != want[1] {
+					t.Errorf("%s.Equal(%#v, %#v) = %v, %v, want %v, %v", mode, tt.user, tt.rule, equal, ok, want[0], want[1])
+				}
+			}
+		})
+	}
+}
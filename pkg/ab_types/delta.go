@@ -0,0 +1,40 @@
+package ab_types
+
+// Типы событий outbox, публикуемых в топик дельт.
+const (
+	EventUpsert = "UPSERT"
+	EventDelete = "DELETE"
+	// EventFlagUpsert и EventFlagDelete - изменения флагов (тело - Flag и FlagDeletePayload).
+	EventFlagUpsert = "FLAG_UPSERT"
+	EventFlagDelete = "FLAG_DELETE"
+	// EventSegmentUpsert и EventSegmentDelete - изменения сегментов (тело - Segment и SegmentDeletePayload).
+	EventSegmentUpsert = "SEGMENT_UPSERT"
+	EventSegmentDelete = "SEGMENT_DELETE"
+	// EventIDListUpsert и EventIDListDelete - изменения метаданных списков идентификаторов
+	// (тело - IDList и IDListDeletePayload).
+	EventIDListUpsert = "ID_LIST_UPSERT"
+	EventIDListDelete = "ID_LIST_DELETE"
+)
+
+// Заголовки сообщений в топике дельт.
+const (
+	// DeltaHeaderSeq - номер изменения проекта (config_state.seq) в десятичной записи.
+	// Сравнивается с Snapshot.Seq, чтобы применять только дельты после снэпшота.
+	DeltaHeaderSeq = "ab-seq"
+	// DeltaHeaderEventType - тип события (EventUpsert, EventDelete, EventFlag*, EventSegment* или EventIDList*).
+	DeltaHeaderEventType = "ab-event-type"
+	// DeltaHeaderEnvironment - окружение измененного эксперимента. Отсутствует у событий,
+	// относящихся ко всем окружениям (флаги хранят состояние всех окружений сразу, сегменты
+	// и списки идентификаторов общие для всех окружений).
+	DeltaHeaderEnvironment = "ab-environment"
+)
+
+// DeletePayload - тело события EventDelete.
+type DeletePayload struct {
+	ID string `json:"id"`
+}
+
+// FlagDeletePayload - тело события EventFlagDelete.
+type FlagDeletePayload struct {
+	Key string `json:"key"`
+}
@@ -0,0 +1,49 @@
+package ab_types
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// namePattern - допустимые имена окружений и проектов: они входят в имена объектов MinIO
+// и топиков Kafka.
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// ValidateEnvironmentName проверяет имя окружения.
+// Имена projectsPrefix и idListsPrefix зарезервированы: под ними лежат снэпшоты проектов
+// и списки идентификаторов.
+func ValidateEnvironmentName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid environment name %q: expected lowercase letters, digits, '-' and '_'", name)
+	}
+	if name == projectsPrefix || name == idListsPrefix {
+		return fmt.Errorf("environment name %q is reserved", name)
+	}
+	return nil
+}
+
+// EnvironmentOrDefault возвращает окружение эксперимента.
+// Эксперименты, созданные до появления окружений, относятся к DefaultEnvironment.
+func (e *Experiment) EnvironmentOrDefault() string {
+	if e.Environment == "" {
+		return DefaultEnvironment
+	}
+	return e.Environment
+}
+
+// SnapshotPrefix возвращает префикс объектов снэпшотов проекта и окружения в бакете.
+// Снэпшоты DefaultProject лежат там же, где до появления проектов (DefaultEnvironment - в корне
+// бакета, остальные окружения - в каталоге окружения), поэтому существующие клиенты читают их
+// без изменений. Снэпшоты других проектов лежат в projects/<проект>/<окружение>/.
+func SnapshotPrefix(project, environment string) string {
+	if environment == "" {
+		environment = DefaultEnvironment
+	}
+	if project != "" && project != DefaultProject {
+		return projectsPrefix + "/" + project + "/" + environment + "/"
+	}
+	if environment == DefaultEnvironment {
+		return ""
+	}
+	return environment + "/"
+}
@@ -2,7 +2,10 @@
 
 package ab_types
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // ExperimentStatus определяет возможные статусы эксперимента.
 type ExperimentStatus string
@@ -38,6 +41,19 @@ const (
 	// Операторы для списков/массивов
 	OpInList    Operator = "IN_LIST"
 	OpNotInList Operator = "NOT_IN_LIST"
+
+	// Операторы для строковых шаблонов
+	OpMatchesRegex Operator = "MATCHES_REGEX"
+	OpStartsWith   Operator = "STARTS_WITH"
+	OpEndsWith     Operator = "ENDS_WITH"
+
+	// Операторы для дат (см. ParseRuleTime)
+	OpDateBefore     Operator = "DATE_BEFORE"
+	OpDateAfter      Operator = "DATE_AFTER"
+	OpWithinLastDays Operator = "WITHIN_LAST_DAYS"
+
+	// Операторы для IP-адресов (см. ParseCIDRs)
+	OpIPInCIDR Operator = "IP_IN_CIDR"
 )
 
 // Experiment представляет полную конфигурацию A/B-эксперимента.
@@ -57,6 +73,15 @@ type Experiment struct {
 
 	// Salt - уникальная строка для хеширования, обеспечивает статистическую независимость.
 	Salt string `json:"salt"`
+	// BucketBy - единица рандомизации: user_id (по умолчанию) или имя идентификатора
+	// (device_id, session_id, org_id и т.п.) из DecisionContext.Identifiers или атрибутов.
+	BucketBy string `json:"bucket_by,omitempty"`
+	// BucketResolution - число бакетов (например, 10000 или 100000 для долей меньше 0.1%).
+	// 0 означает LegacyBucketResolution (1000).
+	BucketResolution int `json:"bucket_resolution,omitempty"`
+	// BucketingVersion - схема вычисления хеша (BucketingLegacy, BucketingLengthPrefixed).
+	// Фиксируется при создании, чтобы распределение эксперимента не менялось; 0 означает BucketingLegacy.
+	BucketingVersion int `json:"bucketing_version,omitempty"`
 
 	// Status - текущий жизненный цикл эксперимента.
 	Status ExperimentStatus `json:"status"`
@@ -70,16 +95,37 @@ type Experiment struct {
 
 	// Variants - массив вариантов (групп) теста.
 	Variants []Variant `json:"variants"`
+	// Sticky - назначенный пользователю вариант сохраняется в AssignmentStore и не меняется
+	// при последующих изменениях диапазонов бакетов и правил таргетинга, пока эксперимент активен.
+	Sticky bool `json:"sticky,omitempty"`
+	// ProjectID - проект эксперимента; пусто означает DefaultProject. Задается при создании
+	// по API-ключу запроса и не меняется. Слои (LayerID) разных проектов независимы.
+	ProjectID string `json:"project_id,omitempty"`
+	// Environment - окружение эксперимента ("production", "staging"...); пусто означает DefaultEnvironment.
+	// Задается при создании и не меняется: перенос в другое окружение - через promote.
+	Environment string `json:"environment,omitempty"`
+	// Ramp - план постепенного раскатывания варианта (опционально). Применяется планировщиком central-api.
+	Ramp *RampPlan `json:"ramp,omitempty"`
+	// ParameterSchema - схема параметров вариантов: [имя параметра] -> тип.
+	ParameterSchema map[string]ParameterSpec `json:"parameter_schema,omitempty"`
 }
 
-// TargetingRule определяет одно правило для таргетинга.
+// TargetingRule определяет одно правило для таргетинга: сравнение атрибута (Attribute,
+// Operator, Value) или группу правил (ровно одно из All, Any, Not).
 type TargetingRule struct {
 	// Attribute - атрибут пользователя для проверки (например, "country", "app_version").
-	Attribute string `json:"attribute"`
+	Attribute string `json:"attribute,omitempty"`
 	// Operator - операция для сравнения.
-	Operator Operator `json:"operator"`
+	Operator Operator `json:"operator,omitempty"`
 	// Value - значение, с которым сравнивается атрибут пользователя.
-	Value any `json:"value"`
+	Value any `json:"value,omitempty"`
+
+	// All - группа выполняется, если выполнены все вложенные правила.
+	All []TargetingRule `json:"all,omitempty"`
+	// Any - группа выполняется, если выполнено хотя бы одно вложенное правило.
+	Any []TargetingRule `json:"any,omitempty"`
+	// Not - группа выполняется, если вложенное правило не выполнено.
+	Not *TargetingRule `json:"not,omitempty"`
 }
 
 // OverrideLists содержит списки пользователей для принудительного включения/исключения.
@@ -88,12 +134,74 @@ type OverrideLists struct {
 	// Ключ - имя варианта, значение - массив ID пользователей.
 	ForceInclude map[string][]string `json:"force_include"`
 	ForceExclude []string            `json:"force_exclude"`
+	// ForceIncludeLists и ForceExcludeLists - то же по загруженным спискам идентификаторов
+	// (ID списков IDList). Предназначены для больших списков, которые не стоит хранить в эксперименте.
+	ForceIncludeLists map[string][]string `json:"force_include_lists,omitempty"`
+	ForceExcludeLists []string            `json:"force_exclude_lists,omitempty"`
+}
+
+// OverrideSet - inline-оверрайды эксперимента (ForceExclude, ForceInclude), преобразованные
+// в множества при загрузке конфигурации, чтобы проверка не зависела от длины списков.
+// Нулевое значение никого не включает и не исключает.
+type OverrideSet struct {
+	exclude map[string]struct{}
+	// include - множества пользователей, индексированные по имени варианта.
+	include map[string]map[string]struct{}
+}
+
+// NewOverrideSet строит множества inline-оверрайдов o.
+func NewOverrideSet(o *OverrideLists) OverrideSet {
+	var set OverrideSet
+	if len(o.ForceExclude) > 0 {
+		set.exclude = make(map[string]struct{}, len(o.ForceExclude))
+		for _, id := range o.ForceExclude {
+			set.exclude[id] = struct{}{}
+		}
+	}
+	if len(o.ForceInclude) > 0 {
+		set.include = make(map[string]map[string]struct{}, len(o.ForceInclude))
+		for variantName, ids := range o.ForceInclude {
+			members := make(map[string]struct{}, len(ids))
+			for _, id := range ids {
+				members[id] = struct{}{}
+			}
+			set.include[variantName] = members
+		}
+	}
+	return set
+}
+
+// Excluded сообщает, исключен ли unitID из эксперимента через ForceExclude.
+func (s OverrideSet) Excluded(unitID string) bool {
+	_, ok := s.exclude[unitID]
+	return ok
+}
+
+// IncludedVariant возвращает вариант, в который unitID включен через ForceInclude.
+func (s OverrideSet) IncludedVariant(unitID string) (string, bool) {
+	for variantName, members := range s.include {
+		if _, ok := members[unitID]; ok {
+			return variantName, true
+		}
+	}
+	return "", false
 }
 
 // Variant определяет один из вариантов в эксперименте (контрольный или тестовый).
 type Variant struct {
 	// Name - уникальное в рамках эксперимента имя варианта (например, "control", "treatment_A").
 	Name string `json:"name"`
-	// BucketRange - диапазон бакетов [от, до] (включительно), от 0 до 999.
+	// BucketRange - диапазон бакетов [от, до] (включительно), от 0 до Resolution()-1.
+	// Диапазон с концом меньше начала пуст.
 	BucketRange [2]int `json:"bucket_range"`
+	// Percent - доля трафика в процентах. Если задана, central-api пересчитывает ее в BucketRange.
+	Percent *float64 `json:"percent,omitempty"`
+	// Parameters - значения параметров варианта (удаленная конфигурация), [имя] -> JSON-значение.
+	// Допустимые имена и типы задаются в Experiment.ParameterSchema.
+	Parameters map[string]json.RawMessage `json:"parameters,omitempty"`
+}
+
+// HasVariant сообщает, есть ли в эксперименте вариант с именем name.
+func (e *Experiment) HasVariant(name string) bool {
+	return e.FindVariant(name) != nil
 }
@@ -0,0 +1,40 @@
+package ab_types
+
+import "testing"
+
+func TestOverrideSet(t *testing.T) {
+	set := NewOverrideSet(&OverrideLists{
+		ForceInclude: map[string][]string{"control": {"user-1"}, "treatment": {"user-2", "user-3"}},
+		ForceExclude: []string{"user-4"},
+	})
+
+	tests := []struct {
+		unitID       string
+		wantExcluded bool
+		wantVariant  string
+	}{
+		{"user-1", false, "control"},
+		{"user-3", false, "treatment"},
+		{"user-4", true, ""},
+		{"user-5", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.unitID, func(t *testing.T) {
+			if got := set.Excluded(tt.unitID); got != tt.wantExcluded {
+				t.Errorf("Excluded() = %v, want %v", got, tt.wantExcluded)
+			}
+			variantName, ok := set.IncludedVariant(tt.unitID)
+			if variantName != tt.wantVariant || ok != (tt.wantVariant != "") {
+				t.Errorf("IncludedVariant() = %q, %v, want %q", variantName, ok, tt.wantVariant)
+			}
+		})
+	}
+
+	var empty OverrideSet
+	if empty.Excluded("user-1") {
+		t.Error("zero OverrideSet excludes users")
+	}
+	if _, ok := empty.IncludedVariant("user-1"); ok {
+		t.Error("zero OverrideSet includes users")
+	}
+}
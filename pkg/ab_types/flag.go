@@ -0,0 +1,92 @@
+package ab_types
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// DefaultEnvironment - окружение по умолчанию для экспериментов, флагов и клиентов.
+	DefaultEnvironment = "production"
+
+	// FlagBucketResolution - число бакетов раскатки флага (шаг доли 0.001%).
+	FlagBucketResolution = 100000
+)
+
+// Flag - фиче-флаг: включение функциональности без вариантов и событий назначения.
+// Состояние (включен ли флаг, таргетинг и доля раскатки) задается отдельно для каждого окружения.
+type Flag struct {
+	Key string `json:"key"`
+	// ProjectID - проект флага; ключ уникален в пределах проекта. Пусто означает DefaultProject.
+	ProjectID   string `json:"project_id,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Default - значение флага, если он выключен в окружении или окружение не настроено.
+	Default bool `json:"default"`
+	// BucketBy - идентификатор, по которому считается доля раскатки (см. Experiment.BucketBy).
+	BucketBy      string `json:"bucket_by,omitempty"`
+	Salt          string `json:"salt"`
+	ConfigVersion string `json:"config_version"`
+	// Environments - состояние флага по окружениям ("production", "staging"...).
+	Environments map[string]FlagEnvironment `json:"environments"`
+}
+
+// FlagEnvironment - состояние флага в одном окружении.
+type FlagEnvironment struct {
+	// Enabled - флаг включен; выключенный флаг для всех возвращает Flag.Default (kill switch).
+	Enabled bool `json:"enabled"`
+	// TargetingRules - пользователи, не прошедшие правила, получают false.
+	TargetingRules []TargetingRule `json:"targeting_rules,omitempty"`
+	// Rollout - доля прошедших таргетинг пользователей (в процентах), для которых флаг включен.
+	// nil означает 100%. Доля растет монотонно: при увеличении пользователи не выпадают из раскатки.
+	Rollout *float64 `json:"rollout,omitempty"`
+}
+
+// FlagAggregateID возвращает ключ событий outbox флага. Префикс отделяет флаги
+// от экспериментов с тем же идентификатором.
+func FlagAggregateID(key string) string {
+	return "flag:" + key
+}
+
+// Validate проверяет ключ флага, правила таргетинга и доли раскатки во всех окружениях.
+func (f *Flag) Validate() error {
+	if f.Key == "" {
+		return errors.New("flag key is required")
+	}
+	for name, env := range f.Environments {
+		if name == "" {
+			return errors.New("environment name must not be empty")
+		}
+		if env.Rollout != nil {
+			if _, err := percentBuckets(*env.Rollout, FlagBucketResolution); err != nil {
+				return fmt.Errorf("environment %q: rollout: %w", name, err)
+			}
+		}
+		if err := ValidateTargetingRules(env.TargetingRules); err != nil {
+			return fmt.Errorf("environment %q: targeting rules: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// TargetingRules возвращает правила таргетинга флага во всех окружениях.
+func (f *Flag) TargetingRules() []TargetingRule {
+	var rules []TargetingRule
+	for _, env := range f.Environments {
+		rules = append(rules, env.TargetingRules...)
+	}
+	return rules
+}
+
+// InRollout сообщает, попадает ли ключ рандомизации в долю раскатки окружения.
+// Пользователь включен, если его бакет меньше числа бакетов доли, поэтому увеличение
+// доли только добавляет пользователей.
+func (f *Flag) InRollout(env *FlagEnvironment, bucketKey string) bool {
+	if env.Rollout == nil {
+		return true
+	}
+	buckets, err := percentBuckets(*env.Rollout, FlagBucketResolution)
+	if err != nil {
+		return false
+	}
+	return int(BucketHash(LatestBucketingVersion, bucketKey, f.Salt)%FlagBucketResolution) < buckets
+}
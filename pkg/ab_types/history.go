@@ -0,0 +1,22 @@
+package ab_types
+
+import "time"
+
+// HistoryPromote - перенос конфигурации эксперимента в другое окружение.
+const HistoryPromote = "PROMOTE"
+
+// HistoryEntry - запись истории изменений эксперимента.
+type HistoryEntry struct {
+	ID int64 `json:"id"`
+	// ExperimentID и Environment - эксперимент, который был изменен.
+	ExperimentID string `json:"experiment_id"`
+	Environment  string `json:"environment"`
+	Action       string `json:"action"`
+	// SourceExperimentID и SourceEnvironment - откуда перенесена конфигурация (для HistoryPromote).
+	SourceExperimentID string `json:"source_experiment_id,omitempty"`
+	SourceEnvironment  string `json:"source_environment,omitempty"`
+	ConfigVersion      string `json:"config_version"`
+	// Experiment - конфигурация эксперимента после изменения.
+	Experiment Experiment `json:"experiment"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
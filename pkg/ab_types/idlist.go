@@ -0,0 +1,163 @@
+package ab_types
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Операторы проверки вхождения в загруженный список идентификаторов. Value - ID списка
+// того же проекта, Attribute - идентификатор пользователя, как в Experiment.BucketBy
+// (пусто - user_id, иначе имя из Identifiers или строковый атрибут).
+const (
+	OpInIDList    Operator = "IN_ID_LIST"
+	OpNotInIDList Operator = "NOT_IN_ID_LIST"
+)
+
+// idListsPrefix - каталог объектов списков идентификаторов в бакете снэпшотов.
+// Листинги снэпшотов фильтруются по SnapshotObjectPrefix, поэтому списки им не мешают.
+const idListsPrefix = "id-lists"
+
+// IDList - метаданные загруженного списка идентификаторов (пользователей, устройств...).
+// Содержимое хранится отдельно, в объекте ObjectKey бакета снэпшотов: в снэпшоты и дельты
+// попадают только метаданные, а клиенты загружают содержимое и строят по нему хеш-множество.
+type IDList struct {
+	ID string `json:"id"`
+	// ProjectID - проект списка. Пусто означает DefaultProject.
+	ProjectID   string `json:"project_id,omitempty"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Size - число уникальных идентификаторов.
+	Size int `json:"size"`
+	// Checksum - SHA-256 (hex) содержимого объекта.
+	Checksum string `json:"checksum,omitempty"`
+	// ObjectKey - объект с содержимым; пусто, пока содержимое не загружено (пустой список).
+	// Каждая загрузка создает новый объект, поэтому содержимое по ключу не меняется.
+	ObjectKey     string    `json:"object_key,omitempty"`
+	ConfigVersion string    `json:"config_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// IDListDeletePayload - тело события EventIDListDelete.
+type IDListDeletePayload struct {
+	ID string `json:"id"`
+}
+
+// IDListAggregateID возвращает ключ событий outbox списка идентификаторов.
+func IDListAggregateID(id string) string {
+	return "id-list:" + id
+}
+
+// ProjectOrDefault возвращает проект списка.
+func (l *IDList) ProjectOrDefault() string {
+	return projectOrDefault(l.ProjectID)
+}
+
+// IDListObjectKey возвращает имя объекта с содержимым версии configVersion списка.
+func IDListObjectKey(project, id, configVersion string) string {
+	return idListsPrefix + "/" + projectOrDefault(project) + "/" + id + "/" + configVersion + ".txt"
+}
+
+// IDListObjectPrefix возвращает каталог всех версий содержимого списка.
+func IDListObjectPrefix(project, id string) string {
+	return idListsPrefix + "/" + projectOrDefault(project) + "/" + id + "/"
+}
+
+// EncodeIDs возвращает каноническое содержимое списка: уникальные идентификаторы
+// в отсортированном порядке, по одному на строку.
+func EncodeIDs(ids []string) []byte {
+	ids = slices.Clone(ids)
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+
+	var buf bytes.Buffer
+	for _, id := range ids {
+		buf.WriteString(id)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// ParseIDs разбирает содержимое списка, записанное по одному идентификатору на строку.
+// Пустые строки пропускаются, пробелы по краям отбрасываются.
+func ParseIDs(data []byte) []string {
+	var ids []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if id := strings.TrimSpace(line); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// IDListChecksum возвращает SHA-256 (hex) содержимого списка.
+func IDListChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Verify сверяет загруженное содержимое с контрольной суммой из метаданных.
+func (l *IDList) Verify(data []byte) error {
+	if l.Checksum != "" && IDListChecksum(data) != l.Checksum {
+		return fmt.Errorf("id list %s: checksum mismatch", l.ID)
+	}
+	return nil
+}
+
+// IDListKey возвращает ID списка, если правило проверяет вхождение в список.
+func (r *TargetingRule) IDListKey() (string, bool) {
+	if r.Operator != OpInIDList && r.Operator != OpNotInIDList {
+		return "", false
+	}
+	id, _ := r.Value.(string)
+	return id, true
+}
+
+// ReferencedIDLists возвращает ID списков, на которые ссылаются правила (включая
+// вложенные в группы), без повторов. Ошибка - если значение правила-ссылки
+// не является непустой строкой.
+func ReferencedIDLists(rules []TargetingRule) ([]string, error) {
+	var ids []string
+	var err error
+	walkRuleLeaves(rules, func(rule *TargetingRule) {
+		id, ok := rule.IDListKey()
+		if !ok || err != nil {
+			return
+		}
+		if id == "" {
+			err = fmt.Errorf("operator %s requires an id list ID as value", rule.Operator)
+			return
+		}
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// OverrideIDLists возвращает ID списков, на которые ссылаются оверрайды эксперимента.
+func (o *OverrideLists) OverrideIDLists() []string {
+	ids := slices.Clone(o.ForceExcludeLists)
+	for _, lists := range o.ForceIncludeLists {
+		ids = append(ids, lists...)
+	}
+	slices.Sort(ids)
+	return slices.Compact(ids)
+}
+
+// ReferencesIDList сообщает, ссылаются ли правила или оверрайды эксперимента на список id.
+func (e *Experiment) ReferencesIDList(id string) bool {
+	if slices.Contains(e.OverrideLists.OverrideIDLists(), id) {
+		return true
+	}
+	ids, _ := ReferencedIDLists(e.TargetingRules)
+	return slices.Contains(ids, id)
+}
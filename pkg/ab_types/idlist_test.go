@@ -0,0 +1,132 @@
+package ab_types
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestEncodeIDs(t *testing.T) {
+	tests := []struct {
+		name string
+		ids  []string
+		want string
+	}{
+		{"empty", nil, ""},
+		{"sorted and unique", []string{"user-2", "user-1", "user-2", "user-3"}, "user-1\nuser-2\nuser-3\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := slices.Clone(tt.ids)
+			if got := string(EncodeIDs(tt.ids)); got != tt.want {
+				t.Errorf("EncodeIDs(%q) = %q, want %q", tt.ids, got, tt.want)
+			}
+			if !slices.Equal(tt.ids, input) {
+				t.Errorf("EncodeIDs modified its input: %q, want %q", tt.ids, input)
+			}
+		})
+	}
+}
+
+func TestParseIDs(t *testing.T) {
+	tests := []struct {
+		data string
+		want []string
+	}{
+		{"", nil},
+		{"user-1\nuser-2\n", []string{"user-1", "user-2"}},
+		{"  user-1 \r\n\n\tuser-2", []string{"user-1", "user-2"}},
+	}
+	for _, tt := range tests {
+		if got := ParseIDs([]byte(tt.data)); !slices.Equal(got, tt.want) {
+			t.Errorf("ParseIDs(%q) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeParseIDsRoundTrip(t *testing.T) {
+	ids := []string{"device-b", "device-a", "device-c"}
+	got := ParseIDs(EncodeIDs(ids))
+	if want := []string{"device-a", "device-b", "device-c"}; !slices.Equal(got, want) {
+		t.Errorf("ParseIDs(EncodeIDs(%q)) = %q, want %q", ids, got, want)
+	}
+}
+
+func TestIDListVerify(t *testing.T) {
+	data := EncodeIDs([]string{"user-1", "user-2"})
+	// SHA-256 от "user-1\nuser-2\n".
+	const checksum = "f7dffe76d6ed349dea5fb371c984b6eaf580d48d9c052142f0d2006002c5c619"
+	if got := IDListChecksum(data); got != checksum {
+		t.Fatalf("IDListChecksum() = %q, want %q", got, checksum)
+	}
+
+	tests := []struct {
+		name     string
+		checksum string
+		wantErr  bool
+	}{
+		{"matching checksum", checksum, false},
+		{"no checksum", "", false},
+		{"other checksum", IDListChecksum([]byte("user-1\n")), true},
+	}
+	for _, tt := range tests {
+		list := IDList{ID: "beta-users", Checksum: tt.checksum}
+		if err := list.Verify(data); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Verify() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestIDListObjectKey(t *testing.T) {
+	if got, want := IDListObjectKey("", "beta", "v1"), "id-lists/default/beta/v1.txt"; got != want {
+		t.Errorf("IDListObjectKey() = %q, want %q", got, want)
+	}
+	if got, want := IDListObjectPrefix("search", "beta"), "id-lists/search/beta/"; got != want {
+		t.Errorf("IDListObjectPrefix() = %q, want %q", got, want)
+	}
+}
+
+func TestReferencedIDLists(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []TargetingRule
+		want    []string
+		wantErr bool
+	}{
+		{"no references", []TargetingRule{{Attribute: "country", Operator: OpEquals, Value: "DE"}}, nil, false},
+		{"nested without duplicates", []TargetingRule{
+			{Operator: OpInIDList, Value: "beta"},
+			{Any: []TargetingRule{
+				{Operator: OpNotInIDList, Value: "blocked"},
+				{Not: &TargetingRule{Operator: OpInIDList, Value: "beta"}},
+			}},
+		}, []string{"beta", "blocked"}, false},
+		{"empty list id", []TargetingRule{{Operator: OpInIDList, Value: ""}}, nil, true},
+		{"non-string list id", []TargetingRule{{Operator: OpInIDList, Value: float64(1)}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReferencedIDLists(tt.rules)
+			if (err != nil) != tt.wantErr || !slices.Equal(got, tt.want) {
+				t.Errorf("ReferencedIDLists() = %q, %v, want %q, wantErr %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExperimentReferencesIDList(t *testing.T) {
+	exp := Experiment{
+		TargetingRules: []TargetingRule{{Not: &TargetingRule{Operator: OpInIDList, Value: "employees"}}},
+		OverrideLists: OverrideLists{
+			ForceExcludeLists: []string{"blocked"},
+			ForceIncludeLists: map[string][]string{"treatment": {"beta", "blocked"}},
+		},
+	}
+	if got, want := exp.OverrideLists.OverrideIDLists(), []string{"beta", "blocked"}; !slices.Equal(got, want) {
+		t.Errorf("OverrideIDLists() = %q, want %q", got, want)
+	}
+	for id, want := range map[string]bool{"employees": true, "beta": true, "blocked": true, "other": false} {
+		if got := exp.ReferencesIDList(id); got != want {
+			t.Errorf("ReferencesIDList(%q) = %v, want %v", id, got, want)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package ab_types
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ruleDateLayout - формат даты без времени в правилах и атрибутах (полночь UTC).
+const ruleDateLayout = "2006-01-02"
+
+// ParseRuleTime разбирает момент времени из значения правила или атрибута:
+// строку RFC 3339, дату YYYY-MM-DD (полночь UTC) или Unix-время в секундах (число).
+func ParseRuleTime(v any) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case string:
+		if parsed, err := time.Parse(time.RFC3339, t); err == nil {
+			return parsed, true
+		}
+		parsed, err := time.Parse(ruleDateLayout, t)
+		return parsed, err == nil
+	case float64:
+		return time.Unix(0, int64(t*float64(time.Second))), true
+	case int64:
+		return time.Unix(t, 0), true
+	case int:
+		return time.Unix(int64(t), 0), true
+	default:
+		return time.Time{}, false
+	}
+}
+
+// WithinLastDaysWindow возвращает окно оператора WITHIN_LAST_DAYS: значение правила - число дней.
+func WithinLastDaysWindow(v any) (time.Duration, bool) {
+	var days float64
+	switch d := v.(type) {
+	case float64:
+		days = d
+	case int:
+		days = float64(d)
+	case int64:
+		days = float64(d)
+	default:
+		return 0, false
+	}
+	if days <= 0 {
+		return 0, false
+	}
+	return time.Duration(days * float64(24*time.Hour)), true
+}
+
+// IPAttribute - атрибут, в который вычислители кладут IP-адрес пользователя из запроса
+// (DecisionRequest.IP в central-api, DecisionContext.IP в SDK), если он не передан явно.
+const IPAttribute = "ip"
+
+// ParseCIDRs разбирает значение правила IP_IN_CIDR: диапазон CIDR ("10.0.0.0/8")
+// или адрес ("192.0.2.1"), либо список таких строк.
+func ParseCIDRs(v any) ([]netip.Prefix, bool) {
+	var values []any
+	switch value := v.(type) {
+	case string:
+		values = []any{value}
+	case []any:
+		values = value
+	case []string:
+		for _, s := range value {
+			values = append(values, s)
+		}
+	default:
+		return nil, false
+	}
+	if len(values) == 0 {
+		return nil, false
+	}
+
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, item := range values {
+		s, ok := item.(string)
+		if !ok {
+			return nil, false
+		}
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(s)
+			if addrErr != nil {
+				return nil, false
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, true
+}
+
+// IPInCIDRs сообщает, входит ли адрес ip (строка) хотя бы в один из диапазонов правила IP_IN_CIDR.
+// IPv4-адреса в форме IPv6 (::ffff:a.b.c.d) сравниваются как IPv4.
+func IPInCIDRs(ip string, prefixes []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// RegexPattern возвращает шаблон, если правило использует оператор MATCHES_REGEX.
+func (r *TargetingRule) RegexPattern() (string, bool) {
+	if r.Operator != OpMatchesRegex {
+		return "", false
+	}
+	pattern, ok := r.Value.(string)
+	return pattern, ok
+}
+
+// RegexPatterns возвращает шаблоны MATCHES_REGEX из правил (включая вложенные в группы).
+func RegexPatterns(rules []TargetingRule) []string {
+	var patterns []string
+	walkRuleLeaves(rules, func(rule *TargetingRule) {
+		if pattern, ok := rule.RegexPattern(); ok {
+			patterns = append(patterns, pattern)
+		}
+	})
+	return patterns
+}
+
+// RuleRegexps - скомпилированные шаблоны MATCHES_REGEX, индексированные по тексту шаблона.
+// Вычислители компилируют шаблоны при загрузке конфигурации, а не при каждой проверке правила.
+type RuleRegexps map[string]*regexp.Regexp
+
+// Compile компилирует шаблоны правил, которых еще нет в m. Некорректные шаблоны пропускаются
+// (правила с ними не пропускают пользователей); возвращается первая ошибка компиляции.
+func (m RuleRegexps) Compile(rules []TargetingRule) error {
+	var firstErr error
+	for _, pattern := range RegexPatterns(rules) {
+		if _, ok := m[pattern]; ok {
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("invalid regex %q: %w", pattern, err)
+			}
+			continue
+		}
+		m[pattern] = re
+	}
+	return firstErr
+}
+
+// CIDRKey возвращает ключ значения правила IP_IN_CIDR в RuleCIDRs - диапазоны через запятую.
+func (r *TargetingRule) CIDRKey() (string, bool) {
+	if r.Operator != OpIPInCIDR {
+		return "", false
+	}
+	switch value := r.Value.(type) {
+	case string:
+		return value, true
+	case []string:
+		return strings.Join(value, ","), true
+	case []any:
+		items := make([]string, len(value))
+		for i, item := range value {
+			s, ok := item.(string)
+			if !ok {
+				return "", false
+			}
+			items[i] = s
+		}
+		return strings.Join(items, ","), true
+	default:
+		return "", false
+	}
+}
+
+// CIDRKeys возвращает ключи значений правил IP_IN_CIDR (включая вложенные в группы).
+func CIDRKeys(rules []TargetingRule) []string {
+	var keys []string
+	walkRuleLeaves(rules, func(rule *TargetingRule) {
+		if key, ok := rule.CIDRKey(); ok {
+			keys = append(keys, key)
+		}
+	})
+	return keys
+}
+
+// RuleCIDRs - разобранные диапазоны правил IP_IN_CIDR, индексированные по CIDRKey.
+// Как и RuleRegexps, заполняется при загрузке конфигурации, а не при каждой проверке правила.
+type RuleCIDRs map[string][]netip.Prefix
+
+// Compile разбирает диапазоны правил, которых еще нет в m. Некорректные значения пропускаются
+// (правила с ними не пропускают пользователей); возвращается первая ошибка разбора.
+func (m RuleCIDRs) Compile(rules []TargetingRule) error {
+	var firstErr error
+	walkRuleLeaves(rules, func(rule *TargetingRule) {
+		if rule.Operator != OpIPInCIDR {
+			return
+		}
+		// Значение, для которого нет ключа, не разбирается и ParseCIDRs.
+		key, _ := rule.CIDRKey()
+		if _, found := m[key]; found {
+			return
+		}
+		prefixes, ok := ParseCIDRs(rule.Value)
+		if !ok {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("invalid CIDR range %v", rule.Value)
+			}
+			return
+		}
+		m[key] = prefixes
+	})
+	return firstErr
+}
+
+// Prefixes возвращает диапазоны правила IP_IN_CIDR. Значение, которого нет в m,
+// разбирается на месте.
+func (m RuleCIDRs) Prefixes(rule *TargetingRule) ([]netip.Prefix, bool) {
+	if key, ok := rule.CIDRKey(); ok {
+		if prefixes, found := m[key]; found {
+			return prefixes, true
+		}
+	}
+	return ParseCIDRs(rule.Value)
+}
+
+// validateOperatorValue проверяет значение сравнения для операторов, которым нужно
+// значение определенного вида. Остальные операторы проверяются при вычислении.
+func validateOperatorValue(rule *TargetingRule) error {
+	switch rule.Operator {
+	case OpMatchesRegex:
+		pattern, ok := rule.Value.(string)
+		if !ok {
+			return fmt.Errorf("operator %s requires a regex string as value", rule.Operator)
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid regex %q: %w", pattern, err)
+		}
+	case OpStartsWith, OpEndsWith:
+		if value, ok := rule.Value.(string); !ok || value == "" {
+			return fmt.Errorf("operator %s requires a non-empty string as value", rule.Operator)
+		}
+	case OpDateBefore, OpDateAfter:
+		if _, ok := ParseRuleTime(rule.Value); !ok {
+			return fmt.Errorf("operator %s requires an RFC 3339 timestamp, a YYYY-MM-DD date or Unix seconds as value", rule.Operator)
+		}
+	case OpIPInCIDR:
+		if _, ok := ParseCIDRs(rule.Value); !ok {
+			return errors.New("operator IP_IN_CIDR requires a CIDR range, an IP address or a list of them as value")
+		}
+	case OpWithinLastDays:
+		if _, ok := WithinLastDaysWindow(rule.Value); !ok {
+			return errors.New("operator WITHIN_LAST_DAYS requires a positive number of days as value")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package ab_types
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRuleTime(t *testing.T) {
+	tests := []struct {
+		value any
+		want  time.Time
+		ok    bool
+	}{
+		{"2024-03-01T12:30:00Z", time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC), true},
+		{"2024-03-01T15:30:00+03:00", time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC), true},
+		{"2024-03-01", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), true},
+		{float64(1709296200), time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC), true},
+		{float64(1709296200.5), time.Date(2024, 3, 1, 12, 30, 0, int(500*time.Millisecond), time.UTC), true},
+		{int64(1709296200), time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC), true},
+		{int(1709296200), time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC), true},
+		{"01.03.2024", time.Time{}, false},
+		{true, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseRuleTime(tt.value)
+		if ok != tt.ok || (ok && !got.Equal(tt.want)) {
+			t.Errorf("ParseRuleTime(%#v) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestWithinLastDaysWindow(t *testing.T) {
+	tests := []struct {
+		value any
+		want  time.Duration
+		ok    bool
+	}{
+		{float64(30), 30 * 24 * time.Hour, true},
+		{float64(0.5), 12 * time.Hour, true},
+		{int(7), 7 * 24 * time.Hour, true},
+		{int64(1), 24 * time.Hour, true},
+		{float64(0), 0, false},
+		{float64(-1), 0, false},
+		{"30", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := WithinLastDaysWindow(tt.value)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("WithinLastDaysWindow(%#v) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestIPInCIDRs(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		ip    string
+		want  bool
+	}{
+		{"ipv4 range", "10.0.0.0/8", "10.1.2.3", true},
+		{"outside ipv4 range", "10.0.0.0/8", "11.0.0.1", false},
+		{"unmasked range", "192.168.1.77/24", "192.168.1.1", true},
+		{"single address", "192.0.2.1", "192.0.2.1", true},
+		{"other address", "192.0.2.1", "192.0.2.2", false},
+		{"list", []any{"203.0.113.0/24", "2001:db8::/32"}, "2001:db8::1", true},
+		{"string list", []string{"203.0.113.0/24"}, "203.0.113.9", true},
+		{"ipv4-mapped ipv6", "10.0.0.0/8", "::ffff:10.0.0.1", true},
+		{"invalid ip", "10.0.0.0/8", "not-an-ip", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefixes, ok := ParseCIDRs(tt.value)
+			if !ok {
+				t.Fatalf("ParseCIDRs(%#v) failed", tt.value)
+			}
+			if got := IPInCIDRs(tt.ip, prefixes); got != tt.want {
+				t.Errorf("IPInCIDRs(%q, %v) = %v, want %v", tt.ip, prefixes, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCIDRsRejectsInvalidValues(t *testing.T) {
+	for _, value := range []any{"10.0.0.0/33", "example.com", []any{}, []any{"10.0.0.0/8", float64(1)}, float64(10)} {
+		if prefixes, ok := ParseCIDRs(value); ok {
+			t.Errorf("ParseCIDRs(%#v) = %v, want failure", value, prefixes)
+		}
+	}
+}
+
+func TestRuleRegexpsCompile(t *testing.T) {
+	rules := []TargetingRule{
+		{Attribute: "email", Operator: OpMatchesRegex, Value: `@example\.com$`},
+		{Any: []TargetingRule{
+			{Attribute: "email", Operator: OpMatchesRegex, Value: `^admin@`},
+			{Attribute: "name", Operator: OpMatchesRegex, Value: `(`},
+		}},
+		{Attribute: "country", Operator: OpEquals, Value: "DE"},
+	}
+
+	regexps := make(RuleRegexps)
+	if err := regexps.Compile(rules); err == nil {
+		t.Error("Compile() error = nil, want invalid regex error")
+	}
+	if len(regexps) != 2 {
+		t.Fatalf("Compile() compiled %d patterns, want 2", len(regexps))
+	}
+	if re := regexps[`@example\.com$`]; re == nil || !re.MatchString("user@example.com") {
+		t.Errorf("pattern @example\\.com$ does not match user@example.com")
+	}
+	if _, ok := regexps[`(`]; ok {
+		t.Error("invalid pattern was stored")
+	}
+}
+
+func TestRuleCIDRsCompile(t *testing.T) {
+	rules := []TargetingRule{
+		{Attribute: "ip", Operator: OpIPInCIDR, Value: "10.0.0.0/8"},
+		{Any: []TargetingRule{
+			{Attribute: "ip", Operator: OpIPInCIDR, Value: []any{"203.0.113.0/24", "2001:db8::/32"}},
+			{Attribute: "ip", Operator: OpIPInCIDR, Value: "10.0.0.0/99"},
+		}},
+		{Attribute: "country", Operator: OpEquals, Value: "DE"},
+	}
+
+	cidrs := make(RuleCIDRs)
+	if err := cidrs.Compile(rules); err == nil {
+		t.Error("Compile() error = nil, want invalid CIDR error")
+	}
+	if len(cidrs) != 2 {
+		t.Fatalf("Compile() parsed %d values, want 2", len(cidrs))
+	}
+
+	tests := []struct {
+		name string
+		rule TargetingRule
+		ip   string
+		want bool
+		ok   bool
+	}{
+		{"precompiled range", rules[0], "10.1.2.3", true, true},
+		{"precompiled list", rules[1].Any[0], "2001:db8::1", true, true},
+		{"not precompiled", TargetingRule{Operator: OpIPInCIDR, Value: []string{"192.0.2.0/24"}}, "192.0.2.7", true, true},
+		{"invalid range", rules[1].Any[1], "10.1.2.3", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefixes, ok := cidrs.Prefixes(&tt.rule)
+			if ok != tt.ok {
+				t.Fatalf("Prefixes() ok = %v, want %v", ok, tt.ok)
+			}
+			if got := IPInCIDRs(tt.ip, prefixes); got != tt.want {
+				t.Errorf("IPInCIDRs(%q, %v) = %v, want %v", tt.ip, prefixes, got, tt.want)
+			}
+		})
+	}
+
+	// Разобранные заранее диапазоны берутся из кэша, а не из значения правила.
+	cidrs["10.0.0.0/8"] = nil
+	if prefixes, ok := cidrs.Prefixes(&rules[0]); !ok || prefixes != nil {
+		t.Errorf("Prefixes() = %v, %v, want the precompiled value", prefixes, ok)
+	}
+}
+
+func TestValidateOperatorValue(t *testing.T) {
+	tests := []struct {
+		rule    TargetingRule
+		wantErr bool
+	}{
+		{TargetingRule{Attribute: "email", Operator: OpMatchesRegex, Value: `^a`}, false},
+		{TargetingRule{Attribute: "email", Operator: OpMatchesRegex, Value: `[`}, true},
+		{TargetingRule{Attribute: "email", Operator: OpMatchesRegex, Value: float64(1)}, true},
+		{TargetingRule{Attribute: "path", Operator: OpStartsWith, Value: "/api"}, false},
+		{TargetingRule{Attribute: "path", Operator: OpEndsWith, Value: ""}, true},
+		{TargetingRule{Attribute: "signup", Operator: OpDateBefore, Value: "2024-01-01"}, false},
+		{TargetingRule{Attribute: "signup", Operator: OpDateAfter, Value: "yesterday"}, true},
+		{TargetingRule{Attribute: "ip", Operator: OpIPInCIDR, Value: "10.0.0.0/8"}, false},
+		{TargetingRule{Attribute: "ip", Operator: OpIPInCIDR, Value: "10.0.0.0/99"}, true},
+		{TargetingRule{Attribute: "signup", Operator: OpWithinLastDays, Value: float64(30)}, false},
+		{TargetingRule{Attribute: "signup", Operator: OpWithinLastDays, Value: float64(0)}, true},
+		{TargetingRule{Attribute: "country", Operator: OpEquals, Value: "DE"}, false},
+	}
+	for _, tt := range tests {
+		if err := validateOperatorValue(&tt.rule); (err != nil) != tt.wantErr {
+			t.Errorf("validateOperatorValue(%s %v) error = %v, wantErr %v", tt.rule.Operator, tt.rule.Value, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package ab_types
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// ParameterType - тип значения параметра варианта.
+type ParameterType string
+
+const (
+	ParamString ParameterType = "string"
+	ParamNumber ParameterType = "number"
+	// ParamInteger - число без дробной части.
+	ParamInteger ParameterType = "integer"
+	ParamBool    ParameterType = "bool"
+	// ParamJSON - произвольное JSON-значение (объект, массив и т.д.).
+	ParamJSON ParameterType = "json"
+)
+
+// ParameterSpec описывает один параметр в схеме эксперимента.
+type ParameterSpec struct {
+	Type ParameterType `json:"type"`
+	// Required - параметр обязан присутствовать в каждом варианте.
+	Required bool `json:"required,omitempty"`
+}
+
+// ValidateParameters проверяет параметры всех вариантов по ParameterSchema эксперимента:
+// каждый параметр объявлен в схеме, имеет объявленный тип, а обязательные параметры заданы.
+func (e *Experiment) ValidateParameters() error {
+	for name, spec := range e.ParameterSchema {
+		switch spec.Type {
+		case ParamString, ParamNumber, ParamInteger, ParamBool, ParamJSON:
+		default:
+			return fmt.Errorf("parameter %q has unknown type %q", name, spec.Type)
+		}
+	}
+
+	for _, variant := range e.Variants {
+		for _, name := range sortedKeys(variant.Parameters) {
+			spec, ok := e.ParameterSchema[name]
+			if !ok {
+				return fmt.Errorf("variant %q: parameter %q is not declared in parameter_schema", variant.Name, name)
+			}
+			if err := spec.Type.check(variant.Parameters[name]); err != nil {
+				return fmt.Errorf("variant %q: parameter %q: %w", variant.Name, name, err)
+			}
+		}
+		for _, name := range sortedKeys(e.ParameterSchema) {
+			if _, ok := variant.Parameters[name]; e.ParameterSchema[name].Required && !ok {
+				return fmt.Errorf("variant %q: required parameter %q is missing", variant.Name, name)
+			}
+		}
+	}
+	return nil
+}
+
+// check проверяет, что raw - валидное JSON-значение типа t.
+func (t ParameterType) check(raw json.RawMessage) error {
+	var value any
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Errorf("invalid JSON value: %w", err)
+	}
+
+	ok := false
+	switch t {
+	case ParamString:
+		_, ok = value.(string)
+	case ParamNumber:
+		_, ok = value.(json.Number)
+	case ParamInteger:
+		if number, isNumber := value.(json.Number); isNumber {
+			_, err := number.Int64()
+			ok = err == nil
+		}
+	case ParamBool:
+		_, ok = value.(bool)
+	case ParamJSON:
+		ok = value != nil
+	}
+	if !ok {
+		return fmt.Errorf("expected %s, got %s", t, string(raw))
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
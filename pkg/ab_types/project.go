@@ -0,0 +1,83 @@
+package ab_types
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultProject - проект экспериментов и флагов, созданных до появления проектов,
+	// и запросов без API-ключа.
+	DefaultProject = "default"
+
+	// DeltasTopic - топик дельт DefaultProject. Дельты остальных проектов публикуются
+	// в отдельные топики (ProjectDeltasTopic), чтобы клиент получал только свой проект.
+	DeltasTopic = "ab_deltas"
+
+	// APIKeyHeader - заголовок HTTP-запроса с API-ключом проекта. Его проверяет central-api
+	// и передают HTTP-источники client-sdk.
+	APIKeyHeader = "X-API-Key"
+
+	// projectsPrefix - каталог снэпшотов проектов, кроме DefaultProject.
+	projectsPrefix = "projects"
+)
+
+// Project - проект (пространство имен) продуктовой группы. Эксперименты, слои и флаги
+// принадлежат проекту: одинаковые слои и ключи флагов разных проектов не пересекаются.
+type Project struct {
+	// ID - неизменяемый идентификатор проекта; входит в имена объектов MinIO и топиков Kafka.
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// APIKey - ключ доступа к API проекта. Ключ хранится только в виде хеша,
+// открытое значение возвращается один раз - при создании.
+type APIKey struct {
+	ID        string `json:"id"`
+	ProjectID string `json:"project_id"`
+	Name      string `json:"name"`
+	// Key - открытое значение ключа; заполняется только в ответе на создание.
+	Key       string    `json:"key,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ValidateProjectID проверяет идентификатор проекта.
+func ValidateProjectID(id string) error {
+	if !namePattern.MatchString(id) {
+		return fmt.Errorf("invalid project id %q: expected lowercase letters, digits, '-' and '_'", id)
+	}
+	return nil
+}
+
+// ProjectOrDefault возвращает проект эксперимента.
+// Эксперименты, созданные до появления проектов, относятся к DefaultProject.
+func (e *Experiment) ProjectOrDefault() string {
+	return projectOrDefault(e.ProjectID)
+}
+
+// ProjectOrDefault возвращает проект флага.
+func (f *Flag) ProjectOrDefault() string {
+	return projectOrDefault(f.ProjectID)
+}
+
+// ProjectOrDefault возвращает проект сегмента.
+func (s *Segment) ProjectOrDefault() string {
+	return projectOrDefault(s.ProjectID)
+}
+
+func projectOrDefault(project string) string {
+	if project == "" {
+		return DefaultProject
+	}
+	return project
+}
+
+// ProjectDeltasTopic возвращает топик дельт проекта. Для DefaultProject это DeltasTopic,
+// поэтому существующие клиенты продолжают читать тот же топик.
+func ProjectDeltasTopic(project string) string {
+	if project == "" || project == DefaultProject {
+		return DeltasTopic
+	}
+	return DeltasTopic + "." + project
+}
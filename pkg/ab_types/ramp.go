@@ -0,0 +1,183 @@
+package ab_types
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RampState - состояние плана постепенного раскатывания.
+type RampState string
+
+const (
+	RampActive    RampState = "ACTIVE"
+	RampPaused    RampState = "PAUSED"
+	RampAborted   RampState = "ABORTED"
+	RampCompleted RampState = "COMPLETED"
+)
+
+// RampStep - шаг раскатывания: с момента At вариант получает Percent трафика.
+type RampStep struct {
+	At      time.Time `json:"at"`
+	Percent float64   `json:"percent"`
+}
+
+// RampPlan - декларативный план раскатывания одного варианта.
+// Диапазон варианта растет от фиксированного бакета StartBucket, поэтому пользователи,
+// уже попавшие в вариант, остаются в нем на всех следующих шагах.
+type RampPlan struct {
+	Variant string     `json:"variant"`
+	Steps   []RampStep `json:"steps"`
+	State   RampState  `json:"state"`
+	// StartBucket - первый бакет диапазона варианта, фиксируется при создании плана.
+	StartBucket int `json:"start_bucket"`
+	// AppliedStep - индекс последнего примененного шага (-1, если ни один не применен).
+	AppliedStep int `json:"applied_step"`
+}
+
+// CurrentPercent возвращает долю трафика, выставленную последним примененным шагом.
+func (p *RampPlan) CurrentPercent() float64 {
+	if p.AppliedStep < 0 || p.AppliedStep >= len(p.Steps) {
+		return 0
+	}
+	return p.Steps[p.AppliedStep].Percent
+}
+
+// DueStep возвращает индекс последнего шага, время которого наступило к now (-1, если таких нет).
+func (p *RampPlan) DueStep(now time.Time) int {
+	due := -1
+	for i, step := range p.Steps {
+		if !step.At.After(now) {
+			due = i
+		}
+	}
+	return due
+}
+
+// NewRampPlan проверяет план для эксперимента и подготавливает его к запуску.
+// Доли шагов не убывают, и ни один шаг не сужает текущий диапазон варианта (в том числе
+// выставленный предыдущим планом previous): пользователи, уже попавшие в вариант, остаются
+// в нем. Диапазон варианта на последнем шаге не пересекается с другими вариантами.
+func (e *Experiment) NewRampPlan(variant string, steps []RampStep, previous *RampPlan) (*RampPlan, error) {
+	target := e.FindVariant(variant)
+	if target == nil {
+		return nil, fmt.Errorf("variant %q not found", variant)
+	}
+	if len(steps) == 0 {
+		return nil, errors.New("ramp plan must have at least one step")
+	}
+
+	startBucket := target.BucketRange[0]
+	if previous != nil && previous.Variant == variant && previous.State != RampAborted {
+		startBucket = previous.StartBucket
+	}
+	// Диапазон растет от startBucket, поэтому шаг должен покрывать текущий диапазон
+	// варианта целиком, сколько бы трафика ни было выставлено до плана.
+	minBuckets := 0
+	if !target.emptyRange() {
+		if target.BucketRange[0] < startBucket {
+			return nil, fmt.Errorf("current bucket range %v of variant %q starts before ramp start bucket %d", target.BucketRange, variant, startBucket)
+		}
+		minBuckets = target.BucketRange[1] - startBucket + 1
+	}
+
+	floor := 0.0
+	for i, step := range steps {
+		if i > 0 && step.At.Before(steps[i-1].At) {
+			return nil, errors.New("ramp steps must be ordered by time")
+		}
+		if step.Percent < floor {
+			return nil, fmt.Errorf("ramp step %d: percent %v is below the previous step %v", i, step.Percent, floor)
+		}
+		buckets, err := e.rampBuckets(step.Percent)
+		if err != nil {
+			return nil, fmt.Errorf("ramp step %d: %w", i, err)
+		}
+		if buckets < minBuckets {
+			return nil, fmt.Errorf("ramp step %d: percent %v would shrink the variant below its current %d buckets", i, step.Percent, minBuckets)
+		}
+		floor = step.Percent
+	}
+
+	plan := &RampPlan{
+		Variant:     variant,
+		Steps:       steps,
+		State:       RampActive,
+		StartBucket: startBucket,
+		AppliedStep: -1,
+	}
+
+	// Проверяем, что на максимальном шаге вариант не налезет на соседей.
+	probe := *e
+	probe.Variants = append([]Variant(nil), e.Variants...)
+	probe.Ramp = plan
+	if err := probe.applyRampPercent(steps[len(steps)-1].Percent); err != nil {
+		return nil, err
+	}
+	if err := probe.ValidateBuckets(); err != nil {
+		return nil, fmt.Errorf("final ramp step does not fit: %w", err)
+	}
+	return plan, nil
+}
+
+// AdvanceRamp применяет наступивший к now шаг плана. Возвращает true, если эксперимент изменился.
+func (e *Experiment) AdvanceRamp(now time.Time) (bool, error) {
+	plan := e.Ramp
+	if plan == nil || plan.State != RampActive {
+		return false, nil
+	}
+	due := plan.DueStep(now)
+	if due <= plan.AppliedStep {
+		return false, nil
+	}
+	if err := e.applyRampPercent(plan.Steps[due].Percent); err != nil {
+		return false, err
+	}
+	plan.AppliedStep = due
+	if due == len(plan.Steps)-1 {
+		plan.State = RampCompleted
+	}
+	return true, nil
+}
+
+// AbortRamp останавливает план и убирает из варианта весь трафик.
+func (e *Experiment) AbortRamp() error {
+	if e.Ramp == nil {
+		return errors.New("experiment has no ramp plan")
+	}
+	if err := e.applyRampPercent(0); err != nil {
+		return err
+	}
+	e.Ramp.State = RampAborted
+	return nil
+}
+
+// applyRampPercent выставляет варианту плана диапазон из percent трафика от StartBucket.
+func (e *Experiment) applyRampPercent(percent float64) error {
+	target := e.FindVariant(e.Ramp.Variant)
+	if target == nil {
+		return fmt.Errorf("variant %q not found", e.Ramp.Variant)
+	}
+	buckets, err := e.rampBuckets(percent)
+	if err != nil {
+		return err
+	}
+	target.BucketRange = [2]int{e.Ramp.StartBucket, e.Ramp.StartBucket + buckets - 1}
+	target.Percent = nil
+	return nil
+}
+
+// rampBuckets переводит долю трафика в число бакетов эксперимента.
+func (e *Experiment) rampBuckets(percent float64) (int, error) {
+	return percentBuckets(percent, e.Resolution())
+}
+
+// FindVariant возвращает вариант с именем name или nil.
+func (e *Experiment) FindVariant(name string) *Variant {
+	for i := range e.Variants {
+		if e.Variants[i].Name == name {
+			return &e.Variants[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package ab_types
+
+import (
+	"testing"
+	"time"
+)
+
+func rampExperiment(treatment [2]int) *Experiment {
+	return &Experiment{Variants: []Variant{
+		{Name: "control", BucketRange: [2]int{0, 499}},
+		{Name: "treatment", BucketRange: treatment},
+	}}
+}
+
+func rampSteps(start time.Time, percents ...float64) []RampStep {
+	steps := make([]RampStep, len(percents))
+	for i, percent := range percents {
+		steps[i] = RampStep{At: start.Add(time.Duration(i) * time.Hour), Percent: percent}
+	}
+	return steps
+}
+
+func TestNewRampPlan(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		treatment [2]int
+		steps     []RampStep
+		previous  *RampPlan
+		wantStart int
+		wantErr   bool
+	}{
+		{"from empty variant", [2]int{500, 499}, rampSteps(start, 1, 10, 50), nil, 500, false},
+		{"covers current range", [2]int{500, 599}, rampSteps(start, 10, 20), nil, 500, false},
+		{"shrinks current range", [2]int{500, 599}, rampSteps(start, 5, 20), nil, 0, true},
+		{"decreasing steps", [2]int{500, 499}, rampSteps(start, 10, 5), nil, 0, true},
+		{"unordered steps", [2]int{500, 499}, []RampStep{{At: start.Add(time.Hour), Percent: 1}, {At: start, Percent: 2}}, nil, 0, true},
+		{"not a whole number of buckets", [2]int{500, 499}, rampSteps(start, 0.05), nil, 0, true},
+		{"final step does not fit", [2]int{500, 499}, rampSteps(start, 60), nil, 0, true},
+		{"no steps", [2]int{500, 499}, nil, nil, 0, true},
+		{
+			name:      "continues previous plan",
+			treatment: [2]int{500, 549},
+			steps:     rampSteps(start, 10),
+			previous:  &RampPlan{Variant: "treatment", State: RampPaused, StartBucket: 500, AppliedStep: 0, Steps: rampSteps(start, 5)},
+			wantStart: 500,
+		},
+		{
+			// Предыдущий план поднял вариант до 5%; новый план не может опуститься ниже.
+			name:      "previous plan traffic is kept",
+			treatment: [2]int{500, 549},
+			steps:     rampSteps(start, 2, 10),
+			previous:  &RampPlan{Variant: "treatment", State: RampPaused, StartBucket: 500, AppliedStep: 0, Steps: rampSteps(start, 5)},
+			wantErr:   true,
+		},
+		{
+			name:      "range starts before previous start bucket",
+			treatment: [2]int{500, 549},
+			steps:     rampSteps(start, 10),
+			previous:  &RampPlan{Variant: "treatment", State: RampPaused, StartBucket: 520, AppliedStep: 0, Steps: rampSteps(start, 3)},
+			wantErr:   true,
+		},
+		{
+			name:      "aborted plan starts over",
+			treatment: [2]int{600, 599},
+			steps:     rampSteps(start, 1),
+			previous:  &RampPlan{Variant: "treatment", State: RampAborted, StartBucket: 500, AppliedStep: -1},
+			wantStart: 600,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exp := rampExperiment(tt.treatment)
+			plan, err := exp.NewRampPlan("treatment", tt.steps, tt.previous)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewRampPlan() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if plan.StartBucket != tt.wantStart || plan.State != RampActive || plan.AppliedStep != -1 {
+				t.Errorf("NewRampPlan() = %+v, want active plan from bucket %d", plan, tt.wantStart)
+			}
+			if exp.Variants[1].BucketRange != tt.treatment {
+				t.Errorf("NewRampPlan() changed the experiment: %v", exp.Variants[1].BucketRange)
+			}
+		})
+	}
+}
+
+func TestNewRampPlanUnknownVariant(t *testing.T) {
+	exp := rampExperiment([2]int{500, 499})
+	if _, err := exp.NewRampPlan("missing", rampSteps(time.Now(), 10), nil); err == nil {
+		t.Error("NewRampPlan() error = nil, want unknown variant error")
+	}
+}
+
+func TestAdvanceRamp(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	exp := rampExperiment([2]int{500, 499})
+	plan, err := exp.NewRampPlan("treatment", rampSteps(start, 1, 10, 50), nil)
+	if err != nil {
+		t.Fatalf("NewRampPlan() error = %v", err)
+	}
+	exp.Ramp = plan
+
+	steps := []struct {
+		now     time.Time
+		changed bool
+		want    [2]int
+		state   RampState
+	}{
+		{start.Add(-time.Minute), false, [2]int{500, 499}, RampActive},
+		{start, true, [2]int{500, 509}, RampActive},
+		{start.Add(30 * time.Minute), false, [2]int{500, 509}, RampActive},
+		// Пропущенные шаги не применяются по очереди: сразу выставляется последний наступивший.
+		{start.Add(3 * time.Hour), true, [2]int{500, 999}, RampCompleted},
+		{start.Add(4 * time.Hour), false, [2]int{500, 999}, RampCompleted},
+	}
+	for _, step := range steps {
+		changed, err := exp.AdvanceRamp(step.now)
+		if err != nil {
+			t.Fatalf("AdvanceRamp(%v) error = %v", step.now, err)
+		}
+		if changed != step.changed || exp.Variants[1].BucketRange != step.want || plan.State != step.state {
+			t.Errorf("AdvanceRamp(%v) = %v, range %v, state %s, want %v, range %v, state %s",
+				step.now, changed, exp.Variants[1].BucketRange, plan.State, step.changed, step.want, step.state)
+		}
+	}
+}
+
+func TestAbortRamp(t *testing.T) {
+	exp := rampExperiment([2]int{500, 599})
+	if err := exp.AbortRamp(); err == nil {
+		t.Error("AbortRamp() without a plan: error = nil, want error")
+	}
+
+	plan, err := exp.NewRampPlan("treatment", rampSteps(time.Now(), 20), nil)
+	if err != nil {
+		t.Fatalf("NewRampPlan() error = %v", err)
+	}
+	exp.Ramp = plan
+	if err := exp.AbortRamp(); err != nil {
+		t.Fatalf("AbortRamp() error = %v", err)
+	}
+	if treatment := exp.Variants[1]; plan.State != RampAborted || !treatment.emptyRange() {
+		t.Errorf("AbortRamp() left state %s and range %v, want aborted plan and empty range", plan.State, treatment.BucketRange)
+	}
+}
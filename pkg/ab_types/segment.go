@@ -0,0 +1,114 @@
+package ab_types
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Операторы ссылок на сегменты. Attribute у таких правил не используется,
+// а Value - ключ сегмента того же проекта.
+const (
+	OpInSegment    Operator = "IN_SEGMENT"
+	OpNotInSegment Operator = "NOT_IN_SEGMENT"
+)
+
+// Segment - именованная аудитория проекта, на которую ссылаются правила таргетинга
+// экспериментов и флагов. Изменение сегмента сразу меняет аудиторию всех ссылающихся правил.
+type Segment struct {
+	Key string `json:"key"`
+	// ProjectID - проект сегмента; ключ уникален в пределах проекта. Пусто означает DefaultProject.
+	ProjectID   string `json:"project_id,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Rules - пользователь входит в сегмент, если удовлетворяет ВСЕМ правилам.
+	// Ссылки на другие сегменты в правилах сегмента запрещены.
+	Rules []TargetingRule `json:"rules"`
+	// Version - номер версии сегмента; увеличивается при каждом изменении.
+	Version       int    `json:"version"`
+	ConfigVersion string `json:"config_version"`
+}
+
+// SegmentVersion - сохраненная версия сегмента (история изменений).
+type SegmentVersion struct {
+	Version       int             `json:"version"`
+	Description   string          `json:"description,omitempty"`
+	Rules         []TargetingRule `json:"rules"`
+	ConfigVersion string          `json:"config_version"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// SegmentDeletePayload - тело события EventSegmentDelete.
+type SegmentDeletePayload struct {
+	Key string `json:"key"`
+}
+
+// SegmentAggregateID возвращает ключ событий outbox сегмента.
+func SegmentAggregateID(key string) string {
+	return "segment:" + key
+}
+
+// Validate проверяет ключ сегмента, структуру его правил и отсутствие в них ссылок
+// на другие сегменты.
+func (s *Segment) Validate() error {
+	if s.Key == "" {
+		return errors.New("segment key is required")
+	}
+	if err := ValidateTargetingRules(s.Rules); err != nil {
+		return err
+	}
+	refs, err := ReferencedSegments(s.Rules)
+	if err != nil {
+		return err
+	}
+	if len(refs) > 0 {
+		return fmt.Errorf("segment rules must not reference other segments (found %q)", refs[0])
+	}
+	return nil
+}
+
+// SegmentKey возвращает ключ сегмента, если правило ссылается на сегмент.
+func (r *TargetingRule) SegmentKey() (string, bool) {
+	if r.Operator != OpInSegment && r.Operator != OpNotInSegment {
+		return "", false
+	}
+	key, _ := r.Value.(string)
+	return key, true
+}
+
+// ReferencedSegments возвращает ключи сегментов, на которые ссылаются правила
+// (включая вложенные в группы), без повторов. Ошибка - если значение правила-ссылки
+// не является непустой строкой.
+func ReferencedSegments(rules []TargetingRule) ([]string, error) {
+	var keys []string
+	var err error
+	seen := make(map[string]bool)
+	walkRuleLeaves(rules, func(rule *TargetingRule) {
+		key, ok := rule.SegmentKey()
+		if !ok || err != nil {
+			return
+		}
+		if key == "" {
+			err = fmt.Errorf("operator %s requires a segment key as value", rule.Operator)
+			return
+		}
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// ReferencesSegment сообщает, ссылаются ли правила (включая вложенные в группы) на сегмент key.
+func ReferencesSegment(rules []TargetingRule, key string) bool {
+	found := false
+	walkRuleLeaves(rules, func(rule *TargetingRule) {
+		if ruleKey, ok := rule.SegmentKey(); ok && ruleKey == key {
+			found = true
+		}
+	})
+	return found
+}
@@ -0,0 +1,225 @@
+package ab_types
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+const (
+	// SnapshotObjectPrefix - префикс имен объектов снэпшотов в бакете.
+	SnapshotObjectPrefix = "snapshot-"
+	// ManifestObjectPrefix - префикс имен объектов манифестов снэпшотов.
+	ManifestObjectPrefix = "manifest-"
+	// SnapshotManifestHeader - заголовок HTTP-ответа с манифестом снэпшота (JSON),
+	// например, в GET /snapshot central-api.
+	SnapshotManifestHeader = "X-Snapshot-Manifest"
+	// LatestSnapshotPointer - имя объекта-указателя на последний снэпшот.
+	// Позволяет SDK получить актуальный снэпшот одним GET без листинга бакета.
+	LatestSnapshotPointer = "latest.json"
+
+	// SnapshotSchemaVersion - версия формата содержимого снэпшота.
+	// 1 - массив экспериментов; 2 - конверт Snapshot с глобальным номером изменения.
+	SnapshotSchemaVersion = 2
+)
+
+// Snapshot - согласованный срез конфигурации, снятый в одной REPEATABLE READ транзакции.
+// Содержит все существующие эксперименты независимо от статуса, флаги и номер последнего
+// изменения (Seq), вошедшего в срез. Дельты с номером <= Seq уже учтены в снэпшоте.
+type Snapshot struct {
+	SchemaVersion int `json:"schema_version"`
+	// Version - уникальная версия снэпшота (UUIDv7 момента генерации).
+	Version string `json:"version"`
+	// Seq - номер изменения проекта (high-water mark outbox), соответствующий срезу.
+	Seq       int64  `json:"seq"`
+	CreatedAt string `json:"created_at"`
+	// Project - проект, эксперименты и флаги которого входят в снэпшот.
+	Project string `json:"project,omitempty"`
+	// Environment - окружение, эксперименты которого входят в снэпшот.
+	Environment string       `json:"environment,omitempty"`
+	Experiments []Experiment `json:"experiments"`
+	// Flags - все флаги со всеми окружениями.
+	Flags []Flag `json:"flags,omitempty"`
+	// Segments - все сегменты проекта (общие для всех окружений).
+	Segments []Segment `json:"segments,omitempty"`
+	// IDLists - метаданные списков идентификаторов проекта (содержимое загружается отдельно).
+	IDLists []IDList `json:"id_lists,omitempty"`
+}
+
+// SnapshotMeta описывает загруженный снэпшот.
+// Публикуется в Kafka и хранится в объекте-указателе LatestSnapshotPointer.
+type SnapshotMeta struct {
+	SnapshotVersion string `json:"snapshot_version"`
+	Seq             int64  `json:"seq"`
+	Path            string `json:"path"`
+	ManifestPath    string `json:"manifest_path,omitempty"`
+	CreatedAt       string `json:"created_at"`
+	// Project - проект снэпшота (пусто у снэпшотов, созданных до появления проектов).
+	Project string `json:"project,omitempty"`
+	// Environment - окружение снэпшота (пусто у снэпшотов, созданных до появления окружений).
+	Environment string `json:"environment,omitempty"`
+
+	// Encoding и Compression описывают формат объекта Path.
+	// Пустые значения соответствуют DefaultSnapshotFormat.
+	Encoding    SnapshotEncoding    `json:"encoding,omitempty"`
+	Compression SnapshotCompression `json:"compression,omitempty"`
+	ContentType string              `json:"content_type,omitempty"`
+	// SigningKeyID - идентификатор ключа, которым подписан манифест (см. SigningKeyID).
+	// Пусто, если манифест не подписан.
+	SigningKeyID string `json:"signing_key_id,omitempty"`
+}
+
+// Format возвращает формат снэпшота, описанного метаданными.
+func (m *SnapshotMeta) Format() SnapshotFormat {
+	if m.Encoding == "" {
+		return DefaultSnapshotFormat
+	}
+	format := SnapshotFormat{Encoding: m.Encoding, Compression: m.Compression}
+	if format.Compression == "" {
+		format.Compression = CompressionNone
+	}
+	return format
+}
+
+// SnapshotManifest подтверждает целостность и подлинность снэпшота.
+type SnapshotManifest struct {
+	SchemaVersion   int    `json:"schema_version"`
+	SnapshotVersion string `json:"snapshot_version"`
+	Seq             int64  `json:"seq"`
+	Path            string `json:"path"`
+	// SHA256 - hex-представление SHA-256 содержимого снэпшота.
+	SHA256          string `json:"sha256"`
+	Size            int64  `json:"size"`
+	ExperimentCount int    `json:"experiment_count"`
+	CreatedAt       string `json:"created_at"`
+	// ContentType - MIME-тип снэпшота (см. SnapshotFormat.ContentType).
+	ContentType string `json:"content_type,omitempty"`
+	// Signature - base64-подпись Ed25519 над SigningPayload. Пустая, если ключ подписи не настроен.
+	Signature string `json:"signature,omitempty"`
+}
+
+// ManifestPathFor возвращает имя манифеста для объекта снэпшота.
+// Префикс окружения (каталог) сохраняется: "staging/snapshot-<v>.json" -> "staging/manifest-<v>.json".
+// Манифест всегда хранится в JSON, независимо от формата снэпшота.
+func ManifestPathFor(snapshotPath string) string {
+	dir, name := path.Split(snapshotPath)
+	version, _, _ := strings.Cut(strings.TrimPrefix(name, SnapshotObjectPrefix), ".")
+	return dir + ManifestObjectPrefix + version + ".json"
+}
+
+// NewSnapshotManifest строит неподписанный манифест для данных снэпшота.
+func NewSnapshotManifest(snapshot *Snapshot, path, contentType string, data []byte) *SnapshotManifest {
+	sum := sha256.Sum256(data)
+	return &SnapshotManifest{
+		SchemaVersion:   snapshot.SchemaVersion,
+		SnapshotVersion: snapshot.Version,
+		Seq:             snapshot.Seq,
+		Path:            path,
+		SHA256:          hex.EncodeToString(sum[:]),
+		Size:            int64(len(data)),
+		ExperimentCount: len(snapshot.Experiments),
+		CreatedAt:       snapshot.CreatedAt,
+		ContentType:     contentType,
+	}
+}
+
+// SigningPayload возвращает каноническое представление полей манифеста, которое подписывается.
+// Формат построчный, чтобы не зависеть от порядка полей при JSON-сериализации.
+func (m *SnapshotManifest) SigningPayload() []byte {
+	return []byte(fmt.Sprintf("ab-snapshot-manifest\n%d\n%s\n%d\n%s\n%s\n%d\n%d\n%s\n%s\n",
+		m.SchemaVersion, m.SnapshotVersion, m.Seq, m.Path, m.SHA256, m.Size, m.ExperimentCount, m.CreatedAt, m.ContentType))
+}
+
+// SigningKeyID возвращает короткий идентификатор ключа подписи: первые 8 байт SHA-256
+// публичного ключа в hex. Пустая строка для nil-ключа.
+func SigningKeyID(key ed25519.PrivateKey) string {
+	if key == nil {
+		return ""
+	}
+	sum := sha256.Sum256(key.Public().(ed25519.PublicKey))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Sign подписывает манифест ключом Ed25519.
+func (m *SnapshotManifest) Sign(key ed25519.PrivateKey) {
+	m.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, m.SigningPayload()))
+}
+
+// Verify проверяет, что data соответствует манифесту.
+// Если publicKey задан, дополнительно проверяется подпись.
+// Количество экспериментов проверяет вызывающая сторона после разбора снэпшота.
+func (m *SnapshotManifest) Verify(data []byte, publicKey ed25519.PublicKey) error {
+	if m.SchemaVersion > SnapshotSchemaVersion {
+		return fmt.Errorf("unsupported snapshot schema version %d", m.SchemaVersion)
+	}
+	if int64(len(data)) != m.Size {
+		return fmt.Errorf("snapshot size mismatch: expected %d bytes, got %d", m.Size, len(data))
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != m.SHA256 {
+		return errors.New("snapshot checksum mismatch")
+	}
+
+	if publicKey == nil {
+		return nil
+	}
+	if m.Signature == "" {
+		return errors.New("snapshot manifest is not signed")
+	}
+	signature, err := base64.StdEncoding.DecodeString(m.Signature)
+	if err != nil {
+		return fmt.Errorf("failed to decode manifest signature: %w", err)
+	}
+	if !ed25519.Verify(publicKey, m.SigningPayload(), signature) {
+		return errors.New("snapshot manifest signature is invalid")
+	}
+	return nil
+}
+
+// Describes проверяет, что манифест относится к снэпшоту, на который указывают метаданные.
+// Подпись защищает только поля манифеста: без этой проверки подлинный манифест старого
+// снэпшота можно выдать за манифест объекта, полученного по указателю.
+// Версия сверяется, только если она известна (метаданные, полученные листингом, ее не содержат).
+func (m *SnapshotManifest) Describes(meta *SnapshotMeta) error {
+	if m.Path != meta.Path {
+		return fmt.Errorf("snapshot manifest describes %q, not %q", m.Path, meta.Path)
+	}
+	if meta.SnapshotVersion != "" && m.SnapshotVersion != meta.SnapshotVersion {
+		return fmt.Errorf("snapshot manifest version %q does not match pointer version %q", m.SnapshotVersion, meta.SnapshotVersion)
+	}
+	return nil
+}
+
+// ParseEd25519PublicKey разбирает base64-представление публичного ключа Ed25519.
+func ParseEd25519PublicKey(encoded string) (ed25519.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode public key: %w", err)
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key size: %d", len(raw))
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// ParseEd25519PrivateKey разбирает base64-представление приватного ключа Ed25519.
+// Допускается как 32-байтовый seed, так и полный 64-байтовый ключ.
+func ParseEd25519PrivateKey(encoded string) (ed25519.PrivateKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode private key: %w", err)
+	}
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(raw), nil
+	default:
+		return nil, fmt.Errorf("invalid private key size: %d", len(raw))
+	}
+}
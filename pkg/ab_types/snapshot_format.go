@@ -0,0 +1,249 @@
+package ab_types
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// SnapshotEncoding определяет способ сериализации экспериментов в снэпшоте.
+type SnapshotEncoding string
+
+const (
+	EncodingJSON SnapshotEncoding = "json"
+	// EncodingGob - компактное бинарное представление (encoding/gob).
+	EncodingGob SnapshotEncoding = "gob"
+)
+
+// SnapshotCompression определяет алгоритм сжатия снэпшота.
+type SnapshotCompression string
+
+const (
+	CompressionNone SnapshotCompression = "none"
+	CompressionGzip SnapshotCompression = "gzip"
+	CompressionZstd SnapshotCompression = "zstd"
+)
+
+const (
+	contentTypeJSON   = "application/json"
+	contentTypeVendor = "application/vnd.ab-snapshot."
+)
+
+// Магические байты сжатых форматов, используются при определении формата без content type.
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Кодер и декодер zstd дороги в создании; EncodeAll/DecodeAll безопасны для конкурентного вызова.
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+)
+
+func init() {
+	// Значения правил таргетинга (TargetingRule.Value) имеют тип any,
+	// поэтому gob должен знать конкретные типы, которые дает разбор JSON.
+	gob.Register([]any{})
+	gob.Register(map[string]any{})
+}
+
+// SnapshotFormat - сочетание сериализации и сжатия снэпшота.
+type SnapshotFormat struct {
+	Encoding    SnapshotEncoding    `json:"encoding"`
+	Compression SnapshotCompression `json:"compression"`
+}
+
+// DefaultSnapshotFormat - несжатый JSON, формат снэпшотов до появления SnapshotFormat.
+var DefaultSnapshotFormat = SnapshotFormat{Encoding: EncodingJSON, Compression: CompressionNone}
+
+// Validate проверяет, что формат поддерживается.
+func (f SnapshotFormat) Validate() error {
+	switch f.Encoding {
+	case EncodingJSON, EncodingGob:
+	default:
+		return fmt.Errorf("unsupported snapshot encoding %q", f.Encoding)
+	}
+	switch f.Compression {
+	case CompressionNone, CompressionGzip, CompressionZstd:
+	default:
+		return fmt.Errorf("unsupported snapshot compression %q", f.Compression)
+	}
+	return nil
+}
+
+// ContentType возвращает MIME-тип, под которым снэпшот хранится в MinIO.
+// Несжатый JSON сохраняет исторический "application/json".
+func (f SnapshotFormat) ContentType() string {
+	if f == DefaultSnapshotFormat {
+		return contentTypeJSON
+	}
+	contentType := contentTypeVendor + string(f.Encoding)
+	if f.Compression != CompressionNone {
+		contentType += "+" + string(f.Compression)
+	}
+	return contentType
+}
+
+// FileExtension возвращает расширение имени объекта снэпшота.
+func (f SnapshotFormat) FileExtension() string {
+	ext := "." + string(f.Encoding)
+	switch f.Compression {
+	case CompressionGzip:
+		ext += ".gz"
+	case CompressionZstd:
+		ext += ".zst"
+	}
+	return ext
+}
+
+// ParseSnapshotContentType восстанавливает формат по MIME-типу.
+// Возвращает false, если тип не относится к снэпшотам.
+func ParseSnapshotContentType(contentType string) (SnapshotFormat, bool) {
+	contentType = strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	if contentType == contentTypeJSON {
+		return DefaultSnapshotFormat, true
+	}
+	if !strings.HasPrefix(contentType, contentTypeVendor) {
+		return SnapshotFormat{}, false
+	}
+
+	encoding, compression, found := strings.Cut(strings.TrimPrefix(contentType, contentTypeVendor), "+")
+	format := SnapshotFormat{Encoding: SnapshotEncoding(encoding), Compression: CompressionNone}
+	if found {
+		format.Compression = SnapshotCompression(compression)
+	}
+	if format.Validate() != nil {
+		return SnapshotFormat{}, false
+	}
+	return format, true
+}
+
+// DetectSnapshotFormat определяет формат по содержимому, когда content type неизвестен
+// (например, для локального кэша без манифеста).
+// Кодировку внутри сжатых данных определить нельзя без распаковки, поэтому она уточняется в DecodeSnapshot.
+func DetectSnapshotFormat(data []byte) SnapshotFormat {
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		return SnapshotFormat{Encoding: "", Compression: CompressionGzip}
+	case bytes.HasPrefix(data, zstdMagic):
+		return SnapshotFormat{Encoding: "", Compression: CompressionZstd}
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+		return DefaultSnapshotFormat
+	}
+	return SnapshotFormat{Encoding: EncodingGob, Compression: CompressionNone}
+}
+
+// EncodeSnapshot сериализует и сжимает снэпшот в заданном формате.
+func EncodeSnapshot(snapshot *Snapshot, format SnapshotFormat) ([]byte, error) {
+	if err := format.Validate(); err != nil {
+		return nil, err
+	}
+
+	var raw bytes.Buffer
+	switch format.Encoding {
+	case EncodingJSON:
+		data, err := json.Marshal(snapshot)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode snapshot as JSON: %w", err)
+		}
+		raw.Write(data)
+	case EncodingGob:
+		if err := gob.NewEncoder(&raw).Encode(snapshot); err != nil {
+			return nil, fmt.Errorf("failed to encode snapshot as gob: %w", err)
+		}
+	}
+
+	switch format.Compression {
+	case CompressionGzip:
+		var compressed bytes.Buffer
+		writer := gzip.NewWriter(&compressed)
+		if _, err := writer.Write(raw.Bytes()); err != nil {
+			return nil, fmt.Errorf("failed to gzip snapshot: %w", err)
+		}
+		if err := writer.Close(); err != nil {
+			return nil, fmt.Errorf("failed to gzip snapshot: %w", err)
+		}
+		return compressed.Bytes(), nil
+	case CompressionZstd:
+		return zstdEncoder.EncodeAll(raw.Bytes(), nil), nil
+	default:
+		return raw.Bytes(), nil
+	}
+}
+
+// DecodeSnapshot распаковывает и десериализует снэпшот.
+// Пустая кодировка в format означает, что ее нужно определить по распакованным данным.
+// Снэпшоты схемы 1 (голый массив экспериментов) возвращаются как Snapshot с Seq = 0.
+func DecodeSnapshot(data []byte, format SnapshotFormat) (*Snapshot, error) {
+	raw, err := decompressSnapshot(data, format.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	encoding := format.Encoding
+	if encoding == "" {
+		encoding = DetectSnapshotFormat(raw).Encoding
+	}
+
+	switch encoding {
+	case EncodingJSON:
+		if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+			var experiments []Experiment
+			if err := json.Unmarshal(raw, &experiments); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal snapshot JSON: %w", err)
+			}
+			return &Snapshot{SchemaVersion: 1, Experiments: experiments}, nil
+		}
+		var snapshot Snapshot
+		if err := json.Unmarshal(raw, &snapshot); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal snapshot JSON: %w", err)
+		}
+		return &snapshot, nil
+	case EncodingGob:
+		var snapshot Snapshot
+		if err := gob.NewDecoder(bytes.NewReader(raw)).Decode(&snapshot); err == nil {
+			return &snapshot, nil
+		}
+		var experiments []Experiment
+		if err := gob.NewDecoder(bytes.NewReader(raw)).Decode(&experiments); err != nil {
+			return nil, fmt.Errorf("failed to decode snapshot gob: %w", err)
+		}
+		return &Snapshot{SchemaVersion: 1, Experiments: experiments}, nil
+	default:
+		return nil, fmt.Errorf("unsupported snapshot encoding %q", encoding)
+	}
+}
+
+func decompressSnapshot(data []byte, compression SnapshotCompression) ([]byte, error) {
+	switch compression {
+	case CompressionNone, "":
+		return data, nil
+	case CompressionGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open gzip snapshot: %w", err)
+		}
+		defer reader.Close()
+		raw, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress gzip snapshot: %w", err)
+		}
+		return raw, nil
+	case CompressionZstd:
+		raw, err := zstdDecoder.DecodeAll(data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress zstd snapshot: %w", err)
+		}
+		return raw, nil
+	default:
+		return nil, fmt.Errorf("unsupported snapshot compression %q", compression)
+	}
+}
@@ -0,0 +1,189 @@
+package ab_types
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+var snapshotFormats = []SnapshotFormat{
+	{Encoding: EncodingJSON, Compression: CompressionNone},
+	{Encoding: EncodingJSON, Compression: CompressionGzip},
+	{Encoding: EncodingJSON, Compression: CompressionZstd},
+	{Encoding: EncodingGob, Compression: CompressionNone},
+	{Encoding: EncodingGob, Compression: CompressionGzip},
+	{Encoding: EncodingGob, Compression: CompressionZstd},
+}
+
+func formatName(format SnapshotFormat) string {
+	return string(format.Encoding) + "+" + string(format.Compression)
+}
+
+// syntheticSnapshot строит снэпшот, близкий к реальному: правила таргетинга разных типов
+// и крупные списки ForceInclude, которые и определяют размер снэпшота.
+func syntheticSnapshot(count, overrideUsers int) *Snapshot {
+	experiments := make([]Experiment, count)
+	for i := range experiments {
+		users := make([]string, overrideUsers)
+		for j := range users {
+			users[j] = fmt.Sprintf("user-%d-%d", i, j)
+		}
+		experiments[i] = Experiment{
+			ID:            fmt.Sprintf("experiment-%d", i),
+			LayerID:       fmt.Sprintf("layer-%d", i%10),
+			ConfigVersion: fmt.Sprintf("version-%d", i),
+			Salt:          fmt.Sprintf("salt-%d", i),
+			Status:        StatusActive,
+			TargetingRules: []TargetingRule{
+				{Attribute: "country", Operator: OpInList, Value: []any{"DE", "FR", "US"}},
+				{Attribute: "age", Operator: OpGreaterThan, Value: float64(18)},
+				{Attribute: "app_version", Operator: OpVersionGreaterThan, Value: "5.2.0"},
+			},
+			OverrideLists: OverrideLists{
+				ForceInclude: map[string][]string{"treatment": users},
+				ForceExclude: []string{"qa-user-1", "qa-user-2"},
+			},
+			Variants: []Variant{
+				{Name: "control", BucketRange: [2]int{0, 499}},
+				{Name: "treatment", BucketRange: [2]int{500, 999}},
+			},
+		}
+	}
+	return &Snapshot{
+		SchemaVersion: SnapshotSchemaVersion,
+		Version:       "snapshot-version",
+		Seq:           42,
+		CreatedAt:     "2024-01-01T00:00:00Z",
+		Project:       DefaultProject,
+		Experiments:   experiments,
+	}
+}
+
+func TestSnapshotFormatRoundTrip(t *testing.T) {
+	snapshot := syntheticSnapshot(3, 10)
+	want, _ := json.Marshal(snapshot)
+
+	for _, format := range snapshotFormats {
+		t.Run(formatName(format), func(t *testing.T) {
+			data, err := EncodeSnapshot(snapshot, format)
+			if err != nil {
+				t.Fatalf("EncodeSnapshot() error = %v", err)
+			}
+
+			decoded, err := DecodeSnapshot(data, format)
+			if err != nil {
+				t.Fatalf("DecodeSnapshot() error = %v", err)
+			}
+			if got, _ := json.Marshal(decoded); !bytes.Equal(got, want) {
+				t.Errorf("DecodeSnapshot() = %s, want %s", got, want)
+			}
+
+			// Без content type формат определяется по содержимому.
+			detected, err := DecodeSnapshot(data, DetectSnapshotFormat(data))
+			if err != nil {
+				t.Fatalf("DecodeSnapshot(detected) error = %v", err)
+			}
+			if got, _ := json.Marshal(detected); !bytes.Equal(got, want) {
+				t.Errorf("DecodeSnapshot(detected) = %s, want %s", got, want)
+			}
+
+			parsed, ok := ParseSnapshotContentType(format.ContentType())
+			if !ok || parsed != format {
+				t.Errorf("ParseSnapshotContentType(%q) = %v, %v, want %v", format.ContentType(), parsed, ok, format)
+			}
+		})
+	}
+}
+
+func TestDecodeSnapshotLegacyArray(t *testing.T) {
+	snapshot, err := DecodeSnapshot([]byte(`[{"id":"exp-1","salt":"s"}]`), DefaultSnapshotFormat)
+	if err != nil {
+		t.Fatalf("DecodeSnapshot() error = %v", err)
+	}
+	if snapshot.SchemaVersion != 1 || snapshot.Seq != 0 || len(snapshot.Experiments) != 1 || snapshot.Experiments[0].ID != "exp-1" {
+		t.Errorf("DecodeSnapshot() = %+v, want schema 1 with one experiment", snapshot)
+	}
+}
+
+func TestParseSnapshotContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        SnapshotFormat
+		ok          bool
+	}{
+		{"application/json", DefaultSnapshotFormat, true},
+		{"application/json; charset=utf-8", DefaultSnapshotFormat, true},
+		{"application/vnd.ab-snapshot.gob", SnapshotFormat{Encoding: EncodingGob, Compression: CompressionNone}, true},
+		{"application/vnd.ab-snapshot.json+zstd", SnapshotFormat{Encoding: EncodingJSON, Compression: CompressionZstd}, true},
+		{"application/vnd.ab-snapshot.xml", SnapshotFormat{}, false},
+		{"application/vnd.ab-snapshot.gob+brotli", SnapshotFormat{}, false},
+		{"application/octet-stream", SnapshotFormat{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseSnapshotContentType(tt.contentType)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ParseSnapshotContentType(%q) = %v, %v, want %v, %v", tt.contentType, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSnapshotFormatValidate(t *testing.T) {
+	tests := []struct {
+		format  SnapshotFormat
+		wantErr bool
+	}{
+		{DefaultSnapshotFormat, false},
+		{SnapshotFormat{Encoding: EncodingGob, Compression: CompressionZstd}, false},
+		{SnapshotFormat{Encoding: "xml", Compression: CompressionNone}, true},
+		{SnapshotFormat{Encoding: EncodingJSON, Compression: "brotli"}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.format.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%v.Validate() error = %v, wantErr %v", tt.format, err, tt.wantErr)
+		}
+	}
+}
+
+// Параметры синтетического снэпшота для бенчмарков.
+const (
+	benchExperiments   = 200
+	benchOverrideUsers = 5000
+)
+
+func BenchmarkEncodeSnapshot(b *testing.B) {
+	snapshot := syntheticSnapshot(benchExperiments, benchOverrideUsers)
+	for _, format := range snapshotFormats {
+		b.Run(formatName(format), func(b *testing.B) {
+			b.ReportAllocs()
+			var size int
+			for i := 0; i < b.N; i++ {
+				data, err := EncodeSnapshot(snapshot, format)
+				if err != nil {
+					b.Fatal(err)
+				}
+				size = len(data)
+			}
+			b.ReportMetric(float64(size), "bytes")
+		})
+	}
+}
+
+func BenchmarkDecodeSnapshot(b *testing.B) {
+	snapshot := syntheticSnapshot(benchExperiments, benchOverrideUsers)
+	for _, format := range snapshotFormats {
+		data, err := EncodeSnapshot(snapshot, format)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(formatName(format), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := DecodeSnapshot(data, format); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(data)), "bytes")
+		})
+	}
+}
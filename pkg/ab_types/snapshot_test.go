@@ -0,0 +1,25 @@
+package ab_types
+
+import "testing"
+
+func TestSnapshotManifestDescribes(t *testing.T) {
+	manifest := &SnapshotManifest{SnapshotVersion: "v2", Path: "staging/snapshot-v2.json"}
+
+	tests := []struct {
+		name    string
+		meta    SnapshotMeta
+		wantErr bool
+	}{
+		{"pointer", SnapshotMeta{SnapshotVersion: "v2", Path: "staging/snapshot-v2.json"}, false},
+		{"listing without version", SnapshotMeta{Path: "staging/snapshot-v2.json"}, false},
+		{"other object", SnapshotMeta{SnapshotVersion: "v2", Path: "staging/snapshot-v1.json"}, true},
+		{"other version", SnapshotMeta{SnapshotVersion: "v1", Path: "staging/snapshot-v2.json"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := manifest.Describes(&tt.meta); (err != nil) != tt.wantErr {
+				t.Errorf("Describes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
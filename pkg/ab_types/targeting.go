@@ -0,0 +1,131 @@
+package ab_types
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MaxRuleDepth - максимальная вложенность групп правил таргетинга.
+// Правила верхнего уровня (неявное AND) находятся на глубине 1.
+const MaxRuleDepth = 5
+
+// RuleResult - результат вычисления правила таргетинга в трехзначной логике.
+// RuleUnknown означает, что атрибут несравним со значением правила (например, строка
+// против числа в строгом режиме). Not его не инвертирует, All и Any распространяют его,
+// если результат не определен остальными правилами группы, и такое правило не пропускает
+// пользователя.
+type RuleResult int8
+
+const (
+	RuleFalse RuleResult = iota
+	RuleTrue
+	RuleUnknown
+)
+
+// RuleResultOf переводит результат сравнения в RuleResult.
+func RuleResultOf(matched bool) RuleResult {
+	if matched {
+		return RuleTrue
+	}
+	return RuleFalse
+}
+
+// Not инвертирует результат; RuleUnknown остается RuleUnknown.
+func (r RuleResult) Not() RuleResult {
+	switch r {
+	case RuleTrue:
+		return RuleFalse
+	case RuleFalse:
+		return RuleTrue
+	default:
+		return RuleUnknown
+	}
+}
+
+// Passed сообщает, пропускает ли правило пользователя.
+func (r RuleResult) Passed() bool {
+	return r == RuleTrue
+}
+
+// IsGroup сообщает, является ли правило группой (All, Any или Not), а не сравнением атрибута.
+func (r *TargetingRule) IsGroup() bool {
+	return r.All != nil || r.Any != nil || r.Not != nil
+}
+
+// ValidateTargetingRules проверяет структуру дерева правил: группа задает ровно одно из
+// All, Any, Not и не содержит сравнения, у сравнения задан оператор с допустимым значением
+// (например, компилируемым шаблоном MATCHES_REGEX), а вложенность не превышает MaxRuleDepth.
+func ValidateTargetingRules(rules []TargetingRule) error {
+	for i := range rules {
+		if err := validateRule(&rules[i], 1); err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func validateRule(rule *TargetingRule, depth int) error {
+	if depth > MaxRuleDepth {
+		return fmt.Errorf("rule groups are nested deeper than %d levels", MaxRuleDepth)
+	}
+	if !rule.IsGroup() {
+		if rule.Operator == "" {
+			return errors.New("operator is required")
+		}
+		return validateOperatorValue(rule)
+	}
+
+	kinds := 0
+	for _, set := range []bool{rule.All != nil, rule.Any != nil, rule.Not != nil} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds > 1 {
+		return errors.New("a group must set exactly one of all, any, not")
+	}
+	if rule.Attribute != "" || rule.Operator != "" || rule.Value != nil {
+		return errors.New("a group must not set attribute, operator or value")
+	}
+
+	switch {
+	case rule.Not != nil:
+		if err := validateRule(rule.Not, depth+1); err != nil {
+			return fmt.Errorf("not: %w", err)
+		}
+	case rule.All != nil:
+		return validateGroupMembers("all", rule.All, depth)
+	default:
+		return validateGroupMembers("any", rule.Any, depth)
+	}
+	return nil
+}
+
+func validateGroupMembers(kind string, members []TargetingRule, depth int) error {
+	if len(members) == 0 {
+		return fmt.Errorf("%s group must not be empty", kind)
+	}
+	for i := range members {
+		if err := validateRule(&members[i], depth+1); err != nil {
+			return fmt.Errorf("%s[%d]: %w", kind, i, err)
+		}
+	}
+	return nil
+}
+
+// walkRuleLeaves вызывает visit для каждого сравнения в дереве правил.
+func walkRuleLeaves(rules []TargetingRule, visit func(rule *TargetingRule)) {
+	for i := range rules {
+		rule := &rules[i]
+		switch {
+		case rule.All != nil:
+			walkRuleLeaves(rule.All, visit)
+		case rule.Any != nil:
+			walkRuleLeaves(rule.Any, visit)
+		case rule.Not != nil:
+			walkRuleLeaves([]TargetingRule{*rule.Not}, visit)
+		default:
+			visit(rule)
+		}
+	}
+}
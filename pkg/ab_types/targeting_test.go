@@ -0,0 +1,63 @@
+package ab_types
+
+import "testing"
+
+func TestValidateTargetingRules(t *testing.T) {
+	country := TargetingRule{Attribute: "country", Operator: OpEquals, Value: "DE"}
+	plan := TargetingRule{Attribute: "plan", Operator: OpEquals, Value: "pro"}
+
+	// nested вкладывает правило в depth групп Not.
+	nested := func(depth int) TargetingRule {
+		rule := country
+		for i := 0; i < depth; i++ {
+			inner := rule
+			rule = TargetingRule{Not: &inner}
+		}
+		return rule
+	}
+
+	tests := []struct {
+		name    string
+		rules   []TargetingRule
+		wantErr bool
+	}{
+		{"no rules", nil, false},
+		{"flat rules", []TargetingRule{country, plan}, false},
+		{"any group", []TargetingRule{{Any: []TargetingRule{country, plan}}}, false},
+		{"all inside any", []TargetingRule{{Any: []TargetingRule{country, {All: []TargetingRule{plan, country}}}}}, false},
+		{"not group", []TargetingRule{{Not: &country}}, false},
+		{"max depth", []TargetingRule{nested(MaxRuleDepth - 1)}, false},
+		{"too deep", []TargetingRule{nested(MaxRuleDepth)}, true},
+		{"missing operator", []TargetingRule{{Attribute: "country", Value: "DE"}}, true},
+		{"empty any", []TargetingRule{{Any: []TargetingRule{}}}, true},
+		{"empty all", []TargetingRule{{All: []TargetingRule{}}}, true},
+		{"several kinds", []TargetingRule{{Any: []TargetingRule{country}, Not: &plan}}, true},
+		{"group with comparison", []TargetingRule{{Attribute: "country", Any: []TargetingRule{plan}}}, true},
+		{"invalid member", []TargetingRule{{All: []TargetingRule{country, {Attribute: "plan"}}}}, true},
+		{"invalid operand in not", []TargetingRule{{Not: &TargetingRule{Attribute: "email", Operator: OpMatchesRegex, Value: "("}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateTargetingRules(tt.rules); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateTargetingRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWalkRuleLeaves(t *testing.T) {
+	rules := []TargetingRule{
+		{Attribute: "a", Operator: OpEquals, Value: "1"},
+		{Any: []TargetingRule{
+			{Attribute: "b", Operator: OpEquals, Value: "2"},
+			{Not: &TargetingRule{All: []TargetingRule{{Attribute: "c", Operator: OpEquals, Value: "3"}}}},
+		}},
+	}
+	var attributes []string
+	walkRuleLeaves(rules, func(rule *TargetingRule) {
+		attributes = append(attributes, rule.Attribute)
+	})
+	if len(attributes) != 3 || attributes[0] != "a" || attributes[1] != "b" || attributes[2] != "c" {
+		t.Errorf("walkRuleLeaves() visited %v, want [a b c]", attributes)
+	}
+}
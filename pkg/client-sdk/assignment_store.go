@@ -0,0 +1,81 @@
+package client_sdk
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+const (
+	// defaultAssignmentStoreSize - размер MemoryAssignmentStore по умолчанию.
+	defaultAssignmentStoreSize = 100000
+	// defaultAssignmentStoreTimeout - ограничение одного обращения к AssignmentStore по умолчанию.
+	defaultAssignmentStoreTimeout = 100 * time.Millisecond
+)
+
+// AssignmentStore хранит закрепленные (sticky) назначения пользователей.
+// Используется только для экспериментов с Experiment.Sticky.
+// Методы вызываются на пути принятия решения, поэтому реализации должны быть быстрыми.
+type AssignmentStore interface {
+	// Get возвращает сохраненный вариант пользователя в эксперименте.
+	Get(ctx context.Context, experimentID, userID string) (variantName string, ok bool, err error)
+	// Save сохраняет вариант пользователя. Уже сохраненный вариант не перезаписывается.
+	Save(ctx context.Context, experimentID, userID, variantName string) error
+}
+
+// MemoryAssignmentStore - AssignmentStore в памяти процесса с вытеснением по LRU.
+// Назначения не переживают перезапуск и не разделяются между экземплярами сервиса.
+type MemoryAssignmentStore struct {
+	cache *lruCache[string, string]
+}
+
+// NewMemoryAssignmentStore создает хранилище на size назначений.
+func NewMemoryAssignmentStore(size int) *MemoryAssignmentStore {
+	return &MemoryAssignmentStore{cache: newLRUCache[string, string](positiveOr(size, defaultAssignmentStoreSize))}
+}
+
+func (s *MemoryAssignmentStore) Get(_ context.Context, experimentID, userID string) (string, bool, error) {
+	variantName, ok := s.cache.Get(assignmentKey(experimentID, userID))
+	return variantName, ok, nil
+}
+
+func (s *MemoryAssignmentStore) Save(_ context.Context, experimentID, userID, variantName string) error {
+	// Атомарно: при одновременных первых назначениях сохраняется только одно из них.
+	s.cache.AddIfAbsent(assignmentKey(experimentID, userID), variantName)
+	return nil
+}
+
+func assignmentKey(experimentID, userID string) string {
+	return experimentID + "\x00" + userID
+}
+
+// stickyVariant возвращает сохраненный вариант пользователя, если он все еще есть в эксперименте.
+// Вызывается под блокировкой кэша, поэтому обращение к хранилищу ограничено по времени.
+func (c *Client) stickyVariant(bucketKey string, exp *ab_types.Experiment) (string, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.assignmentStoreTimeout)
+	defer cancel()
+	variantName, ok, err := c.assignmentStore.Get(ctx, exp.ID, bucketKey)
+	if err != nil {
+		c.metrics.errors.WithLabelValues("assignment_store_error").Inc()
+		log.Printf("WARN: Failed to read sticky assignment for experiment %s: %v", exp.ID, err)
+		return "", false
+	}
+	// Вариант мог быть удален из эксперимента - тогда пользователь распределяется заново.
+	if !ok || !exp.HasVariant(variantName) {
+		return "", false
+	}
+	return variantName, true
+}
+
+// stickAssignment сохраняет назначение по бакетам для sticky-эксперимента.
+// Вызывается после снятия блокировки кэша.
+func (c *Client) stickAssignment(bucketKey, experimentID, variantName string) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.assignmentStoreTimeout)
+	defer cancel()
+	if err := c.assignmentStore.Save(ctx, experimentID, bucketKey, variantName); err != nil {
+		c.metrics.errors.WithLabelValues("assignment_store_error").Inc()
+		log.Printf("WARN: Failed to save sticky assignment for experiment %s: %v", experimentID, err)
+	}
+}
@@ -0,0 +1,59 @@
+package client_sdk
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestMemoryAssignmentStoreKeepsFirstVariant(t *testing.T) {
+	store := NewMemoryAssignmentStore(10)
+	ctx := context.Background()
+
+	if err := store.Save(ctx, "exp", "user-1", "control"); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := store.Save(ctx, "exp", "user-1", "treatment"); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if variantName, ok, _ := store.Get(ctx, "exp", "user-1"); !ok || variantName != "control" {
+		t.Errorf("Get() = %q, %v, want control", variantName, ok)
+	}
+	if _, ok, _ := store.Get(ctx, "other-exp", "user-1"); ok {
+		t.Error("Get() found an assignment in another experiment")
+	}
+}
+
+func TestMemoryAssignmentStoreConcurrentFirstAssignments(t *testing.T) {
+	// Одновременные первые назначения одного пользователя: сохраняется ровно одно,
+	// и все вызывающие видят один и тот же вариант.
+	for attempt := 0; attempt < 100; attempt++ {
+		store := NewMemoryAssignmentStore(10)
+		ctx := context.Background()
+
+		const writers = 8
+		seen := make([]string, writers)
+		var start, done sync.WaitGroup
+		start.Add(1)
+		for i := 0; i < writers; i++ {
+			done.Add(1)
+			go func() {
+				defer done.Done()
+				start.Wait()
+				if err := store.Save(ctx, "exp", "user-1", fmt.Sprintf("variant-%d", i)); err != nil {
+					t.Errorf("Save() error = %v", err)
+				}
+				seen[i], _, _ = store.Get(ctx, "exp", "user-1")
+			}()
+		}
+		start.Done()
+		done.Wait()
+
+		for i := 1; i < writers; i++ {
+			if seen[i] != seen[0] {
+				t.Fatalf("attempt %d: variants %q and %q were both recorded for the same user", attempt, seen[0], seen[i])
+			}
+		}
+	}
+}
@@ -1,32 +1,40 @@
 package client_sdk
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"github.com/goriiin/go-ab-service/internal/platform/queue"
 	"github.com/goriiin/go-ab-service/pkg/ab_types"
-	"github.com/segmentio/kafka-go"
-	"io"
 	"log"
-	"math/rand"
+	"maps"
 	"os"
-	"sort"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
-
-	"github.com/minio/minio-go/v7"
-	"github.com/minio/minio-go/v7/pkg/credentials"
 )
 
 // InMemoryCache хранит конфигурации экспериментов в памяти для сверхбыстрого доступа.
 type InMemoryCache struct {
 	// experiments - основное хранилище, индексированное по layerID.
 	experiments map[string][]ab_types.Experiment
+	// flags - флаги, индексированные по ключу.
+	flags map[string]ab_types.Flag
+	// segments - сегменты, на которые ссылаются правила таргетинга, индексированные по ключу.
+	segments map[string]ab_types.Segment
+	// idLists - содержимое списков идентификаторов, индексированное по ID списка.
+	idLists map[string]*idListSet
+	// regexps - шаблоны MATCHES_REGEX загруженных правил, скомпилированные при загрузке конфигурации.
+	regexps ab_types.RuleRegexps
+	// cidrs - диапазоны IP_IN_CIDR загруженных правил, разобранные при загрузке конфигурации.
+	cidrs ab_types.RuleCIDRs
+	// overrides - inline-оверрайды экспериментов кэша в виде множеств, индексированные по ID эксперимента.
+	overrides map[string]ab_types.OverrideSet
 	// configVersion - последняя версия конфигурации, загруженная в кэш.
 	configVersion string
+	// seq - номер изменения проекта, с которым согласован кэш (0, если неизвестен).
+	seq int64
 	// rwMutex защищает кэш от одновременной записи и чтения.
 	rwMutex sync.RWMutex
 }
@@ -35,54 +43,102 @@ type InMemoryCache struct {
 type Client struct {
 	config Config
 	cache  *InMemoryCache
-	// minioClient - клиент для работы с MinIO.
-	minioClient *minio.Client
-
-	kafkaReader *kafka.Reader
+	// snapshotSource - источник полных снэпшотов (по умолчанию MinIO).
+	snapshotSource SnapshotSource
+	// deltaSource - источник дельт (по умолчанию Kafka); nil, если дельты не настроены.
+	deltaSource DeltaSource
+	// idListSource - источник содержимого списков идентификаторов; nil, если не настроен.
+	idListSource IDListSource
 	// cancelFunc для грациозной остановки фонового процесса
 	cancelFunc context.CancelFunc
 
+	// resyncCh получает минимальный номер изменения, который должен покрыть снэпшот ресинхронизации.
+	resyncCh chan int64
+
+	// ready выставляется после загрузки первой конфигурации; readyCh закрывается одновременно с ним.
+	ready     atomic.Bool
+	readyCh   chan struct{}
+	readyOnce sync.Once
+	statusMu  sync.Mutex
+	status    Status
+
+	// localCacheMu упорядочивает записи локального кэша из начальной загрузки и ресинхронизаций.
+	localCacheMu sync.Mutex
+
 	overrides map[string]string // Карта [experiment_id] -> variant_name
 	metrics   *sdkMetrics
+	// coercionMode - разобранный Config.CoercionMode.
+	coercionMode ab_types.CoercionMode
 
 	assignmentProducer *queue.Producer // Переиспользуем наш платформенный пакет
+	// assignmentStore хранит закрепленные назначения sticky-экспериментов.
+	assignmentStore AssignmentStore
+	// assignmentStoreTimeout - Config.AssignmentStoreTimeout или значение по умолчанию.
+	assignmentStoreTimeout time.Duration
+	// exposures - очередь событий экспозиции; nil, если Kafka не настроена.
+	exposures *exposurePipeline
 }
 
+// resyncRetryInterval - пауза между попытками ресинхронизации по снэпшоту.
+const resyncRetryInterval = 10 * time.Second
+
 type AssignmentEvent struct {
-	UserID       string         `json:"user_id"`
-	ExperimentID string         `json:"experiment_id"`
-	VariantName  string         `json:"variant_name"`
-	Timestamp    time.Time      `json:"timestamp"`
-	Context      map[string]any `json:"context"`
+	UserID       string            `json:"user_id"`
+	Identifiers  map[string]string `json:"identifiers,omitempty"`
+	ExperimentID string            `json:"experiment_id"`
+	VariantName  string            `json:"variant_name"`
+	Timestamp    time.Time         `json:"timestamp"`
+	Context      map[string]any    `json:"context"`
 }
 
 // NewClient создает и инициализирует новый клиент A/B-платформы.
-// Это блокирующая операция, которая не завершится, пока не будет загружена валидная конфигурация.
+// По умолчанию это блокирующая операция, которая не завершится, пока не будет загружена валидная конфигурация.
+// С Config.NonBlockingStartup клиент возвращается сразу и загружает конфигурацию в фоне.
 func NewClient(ctx context.Context, config Config) (*Client, error) {
 	// 1. Добавляем jitter для предотвращения "эффекта толпы"
-	jitter := time.Duration(rand.Intn(1000)) * time.Millisecond
-	log.Printf("INFO: Applying startup jitter of %v", jitter)
-	time.Sleep(jitter)
+	if !config.NonBlockingStartup {
+		jitter := startupJitter()
+		log.Printf("INFO: Applying startup jitter of %v", jitter)
+		time.Sleep(jitter)
+	}
 
 	// 2. Инициализируем зависимости
-	minioClient, err := minio.New(config.MinIOEndpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(config.MinIOAccessKey, config.MinIOSecretKey, ""),
-		Secure: config.MinIOUseSSL,
-	})
+	snapshotSource, deltaSource, err := resolveSources(config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create MinIO client: %w", err)
+		return nil, err
+	}
+	coercionMode, err := ab_types.ParseCoercionMode(string(config.CoercionMode))
+	if err != nil {
+		return nil, err
 	}
 
 	internalCtx, cancel := context.WithCancel(context.Background())
 
 	client := &Client{
-		config:             config,
-		cache:              &InMemoryCache{experiments: make(map[string][]ab_types.Experiment)},
-		minioClient:        minioClient,
-		cancelFunc:         cancel,
-		overrides:          make(map[string]string),
-		metrics:            registerMetrics(), // Регистрируем метрики при старте
-		assignmentProducer: queue.NewProducer(config.KafkaBrokers, config.AssignmentEventsTopic),
+		config:         config,
+		cache:          &InMemoryCache{experiments: make(map[string][]ab_types.Experiment), flags: make(map[string]ab_types.Flag), segments: make(map[string]ab_types.Segment), idLists: make(map[string]*idListSet), regexps: make(ab_types.RuleRegexps), cidrs: make(ab_types.RuleCIDRs), overrides: make(map[string]ab_types.OverrideSet)},
+		snapshotSource: snapshotSource,
+		deltaSource:    deltaSource,
+		cancelFunc:     cancel,
+		resyncCh:       make(chan int64, 1),
+		readyCh:        make(chan struct{}),
+		overrides:      make(map[string]string),
+		metrics:        registerMetrics(), // Регистрируем метрики при старте
+		coercionMode:   coercionMode,
+	}
+	client.idListSource = config.IDListSource
+	if client.idListSource == nil {
+		client.idListSource, _ = snapshotSource.(IDListSource)
+	}
+	client.assignmentStore = config.AssignmentStore
+	if client.assignmentStore == nil {
+		client.assignmentStore = NewMemoryAssignmentStore(defaultAssignmentStoreSize)
+	}
+	client.assignmentStoreTimeout = positiveOr(config.AssignmentStoreTimeout, defaultAssignmentStoreTimeout)
+	// Без Kafka события назначений не отправляются.
+	if len(config.KafkaBrokers) > 0 {
+		client.assignmentProducer = queue.NewProducer(config.KafkaBrokers, config.AssignmentEventsTopic)
+		client.exposures = newExposurePipeline(client.assignmentProducer, config, client.metrics)
 	}
 
 	if client.config.OverridesFilePath != "" {
@@ -95,27 +151,46 @@ func NewClient(ctx context.Context, config Config) (*Client, error) {
 		}
 	}
 
+	go client.runResync(internalCtx)
+
 	// 3. Загружаем начальный снэпшот
+	if config.NonBlockingStartup {
+		log.Printf("INFO: A/B client started in non-blocking mode with %d default variants. Loading configuration in background.", len(config.DefaultVariants))
+		go client.runInitialLoad(internalCtx)
+		return client, nil
+	}
+
 	if err := client.loadInitialSnapshot(ctx); err != nil {
+		cancel()
 		return nil, fmt.Errorf("CRITICAL: failed to load initial configuration: %w", err)
 	}
-
-	// TODO: На следующих шагах здесь будет запущен фоновый потребитель Kafka.
-
-	client.initKafkaReader()
-	go client.runDeltaConsumer(internalCtx)
+	client.startDeltaConsumer(internalCtx)
 
 	log.Printf("INFO: A/B client initialized successfully with config version %s", client.cache.configVersion)
 	return client, nil
 }
 
+// startDeltaConsumer запускает чтение дельт. Вызывается только после загрузки снэпшота,
+// иначе дельты опередили бы снэпшот и он был бы отброшен как устаревший.
+func (c *Client) startDeltaConsumer(ctx context.Context) {
+	if c.deltaSource == nil {
+		log.Println("WARN: No delta source configured. Configuration will only change on resync.")
+		return
+	}
+	go c.runDeltaConsumer(ctx)
+}
+
 func (c *Client) Close() error {
 	log.Println("INFO: Shutting down A/B client...")
 	c.cancelFunc() // Сигнализируем горутине-консьюмеру о необходимости завершиться
 
-	// Закрываем оба соединения с Kafka
-	if c.kafkaReader != nil {
-		c.kafkaReader.Close()
+	// Закрываем источник дельт и продюсер событий назначений
+	if c.deltaSource != nil {
+		c.deltaSource.Close()
+	}
+	if c.exposures != nil {
+		// Отправляем накопленные события экспозиции до закрытия продюсера
+		c.exposures.close(c.config.ExposureCloseTimeout)
 	}
 	if c.assignmentProducer != nil {
 		return c.assignmentProducer.Close()
@@ -123,235 +198,332 @@ func (c *Client) Close() error {
 	return nil
 }
 
-func (c *Client) initKafkaReader() {
-	c.kafkaReader = kafka.NewReader(kafka.ReaderConfig{
-		Brokers:  c.config.KafkaBrokers,
-		GroupID:  c.config.KafkaGroupID,
-		Topic:    "ab_deltas",
-		MinBytes: 10e3, // 10KB
-		MaxBytes: 10e6, // 10MB
-	})
+// resolveSources возвращает источники из конфигурации, подставляя реализации по умолчанию:
+// MinIO для снэпшотов и Kafka для дельт (если заданы KafkaBrokers) проекта клиента.
+func resolveSources(config Config) (SnapshotSource, DeltaSource, error) {
+	snapshotSource := config.SnapshotSource
+	if snapshotSource == nil {
+		minioSource, err := NewMinIOSnapshotSource(config.MinIOEndpoint, config.MinIOAccessKey, config.MinIOSecretKey, config.MinIOUseSSL, config.SnapshotBucket)
+		if err != nil {
+			return nil, nil, err
+		}
+		snapshotSource = minioSource.WithPrefix(ab_types.SnapshotPrefix(config.Project, config.Environment))
+	}
+
+	deltaSource := config.DeltaSource
+	if deltaSource == nil && len(config.KafkaBrokers) > 0 {
+		deltaSource = NewKafkaDeltaSource(config.KafkaBrokers, config.KafkaGroupID, ab_types.ProjectDeltasTopic(config.Project))
+	}
+	return snapshotSource, deltaSource, nil
 }
 
 // runDeltaConsumer - основной цикл фонового процесса, читающего дельты.
 func (c *Client) runDeltaConsumer(ctx context.Context) {
-	for {
-		select {
-		case <-ctx.Done(): // Если контекст отменен, завершаем работу
-			log.Println("INFO: Delta consumer shutting down.")
-			return
-		default:
-			msg, err := c.kafkaReader.ReadMessage(ctx)
-			if err != nil {
-				c.metrics.errors.WithLabelValues("kafka_read_error").Inc()
-
-				// Контекст был отменен во время чтения
-				if errors.Is(err, context.Canceled) {
-					return
-				}
-				log.Printf("ERROR: Failed to read delta message from Kafka: %v", err)
-				continue
-			}
-
-			var exp ab_types.Experiment
-			if err := json.Unmarshal(msg.Value, &exp); err != nil {
-				c.metrics.errors.WithLabelValues("kafka_read_error").Inc()
-
-				log.Printf("ERROR: Failed to unmarshal delta payload: %v", err)
-
-				continue // Пропускаем битое сообщение
-			}
-
-			c.applyDelta(&exp)
-		}
+	if err := c.deltaSource.Run(ctx, clientDeltaSink{client: c}); err != nil {
+		c.metrics.errors.WithLabelValues("delta_source_error").Inc()
+		log.Printf("ERROR: Delta source stopped: %v", err)
 	}
 }
 
 // applyDelta атомарно применяет изменение к in-memory кэшу.
-func (c *Client) applyDelta(exp *ab_types.Experiment) {
+// Содержимое измененного списка идентификаторов загружается до блокировки кэша.
+func (c *Client) applyDelta(d *Delta) {
+	var idList *idListSet
+	if d.Type == ab_types.EventIDListUpsert && d.IDList != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), idListFetchTimeout)
+		idList = c.fetchIDList(ctx, d.IDList)
+		cancel()
+	}
+
 	c.cache.rwMutex.Lock()
 	defer c.cache.rwMutex.Unlock()
 
-	// Защита от устаревших сообщений: не применяем дельту, если ее версия старше, чем в кэше.
-	if exp.ConfigVersion <= c.cache.configVersion {
-		log.Printf("WARN: Skipping stale delta for experiment %s (delta version: %s, cache version: %s)", exp.ID, exp.ConfigVersion, c.cache.configVersion)
+	if d.Seq > 0 {
+		// Защита от устаревших сообщений: дельта с номером <= номера кэша уже учтена (в т.ч. в снэпшоте).
+		if d.Seq <= c.cache.seq {
+			log.Printf("WARN: Skipping stale delta for experiment %s (delta seq: %d, cache seq: %d)", d.ExperimentID, d.Seq, c.cache.seq)
+			return
+		}
+		// Пропуск номеров означает, что часть изменений потеряна (например, смещение группы
+		// потребителей ушло дальше снэпшота). Применяем дельту и догоняем состояние по снэпшоту.
+		if c.cache.seq > 0 && d.Seq > c.cache.seq+1 {
+			log.Printf("WARN: Delta sequence gap detected (cache seq: %d, delta seq: %d). Scheduling resync from snapshot.", c.cache.seq, d.Seq)
+			c.metrics.errors.WithLabelValues("delta_sequence_gap").Inc()
+			c.requestResync(d.Seq)
+		}
+	} else if existing, ok := c.cache.flags[d.FlagKey]; ok && d.Flag != nil && d.Flag.ConfigVersion <= existing.ConfigVersion {
+		log.Printf("WARN: Skipping stale delta for flag %s (delta version: %s, cached version: %s)", d.FlagKey, d.Flag.ConfigVersion, existing.ConfigVersion)
+		return
+	} else if existing, ok := c.cache.segments[d.SegmentKey]; ok && d.Segment != nil && d.Segment.Version <= existing.Version {
+		log.Printf("WARN: Skipping stale delta for segment %s (delta version: %d, cached version: %d)", d.SegmentKey, d.Segment.Version, existing.Version)
+		return
+	} else if existing, ok := c.cache.idLists[d.IDListID]; ok && d.IDList != nil && d.IDList.ConfigVersion <= existing.configVersion {
+		log.Printf("WARN: Skipping stale delta for id list %s (delta version: %s, cached version: %s)", d.IDListID, d.IDList.ConfigVersion, existing.configVersion)
+		return
+	} else if existing := c.findCachedExperiment(d.ExperimentID); existing != nil && d.Experiment != nil &&
+		d.Experiment.ConfigVersion <= existing.ConfigVersion {
+		// Дельта без номера: сравниваем с версией того же эксперимента, а не с глобальной.
+		log.Printf("WARN: Skipping stale delta for experiment %s (delta version: %s, cached version: %s)", d.ExperimentID, d.Experiment.ConfigVersion, existing.ConfigVersion)
 		return
 	}
 
-	// Проверяем, относится ли эксперимент к отслеживаемым слоям.
-	useScoping := len(c.config.RelevantLayerIDs) > 0
-	if useScoping {
-		isRelevant := false
-		for _, layerID := range c.config.RelevantLayerIDs {
-			if exp.LayerID == layerID {
-				isRelevant = true
-				break
-			}
-		}
-		if !isRelevant {
-			return // Игнорируем дельту для нерелевантного слоя
-		}
+	if d.Seq > c.cache.seq {
+		c.cache.seq = d.Seq
+		c.metrics.configSeq.Set(float64(c.cache.seq))
 	}
 
-	layerExperiments := c.cache.experiments[exp.LayerID]
-	found := false
-	for i, existingExp := range layerExperiments {
-		if existingExp.ID == exp.ID {
-			layerExperiments[i] = *exp // Обновляем существующий эксперимент
-			found = true
-			break
-		}
+	// Изменения других окружений только сдвигают номер изменения: иначе каждое из них
+	// выглядело бы как пропуск в последовательности дельт.
+	if d.Environment != "" && d.Environment != c.environment() {
+		return
 	}
 
-	if !found {
-		// Добавляем новый эксперимент в слой
-		c.cache.experiments[exp.LayerID] = append(layerExperiments, *exp)
+	if d.Type == ab_types.EventFlagUpsert || d.Type == ab_types.EventFlagDelete {
+		c.applyFlagDelta(d)
+		return
+	}
+	if d.Type == ab_types.EventSegmentUpsert || d.Type == ab_types.EventSegmentDelete {
+		c.applySegmentDelta(d)
+		return
+	}
+	if d.Type == ab_types.EventIDListUpsert || d.Type == ab_types.EventIDListDelete {
+		c.applyIDListDelta(d, idList)
+		return
 	}
 
-	// Обновляем глобальную версию конфигурации
-	c.cache.configVersion = exp.ConfigVersion
-	c.metrics.setVersionMetric(c.cache.configVersion) // Обновляем метрику вместе с версией
-	log.Printf("INFO: Applied delta for experiment %s. New config version: %s", exp.ID, c.cache.configVersion)
-}
+	// Эксперимент мог сменить слой, поэтому старая копия удаляется из всех слоев.
+	position := c.removeCachedExperiment(d.ExperimentID)
 
-// loadInitialSnapshot реализует отказоустойчивую логику загрузки: MinIO -> Local Cache
-func (c *Client) loadInitialSnapshot(ctx context.Context) error {
-	// Попытка №1: Загрузить из MinIO
-	snapshotData, err := c.fetchLatestSnapshotFromMinIO(ctx)
-	if err == nil {
-		log.Println("INFO: Successfully fetched latest snapshot from MinIO.")
-		// Сохраняем свежий снэпшот локально для будущего отката
-		if err := os.WriteFile(c.config.LocalCachePath, snapshotData, 0644); err != nil {
-			log.Printf("WARN: Failed to save snapshot to local cache: %v", err)
-		}
-	} else {
-		log.Printf("WARN: Failed to fetch snapshot from MinIO: %v. Falling back to local cache.", err)
-		// Попытка №2: Загрузить с локального диска
-		snapshotData, err = c.loadFromLocalCache()
-		if err != nil {
-			return fmt.Errorf("MinIO and local cache failed: %w", err)
-		}
-		log.Printf("INFO: Successfully loaded configuration from local cache file: %s", c.config.LocalCachePath)
+	if d.Type == ab_types.EventDelete {
+		log.Printf("INFO: Applied delete for experiment %s.", d.ExperimentID)
+		return
 	}
 
-	// Если мы здесь, у нас есть данные. Парсим и заполняем кэш.
-	return c.populateCacheFromSnapshot(snapshotData)
-}
-
-// fetchLatestSnapshotFromMinIO находит и загружает самый последний снэпшот.
-func (c *Client) fetchLatestSnapshotFromMinIO(ctx context.Context) ([]byte, error) {
-	objectCh := c.minioClient.ListObjects(ctx, c.config.SnapshotBucket, minio.ListObjectsOptions{})
-	var objectNames []string
-	for object := range objectCh {
-		if object.Err != nil {
-			return nil, object.Err
-		}
-		objectNames = append(objectNames, object.Key)
+	exp := d.Experiment
+	// Проверяем, относится ли эксперимент к отслеживаемым слоям.
+	if len(c.config.RelevantLayerIDs) > 0 && !slices.Contains(c.config.RelevantLayerIDs, exp.LayerID) {
+		return // Игнорируем дельту для нерелевантного слоя
 	}
 
-	if len(objectNames) == 0 {
-		return nil, errors.New("no snapshots found in bucket")
+	c.compileRulePatterns(exp.TargetingRules)
+	c.cache.overrides[exp.ID] = ab_types.NewOverrideSet(&exp.OverrideLists)
+	layerExperiments := c.cache.experiments[exp.LayerID]
+	if position.layerID == exp.LayerID && position.index >= 0 {
+		// Сохраняем порядок экспериментов в слое: от него зависит взаимное исключение.
+		c.cache.experiments[exp.LayerID] = slices.Insert(layerExperiments, position.index, *exp)
+	} else {
+		// Добавляем новый эксперимент в слой
+		c.cache.experiments[exp.LayerID] = append(layerExperiments, *exp)
 	}
 
-	// Сортируем имена файлов. Т.к. версия - это UUIDv7, лексикографическая сортировка верна.
-	sort.Strings(objectNames)
-	latestSnapshotName := objectNames[len(objectNames)-1]
-	log.Printf("INFO: Found latest snapshot: %s", latestSnapshotName)
+	if exp.ConfigVersion > c.cache.configVersion {
+		c.cache.configVersion = exp.ConfigVersion
+		c.metrics.setVersionMetric(c.cache.configVersion) // Обновляем метрику вместе с версией
+	}
+	log.Printf("INFO: Applied delta for experiment %s. Cache seq: %d, config version: %s", exp.ID, c.cache.seq, c.cache.configVersion)
+}
 
-	obj, err := c.minioClient.GetObject(ctx, c.config.SnapshotBucket, latestSnapshotName, minio.GetObjectOptions{})
-	if err != nil {
-		return nil, err
+// applyFlagDelta применяет изменение флага. Вызывается под блокировкой кэша на запись.
+// Флаги не скоупятся по RelevantLayerIDs: у них нет слоя.
+func (c *Client) applyFlagDelta(d *Delta) {
+	if d.Type == ab_types.EventFlagDelete {
+		delete(c.cache.flags, d.FlagKey)
+		log.Printf("INFO: Applied delete for flag %s.", d.FlagKey)
+		return
 	}
-	defer obj.Close()
+	c.cache.flags[d.FlagKey] = *d.Flag
+	c.compileRulePatterns(d.Flag.TargetingRules())
+	log.Printf("INFO: Applied delta for flag %s. Cache seq: %d", d.FlagKey, c.cache.seq)
+}
 
-	buf := new(bytes.Buffer)
-	if _, err := io.Copy(buf, obj); err != nil {
-		return nil, err
+// applySegmentDelta применяет изменение сегмента. Вызывается под блокировкой кэша на запись.
+// Новые правила сегмента сразу действуют во всех ссылающихся на него экспериментах и флагах.
+func (c *Client) applySegmentDelta(d *Delta) {
+	if d.Type == ab_types.EventSegmentDelete {
+		delete(c.cache.segments, d.SegmentKey)
+		log.Printf("INFO: Applied delete for segment %s.", d.SegmentKey)
+		return
 	}
-	return buf.Bytes(), nil
+	c.cache.segments[d.SegmentKey] = *d.Segment
+	c.compileRulePatterns(d.Segment.Rules)
+	log.Printf("INFO: Applied delta for segment %s (version %d). Cache seq: %d", d.SegmentKey, d.Segment.Version, c.cache.seq)
 }
 
-// loadFromLocalCache загружает снэпшот с диска и проверяет его TTL.
-func (c *Client) loadFromLocalCache() ([]byte, error) {
-	info, err := os.Stat(c.config.LocalCachePath)
-	if os.IsNotExist(err) {
-		return nil, errors.New("local cache file does not exist")
+// compileRulePatterns компилирует шаблоны MATCHES_REGEX и разбирает диапазоны IP_IN_CIDR
+// правил, которых еще нет в кэше. Вызывается под блокировкой кэша на запись; значения,
+// ставшие ненужными, удаляются при следующей загрузке снэпшота.
+func (c *Client) compileRulePatterns(rules []ab_types.TargetingRule) {
+	if err := c.cache.regexps.Compile(rules); err != nil {
+		c.metrics.errors.WithLabelValues("invalid_regex").Inc()
+		log.Printf("WARN: %v. Rules with this pattern will not match.", err)
 	}
-	if time.Since(info.ModTime()) > c.config.LocalCacheTTL {
-		return nil, fmt.Errorf("local cache is stale (older than %v)", c.config.LocalCacheTTL)
+	if err := c.cache.cidrs.Compile(rules); err != nil {
+		c.metrics.errors.WithLabelValues("invalid_cidr").Inc()
+		log.Printf("WARN: %v. Rules with this range will not match.", err)
 	}
-	return os.ReadFile(c.config.LocalCachePath)
 }
 
-// populateCacheFromSnapshot парсит JSON и заполняет in-memory кэш.
-func (c *Client) populateCacheFromSnapshot(data []byte) error {
-	var experiments []ab_types.Experiment
-	if err := json.Unmarshal(data, &experiments); err != nil {
-		return fmt.Errorf("failed to unmarshal snapshot JSON: %w", err)
+// cachePosition - место эксперимента в кэше.
+type cachePosition struct {
+	layerID string
+	index   int
+}
+
+// findCachedExperiment ищет эксперимент в кэше. Вызывается под блокировкой кэша.
+func (c *Client) findCachedExperiment(id string) *ab_types.Experiment {
+	position := c.locateCachedExperiment(id)
+	if position.index < 0 {
+		return nil
 	}
+	return &c.cache.experiments[position.layerID][position.index]
+}
 
-	c.cache.rwMutex.Lock()
-	defer c.cache.rwMutex.Unlock()
+// locateCachedExperiment возвращает позицию эксперимента в кэше (index = -1, если его нет).
+// Вызывается под блокировкой кэша.
+func (c *Client) locateCachedExperiment(id string) cachePosition {
+	for layerID, experiments := range c.cache.experiments {
+		for i := range experiments {
+			if experiments[i].ID == id {
+				return cachePosition{layerID: layerID, index: i}
+			}
+		}
+	}
+	return cachePosition{index: -1}
+}
 
-	// Очищаем старый кэш
-	c.cache.experiments = make(map[string][]ab_types.Experiment)
-	c.cache.configVersion = ""
+// removeCachedExperiment удаляет эксперимент из кэша и возвращает его бывшую позицию
+// (index = -1, если эксперимента не было). Вызывается под блокировкой кэша на запись.
+func (c *Client) removeCachedExperiment(id string) cachePosition {
+	for layerID, experiments := range c.cache.experiments {
+		for i := range experiments {
+			if experiments[i].ID != id {
+				continue
+			}
+			experiments = slices.Delete(experiments, i, i+1)
+			delete(c.cache.overrides, id)
+			if len(experiments) == 0 {
+				delete(c.cache.experiments, layerID)
+			} else {
+				c.cache.experiments[layerID] = experiments
+			}
+			return cachePosition{layerID: layerID, index: i}
+		}
+	}
+	return cachePosition{index: -1}
+}
 
-	useScoping := len(c.config.RelevantLayerIDs) > 0
-	relevantLayers := make(map[string]bool)
-	for _, id := range c.config.RelevantLayerIDs {
-		relevantLayers[id] = true
+// requestResync просит фоновый процесс перезагрузить снэпшот с номером не ниже minSeq.
+func (c *Client) requestResync(minSeq int64) {
+	select {
+	case c.resyncCh <- minSeq:
+	default: // Ресинхронизация уже запрошена
 	}
+}
 
-	loadedCount := 0
-	for _, exp := range experiments {
-		// Применяем скоупинг, если он настроен
-		if useScoping && !relevantLayers[exp.LayerID] {
-			continue
+// runResync перезагружает снэпшот после обнаружения пропуска в дельтах.
+// Снэпшот применяется только когда он покрывает номер, на котором обнаружен пропуск.
+func (c *Client) runResync(ctx context.Context) {
+	for {
+		var minSeq int64
+		select {
+		case <-ctx.Done():
+			return
+		case minSeq = <-c.resyncCh:
 		}
 
-		c.cache.experiments[exp.LayerID] = append(c.cache.experiments[exp.LayerID], exp)
-		if exp.ConfigVersion > c.cache.configVersion {
-			c.cache.configVersion = exp.ConfigVersion
+		for attempt := 1; ; attempt++ {
+			snapshot, _, err := c.fetchSnapshot(ctx)
+			if err == nil && snapshot.Seq >= minSeq {
+				c.populateCache(snapshot)
+				log.Printf("INFO: Resynced configuration from snapshot at seq %d.", snapshot.Seq)
+				break
+			}
+			if err == nil {
+				err = fmt.Errorf("latest snapshot is at seq %d, need at least %d", snapshot.Seq, minSeq)
+			}
+			log.Printf("WARN: Resync attempt %d failed: %v", attempt, err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(resyncRetryInterval):
+			}
 		}
-		loadedCount++
 	}
-
-	log.Printf("INFO: Populated cache with %d experiments across %d layers.", loadedCount, len(c.cache.experiments))
-	c.metrics.setVersionMetric(c.cache.configVersion)
-
-	return nil
 }
 
 type DecisionContext struct {
-	UserID     string
-	Attributes map[string]any
+	UserID string
+	// Identifiers - дополнительные идентификаторы (device_id, session_id, org_id, anonymous_id...),
+	// по которым могут рандомизироваться эксперименты с BucketBy.
+	Identifiers map[string]string
+	Attributes  map[string]any
+	// IP - IP-адрес пользователя. Попадает в атрибут ab_types.IPAttribute (для правил IP_IN_CIDR)
+	// и передается в Config.AttributeEnricher.
+	IP string
+}
+
+// hasIdentity сообщает, передан ли хотя бы один идентификатор.
+func (ctx *DecisionContext) hasIdentity() bool {
+	return ctx.UserID != "" || len(ctx.Identifiers) > 0
 }
 
 // Decide принимает решение для пользователя на основе его ID и атрибутов.
 // Возвращает map[experiment_id]variant_name для всех экспериментов, в которые попал пользователь.
 func (c *Client) Decide(userID string, attributes map[string]any) map[string]string {
-	if userID == "" {
+	return c.DecideFor(DecisionContext{UserID: userID, Attributes: attributes})
+}
+
+// DecideFor - Decide для контекста с несколькими идентификаторами.
+func (c *Client) DecideFor(user DecisionContext) map[string]string {
+	if !user.hasIdentity() {
 		return map[string]string{}
 	}
 
+	// Пока конфигурация не загружена, отдаем варианты по умолчанию.
+	if !c.Ready() {
+		assignments := maps.Clone(c.config.DefaultVariants)
+		if assignments == nil {
+			assignments = make(map[string]string)
+		}
+		maps.Copy(assignments, c.overrides)
+		return assignments
+	}
+
 	assignments := make(map[string]string)
+	c.enrichContext(&user)
+	ctx := &user
+
+	// Назначения учитываются (в том числе сохраняются в AssignmentStore) после снятия
+	// блокировки кэша, чтобы медленное хранилище не задерживало применение дельт.
+	for _, resolved := range c.resolveLayers(ctx) {
+		assignments[resolved.experiment.ID] = resolved.variantName
+		c.recordAssignment(ctx, resolved.experiment, resolved.variantName, resolved.reason)
+	}
 
-	ctx := &DecisionContext{
-		UserID:     userID,
-		Attributes: attributes,
+	if len(c.overrides) > 0 {
+		for expID, variantName := range c.overrides {
+			assignments[expID] = variantName
+		}
 	}
 
+	return assignments
+}
+
+// resolveLayers вычисляет назначения пользователя во всех слоях под блокировкой кэша.
+func (c *Client) resolveLayers(ctx *DecisionContext) []resolvedVariant {
 	c.cache.rwMutex.RLock() // Блокируем кэш только на чтение
 	defer c.cache.rwMutex.RUnlock()
 
+	var resolved []resolvedVariant
 	// Итерируемся по каждому слою в кэше
 	for _, experimentsInLayer := range c.cache.experiments {
 		for _, exp := range experimentsInLayer {
 			// Проверяем, подходит ли пользователь для данного эксперимента
-			isAssigned, variantName := c.evaluateExperiment(ctx, &exp)
-			if isAssigned {
-				assignments[exp.ID] = variantName
+			variantName, reason := c.evaluateExperiment(ctx, &exp)
+			if variantName != "" {
+				// exp - копия элемента слоя, поэтому ее можно использовать после снятия блокировки.
+				resolved = append(resolved, resolvedVariant{variantName: variantName, reason: reason, experiment: &exp})
 				// Ключевой момент: как только пользователь попал в один эксперимент в слое,
 				// мы прекращаем обработку этого слоя и переходим к следующему.
 				// Это обеспечивает взаимную исключительность.
@@ -359,14 +531,7 @@ func (c *Client) Decide(userID string, attributes map[string]any) map[string]str
 			}
 		}
 	}
-
-	if len(c.overrides) > 0 {
-		for expID, variantName := range c.overrides {
-			assignments[expID] = variantName
-		}
-	}
-
-	return assignments
+	return resolved
 }
 
 /*
@@ -0,0 +1,150 @@
+package client_sdk
+
+import (
+	"context"
+	"os"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+func TestMain(m *testing.M) {
+	// Клиенты в тестах загружают конфигурацию без случайной задержки.
+	maxStartupJitter = 0
+	os.Exit(m.Run())
+}
+
+// testExperiment - активный эксперимент, в котором все бакеты отданы варианту treatment.
+func testExperiment(id string) ab_types.Experiment {
+	return ab_types.Experiment{
+		ID:            id,
+		LayerID:       "layer-" + id,
+		ConfigVersion: "v1",
+		Salt:          "salt-" + id,
+		Status:        ab_types.StatusActive,
+		Variants:      []ab_types.Variant{{Name: "treatment", BucketRange: [2]int{0, 999}}},
+	}
+}
+
+// newTestClient создает клиент, загружающий снэпшоты из source. Дельты source
+// клиенту не передаются: тесты применяют их явно.
+func newTestClient(t *testing.T, source SnapshotSource, config Config) *Client {
+	t.Helper()
+	config.SnapshotSource = source
+	client, err := NewClient(context.Background(), config)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// cachedExperimentIDs возвращает отсортированные ID экспериментов в кэше клиента.
+func cachedExperimentIDs(c *Client) []string {
+	c.cache.rwMutex.RLock()
+	defer c.cache.rwMutex.RUnlock()
+
+	var ids []string
+	for _, experiments := range c.cache.experiments {
+		for _, exp := range experiments {
+			ids = append(ids, exp.ID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func upsertDelta(seq int64, exp ab_types.Experiment) *Delta {
+	return &Delta{Type: ab_types.EventUpsert, Seq: seq, ExperimentID: exp.ID, Experiment: &exp, Environment: exp.EnvironmentOrDefault()}
+}
+
+func TestApplyDeltaSequence(t *testing.T) {
+	staging := testExperiment("staging-exp")
+	staging.Environment = "staging"
+
+	tests := []struct {
+		name            string
+		deltas          []*Delta
+		wantSeq         int64
+		wantExperiments []string
+		wantGaps        float64
+	}{
+		{
+			name:            "in order",
+			deltas:          []*Delta{upsertDelta(2, testExperiment("b"))},
+			wantSeq:         2,
+			wantExperiments: []string{"a", "b"},
+		},
+		{
+			name:            "already applied",
+			deltas:          []*Delta{upsertDelta(1, testExperiment("b"))},
+			wantSeq:         1,
+			wantExperiments: []string{"a"},
+		},
+		{
+			name:            "gap",
+			deltas:          []*Delta{upsertDelta(4, testExperiment("b"))},
+			wantSeq:         4,
+			wantExperiments: []string{"a", "b"},
+			wantGaps:        1,
+		},
+		{
+			// Дельта другого окружения не применяется, но сдвигает номер: следующая дельта - не пропуск.
+			name:            "other environment",
+			deltas:          []*Delta{upsertDelta(2, staging), upsertDelta(3, testExperiment("c"))},
+			wantSeq:         3,
+			wantExperiments: []string{"a", "c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := NewMemorySource()
+			source.Upsert(testExperiment("a"))
+			client := newTestClient(t, source, Config{})
+
+			gaps := client.metrics.errors.WithLabelValues("delta_sequence_gap")
+			gapsBefore := testutil.ToFloat64(gaps)
+			for _, delta := range tt.deltas {
+				clientDeltaSink{client: client}.Apply(delta)
+			}
+
+			if got := client.Status().Seq; got != tt.wantSeq {
+				t.Errorf("seq = %d, want %d", got, tt.wantSeq)
+			}
+			if got := cachedExperimentIDs(client); !slices.Equal(got, tt.wantExperiments) {
+				t.Errorf("experiments = %v, want %v", got, tt.wantExperiments)
+			}
+			if got := testutil.ToFloat64(gaps) - gapsBefore; got != tt.wantGaps {
+				t.Errorf("sequence gaps = %v, want %v", got, tt.wantGaps)
+			}
+		})
+	}
+}
+
+func TestDeltaGapTriggersResync(t *testing.T) {
+	source := NewMemorySource()
+	source.Upsert(testExperiment("a"))
+	client := newTestClient(t, source, Config{})
+
+	// Изменения 2 и 3 не дошли до клиента дельтами; дельта 3 обнаруживает пропуск,
+	// и клиент догоняет состояние по снэпшоту источника.
+	source.Upsert(testExperiment("b"))
+	source.Upsert(testExperiment("c"))
+	clientDeltaSink{client: client}.Apply(upsertDelta(3, testExperiment("c")))
+
+	deadline := time.Now().Add(time.Second)
+	for !slices.Equal(cachedExperimentIDs(client), []string{"a", "b", "c"}) {
+		if time.Now().After(deadline) {
+			t.Fatalf("experiments = %v after resync, want [a b c]", cachedExperimentIDs(client))
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := client.Status().Seq; got != 3 {
+		t.Errorf("seq = %d after resync, want 3", got)
+	}
+}
@@ -1,6 +1,11 @@
 package client_sdk
 
-import "time"
+import (
+	"crypto/ed25519"
+	"time"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
 
 // Config содержит все параметры, необходимые для инициализации и работы клиентской библиотеки.
 type Config struct {
@@ -9,6 +14,17 @@ type Config struct {
 	// Это ключевой механизм для скоупинга и экономии памяти.
 	RelevantLayerIDs []string
 
+	// SnapshotSource - источник снэпшотов. Если не задан, используется MinIO
+	// с параметрами MinIO* ниже.
+	SnapshotSource SnapshotSource
+	// DeltaSource - источник дельт. Если не задан, используется Kafka (топик дельт проекта,
+	// см. Project), если указаны KafkaBrokers; иначе клиент работает без дельт.
+	DeltaSource DeltaSource
+	// IDListSource - источник содержимого списков идентификаторов. Если не задан,
+	// используется SnapshotSource, если он реализует IDListSource (как MinIOSnapshotSource);
+	// иначе правила и оверрайды со списками никого не пропускают.
+	IDListSource IDListSource
+
 	// Kafka configuration for receiving deltas
 	KafkaBrokers []string
 	KafkaGroupID string // Уникальный ID для группы потребителей
@@ -20,11 +36,78 @@ type Config struct {
 	MinIOUseSSL    bool
 	SnapshotBucket string
 
+	// SnapshotPublicKey - публичный ключ Ed25519 для проверки подписи манифеста снэпшота.
+	// Если задан, снэпшоты без валидного подписанного манифеста отвергаются.
+	// Если не задан, проверяются только контрольная сумма и размер (при наличии манифеста).
+	SnapshotPublicKey ed25519.PublicKey
+
 	// Local fallback cache settings
 	LocalCachePath string        // Путь к файлу для кэширования снэпшота на диске
 	LocalCacheTTL  time.Duration // Максимальное время жизни локального кэша
 
 	OverridesFilePath string
 
+	// Project - проект клиента (по умолчанию ab_types.DefaultProject). Определяет префикс
+	// снэпшотов в MinIO и топик дельт, поэтому клиент загружает только конфигурацию своего проекта.
+	// Для HTTPSnapshotSource проект определяется API-ключом (HTTPSnapshotSource.WithAPIKey).
+	Project string
+
+	// Environment - окружение клиента (по умолчанию ab_types.DefaultEnvironment).
+	// Определяет префикс снэпшотов в MinIO, какие дельты и эксперименты применяются,
+	// и состояние флагов, которое использует IsEnabled. Для HTTPSnapshotSource окружение
+	// передается в URL: /snapshot?environment=staging.
+	Environment string
+
+	// NonBlockingStartup - NewClient возвращается сразу, а конфигурация загружается в фоне
+	// с повторными попытками. До загрузки Decide возвращает DefaultVariants;
+	// готовность проверяется через Ready, WaitReady и Status.
+	NonBlockingStartup bool
+	// DefaultVariants - варианты [experiment_id] -> variant_name, которые Decide
+	// возвращает, пока конфигурация не загружена.
+	DefaultVariants map[string]string
+	// InitialLoadRetryInterval - пауза между попытками фоновой загрузки (по умолчанию 5s).
+	InitialLoadRetryInterval time.Duration
+
 	AssignmentEventsTopic string
+	// AutoExpose - отправлять событие экспозиции при каждом назначении в Decide, GetVariant и Get*.
+	// По умолчанию вычисление варианта не имеет побочных эффектов, и событие
+	// отправляется только явным вызовом LogExposure.
+	AutoExpose bool
+
+	// IdentityMapper - необязательный хук, приводящий идентификатор к каноническому
+	// (например, user_id -> anonymous_id до логина), чтобы вариант сохранялся после входа.
+	IdentityMapper IdentityMapper
+
+	// AttributeEnricher - необязательный хук, дополняющий атрибуты по DecisionContext.IP
+	// (например, geoip.NewEnricher(reader).Enrich). Вызывается только для контекстов с IP.
+	AttributeEnricher AttributeEnricher
+
+	// CoercionMode - сравнение атрибутов пользователя со значениями правил разных типов:
+	// ab_types.CoercionLenient (по умолчанию) приводит типы, ab_types.CoercionStrict требует
+	// их совпадения. Несравнимые значения не проходят правило и учитываются в метрике
+	// ab_client_rule_type_mismatches_total.
+	CoercionMode ab_types.CoercionMode
+
+	// AssignmentStore хранит закрепленные назначения экспериментов с Sticky.
+	// Если не задан, используется MemoryAssignmentStore на 100000 назначений.
+	AssignmentStore AssignmentStore
+	// AssignmentStoreTimeout ограничивает каждое обращение к AssignmentStore (100ms).
+	// Чтение выполняется под блокировкой кэша, поэтому медленное хранилище задерживает применение дельт.
+	AssignmentStoreTimeout time.Duration
+
+	// Очередь событий экспозиции. Нулевые значения заменяются значениями по умолчанию.
+	ExposureQueueSize     int           // Максимум событий в очереди (10000)
+	ExposureBatchSize     int           // Максимум событий в одном запросе к Kafka (500)
+	ExposureFlushInterval time.Duration // Период отправки неполного пакета (1s)
+	// ExposureDropPolicy - поведение при переполнении очереди (DropNewest по умолчанию).
+	ExposureDropPolicy DropPolicy
+	// ExposureDedupWindow - окно, в котором повторные (user, experiment, variant) не отправляются (10m).
+	// Отрицательное значение отключает дедупликацию.
+	ExposureDedupWindow time.Duration
+	ExposureDedupSize   int // Число ключей в LRU дедупликации (100000)
+	// ExposureCloseTimeout - сколько Close ждет отправки накопленных событий (5s).
+	ExposureCloseTimeout time.Duration
+	// ExposurePublishTimeout ограничивает отправку одного пакета (10s); пакет, не отправленный
+	// к сроку, теряется, и очередь продолжает разбираться.
+	ExposurePublishTimeout time.Duration
 }
@@ -1,154 +1,321 @@
 package client_sdk
 
 import (
-	"context"
-	"encoding/json"
-	"fmt"
 	"log"
-	"slices"
-	"strconv"
+	"maps"
+	"strings"
 	"time"
 
-	"github.com/cespare/xxhash/v2"
 	"github.com/goriiin/go-ab-service/pkg/ab_types"
 	"github.com/hashicorp/go-version"
 )
 
 // evaluateExperiment выполняет полную, корректную проверку одного эксперимента для пользователя.
-func (c *Client) evaluateExperiment(ctx *DecisionContext, exp *ab_types.Experiment) (bool, string) {
+// Функция не имеет побочных эффектов: метрики, события назначения и закрепление sticky-назначений
+// (commitAssignment) выполняет вызывающий код.
+func (c *Client) evaluateExperiment(ctx *DecisionContext, exp *ab_types.Experiment) (string, Reason) {
 	// 1. Проверка статуса эксперимента
 	if exp.Status != ab_types.StatusActive || (exp.EndTime != nil && exp.EndTime.Before(time.Now())) {
-		return false, ""
+		return "", ReasonInactive
 	}
 
+	// Идентификатор единицы рандомизации (BucketBy). Списки оверрайдов сверяются с ним,
+	// а хеширование и sticky-назначения используют его каноническую форму (IdentityMapper).
+	unitID, ok := ab_types.BucketKey(exp.BucketBy, ctx.UserID, ctx.Identifiers, ctx.Attributes)
+	if !ok {
+		return "", ReasonMissingBucketKey
+	}
+
+	overrides := c.overrideSet(exp)
+
 	// 2. Проверка принудительного исключения (высший приоритет)
-	if slices.Contains(exp.OverrideLists.ForceExclude, ctx.UserID) {
-		return false, ""
+	if overrides.Excluded(unitID) || c.inAnyIDList(exp.OverrideLists.ForceExcludeLists, unitID) {
+		return "", ReasonForcedExcluded
 	}
 
 	// 3. Проверка принудительного включения в конкретный вариант
-	if exp.OverrideLists.ForceInclude != nil {
-		for variantName, userList := range exp.OverrideLists.ForceInclude {
-			if slices.Contains(userList, ctx.UserID) {
-				// Пользователь принудительно назначен. Пропускаем таргетинг и бакетирование.
-				go c.trackAssignment(ctx, exp.ID, variantName)
-				return true, variantName
-			}
+	if variantName, ok := overrides.IncludedVariant(unitID); ok {
+		// Пользователь принудительно назначен. Пропускаем таргетинг и бакетирование.
+		return variantName, ReasonForcedIncluded
+	}
+	for variantName, listIDs := range exp.OverrideLists.ForceIncludeLists {
+		if c.inAnyIDList(listIDs, unitID) {
+			return variantName, ReasonForcedIncluded
+		}
+	}
+
+	bucketKey := c.canonicalID(exp, unitID)
+
+	// 4. Закрепленное назначение имеет приоритет над текущими таргетингом и бакетами
+	if exp.Sticky {
+		if variantName, ok := c.stickyVariant(bucketKey, exp); ok {
+			return variantName, ReasonSticky
 		}
 	}
 
-	// 4. Проверка правил таргетинга
+	// 5. Проверка правил таргетинга
 	if !c.checkTargetingRules(ctx, exp.TargetingRules) {
-		return false, ""
+		return "", ReasonTargetedOut
 	}
 
-	// 5. Финальное распределение (бакетирование)
-	return c.getVariantForUser(ctx, exp)
+	// 6. Финальное распределение (бакетирование)
+	if variantName, ok := getVariantForUser(bucketKey, exp); ok {
+		return variantName, ReasonAssigned
+	}
+	return "", ReasonNotInBuckets
 }
 
-// checkTargetingRules проверяет, удовлетворяет ли пользователь ВСЕМ правилам таргетинга.
-func (c *Client) checkTargetingRules(ctx *DecisionContext, rules []ab_types.TargetingRule) bool {
-	for _, rule := range rules {
-		if !c.evaluateRule(ctx, &rule) {
-			return false
-		}
+// overrideSet возвращает inline-оверрайды эксперимента в виде множеств. Множества строятся
+// при загрузке конфигурации; для эксперимента не из кэша они строятся на месте.
+// Вызывается под блокировкой кэша на чтение.
+func (c *Client) overrideSet(exp *ab_types.Experiment) ab_types.OverrideSet {
+	if overrides, ok := c.cache.overrides[exp.ID]; ok {
+		return overrides
 	}
-	return true
+	return ab_types.NewOverrideSet(&exp.OverrideLists)
 }
 
-// getVariantForUser вычисляет хеш и находит вариант для пользователя.
-func (c *Client) getVariantForUser(ctx *DecisionContext, exp *ab_types.Experiment) (bool, string) {
-	hashKey := []byte(ctx.UserID + exp.Salt)
-	bucket := xxhash.Sum64(hashKey) % 1000
-
-	for _, variant := range exp.Variants {
-		if bucket >= uint64(variant.BucketRange[0]) && bucket <= uint64(variant.BucketRange[1]) {
-			c.metrics.decisions.WithLabelValues(exp.ID, variant.Name).Inc()
-			go c.trackAssignment(ctx, exp.ID, variant.Name)
-			return true, variant.Name
+// recordAssignment учитывает итоговое назначение: закрепляет его для sticky-экспериментов
+// и обновляет метрики. Событие экспозиции отправляется только при Config.AutoExpose;
+// иначе за это отвечает явный вызов LogExposure.
+func (c *Client) recordAssignment(ctx *DecisionContext, exp *ab_types.Experiment, variantName string, reason Reason) {
+	expID := exp.ID
+	if exp.Sticky && reason == ReasonAssigned {
+		if unitID, ok := ab_types.BucketKey(exp.BucketBy, ctx.UserID, ctx.Identifiers, ctx.Attributes); ok {
+			c.stickAssignment(c.canonicalID(exp, unitID), expID, variantName)
 		}
 	}
+	c.metrics.decisions.WithLabelValues(expID, variantName).Inc()
+	if c.config.AutoExpose {
+		c.logExposure(ctx, expID, variantName)
+	}
+}
 
-	return false, ""
+// LogExposure фиксирует, что пользователь фактически увидел вариант эксперимента,
+// и отправляет событие в AssignmentEventsTopic. Вызывается в момент показа,
+// а не при вычислении варианта (Decide, GetVariant и Get* не отправляют событий без AutoExpose).
+func (c *Client) LogExposure(experimentID string, user DecisionContext, variantName string) {
+	if !user.hasIdentity() || experimentID == "" || variantName == "" {
+		return
+	}
+	c.logExposure(&user, experimentID, variantName)
 }
 
-func (c *Client) trackAssignment(ctx *DecisionContext, expID, variantName string) {
-	event := AssignmentEvent{
+// logExposure ставит событие экспозиции в очередь отправки.
+func (c *Client) logExposure(ctx *DecisionContext, expID, variantName string) {
+	if c.exposures == nil {
+		return // Kafka не настроена
+	}
+	c.exposures.enqueue(AssignmentEvent{
 		UserID:       ctx.UserID,
+		Identifiers:  maps.Clone(ctx.Identifiers),
 		ExperimentID: expID,
 		VariantName:  variantName,
 		Timestamp:    time.Now().UTC(),
-		Context:      ctx.Attributes,
-	}
-	payload, err := json.Marshal(event)
-	if err != nil {
-		log.Printf("ERROR: Failed to marshal assignment event: %v", err)
-		c.metrics.errors.WithLabelValues("assignment_marshal_error").Inc()
-		return
+		// Копия: вызывающий код может изменить атрибуты до отправки пакета.
+		Context: maps.Clone(ctx.Attributes),
+	})
+}
+
+// checkTargetingRules проверяет, удовлетворяет ли пользователь ВСЕМ правилам таргетинга.
+// Правила с несравнимыми типами (RuleUnknown) не пропускают пользователя.
+func (c *Client) checkTargetingRules(ctx *DecisionContext, rules []ab_types.TargetingRule) bool {
+	return c.evaluateRules(ctx, rules).Passed()
+}
+
+// evaluateRules вычисляет конъюнкцию правил в трехзначной логике: RuleFalse, если
+// хотя бы одно правило ложно, иначе RuleUnknown, если хотя бы одно несравнимо.
+func (c *Client) evaluateRules(ctx *DecisionContext, rules []ab_types.TargetingRule) ab_types.RuleResult {
+	result := ab_types.RuleTrue
+	for i := range rules {
+		switch c.evaluateRule(ctx, &rules[i]) {
+		case ab_types.RuleFalse:
+			return ab_types.RuleFalse
+		case ab_types.RuleUnknown:
+			result = ab_types.RuleUnknown
+		}
 	}
-	err = c.assignmentProducer.Publish(context.Background(), []byte(ctx.UserID), payload)
-	if err != nil {
-		log.Printf("ERROR: Failed to publish assignment event to Kafka: %v", err)
-		c.metrics.errors.WithLabelValues("assignment_publish_error").Inc()
+	return result
+}
+
+// getVariantForUser вычисляет бакет ключа рандомизации и находит вариант для пользователя.
+func getVariantForUser(bucketKey string, exp *ab_types.Experiment) (string, bool) {
+	if variant := exp.VariantForBucket(exp.Bucket(bucketKey)); variant != nil {
+		return variant.Name, true
 	}
+	return "", false
 }
 
 // evaluateRule - ядро логики, проверяющее одно конкретное правило.
-func (c *Client) evaluateRule(ctx *DecisionContext, rule *ab_types.TargetingRule) bool {
+// Отсутствующий атрибут и неизвестный оператор дают RuleFalse, несравнимые типы - RuleUnknown.
+func (c *Client) evaluateRule(ctx *DecisionContext, rule *ab_types.TargetingRule) ab_types.RuleResult {
+	if rule.IsGroup() {
+		return c.evaluateRuleGroup(ctx, rule)
+	}
+	if key, ok := rule.SegmentKey(); ok {
+		return c.evaluateSegmentRule(ctx, rule.Operator, key)
+	}
+	if listID, ok := rule.IDListKey(); ok {
+		return ab_types.RuleResultOf(c.evaluateIDListRule(ctx, rule, listID))
+	}
 	userValue, ok := ctx.Attributes[rule.Attribute]
 	if !ok {
-		return false
+		return ab_types.RuleFalse
 	}
+	mode := c.coercionMode
 	switch rule.Operator {
 	case ab_types.OpEquals:
-		return fmt.Sprintf("%v", userValue) == fmt.Sprintf("%v", rule.Value)
+		equal, ok := mode.Equal(userValue, rule.Value)
+		if !ok {
+			return c.typeMismatch(rule)
+		}
+		return ab_types.RuleResultOf(equal)
 	case ab_types.OpGreaterThan:
-		userNum, ok1 := toFloat64(userValue)
-		ruleNum, ok2 := toFloat64(rule.Value)
-		return ok1 && ok2 && userNum > ruleNum
+		userNum, ok1 := mode.Number(userValue)
+		ruleNum, ok2 := ab_types.ToFloat64(rule.Value)
+		if !ok1 || !ok2 {
+			return c.typeMismatch(rule)
+		}
+		return ab_types.RuleResultOf(userNum > ruleNum)
 	case ab_types.OpInList:
-		userStr := fmt.Sprintf("%v", userValue)
-		ruleList, ok := rule.Value.([]interface{})
+		ruleList, ok := rule.Value.([]any)
 		if !ok {
-			return false
+			return c.typeMismatch(rule)
 		}
+		comparable := len(ruleList) == 0
 		for _, item := range ruleList {
-			if strItem, ok := item.(string); ok && strItem == userStr {
-				return true
+			equal, ok := mode.Equal(userValue, item)
+			if equal {
+				return ab_types.RuleTrue
 			}
+			comparable = comparable || ok
 		}
-		return false
+		if !comparable {
+			return c.typeMismatch(rule)
+		}
+		return ab_types.RuleFalse
 	case ab_types.OpVersionGreaterThan:
-		userVerStr, ok1 := userValue.(string)
+		userVerStr, ok1 := mode.String(userValue)
 		ruleVerStr, ok2 := rule.Value.(string)
 		if !ok1 || !ok2 {
-			return false
+			return c.typeMismatch(rule)
 		}
 		userV, err1 := version.NewVersion(userVerStr)
 		ruleV, err2 := version.NewVersion(ruleVerStr)
-		return err1 == nil && err2 == nil && userV.GreaterThan(ruleV)
+		if err1 != nil || err2 != nil {
+			return c.typeMismatch(rule)
+		}
+		return ab_types.RuleResultOf(userV.GreaterThan(ruleV))
+	case ab_types.OpMatchesRegex:
+		userStr, ok1 := mode.String(userValue)
+		pattern, ok2 := rule.RegexPattern()
+		if !ok1 || !ok2 {
+			return c.typeMismatch(rule)
+		}
+		re := c.cache.regexps[pattern]
+		return ab_types.RuleResultOf(re != nil && re.MatchString(userStr))
+	case ab_types.OpStartsWith, ab_types.OpEndsWith:
+		userStr, ok1 := mode.String(userValue)
+		ruleStr, ok2 := rule.Value.(string)
+		if !ok1 || !ok2 {
+			return c.typeMismatch(rule)
+		}
+		if rule.Operator == ab_types.OpStartsWith {
+			return ab_types.RuleResultOf(strings.HasPrefix(userStr, ruleStr))
+		}
+		return ab_types.RuleResultOf(strings.HasSuffix(userStr, ruleStr))
+	case ab_types.OpDateBefore, ab_types.OpDateAfter:
+		userTime, ok1 := ab_types.ParseRuleTime(userValue)
+		ruleTime, ok2 := ab_types.ParseRuleTime(rule.Value)
+		if !ok1 || !ok2 {
+			return c.typeMismatch(rule)
+		}
+		if rule.Operator == ab_types.OpDateBefore {
+			return ab_types.RuleResultOf(userTime.Before(ruleTime))
+		}
+		return ab_types.RuleResultOf(userTime.After(ruleTime))
+	case ab_types.OpIPInCIDR:
+		userIP, ok1 := userValue.(string)
+		prefixes, ok2 := c.cache.cidrs.Prefixes(rule)
+		if !ok1 || !ok2 {
+			return c.typeMismatch(rule)
+		}
+		return ab_types.RuleResultOf(ab_types.IPInCIDRs(userIP, prefixes))
+	case ab_types.OpWithinLastDays:
+		userTime, ok1 := ab_types.ParseRuleTime(userValue)
+		window, ok2 := ab_types.WithinLastDaysWindow(rule.Value)
+		if !ok1 || !ok2 {
+			return c.typeMismatch(rule)
+		}
+		age := time.Since(userTime)
+		return ab_types.RuleResultOf(age >= 0 && age <= window)
 	default:
 		log.Printf("WARN: Unknown operator used: %s", rule.Operator)
-		return false
+		return ab_types.RuleFalse
 	}
 }
 
-func toFloat64(v any) (float64, bool) {
-	switch i := v.(type) {
-	case float64:
-		return i, true
-	case float32:
-		return float64(i), true
-	case int64:
-		return float64(i), true
-	case int32:
-		return float64(i), true
-	case int:
-		return float64(i), true
-	case string:
-		f, err := strconv.ParseFloat(i, 64)
-		return f, err == nil
+// evaluateRuleGroup вычисляет группу правил All, Any или Not.
+// Any истинна, если истинно хотя бы одно правило, иначе RuleUnknown, если хотя бы одно несравнимо.
+func (c *Client) evaluateRuleGroup(ctx *DecisionContext, rule *ab_types.TargetingRule) ab_types.RuleResult {
+	switch {
+	case rule.Not != nil:
+		return c.evaluateRule(ctx, rule.Not).Not()
+	case rule.Any != nil:
+		result := ab_types.RuleFalse
+		for i := range rule.Any {
+			switch c.evaluateRule(ctx, &rule.Any[i]) {
+			case ab_types.RuleTrue:
+				return ab_types.RuleTrue
+			case ab_types.RuleUnknown:
+				result = ab_types.RuleUnknown
+			}
+		}
+		return result
 	default:
-		return 0, false
+		return c.evaluateRules(ctx, rule.All)
+	}
+}
+
+// evaluateSegmentRule проверяет вхождение пользователя в сегмент из кэша.
+// Вызывается под блокировкой кэша на чтение. Неизвестный сегмент (еще не доставлен
+// или удален) не пропускает пользователя ни для IN_SEGMENT, ни для NOT_IN_SEGMENT.
+func (c *Client) evaluateSegmentRule(ctx *DecisionContext, operator ab_types.Operator, key string) ab_types.RuleResult {
+	segment, ok := c.cache.segments[key]
+	if !ok {
+		return ab_types.RuleFalse
+	}
+	in := c.evaluateRules(ctx, segment.Rules)
+	if operator == ab_types.OpNotInSegment {
+		return in.Not()
+	}
+	return in
+}
+
+// evaluateIDListRule проверяет вхождение идентификатора пользователя (rule.Attribute,
+// как BucketBy) в список из кэша. Вызывается под блокировкой кэша на чтение.
+// Пользователь без идентификатора и неизвестный или не загруженный список
+// не проходят ни IN_ID_LIST, ни NOT_IN_ID_LIST.
+func (c *Client) evaluateIDListRule(ctx *DecisionContext, rule *ab_types.TargetingRule, listID string) bool {
+	set, ok := c.cache.idLists[listID]
+	if !ok {
+		return false
 	}
+	unitID, ok := ab_types.BucketKey(rule.Attribute, ctx.UserID, ctx.Identifiers, ctx.Attributes)
+	if !ok {
+		return false
+	}
+	in := set.contains(unitID)
+	if rule.Operator == ab_types.OpNotInIDList {
+		return !in
+	}
+	return in
+}
+
+// typeMismatch учитывает правило, атрибут которого несравним со значением правила
+// (например, строка против числа в строгом режиме), и возвращает RuleUnknown: такое правило
+// не проходит, в том числе внутри Not.
+func (c *Client) typeMismatch(rule *ab_types.TargetingRule) ab_types.RuleResult {
+	c.metrics.typeMismatches.WithLabelValues(rule.Attribute, string(rule.Operator)).Inc()
+	return ab_types.RuleUnknown
 }
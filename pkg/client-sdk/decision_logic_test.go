@@ -0,0 +1,119 @@
+package client_sdk
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+// withRecordedExposures подменяет очередь экспозиций клиента очередью с записывающим producer.
+func withRecordedExposures(client *Client) *fakePublisher {
+	producer := &fakePublisher{}
+	client.exposures = newTestPipeline(producer, Config{ExposureBatchSize: 1, ExposureFlushInterval: time.Hour})
+	return producer
+}
+
+func TestDecisionsHaveNoExposureSideEffects(t *testing.T) {
+	client := newTestClient(t, NewMemorySource(testExperiment("a")), Config{})
+	producer := withRecordedExposures(client)
+	user := DecisionContext{UserID: "user-1"}
+
+	client.Decide("user-1", nil)
+	client.DecideFor(user)
+	client.GetVariant(context.Background(), "a", user)
+	client.GetVariantOr("a", user, "control")
+	client.GetString("a", user, "title", "default")
+	client.exposures.close(time.Second)
+
+	if _, users := producer.published(); len(users) != 0 {
+		t.Fatalf("published %d exposures without LogExposure, want none", len(users))
+	}
+}
+
+func TestExposureEvents(t *testing.T) {
+	tests := []struct {
+		name       string
+		autoExpose bool
+		decide     func(client *Client, user DecisionContext)
+	}{
+		{"log exposure", false, func(client *Client, user DecisionContext) {
+			variantName, _ := client.GetVariant(context.Background(), "a", user)
+			client.LogExposure("a", user, variantName)
+		}},
+		{"auto expose", true, func(client *Client, user DecisionContext) {
+			client.GetVariant(context.Background(), "a", user)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, NewMemorySource(testExperiment("a")), Config{AutoExpose: tt.autoExpose})
+			producer := withRecordedExposures(client)
+
+			tt.decide(client, DecisionContext{UserID: "user-1"})
+			client.exposures.close(time.Second)
+
+			if _, users := producer.published(); !slices.Equal(users, []string{"user-1"}) {
+				t.Errorf("published exposures for %v, want exactly one for user-1", users)
+			}
+		})
+	}
+}
+
+func TestForcedOverrides(t *testing.T) {
+	exp := splitExperiment("")
+	exp.OverrideLists = ab_types.OverrideLists{
+		ForceInclude: map[string][]string{"control": {"user-in"}},
+		ForceExclude: []string{"user-out"},
+	}
+	// Дельта меняет списки местами: множества оверрайдов должны перестроиться.
+	swapped := exp
+	swapped.OverrideLists = ab_types.OverrideLists{
+		ForceInclude: map[string][]string{"treatment": {"user-out"}},
+		ForceExclude: []string{"user-in"},
+	}
+
+	tests := []struct {
+		name        string
+		delta       *Delta
+		userID      string
+		wantVariant string
+		wantReason  Reason
+	}{
+		{"force include", nil, "user-in", "control", ReasonForcedIncluded},
+		{"force exclude", nil, "user-out", "", ReasonForcedExcluded},
+		{"exclude updated by delta", upsertDelta(2, swapped), "user-in", "", ReasonForcedExcluded},
+		{"include updated by delta", upsertDelta(2, swapped), "user-out", "treatment", ReasonForcedIncluded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := NewMemorySource()
+			source.Upsert(exp)
+			client := newTestClient(t, source, Config{})
+			if tt.delta != nil {
+				clientDeltaSink{client: client}.Apply(tt.delta)
+			}
+
+			variantName, reason := client.GetVariant(context.Background(), exp.ID, DecisionContext{UserID: tt.userID})
+			if variantName != tt.wantVariant || reason != tt.wantReason {
+				t.Errorf("GetVariant() = %q, %q, want %q, %q", variantName, reason, tt.wantVariant, tt.wantReason)
+			}
+		})
+	}
+
+	t.Run("deleted experiment", func(t *testing.T) {
+		source := NewMemorySource()
+		source.Upsert(exp)
+		client := newTestClient(t, source, Config{})
+		clientDeltaSink{client: client}.Apply(&Delta{Type: ab_types.EventDelete, Seq: 2, ExperimentID: exp.ID, Environment: exp.EnvironmentOrDefault()})
+
+		client.cache.rwMutex.RLock()
+		_, ok := client.cache.overrides[exp.ID]
+		client.cache.rwMutex.RUnlock()
+		if ok {
+			t.Error("overrides of a deleted experiment are kept in the cache")
+		}
+	})
+}
@@ -0,0 +1,263 @@
+package client_sdk
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// DropPolicy определяет, какое событие теряется при переполнении очереди экспозиций.
+type DropPolicy string
+
+const (
+	// DropNewest - новое событие отбрасывается (по умолчанию).
+	DropNewest DropPolicy = "drop_newest"
+	// DropOldest - из очереди вытесняется самое старое событие.
+	DropOldest DropPolicy = "drop_oldest"
+)
+
+// Значения по умолчанию для очереди экспозиций.
+const (
+	defaultExposureQueueSize      = 10000
+	defaultExposureBatchSize      = 500
+	defaultExposureFlushInterval  = time.Second
+	defaultExposureDedupWindow    = 10 * time.Minute
+	defaultExposureDedupSize      = 100000
+	defaultExposureCloseTimeout   = 5 * time.Second
+	defaultExposurePublishTimeout = 10 * time.Second
+)
+
+// exposurePublisher отправляет пакет сообщений в Kafka. Реализуется queue.Producer.
+type exposurePublisher interface {
+	PublishBatch(ctx context.Context, messages ...kafka.Message) error
+}
+
+// exposurePipeline - ограниченная очередь событий экспозиции с пакетной отправкой в Kafka.
+// Одинаковые (user, experiment, variant) в пределах окна дедупликации отправляются один раз.
+type exposurePipeline struct {
+	producer       exposurePublisher
+	metrics        *sdkMetrics
+	events         chan AssignmentEvent
+	batchSize      int
+	flushInterval  time.Duration
+	publishTimeout time.Duration
+	dropPolicy     DropPolicy
+
+	// dedup хранит время отправки последнего события по ключу; nil, если дедупликация отключена.
+	dedup       *lruCache[string, time.Time]
+	dedupWindow time.Duration
+
+	// closeMu защищает events от записи после закрытия.
+	closeMu sync.RWMutex
+	closed  bool
+	// drainCtx отменяется по истечении срока закрытия и прерывает отправку оставшихся событий.
+	drainCtx    context.Context
+	drainCancel context.CancelFunc
+	done        chan struct{}
+}
+
+func newExposurePipeline(producer exposurePublisher, config Config, metrics *sdkMetrics) *exposurePipeline {
+	p := &exposurePipeline{
+		producer:       producer,
+		metrics:        metrics,
+		events:         make(chan AssignmentEvent, positiveOr(config.ExposureQueueSize, defaultExposureQueueSize)),
+		batchSize:      positiveOr(config.ExposureBatchSize, defaultExposureBatchSize),
+		flushInterval:  positiveOr(config.ExposureFlushInterval, defaultExposureFlushInterval),
+		publishTimeout: positiveOr(config.ExposurePublishTimeout, defaultExposurePublishTimeout),
+		dropPolicy:     config.ExposureDropPolicy,
+		dedupWindow:    config.ExposureDedupWindow,
+		done:           make(chan struct{}),
+	}
+	if p.dropPolicy == "" {
+		p.dropPolicy = DropNewest
+	}
+	if p.dedupWindow == 0 {
+		p.dedupWindow = defaultExposureDedupWindow
+	}
+	if p.dedupWindow > 0 {
+		p.dedup = newLRUCache[string, time.Time](positiveOr(config.ExposureDedupSize, defaultExposureDedupSize))
+	}
+	p.drainCtx, p.drainCancel = context.WithCancel(context.Background())
+
+	go p.run()
+	return p
+}
+
+// enqueue ставит событие в очередь без блокировки вызывающего кода.
+func (p *exposurePipeline) enqueue(event AssignmentEvent) {
+	p.closeMu.RLock()
+	defer p.closeMu.RUnlock()
+	if p.closed {
+		p.metrics.exposuresDropped.WithLabelValues("closed").Inc()
+		return
+	}
+	if p.isDuplicate(&event) {
+		p.metrics.exposuresDeduplicated.Inc()
+		return
+	}
+
+	select {
+	case p.events <- event:
+		p.metrics.exposures.WithLabelValues(event.ExperimentID, event.VariantName).Inc()
+		return
+	default:
+	}
+
+	if p.dropPolicy == DropOldest {
+		select {
+		case evicted := <-p.events:
+			p.forgetDedup(&evicted)
+			p.metrics.exposuresDropped.WithLabelValues("queue_full").Inc()
+		default:
+		}
+		select {
+		case p.events <- event:
+			p.metrics.exposures.WithLabelValues(event.ExperimentID, event.VariantName).Inc()
+			return
+		default:
+		}
+	}
+	p.forgetDedup(&event)
+	p.metrics.exposuresDropped.WithLabelValues("queue_full").Inc()
+}
+
+// isDuplicate сообщает, отправлялось ли такое же событие в пределах окна дедупликации,
+// и запоминает текущее событие. Если событие затем теряется, запись снимает forgetDedup.
+func (p *exposurePipeline) isDuplicate(event *AssignmentEvent) bool {
+	if p.dedup == nil {
+		return false
+	}
+	key := event.dedupKey()
+	if sentAt, ok := p.dedup.Get(key); ok && event.Timestamp.Sub(sentAt) < p.dedupWindow {
+		return true
+	}
+	p.dedup.Add(key, event.Timestamp)
+	return false
+}
+
+// forgetDedup удаляет запись дедупликации потерянного события, чтобы следующее такое же
+// событие было отправлено. Запись более нового события не трогается.
+func (p *exposurePipeline) forgetDedup(event *AssignmentEvent) {
+	if p.dedup == nil {
+		return
+	}
+	key := event.dedupKey()
+	if sentAt, ok := p.dedup.Get(key); ok && sentAt.Equal(event.Timestamp) {
+		p.dedup.Remove(key)
+	}
+}
+
+// run собирает события в пакеты и отправляет их по размеру пакета или по таймеру.
+func (p *exposurePipeline) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]AssignmentEvent, 0, p.batchSize)
+	for {
+		select {
+		case event, ok := <-p.events:
+			if !ok {
+				p.flush(batch)
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) >= p.batchSize {
+				p.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			p.flush(batch)
+			batch = batch[:0]
+		}
+		p.metrics.exposureQueueLength.Set(float64(len(p.events)))
+	}
+}
+
+// flush отправляет пакет одним запросом к Kafka. Каждый запрос ограничен publishTimeout,
+// чтобы зависший брокер не останавливал отправку, пока очередь переполняется.
+func (p *exposurePipeline) flush(batch []AssignmentEvent) {
+	if len(batch) == 0 {
+		return
+	}
+
+	messages := make([]kafka.Message, 0, len(batch))
+	for _, event := range batch {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("ERROR: Failed to marshal assignment event: %v", err)
+			p.metrics.errors.WithLabelValues("assignment_marshal_error").Inc()
+			continue
+		}
+		messages = append(messages, kafka.Message{Key: []byte(event.unitKey()), Value: payload})
+	}
+
+	ctx, cancel := context.WithTimeout(p.drainCtx, p.publishTimeout)
+	defer cancel()
+	if err := p.producer.PublishBatch(ctx, messages...); err != nil {
+		log.Printf("ERROR: Failed to publish %d assignment events to Kafka: %v", len(messages), err)
+		p.metrics.errors.WithLabelValues("assignment_publish_error").Inc()
+		p.metrics.exposuresDropped.WithLabelValues("publish_error").Add(float64(len(messages)))
+		for i := range batch {
+			p.forgetDedup(&batch[i])
+		}
+		return
+	}
+	p.metrics.exposureBatches.Inc()
+}
+
+// close прекращает прием событий и отправляет накопленные в пределах timeout.
+// run вычитывает очередь до конца, поэтому события, не отправленные к сроку,
+// учитываются в метрике как publish_error.
+func (p *exposurePipeline) close(timeout time.Duration) {
+	p.closeMu.Lock()
+	if p.closed {
+		p.closeMu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.events)
+	p.closeMu.Unlock()
+
+	timer := time.AfterFunc(positiveOr(timeout, defaultExposureCloseTimeout), p.drainCancel)
+	defer timer.Stop()
+	<-p.done
+	p.drainCancel()
+}
+
+// dedupKey - ключ дедупликации события: субъект, эксперимент и вариант.
+func (e *AssignmentEvent) dedupKey() string {
+	return e.unitKey() + "\x00" + e.ExperimentID + "\x00" + e.VariantName
+}
+
+// unitKey идентифицирует субъекта события: UserID, а для анонимных пользователей -
+// набор дополнительных идентификаторов.
+func (e *AssignmentEvent) unitKey() string {
+	if e.UserID != "" {
+		return e.UserID
+	}
+	names := make([]string, 0, len(e.Identifiers))
+	for name := range e.Identifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var key strings.Builder
+	for _, name := range names {
+		key.WriteString(name + "=" + e.Identifiers[name] + ";")
+	}
+	return key.String()
+}
+
+func positiveOr[T int | time.Duration](value, fallback T) T {
+	if value > 0 {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,293 @@
+package client_sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/segmentio/kafka-go"
+)
+
+// fakePublisher записывает отправленные пакеты. Если задан publish, он вызывается перед
+// записью пакета и может задержать или отклонить отправку.
+type fakePublisher struct {
+	mu      sync.Mutex
+	calls   int
+	batches [][]string // UserID событий каждого отправленного пакета
+	publish func(ctx context.Context, call int) error
+}
+
+func (f *fakePublisher) PublishBatch(ctx context.Context, messages ...kafka.Message) error {
+	f.mu.Lock()
+	f.calls++
+	call := f.calls
+	f.mu.Unlock()
+
+	if f.publish != nil {
+		if err := f.publish(ctx, call); err != nil {
+			return err
+		}
+	}
+
+	users := make([]string, 0, len(messages))
+	for _, message := range messages {
+		var event AssignmentEvent
+		if err := json.Unmarshal(message.Value, &event); err != nil {
+			return err
+		}
+		users = append(users, event.UserID)
+	}
+	f.mu.Lock()
+	f.batches = append(f.batches, users)
+	f.mu.Unlock()
+	return nil
+}
+
+// published возвращает размеры отправленных пакетов и UserID всех событий по порядку.
+func (f *fakePublisher) published() (sizes []int, users []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, batch := range f.batches {
+		sizes = append(sizes, len(batch))
+		users = append(users, batch...)
+	}
+	return sizes, users
+}
+
+func newTestPipeline(producer exposurePublisher, config Config) *exposurePipeline {
+	return newExposurePipeline(producer, config, newMetrics(promauto.With(nil)))
+}
+
+func exposure(userID string) AssignmentEvent {
+	return AssignmentEvent{UserID: userID, ExperimentID: "exp", VariantName: "treatment", Timestamp: time.Now()}
+}
+
+// waitFor ждет выполнения условия не дольше секунды.
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestExposurePipelineBatchesBySize(t *testing.T) {
+	producer := &fakePublisher{}
+	p := newTestPipeline(producer, Config{ExposureBatchSize: 3, ExposureFlushInterval: time.Hour})
+
+	for i := 0; i < 7; i++ {
+		p.enqueue(exposure(fmt.Sprintf("user-%d", i)))
+	}
+	waitFor(t, "two full batches", func() bool {
+		sizes, _ := producer.published()
+		return len(sizes) == 2
+	})
+	p.close(time.Second)
+
+	sizes, users := producer.published()
+	if !slices.Equal(sizes, []int{3, 3, 1}) {
+		t.Errorf("batch sizes = %v, want [3 3 1]", sizes)
+	}
+	if len(users) != 7 {
+		t.Errorf("published %d events, want 7", len(users))
+	}
+}
+
+func TestExposurePipelineBatchesByInterval(t *testing.T) {
+	producer := &fakePublisher{}
+	p := newTestPipeline(producer, Config{ExposureBatchSize: 100, ExposureFlushInterval: 10 * time.Millisecond})
+	defer p.close(time.Second)
+
+	p.enqueue(exposure("user-1"))
+	p.enqueue(exposure("user-2"))
+	waitFor(t, "an incomplete batch to be flushed", func() bool {
+		_, users := producer.published()
+		return len(users) == 2
+	})
+}
+
+func TestExposurePipelineDropPolicy(t *testing.T) {
+	tests := []struct {
+		policy DropPolicy
+		want   []string
+	}{
+		{DropNewest, []string{"user-0", "user-1", "user-2"}},
+		{DropOldest, []string{"user-0", "user-2", "user-3"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			// Первый пакет задерживается, пока очередь на два события не переполнится.
+			started, release := make(chan struct{}), make(chan struct{})
+			producer := &fakePublisher{publish: func(_ context.Context, call int) error {
+				if call == 1 {
+					close(started)
+					<-release
+				}
+				return nil
+			}}
+			p := newTestPipeline(producer, Config{
+				ExposureQueueSize:     2,
+				ExposureBatchSize:     1,
+				ExposureFlushInterval: time.Hour,
+				ExposureDropPolicy:    tt.policy,
+			})
+
+			p.enqueue(exposure("user-0"))
+			<-started
+			for _, user := range []string{"user-1", "user-2", "user-3"} {
+				p.enqueue(exposure(user))
+			}
+			close(release)
+			p.close(time.Second)
+
+			if _, users := producer.published(); !slices.Equal(users, tt.want) {
+				t.Errorf("published %v, want %v", users, tt.want)
+			}
+			if dropped := testutil.ToFloat64(p.metrics.exposuresDropped.WithLabelValues("queue_full")); dropped != 1 {
+				t.Errorf("queue_full drops = %v, want 1", dropped)
+			}
+		})
+	}
+}
+
+func TestExposurePipelineLostEventsAreNotDeduplicated(t *testing.T) {
+	t.Run("dropped", func(t *testing.T) {
+		started, release := make(chan struct{}), make(chan struct{})
+		producer := &fakePublisher{publish: func(_ context.Context, call int) error {
+			if call == 1 {
+				close(started)
+				<-release
+			}
+			return nil
+		}}
+		p := newTestPipeline(producer, Config{ExposureQueueSize: 1, ExposureBatchSize: 1, ExposureFlushInterval: time.Hour})
+
+		p.enqueue(exposure("user-0"))
+		<-started
+		p.enqueue(exposure("user-1"))
+		p.enqueue(exposure("user-2")) // очередь заполнена: событие теряется
+		close(release)
+		waitFor(t, "the queue to drain", func() bool {
+			_, users := producer.published()
+			return len(users) == 2
+		})
+
+		p.enqueue(exposure("user-2"))
+		p.close(time.Second)
+
+		if _, users := producer.published(); !slices.Equal(users, []string{"user-0", "user-1", "user-2"}) {
+			t.Errorf("published %v, want the dropped exposure to be sent again", users)
+		}
+		if deduplicated := testutil.ToFloat64(p.metrics.exposuresDeduplicated); deduplicated != 0 {
+			t.Errorf("deduplicated = %v, want 0", deduplicated)
+		}
+	})
+
+	t.Run("publish error", func(t *testing.T) {
+		producer := &fakePublisher{publish: func(_ context.Context, call int) error {
+			if call == 1 {
+				return errors.New("broker unavailable")
+			}
+			return nil
+		}}
+		p := newTestPipeline(producer, Config{ExposureBatchSize: 1, ExposureFlushInterval: time.Hour})
+
+		p.enqueue(exposure("user-1"))
+		waitFor(t, "the failed publish", func() bool {
+			return testutil.ToFloat64(p.metrics.exposuresDropped.WithLabelValues("publish_error")) == 1
+		})
+		p.enqueue(exposure("user-1"))
+		p.close(time.Second)
+
+		if _, users := producer.published(); !slices.Equal(users, []string{"user-1"}) {
+			t.Errorf("published %v, want the failed exposure to be sent again", users)
+		}
+	})
+
+	t.Run("published", func(t *testing.T) {
+		producer := &fakePublisher{}
+		p := newTestPipeline(producer, Config{ExposureBatchSize: 1, ExposureFlushInterval: time.Hour})
+
+		p.enqueue(exposure("user-1"))
+		p.enqueue(exposure("user-1"))
+		p.close(time.Second)
+
+		if _, users := producer.published(); !slices.Equal(users, []string{"user-1"}) {
+			t.Errorf("published %v, want one exposure", users)
+		}
+		if deduplicated := testutil.ToFloat64(p.metrics.exposuresDeduplicated); deduplicated != 1 {
+			t.Errorf("deduplicated = %v, want 1", deduplicated)
+		}
+	})
+}
+
+func TestExposurePipelinePublishTimeout(t *testing.T) {
+	// Зависший первый запрос прерывается по ExposurePublishTimeout, и следующие пакеты отправляются.
+	producer := &fakePublisher{publish: func(ctx context.Context, call int) error {
+		if call == 1 {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	}}
+	p := newTestPipeline(producer, Config{
+		ExposureBatchSize:      1,
+		ExposureFlushInterval:  time.Hour,
+		ExposurePublishTimeout: 20 * time.Millisecond,
+	})
+	defer p.close(time.Second)
+
+	p.enqueue(exposure("user-1"))
+	p.enqueue(exposure("user-2"))
+	waitFor(t, "the batch after the timed out one", func() bool {
+		_, users := producer.published()
+		return slices.Equal(users, []string{"user-2"})
+	})
+}
+
+func TestExposurePipelineClose(t *testing.T) {
+	t.Run("drains the queue", func(t *testing.T) {
+		producer := &fakePublisher{}
+		p := newTestPipeline(producer, Config{ExposureBatchSize: 100, ExposureFlushInterval: time.Hour})
+		for i := 0; i < 10; i++ {
+			p.enqueue(exposure(fmt.Sprintf("user-%d", i)))
+		}
+		p.close(time.Second)
+
+		if _, users := producer.published(); len(users) != 10 {
+			t.Errorf("published %d events, want 10", len(users))
+		}
+		p.enqueue(exposure("user-late"))
+		if closed := testutil.ToFloat64(p.metrics.exposuresDropped.WithLabelValues("closed")); closed != 1 {
+			t.Errorf("closed drops = %v, want 1", closed)
+		}
+	})
+
+	t.Run("stops at the close timeout", func(t *testing.T) {
+		producer := &fakePublisher{publish: func(ctx context.Context, _ int) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}}
+		p := newTestPipeline(producer, Config{ExposureBatchSize: 100, ExposureFlushInterval: time.Hour})
+		p.enqueue(exposure("user-1"))
+
+		start := time.Now()
+		p.close(50 * time.Millisecond)
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("close took %v, want about 50ms", elapsed)
+		}
+		if lost := testutil.ToFloat64(p.metrics.exposuresDropped.WithLabelValues("publish_error")); lost != 1 {
+			t.Errorf("publish_error drops = %v, want 1", lost)
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package client_sdk
+
+import (
+	"strconv"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+// IsEnabled вычисляет фиче-флаг для пользователя в окружении Config.Environment.
+// Выключенный в окружении флаг (или флаг без состояния в окружении) возвращает Flag.Default.
+// Во включенном флаге пользователь получает true, если проходит правила таргетинга
+// и попадает в долю раскатки. Неизвестный флаг и неготовый клиент возвращают false.
+// В отличие от экспериментов, флаги не отправляют событий экспозиции.
+func (c *Client) IsEnabled(flagKey string, user DecisionContext) bool {
+	c.enrichContext(&user)
+	enabled := c.evaluateFlag(flagKey, &user)
+	c.metrics.flags.WithLabelValues(flagKey, strconv.FormatBool(enabled)).Inc()
+	return enabled
+}
+
+// evaluateFlag вычисляет флаг без побочных эффектов. Блокировка кэша удерживается
+// до конца вычисления: правила читают сегменты, списки идентификаторов и шаблоны из кэша.
+func (c *Client) evaluateFlag(flagKey string, user *DecisionContext) bool {
+	c.cache.rwMutex.RLock()
+	defer c.cache.rwMutex.RUnlock()
+	flag, ok := c.cache.flags[flagKey]
+	if !ok {
+		return false
+	}
+
+	env, ok := flag.Environments[c.environment()]
+	if !ok || !env.Enabled {
+		return flag.Default
+	}
+	if !c.checkTargetingRules(user, env.TargetingRules) {
+		return false
+	}
+	unitID, ok := ab_types.BucketKey(flag.BucketBy, user.UserID, user.Identifiers, user.Attributes)
+	if !ok {
+		return false
+	}
+	return flag.InRollout(&env, c.canonicalFlagID(&flag, unitID))
+}
+
+// environment возвращает окружение клиента.
+func (c *Client) environment() string {
+	if c.config.Environment == "" {
+		return ab_types.DefaultEnvironment
+	}
+	return c.config.Environment
+}
+
+// project возвращает проект клиента.
+func (c *Client) project() string {
+	if c.config.Project == "" {
+		return ab_types.DefaultProject
+	}
+	return c.config.Project
+}
@@ -0,0 +1,115 @@
+package client_sdk
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+func TestIsEnabled(t *testing.T) {
+	proOnly := []ab_types.TargetingRule{{Attribute: "plan", Operator: ab_types.OpEquals, Value: "pro"}}
+
+	tests := []struct {
+		name        string
+		flag        ab_types.Flag
+		environment string
+		key         string
+		attributes  map[string]any
+		want        bool
+	}{
+		{
+			name: "unknown flag",
+			flag: ab_types.Flag{Key: "checkout", Environments: map[string]ab_types.FlagEnvironment{"production": {Enabled: true}}},
+			key:  "missing",
+			want: false,
+		},
+		{
+			name: "environment off returns default",
+			flag: ab_types.Flag{Key: "checkout", Default: true, Environments: map[string]ab_types.FlagEnvironment{"production": {Enabled: false}}},
+			want: true,
+		},
+		{
+			name: "environment off ignores rollout",
+			flag: ab_types.Flag{Key: "checkout", Environments: map[string]ab_types.FlagEnvironment{"production": {Enabled: false, Rollout: ptr(100.0)}}},
+			want: false,
+		},
+		{
+			name: "environment not configured returns default",
+			flag: ab_types.Flag{Key: "checkout", Default: true, Environments: map[string]ab_types.FlagEnvironment{"staging": {Enabled: false}}},
+			want: true,
+		},
+		{
+			name:        "state of the client environment",
+			flag:        ab_types.Flag{Key: "checkout", Environments: map[string]ab_types.FlagEnvironment{"production": {Enabled: false}, "staging": {Enabled: true}}},
+			environment: "staging",
+			want:        true,
+		},
+		{
+			name:       "targeted in",
+			flag:       ab_types.Flag{Key: "checkout", Environments: map[string]ab_types.FlagEnvironment{"production": {Enabled: true, TargetingRules: proOnly}}},
+			attributes: map[string]any{"plan": "pro"},
+			want:       true,
+		},
+		{
+			name:       "targeted out",
+			flag:       ab_types.Flag{Key: "checkout", Default: true, Environments: map[string]ab_types.FlagEnvironment{"production": {Enabled: true, TargetingRules: proOnly}}},
+			attributes: map[string]any{"plan": "free"},
+			want:       false,
+		},
+		{
+			name: "zero rollout",
+			flag: ab_types.Flag{Key: "checkout", Environments: map[string]ab_types.FlagEnvironment{"production": {Enabled: true, Rollout: ptr(0.0)}}},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := NewMemorySource()
+			source.UpsertFlag(tt.flag)
+			client := newTestClient(t, source, Config{Environment: tt.environment})
+
+			key := tt.key
+			if key == "" {
+				key = tt.flag.Key
+			}
+			if got := client.IsEnabled(key, DecisionContext{UserID: "user-1", Attributes: tt.attributes}); got != tt.want {
+				t.Errorf("IsEnabled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsEnabledRolloutIsMonotonic(t *testing.T) {
+	const users = 1000
+	var previous map[string]bool
+	for _, rollout := range []float64{0, 10, 25, 50, 99.9, 100} {
+		source := NewMemorySource()
+		source.UpsertFlag(ab_types.Flag{
+			Key:          "checkout",
+			Salt:         "salt",
+			Environments: map[string]ab_types.FlagEnvironment{"production": {Enabled: true, Rollout: ptr(rollout)}},
+		})
+		client := newTestClient(t, source, Config{})
+
+		enabled := make(map[string]bool)
+		for i := 0; i < users; i++ {
+			userID := fmt.Sprintf("user-%d", i)
+			if client.IsEnabled("checkout", DecisionContext{UserID: userID}) {
+				enabled[userID] = true
+			}
+		}
+		for userID := range previous {
+			if !enabled[userID] {
+				t.Errorf("rollout %v%%: %s dropped out of the rollout", rollout, userID)
+			}
+		}
+		// Доля включенных пользователей близка к rollout.
+		if share := float64(len(enabled)) / users * 100; share < rollout-5 || share > rollout+5 {
+			t.Errorf("rollout %v%%: enabled for %.1f%% of users", rollout, share)
+		}
+		previous = enabled
+	}
+}
@@ -0,0 +1,172 @@
+package client_sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+// idListFetchTimeout ограничивает загрузку содержимого списков при обновлении конфигурации.
+const idListFetchTimeout = 30 * time.Second
+
+// IDListSource загружает содержимое списков идентификаторов, на которые ссылаются
+// правила таргетинга и оверрайды. Реализации: MinIOSnapshotSource (объект list.ObjectKey
+// в бакете снэпшотов), HTTPIDListSource и MemorySource.
+type IDListSource interface {
+	// FetchIDList возвращает содержимое списка: идентификаторы по одному на строку.
+	FetchIDList(ctx context.Context, list *ab_types.IDList) ([]byte, error)
+}
+
+// idListSet - загруженный список идентификаторов в виде хеш-множества.
+type idListSet struct {
+	objectKey     string
+	configVersion string
+	members       map[string]struct{}
+}
+
+func (s *idListSet) contains(id string) bool {
+	_, ok := s.members[id]
+	return ok
+}
+
+// loadIDLists загружает содержимое списков проекта клиента из снэпшота. Множества, у которых
+// не изменился объект содержимого, переиспользуются из кэша; при ошибке загрузки
+// сохраняется прежнее множество списка, если оно есть.
+func (c *Client) loadIDLists(lists []ab_types.IDList) map[string]*idListSet {
+	ctx, cancel := context.WithTimeout(context.Background(), idListFetchTimeout)
+	defer cancel()
+
+	sets := make(map[string]*idListSet, len(lists))
+	for i := range lists {
+		list := &lists[i]
+		if list.ProjectOrDefault() != c.project() {
+			continue
+		}
+		if set := c.fetchIDList(ctx, list); set != nil {
+			sets[list.ID] = set
+		}
+	}
+	return sets
+}
+
+// fetchIDList возвращает множество текущей версии списка. Вызывается без блокировки кэша.
+// При ошибке возвращает прежнее множество из кэша (или nil, если его нет).
+func (c *Client) fetchIDList(ctx context.Context, list *ab_types.IDList) *idListSet {
+	c.cache.rwMutex.RLock()
+	cached := c.cache.idLists[list.ID]
+	c.cache.rwMutex.RUnlock()
+	if cached != nil && cached.objectKey == list.ObjectKey {
+		return &idListSet{objectKey: cached.objectKey, configVersion: list.ConfigVersion, members: cached.members}
+	}
+
+	set, err := c.downloadIDList(ctx, list)
+	if err != nil {
+		c.metrics.errors.WithLabelValues("id_list_fetch_error").Inc()
+		log.Printf("WARN: Failed to load content of id list %s: %v", list.ID, err)
+		return cached
+	}
+	return set
+}
+
+// downloadIDList загружает и проверяет содержимое списка.
+func (c *Client) downloadIDList(ctx context.Context, list *ab_types.IDList) (*idListSet, error) {
+	set := &idListSet{objectKey: list.ObjectKey, configVersion: list.ConfigVersion, members: map[string]struct{}{}}
+	if list.ObjectKey == "" {
+		return set, nil // Содержимое еще не загружено: список пуст.
+	}
+	if c.idListSource == nil {
+		return nil, errors.New("no id list source configured")
+	}
+	data, err := c.idListSource.FetchIDList(ctx, list)
+	if err != nil {
+		return nil, err
+	}
+	if err := list.Verify(data); err != nil {
+		return nil, err
+	}
+	for _, id := range ab_types.ParseIDs(data) {
+		set.members[id] = struct{}{}
+	}
+	return set, nil
+}
+
+// applyIDListDelta применяет изменение списка. Вызывается под блокировкой кэша на запись;
+// set - содержимое, загруженное до блокировки (nil, если загрузить не удалось).
+func (c *Client) applyIDListDelta(d *Delta, set *idListSet) {
+	if d.Type == ab_types.EventIDListDelete {
+		delete(c.cache.idLists, d.IDListID)
+		log.Printf("INFO: Applied delete for id list %s.", d.IDListID)
+		return
+	}
+	if set == nil {
+		log.Printf("WARN: Keeping previous content of id list %s: new content could not be loaded.", d.IDListID)
+		return
+	}
+	c.cache.idLists[d.IDListID] = set
+	log.Printf("INFO: Applied delta for id list %s (%d ids). Cache seq: %d", d.IDListID, len(set.members), c.cache.seq)
+}
+
+// inAnyIDList сообщает, входит ли unitID хотя бы в один из списков listIDs.
+// Вызывается под блокировкой кэша на чтение.
+func (c *Client) inAnyIDList(listIDs []string, unitID string) bool {
+	for _, id := range listIDs {
+		if set, ok := c.cache.idLists[id]; ok && set.contains(unitID) {
+			return true
+		}
+	}
+	return false
+}
+
+// HTTPIDListSource загружает содержимое списков с эндпоинта GET /id-lists/{id}/content central-api.
+type HTTPIDListSource struct {
+	baseURL    string
+	httpClient *http.Client
+	// apiKey - API-ключ проекта (заголовок X-API-Key); пусто - проект по умолчанию.
+	apiKey string
+}
+
+// NewHTTPIDListSource создает HTTP-источник списков. baseURL - адрес central-api;
+// если httpClient равен nil, используется http.DefaultClient.
+func NewHTTPIDListSource(baseURL string, httpClient *http.Client) *HTTPIDListSource {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &HTTPIDListSource{baseURL: baseURL, httpClient: httpClient}
+}
+
+// WithAPIKey задает API-ключ проекта, которому принадлежат списки.
+func (s *HTTPIDListSource) WithAPIKey(apiKey string) *HTTPIDListSource {
+	s.apiKey = apiKey
+	return s
+}
+
+func (s *HTTPIDListSource) FetchIDList(ctx context.Context, list *ab_types.IDList) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.baseURL+"/id-lists/"+url.PathEscape(list.ID)+"/content", nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.apiKey != "" {
+		req.Header.Set(ab_types.APIKeyHeader, s.apiKey)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request id list: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected id list response status: %s", resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read id list response: %w", err)
+	}
+	return data, nil
+}
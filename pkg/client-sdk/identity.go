@@ -0,0 +1,62 @@
+package client_sdk
+
+import (
+	"maps"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+// IdentityMapper приводит идентификатор единицы рандомизации к каноническому виду.
+// Например, для bucketBy == "user_id" можно вернуть anonymous_id, под которым пользователь
+// был распределен до входа: тогда хеш, а значит и вариант, после логина не изменится.
+// Возвращаемая пустая строка означает "оставить id без изменений".
+type IdentityMapper func(bucketBy, id string) string
+
+// AttributeEnricher дополняет атрибуты пользователя по его IP-адресу, например, страной
+// и регионом из локальной базы MaxMind (geoip.Enricher.Enrich). Атрибуты, переданные
+// вызывающим кодом, не должны перезаписываться.
+type AttributeEnricher func(ip string, attributes map[string]any)
+
+// enrichContext добавляет в атрибуты контекста IP-адрес (ab_types.IPAttribute) и атрибуты
+// Config.AttributeEnricher. Атрибуты копируются: карта вызывающего кода не изменяется.
+func (c *Client) enrichContext(user *DecisionContext) {
+	if user.IP == "" {
+		return
+	}
+	attributes := maps.Clone(user.Attributes)
+	if attributes == nil {
+		attributes = make(map[string]any)
+	}
+	if _, ok := attributes[ab_types.IPAttribute]; !ok {
+		attributes[ab_types.IPAttribute] = user.IP
+	}
+	if c.config.AttributeEnricher != nil {
+		c.config.AttributeEnricher(user.IP, attributes)
+	}
+	user.Attributes = attributes
+}
+
+// canonicalID возвращает ключ хеширования и sticky-назначений для единицы рандомизации эксперимента.
+func (c *Client) canonicalID(exp *ab_types.Experiment, id string) string {
+	return c.mapIdentity(exp.BucketByOrDefault(), id)
+}
+
+// canonicalFlagID возвращает ключ хеширования для раскатки флага.
+func (c *Client) canonicalFlagID(flag *ab_types.Flag, id string) string {
+	bucketBy := flag.BucketBy
+	if bucketBy == "" {
+		bucketBy = ab_types.DefaultBucketBy
+	}
+	return c.mapIdentity(bucketBy, id)
+}
+
+// mapIdentity применяет Config.IdentityMapper к идентификатору единицы bucketBy.
+func (c *Client) mapIdentity(bucketBy, id string) string {
+	if c.config.IdentityMapper == nil {
+		return id
+	}
+	if mapped := c.config.IdentityMapper(bucketBy, id); mapped != "" {
+		return mapped
+	}
+	return id
+}
@@ -0,0 +1,91 @@
+package client_sdk
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+// splitExperiment - эксперимент 50/50, рандомизируемый по bucketBy.
+func splitExperiment(bucketBy string) ab_types.Experiment {
+	exp := testExperiment("split")
+	exp.BucketBy = bucketBy
+	exp.Variants = []ab_types.Variant{
+		{Name: "control", BucketRange: [2]int{0, 499}},
+		{Name: "treatment", BucketRange: [2]int{500, 999}},
+	}
+	return exp
+}
+
+// idInOtherVariant находит идентификатор с префиксом prefix, попадающий не в тот вариант, что id.
+func idInOtherVariant(t *testing.T, exp *ab_types.Experiment, id, prefix string) (string, string) {
+	t.Helper()
+	variantName, _ := getVariantForUser(id, exp)
+	for i := 0; i < 1000; i++ {
+		candidate := fmt.Sprintf("%s-%d", prefix, i)
+		if other, _ := getVariantForUser(candidate, exp); other != variantName {
+			return candidate, other
+		}
+	}
+	t.Fatalf("no %s id outside variant %s", prefix, variantName)
+	return "", ""
+}
+
+func TestBucketByIdentifier(t *testing.T) {
+	exp := splitExperiment("device_id")
+	// Устройство попадает в другой вариант, чем user_id: результат показывает, по какому ключу шло бакетирование.
+	deviceID, deviceVariant := idInOtherVariant(t, &exp, "user-1", "device")
+
+	tests := []struct {
+		name        string
+		user        DecisionContext
+		wantVariant string
+		wantReason  Reason
+	}{
+		{"identifier", DecisionContext{UserID: "user-1", Identifiers: map[string]string{"device_id": deviceID}}, deviceVariant, ReasonAssigned},
+		{"attribute fallback", DecisionContext{UserID: "user-1", Attributes: map[string]any{"device_id": deviceID}}, deviceVariant, ReasonAssigned},
+		{"identifier over attribute", DecisionContext{UserID: "user-1", Identifiers: map[string]string{"device_id": deviceID}, Attributes: map[string]any{"device_id": "other"}}, deviceVariant, ReasonAssigned},
+		{"missing key", DecisionContext{UserID: "user-1", Identifiers: map[string]string{"session_id": "s-1"}}, "", ReasonMissingBucketKey},
+		{"non-string attribute", DecisionContext{UserID: "user-1", Attributes: map[string]any{"device_id": float64(1)}}, "", ReasonMissingBucketKey},
+	}
+	client := newTestClient(t, NewMemorySource(exp), Config{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			variantName, reason := client.GetVariant(context.Background(), exp.ID, tt.user)
+			if variantName != tt.wantVariant || reason != tt.wantReason {
+				t.Errorf("GetVariant() = %q, %q, want %q, %q", variantName, reason, tt.wantVariant, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestIdentityMapper(t *testing.T) {
+	exp := splitExperiment("")
+	anonymousID, anonymousVariant := idInOtherVariant(t, &exp, "user-1", "anon")
+
+	var calls []string
+	client := newTestClient(t, NewMemorySource(exp), Config{
+		IdentityMapper: func(bucketBy, id string) string {
+			calls = append(calls, bucketBy+":"+id)
+			if id == "user-1" {
+				return anonymousID
+			}
+			return "" // остальные идентификаторы не меняются
+		},
+	})
+
+	// После входа пользователь сохраняет вариант, полученный по anonymous_id.
+	if variantName, reason := client.GetVariant(context.Background(), exp.ID, DecisionContext{UserID: "user-1"}); variantName != anonymousVariant || reason != ReasonAssigned {
+		t.Errorf("GetVariant(mapped) = %q, %q, want %q, %q", variantName, reason, anonymousVariant, ReasonAssigned)
+	}
+	if len(calls) == 0 || calls[0] != ab_types.DefaultBucketBy+":user-1" {
+		t.Errorf("IdentityMapper calls = %v, want user_id:user-1", calls)
+	}
+
+	want, _ := getVariantForUser("user-2", &exp)
+	if variantName, _ := client.GetVariant(context.Background(), exp.ID, DecisionContext{UserID: "user-2"}); variantName != want {
+		t.Errorf("GetVariant(unmapped) = %q, want %q", variantName, want)
+	}
+}
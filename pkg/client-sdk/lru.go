@@ -0,0 +1,95 @@
+package client_sdk
+
+import (
+	"container/list"
+	"sync"
+)
+
+// lruCache - потокобезопасный LRU-кэш фиксированного размера.
+type lruCache[K comparable, V any] struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List // Фронт - самый свежий элемент
+	items    map[K]*list.Element
+}
+
+type lruEntry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+func newLRUCache[K comparable, V any](capacity int) *lruCache[K, V] {
+	return &lruCache[K, V]{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[K]*list.Element),
+	}
+}
+
+// Get возвращает значение и помечает его как недавно использованное.
+func (c *lruCache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.items[key]; ok {
+		c.order.MoveToFront(element)
+		return element.Value.(*lruEntry[K, V]).value, true
+	}
+	var zero V
+	return zero, false
+}
+
+// Add добавляет или обновляет значение, вытесняя самый старый элемент при переполнении.
+func (c *lruCache[K, V]) Add(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.items[key]; ok {
+		element.Value.(*lruEntry[K, V]).value = value
+		c.order.MoveToFront(element)
+		return
+	}
+	c.items[key] = c.order.PushFront(&lruEntry[K, V]{key: key, value: value})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry[K, V]).key)
+	}
+}
+
+// AddIfAbsent добавляет значение, если ключа еще нет. Возвращает значение, оставшееся
+// в кэше, и true, если добавлено value. Проверка и добавление выполняются атомарно.
+func (c *lruCache[K, V]) AddIfAbsent(key K, value V) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.items[key]; ok {
+		c.order.MoveToFront(element)
+		return element.Value.(*lruEntry[K, V]).value, false
+	}
+	c.items[key] = c.order.PushFront(&lruEntry[K, V]{key: key, value: value})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry[K, V]).key)
+	}
+	return value, true
+}
+
+// Remove удаляет значение.
+func (c *lruCache[K, V]) Remove(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.items[key]; ok {
+		c.order.Remove(element)
+		delete(c.items, key)
+	}
+}
+
+// Len возвращает число элементов в кэше.
+func (c *lruCache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
@@ -1,6 +1,8 @@
 package client_sdk
 
 import (
+	"sync"
+
 	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -8,24 +10,86 @@ import (
 
 type sdkMetrics struct {
 	configVersion prometheus.Gauge
+	configSeq     prometheus.Gauge
+	ready         prometheus.Gauge
 	decisions     *prometheus.CounterVec
-	errors        *prometheus.CounterVec
+	exposures     *prometheus.CounterVec
+	flags         *prometheus.CounterVec
+
+	exposuresDropped      *prometheus.CounterVec
+	exposuresDeduplicated prometheus.Counter
+	exposureBatches       prometheus.Counter
+	exposureQueueLength   prometheus.Gauge
+	errors                *prometheus.CounterVec
+	typeMismatches        *prometheus.CounterVec
 }
 
+var (
+	defaultMetrics     *sdkMetrics
+	defaultMetricsOnce sync.Once
+)
+
+// registerMetrics возвращает метрики, зарегистрированные в prometheus.DefaultRegisterer.
+// Метрики общие для всех клиентов процесса: повторная регистрация паникует, а сервису
+// может понадобиться несколько клиентов (например, по одному на проект).
 func registerMetrics() *sdkMetrics {
+	defaultMetricsOnce.Do(func() {
+		defaultMetrics = newMetrics(promauto.With(prometheus.DefaultRegisterer))
+	})
+	return defaultMetrics
+}
+
+// newMetrics создает метрики через factory; promauto.With(nil) создает их без регистрации.
+func newMetrics(factory promauto.Factory) *sdkMetrics {
 	return &sdkMetrics{
-		configVersion: promauto.NewGauge(prometheus.GaugeOpts{
+		configVersion: factory.NewGauge(prometheus.GaugeOpts{
 			Name: "ab_client_config_version_timestamp_ms",
 			Help: "The timestamp (in milliseconds) of the latest config version applied by the client.",
 		}),
-		decisions: promauto.NewCounterVec(prometheus.CounterOpts{
+		configSeq: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "ab_client_config_seq",
+			Help: "The global change sequence number the client configuration is consistent with.",
+		}),
+		ready: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "ab_client_ready",
+			Help: "Whether the client has loaded its first configuration (1) or still serves default variants (0).",
+		}),
+		decisions: factory.NewCounterVec(prometheus.CounterOpts{
 			Name: "ab_client_decisions_total",
 			Help: "Total number of decisions made, partitioned by experiment and variant.",
 		}, []string{"experiment_id", "variant_name"}),
-		errors: promauto.NewCounterVec(prometheus.CounterOpts{
+		exposures: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "ab_client_exposures_total",
+			Help: "Total number of exposure events queued for publishing, partitioned by experiment and variant.",
+		}, []string{"experiment_id", "variant_name"}),
+		flags: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "ab_client_flag_evaluations_total",
+			Help: "Total number of flag evaluations, partitioned by flag and result.",
+		}, []string{"flag", "enabled"}),
+		exposuresDropped: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "ab_client_exposures_dropped_total",
+			Help: "Total number of exposure events lost, partitioned by reason (queue_full, publish_error, closed).",
+		}, []string{"reason"}),
+		exposuresDeduplicated: factory.NewCounter(prometheus.CounterOpts{
+			Name: "ab_client_exposures_deduplicated_total",
+			Help: "Total number of exposure events skipped as duplicates within the dedup window.",
+		}),
+		exposureBatches: factory.NewCounter(prometheus.CounterOpts{
+			Name: "ab_client_exposure_batches_total",
+			Help: "Total number of exposure batches published to Kafka.",
+		}),
+		exposureQueueLength: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "ab_client_exposure_queue_length",
+			Help: "Number of exposure events waiting to be published.",
+		}),
+		errors: factory.NewCounterVec(prometheus.CounterOpts{
 			Name: "ab_client_errors_total",
 			Help: "Total number of errors encountered by the client.",
 		}, []string{"type"}),
+		typeMismatches: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "ab_client_rule_type_mismatches_total",
+			Help: "Total number of targeting rule evaluations where the attribute could not be compared with the rule value.",
+		}, []string{"attribute", "operator"}),
 	}
 }
 
@@ -0,0 +1,78 @@
+package client_sdk
+
+import (
+	"encoding/json"
+	"log"
+)
+
+// GetString возвращает строковый параметр варианта, в который попал пользователь.
+// defaultValue возвращается, если пользователь не участвует в эксперименте,
+// у варианта нет параметра или его тип не совпадает.
+func (c *Client) GetString(experimentID string, user DecisionContext, name string, defaultValue string) string {
+	var value string
+	if !c.getParameter(experimentID, &user, name, &value) {
+		return defaultValue
+	}
+	return value
+}
+
+// GetInt возвращает целочисленный параметр варианта или defaultValue.
+func (c *Client) GetInt(experimentID string, user DecisionContext, name string, defaultValue int64) int64 {
+	var value int64
+	if !c.getParameter(experimentID, &user, name, &value) {
+		return defaultValue
+	}
+	return value
+}
+
+// GetFloat возвращает числовой параметр варианта или defaultValue.
+func (c *Client) GetFloat(experimentID string, user DecisionContext, name string, defaultValue float64) float64 {
+	var value float64
+	if !c.getParameter(experimentID, &user, name, &value) {
+		return defaultValue
+	}
+	return value
+}
+
+// GetBool возвращает логический параметр варианта или defaultValue.
+func (c *Client) GetBool(experimentID string, user DecisionContext, name string, defaultValue bool) bool {
+	var value bool
+	if !c.getParameter(experimentID, &user, name, &value) {
+		return defaultValue
+	}
+	return value
+}
+
+// GetJSON возвращает параметр варианта как JSON (например, объект) или defaultValue.
+func (c *Client) GetJSON(experimentID string, user DecisionContext, name string, defaultValue json.RawMessage) json.RawMessage {
+	var value json.RawMessage
+	if !c.getParameter(experimentID, &user, name, &value) {
+		return defaultValue
+	}
+	return value
+}
+
+// getParameter вычисляет вариант пользователя и разбирает его параметр name в target.
+// Возвращает false, если значение недоступно.
+func (c *Client) getParameter(experimentID string, user *DecisionContext, name string, target any) bool {
+	c.enrichContext(user)
+	resolved := c.resolveVariant(experimentID, user)
+	if resolved.assigned() {
+		c.recordAssignment(user, resolved.experiment, resolved.variantName, resolved.reason)
+	}
+
+	variant := resolved.variant()
+	if variant == nil {
+		return false
+	}
+	raw, ok := variant.Parameters[name]
+	if !ok {
+		return false
+	}
+	if err := json.Unmarshal(raw, target); err != nil {
+		c.metrics.errors.WithLabelValues("parameter_type_mismatch").Inc()
+		log.Printf("WARN: Parameter %q of experiment %s has unexpected type: %v", name, experimentID, err)
+		return false
+	}
+	return true
+}
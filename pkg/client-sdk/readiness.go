@@ -0,0 +1,149 @@
+package client_sdk
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"time"
+)
+
+const (
+	// defaultInitialLoadRetryInterval - пауза между попытками фоновой загрузки по умолчанию.
+	defaultInitialLoadRetryInterval = 5 * time.Second
+	// initialLoadAttemptTimeout ограничивает одну попытку фоновой загрузки.
+	initialLoadAttemptTimeout = 30 * time.Second
+)
+
+// maxStartupJitter - верхняя граница случайной задержки первой загрузки снэпшота,
+// разносящей по времени запросы экземпляров, запущенных одновременно.
+var maxStartupJitter = time.Second
+
+// startupJitter возвращает случайную задержку первой загрузки.
+func startupJitter() time.Duration {
+	if maxStartupJitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(maxStartupJitter)))
+}
+
+// ConfigOrigin - откуда загружена текущая конфигурация клиента.
+type ConfigOrigin string
+
+const (
+	OriginNone           ConfigOrigin = ""
+	OriginSnapshotSource ConfigOrigin = "snapshot_source"
+	OriginLocalCache     ConfigOrigin = "local_cache"
+)
+
+// Status - состояние загрузки конфигурации клиента.
+type Status struct {
+	// Ready - загружена хотя бы одна конфигурация; до этого Decide возвращает DefaultVariants.
+	Ready bool `json:"ready"`
+	// Origin - источник первой загруженной конфигурации.
+	Origin        ConfigOrigin `json:"origin"`
+	ConfigVersion string       `json:"config_version"`
+	Seq           int64        `json:"seq"`
+	// Attempts - число попыток начальной загрузки.
+	Attempts      int       `json:"attempts"`
+	LastError     string    `json:"last_error,omitempty"`
+	LastAttemptAt time.Time `json:"last_attempt_at"`
+	ReadyAt       time.Time `json:"ready_at"`
+}
+
+// Ready сообщает, загружена ли конфигурация.
+func (c *Client) Ready() bool {
+	return c.ready.Load()
+}
+
+// WaitReady блокируется до загрузки конфигурации или отмены ctx.
+func (c *Client) WaitReady(ctx context.Context) error {
+	select {
+	case <-c.readyCh:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Status возвращает текущее состояние загрузки конфигурации.
+func (c *Client) Status() Status {
+	c.statusMu.Lock()
+	status := c.status
+	c.statusMu.Unlock()
+
+	status.Ready = c.Ready()
+	c.cache.rwMutex.RLock()
+	status.ConfigVersion = c.cache.configVersion
+	status.Seq = c.cache.seq
+	c.cache.rwMutex.RUnlock()
+	return status
+}
+
+// recordLoadAttempt фиксирует результат попытки начальной загрузки.
+func (c *Client) recordLoadAttempt(err error) {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+
+	c.status.Attempts++
+	c.status.LastAttemptAt = time.Now()
+	c.status.LastError = ""
+	if err != nil {
+		c.status.LastError = err.Error()
+	}
+}
+
+// markReady переводит клиент в состояние готовности. Повторные вызовы игнорируются.
+func (c *Client) markReady(origin ConfigOrigin) {
+	c.readyOnce.Do(func() {
+		c.statusMu.Lock()
+		c.status.Origin = origin
+		c.status.ReadyAt = time.Now()
+		c.statusMu.Unlock()
+
+		c.ready.Store(true)
+		c.metrics.ready.Set(1)
+		close(c.readyCh)
+	})
+}
+
+// runInitialLoad загружает конфигурацию в фоне (режим NonBlockingStartup),
+// повторяя попытки до успеха или остановки клиента.
+func (c *Client) runInitialLoad(ctx context.Context) {
+	if !sleepContext(ctx, startupJitter()) {
+		return
+	}
+
+	retryInterval := c.config.InitialLoadRetryInterval
+	if retryInterval <= 0 {
+		retryInterval = defaultInitialLoadRetryInterval
+	}
+
+	for {
+		attemptCtx, cancel := context.WithTimeout(ctx, initialLoadAttemptTimeout)
+		err := c.loadInitialSnapshot(attemptCtx)
+		cancel()
+		if err == nil {
+			log.Printf("INFO: A/B client loaded configuration in background with config version %s", c.Status().ConfigVersion)
+			c.startDeltaConsumer(ctx)
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("WARN: Background configuration load failed: %v. Serving default variants, retrying in %v.", err, retryInterval)
+
+		if !sleepContext(ctx, retryInterval) {
+			return
+		}
+	}
+}
+
+// sleepContext ждет d и возвращает false, если ctx отменен раньше.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
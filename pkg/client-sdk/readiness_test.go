@@ -0,0 +1,80 @@
+package client_sdk
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// gatedSnapshotSource отдает снэпшоты MemorySource только после вызова open.
+type gatedSnapshotSource struct {
+	*MemorySource
+	opened atomic.Bool
+}
+
+func (s *gatedSnapshotSource) open() {
+	s.opened.Store(true)
+}
+
+func (s *gatedSnapshotSource) FetchSnapshot(ctx context.Context) (*SnapshotPayload, error) {
+	if !s.opened.Load() {
+		return nil, errors.New("snapshot storage unavailable")
+	}
+	return s.MemorySource.FetchSnapshot(ctx)
+}
+
+func newNotReadyClient(t *testing.T) (*Client, *gatedSnapshotSource) {
+	t.Helper()
+	source := &gatedSnapshotSource{MemorySource: NewMemorySource(testExperiment("a"))}
+	client := newTestClient(t, source, Config{
+		NonBlockingStartup:       true,
+		DefaultVariants:          map[string]string{"a": "control"},
+		InitialLoadRetryInterval: 5 * time.Millisecond,
+	})
+	return client, source
+}
+
+func TestGetVariantBeforeFirstSnapshot(t *testing.T) {
+	client, _ := newNotReadyClient(t)
+
+	variantName, reason := client.GetVariant(context.Background(), "a", DecisionContext{UserID: "user-1"})
+	if variantName != "control" || reason != ReasonNotReady {
+		t.Errorf("GetVariant() = %q, %q, want control, %q", variantName, reason, ReasonNotReady)
+	}
+	if variantName, reason := client.GetVariant(context.Background(), "unknown", DecisionContext{UserID: "user-1"}); variantName != "" || reason != ReasonNotReady {
+		t.Errorf("GetVariant(unknown) = %q, %q, want no variant, %q", variantName, reason, ReasonNotReady)
+	}
+	if got := client.Decide("user-1", nil); got["a"] != "control" {
+		t.Errorf("Decide() = %v, want default variant control", got)
+	}
+	if status := client.Status(); status.Ready || status.Origin != OriginNone {
+		t.Errorf("Status() = %+v, want not ready", status)
+	}
+}
+
+func TestClientBecomesReadyAfterSnapshot(t *testing.T) {
+	client, source := newNotReadyClient(t)
+
+	// Неудачные попытки фиксируются в Status, клиент продолжает отдавать варианты по умолчанию.
+	waitFor(t, "a retried load", func() bool { return client.Status().Attempts >= 2 })
+	if status := client.Status(); status.Ready || status.LastError == "" {
+		t.Errorf("Status() = %+v, want not ready with the last error", status)
+	}
+
+	source.open()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := client.WaitReady(ctx); err != nil {
+		t.Fatalf("WaitReady() error = %v", err)
+	}
+
+	status := client.Status()
+	if !status.Ready || status.Origin != OriginSnapshotSource || status.LastError != "" || status.ReadyAt.IsZero() {
+		t.Errorf("Status() = %+v, want ready from the snapshot source", status)
+	}
+	if variantName, reason := client.GetVariant(context.Background(), "a", DecisionContext{UserID: "user-1"}); variantName != "treatment" || reason != ReasonAssigned {
+		t.Errorf("GetVariant() = %q, %q, want treatment, %q", variantName, reason, ReasonAssigned)
+	}
+}
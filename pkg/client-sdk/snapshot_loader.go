@@ -0,0 +1,259 @@
+package client_sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+// loadInitialSnapshot реализует отказоустойчивую логику загрузки: SnapshotSource -> Local Cache
+// Снэпшот из любого источника проверяется по манифесту до заполнения кэша.
+func (c *Client) loadInitialSnapshot(ctx context.Context) error {
+	// Попытка №1: Загрузить из источника снэпшотов
+	origin := OriginSnapshotSource
+	snapshot, payload, err := c.fetchSnapshot(ctx)
+	if err == nil {
+		log.Println("INFO: Successfully fetched latest snapshot from snapshot source.")
+		// Сохраняем свежий снэпшот локально для будущего отката
+		c.saveToLocalCache(payload)
+	} else {
+		c.metrics.errors.WithLabelValues("snapshot_fetch_error").Inc()
+		log.Printf("WARN: Failed to fetch snapshot from snapshot source: %v. Falling back to local cache.", err)
+		// Попытка №2: Загрузить с локального диска
+		origin = OriginLocalCache
+		snapshot, err = c.loadFromLocalCache()
+		if err != nil {
+			err = fmt.Errorf("snapshot source and local cache failed: %w", err)
+			c.recordLoadAttempt(err)
+			return err
+		}
+		log.Printf("INFO: Successfully loaded configuration from local cache file: %s", c.config.LocalCachePath)
+	}
+
+	// Если мы здесь, у нас есть проверенные данные. Заполняем кэш.
+	c.populateCache(snapshot)
+	c.recordLoadAttempt(nil)
+	c.markReady(origin)
+	return nil
+}
+
+// fetchSnapshot загружает снэпшот из источника и разбирает его.
+func (c *Client) fetchSnapshot(ctx context.Context) (*ab_types.Snapshot, *SnapshotPayload, error) {
+	payload, err := c.snapshotSource.FetchSnapshot(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	snapshot, err := c.decodeSnapshot(payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	return snapshot, payload, nil
+}
+
+// decodeSnapshot проверяет снэпшот по манифесту и разбирает его.
+// Проверяются размер, SHA-256, количество экспериментов и, если настроен SnapshotPublicKey,
+// подпись Ed25519. Без публичного ключа снэпшоты без манифеста допускаются для обратной совместимости.
+// Уже разобранный снэпшот (payload.Snapshot) принимается без проверок.
+func (c *Client) decodeSnapshot(payload *SnapshotPayload) (*ab_types.Snapshot, error) {
+	if payload.Snapshot != nil {
+		return payload.Snapshot, nil
+	}
+	manifest := payload.Manifest
+	if manifest == nil && c.config.SnapshotPublicKey != nil {
+		return nil, errors.New("snapshot manifest is required but missing")
+	}
+	if manifest != nil {
+		if err := manifest.Verify(payload.Data, c.config.SnapshotPublicKey); err != nil {
+			c.metrics.errors.WithLabelValues("snapshot_verification_error").Inc()
+			return nil, err
+		}
+	}
+
+	snapshot, err := ab_types.DecodeSnapshot(payload.Data, payload.format())
+	if err != nil {
+		return nil, err
+	}
+
+	if manifest != nil {
+		if len(snapshot.Experiments) != manifest.ExperimentCount || snapshot.Seq != manifest.Seq {
+			c.metrics.errors.WithLabelValues("snapshot_verification_error").Inc()
+			return nil, fmt.Errorf("snapshot does not match manifest: experiments %d/%d, seq %d/%d",
+				len(snapshot.Experiments), manifest.ExperimentCount, snapshot.Seq, manifest.Seq)
+		}
+	}
+	return snapshot, nil
+}
+
+// localManifestPath - путь к копии манифеста рядом с локальным кэшем снэпшота.
+func (c *Client) localManifestPath() string {
+	return c.config.LocalCachePath + ".manifest"
+}
+
+// saveToLocalCache сохраняет снэпшот и его манифест на диск.
+// Данные сохраняются в исходном формате; формат восстанавливается по манифесту или содержимому.
+// Оба файла заменяются атомарно, манифест - первым: при сбое между заменами новый манифест
+// не совпадет со старыми данными, и loadFromLocalCache отклонит кэш, а не примет его непроверенным.
+func (c *Client) saveToLocalCache(payload *SnapshotPayload) {
+	if c.config.LocalCachePath == "" || payload.Data == nil {
+		return
+	}
+	c.localCacheMu.Lock()
+	defer c.localCacheMu.Unlock()
+
+	if payload.Manifest == nil {
+		// Удаляем манифест предыдущего снэпшота, иначе он не совпадет с новыми данными.
+		if err := os.Remove(c.localManifestPath()); err != nil && !os.IsNotExist(err) {
+			log.Printf("WARN: Failed to remove stale snapshot manifest from local cache: %v", err)
+			return
+		}
+	} else {
+		manifestData, err := json.Marshal(payload.Manifest)
+		if err == nil {
+			err = writeFileAtomic(c.localManifestPath(), manifestData)
+		}
+		if err != nil {
+			log.Printf("WARN: Failed to save snapshot manifest to local cache: %v", err)
+			return
+		}
+	}
+	if err := writeFileAtomic(c.config.LocalCachePath, payload.Data); err != nil {
+		log.Printf("WARN: Failed to save snapshot to local cache: %v", err)
+	}
+}
+
+// writeFileAtomic записывает data во временный файл рядом с path и переименовывает его в path,
+// чтобы читатель никогда не увидел частично записанный файл.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // после успешного переименования файла уже нет
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to chmod temporary file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadFromLocalCache загружает снэпшот с диска, проверяет его TTL и манифест.
+func (c *Client) loadFromLocalCache() (*ab_types.Snapshot, error) {
+	if c.config.LocalCachePath == "" {
+		return nil, errors.New("local cache is not configured")
+	}
+	info, err := os.Stat(c.config.LocalCachePath)
+	if os.IsNotExist(err) {
+		return nil, errors.New("local cache file does not exist")
+	}
+	if time.Since(info.ModTime()) > c.config.LocalCacheTTL {
+		return nil, fmt.Errorf("local cache is stale (older than %v)", c.config.LocalCacheTTL)
+	}
+	data, err := os.ReadFile(c.config.LocalCachePath)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := &SnapshotPayload{Data: data}
+	if manifestData, err := os.ReadFile(c.localManifestPath()); err == nil {
+		payload.Manifest = &ab_types.SnapshotManifest{}
+		if err := json.Unmarshal(manifestData, payload.Manifest); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal local snapshot manifest: %w", err)
+		}
+	}
+
+	snapshot, err := c.decodeSnapshot(payload)
+	if err != nil {
+		return nil, fmt.Errorf("local cache failed verification: %w", err)
+	}
+	return snapshot, nil
+}
+
+// populateCache заполняет in-memory кэш экспериментами, флагами, сегментами и списками
+// идентификаторов из снэпшота. Снэпшот, более старый, чем уже загруженная конфигурация, игнорируется.
+func (c *Client) populateCache(snapshot *ab_types.Snapshot) {
+	// Содержимое списков загружается до блокировки, чтобы не задерживать Decide.
+	idLists := c.loadIDLists(snapshot.IDLists)
+
+	c.cache.rwMutex.Lock()
+	defer c.cache.rwMutex.Unlock()
+
+	if snapshot.Seq > 0 && snapshot.Seq < c.cache.seq {
+		log.Printf("WARN: Ignoring snapshot at seq %d: cache is already at seq %d.", snapshot.Seq, c.cache.seq)
+		return
+	}
+
+	// Очищаем старый кэш
+	c.cache.experiments = make(map[string][]ab_types.Experiment)
+	c.cache.flags = make(map[string]ab_types.Flag, len(snapshot.Flags))
+	c.cache.segments = make(map[string]ab_types.Segment, len(snapshot.Segments))
+	c.cache.idLists = idLists
+	c.cache.regexps = make(ab_types.RuleRegexps)
+	c.cache.cidrs = make(ab_types.RuleCIDRs)
+	c.cache.overrides = make(map[string]ab_types.OverrideSet, len(snapshot.Experiments))
+	c.cache.configVersion = ""
+	c.cache.seq = snapshot.Seq
+
+	useScoping := len(c.config.RelevantLayerIDs) > 0
+	relevantLayers := make(map[string]bool)
+	for _, id := range c.config.RelevantLayerIDs {
+		relevantLayers[id] = true
+	}
+
+	loadedCount := 0
+	for _, exp := range snapshot.Experiments {
+		// Применяем скоупинг, если он настроен
+		if useScoping && !relevantLayers[exp.LayerID] {
+			continue
+		}
+		// Источник может отдать снэпшот с несколькими окружениями или проектами (например, собранный вручную).
+		if exp.EnvironmentOrDefault() != c.environment() || exp.ProjectOrDefault() != c.project() {
+			continue
+		}
+
+		c.cache.experiments[exp.LayerID] = append(c.cache.experiments[exp.LayerID], exp)
+		c.compileRulePatterns(exp.TargetingRules)
+		c.cache.overrides[exp.ID] = ab_types.NewOverrideSet(&exp.OverrideLists)
+		if exp.ConfigVersion > c.cache.configVersion {
+			c.cache.configVersion = exp.ConfigVersion
+		}
+		loadedCount++
+	}
+
+	for _, flag := range snapshot.Flags {
+		if flag.ProjectOrDefault() != c.project() {
+			continue
+		}
+		c.cache.flags[flag.Key] = flag
+		c.compileRulePatterns(flag.TargetingRules())
+	}
+
+	for _, segment := range snapshot.Segments {
+		if segment.ProjectOrDefault() != c.project() {
+			continue
+		}
+		c.cache.segments[segment.Key] = segment
+		c.compileRulePatterns(segment.Rules)
+	}
+
+	log.Printf("INFO: Populated cache with %d experiments across %d layers, %d flags and %d id lists at seq %d.", loadedCount, len(c.cache.experiments), len(c.cache.flags), len(c.cache.idLists), c.cache.seq)
+	c.metrics.setVersionMetric(c.cache.configVersion)
+	c.metrics.configSeq.Set(float64(c.cache.seq))
+}
@@ -0,0 +1,114 @@
+package client_sdk
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+// newLocalCacheClient создает клиент, работающий только с локальным кэшем в каталоге dir.
+func newLocalCacheClient(dir string) *Client {
+	return &Client{
+		config:  Config{LocalCachePath: filepath.Join(dir, "snapshot.json"), LocalCacheTTL: time.Hour},
+		metrics: newMetrics(promauto.With(nil)),
+	}
+}
+
+// payloadWithManifest кодирует снэпшот с указанными экспериментами и строит его неподписанный манифест.
+func payloadWithManifest(t *testing.T, version string, seq int64, ids ...string) *SnapshotPayload {
+	t.Helper()
+	snapshot := &ab_types.Snapshot{SchemaVersion: ab_types.SnapshotSchemaVersion, Version: version, Seq: seq}
+	for _, id := range ids {
+		snapshot.Experiments = append(snapshot.Experiments, testExperiment(id))
+	}
+	data, err := ab_types.EncodeSnapshot(snapshot, ab_types.DefaultSnapshotFormat)
+	if err != nil {
+		t.Fatalf("EncodeSnapshot() error = %v", err)
+	}
+	path := ab_types.SnapshotObjectPrefix + version + ".json"
+	return &SnapshotPayload{Data: data, Manifest: ab_types.NewSnapshotManifest(snapshot, path, "", data)}
+}
+
+func TestLocalCache(t *testing.T) {
+	tests := []struct {
+		name string
+		// prepare записывает кэш в каталог клиента.
+		prepare  func(t *testing.T, c *Client)
+		wantIDs  []string
+		wantLoad bool
+	}{
+		{
+			name: "round trip",
+			prepare: func(t *testing.T, c *Client) {
+				c.saveToLocalCache(payloadWithManifest(t, "v1", 1, "a"))
+				c.saveToLocalCache(payloadWithManifest(t, "v2", 2, "a", "b"))
+			},
+			wantIDs:  []string{"a", "b"},
+			wantLoad: true,
+		},
+		{
+			name: "snapshot without manifest replaces the old manifest",
+			prepare: func(t *testing.T, c *Client) {
+				c.saveToLocalCache(payloadWithManifest(t, "v1", 1, "a"))
+				payload := payloadWithManifest(t, "v2", 2, "a", "b")
+				payload.Manifest = nil
+				c.saveToLocalCache(payload)
+			},
+			wantIDs:  []string{"a", "b"},
+			wantLoad: true,
+		},
+		{
+			// Сбой между заменой манифеста и данных: новый манифест не совпадает со старыми
+			// данными, и кэш отклоняется.
+			name: "interrupted save",
+			prepare: func(t *testing.T, c *Client) {
+				c.saveToLocalCache(payloadWithManifest(t, "v1", 1, "a"))
+				manifestData, err := json.Marshal(payloadWithManifest(t, "v2", 2, "a", "b").Manifest)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := writeFileAtomic(c.localManifestPath(), manifestData); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			client := newLocalCacheClient(dir)
+			tt.prepare(t, client)
+
+			snapshot, err := client.loadFromLocalCache()
+			if (err == nil) != tt.wantLoad {
+				t.Fatalf("loadFromLocalCache() error = %v, want load %v", err, tt.wantLoad)
+			}
+			if err == nil {
+				var ids []string
+				for _, exp := range snapshot.Experiments {
+					ids = append(ids, exp.ID)
+				}
+				if !slices.Equal(ids, tt.wantIDs) {
+					t.Errorf("experiments = %v, want %v", ids, tt.wantIDs)
+				}
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, entry := range entries {
+				if name := entry.Name(); name != "snapshot.json" && name != "snapshot.json.manifest" {
+					t.Errorf("unexpected file %s left in the cache directory", name)
+				}
+			}
+		})
+	}
+}
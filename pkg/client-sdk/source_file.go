@@ -0,0 +1,42 @@
+package client_sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+// FileSnapshotSource читает снэпшот из локального файла.
+// Манифест, если он есть, ищется рядом: <path>.manifest.
+type FileSnapshotSource struct {
+	path string
+}
+
+// NewFileSnapshotSource создает источник снэпшотов из файла.
+func NewFileSnapshotSource(path string) *FileSnapshotSource {
+	return &FileSnapshotSource{path: path}
+}
+
+func (s *FileSnapshotSource) FetchSnapshot(_ context.Context) (*SnapshotPayload, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot file: %w", err)
+	}
+	payload := &SnapshotPayload{Data: data}
+
+	manifestData, err := os.ReadFile(s.path + ".manifest")
+	switch {
+	case err == nil:
+		payload.Manifest = &ab_types.SnapshotManifest{}
+		if err := json.Unmarshal(manifestData, payload.Manifest); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal snapshot manifest: %w", err)
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, fmt.Errorf("failed to read snapshot manifest: %w", err)
+	}
+	return payload, nil
+}
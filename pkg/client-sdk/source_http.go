@@ -0,0 +1,93 @@
+package client_sdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+// SnapshotManifestHeader - заголовок ответа, в котором HTTP-источник передает манифест снэпшота (JSON).
+const SnapshotManifestHeader = ab_types.SnapshotManifestHeader
+
+// HTTPSnapshotSource загружает снэпшот по HTTP, например, с эндпоинта GET /snapshot central-api.
+// Последний ответ кэшируется: повторные запросы отправляются с If-None-Match,
+// и при 304 Not Modified возвращается тот же SnapshotPayload.
+type HTTPSnapshotSource struct {
+	url        string
+	httpClient *http.Client
+	// apiKey - API-ключ проекта (заголовок X-API-Key); пусто - проект по умолчанию.
+	apiKey string
+
+	mu   sync.Mutex
+	etag string
+	last *SnapshotPayload
+}
+
+// NewHTTPSnapshotSource создает HTTP-источник снэпшотов. Если httpClient равен nil,
+// используется http.DefaultClient.
+func NewHTTPSnapshotSource(url string, httpClient *http.Client) *HTTPSnapshotSource {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &HTTPSnapshotSource{url: url, httpClient: httpClient}
+}
+
+// WithAPIKey задает API-ключ проекта: central-api отдает снэпшот проекта, которому принадлежит ключ.
+func (s *HTTPSnapshotSource) WithAPIKey(apiKey string) *HTTPSnapshotSource {
+	s.apiKey = apiKey
+	return s
+}
+
+func (s *HTTPSnapshotSource) FetchSnapshot(ctx context.Context) (*SnapshotPayload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.apiKey != "" {
+		req.Header.Set(ab_types.APIKeyHeader, s.apiKey)
+	}
+	if s.etag != "" && s.last != nil {
+		req.Header.Set("If-None-Match", s.etag)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request snapshot: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		if s.last != nil {
+			return s.last, nil
+		}
+		return nil, fmt.Errorf("unexpected %s without cached snapshot", resp.Status)
+	case http.StatusOK:
+	default:
+		return nil, fmt.Errorf("unexpected snapshot response status: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot response: %w", err)
+	}
+	payload := &SnapshotPayload{Data: data, ContentType: resp.Header.Get("Content-Type")}
+	if manifestHeader := resp.Header.Get(SnapshotManifestHeader); manifestHeader != "" {
+		payload.Manifest = &ab_types.SnapshotManifest{}
+		if err := json.Unmarshal([]byte(manifestHeader), payload.Manifest); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal snapshot manifest: %w", err)
+		}
+	}
+
+	s.etag = resp.Header.Get("ETag")
+	s.last = payload
+	return payload, nil
+}
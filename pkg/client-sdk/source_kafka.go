@@ -0,0 +1,148 @@
+package client_sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+	"github.com/segmentio/kafka-go"
+)
+
+// DefaultDeltasTopic - топик, в который outbox-worker публикует дельты проекта по умолчанию.
+// Топики остальных проектов возвращает ab_types.ProjectDeltasTopic.
+const DefaultDeltasTopic = ab_types.DeltasTopic
+
+// KafkaDeltaSource читает дельты, опубликованные outbox-worker, из Kafka.
+type KafkaDeltaSource struct {
+	reader *kafka.Reader
+}
+
+// NewKafkaDeltaSource создает источник дельт из Kafka.
+func NewKafkaDeltaSource(brokers []string, groupID, topic string) *KafkaDeltaSource {
+	return &KafkaDeltaSource{
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers:  brokers,
+			GroupID:  groupID,
+			Topic:    topic,
+			MinBytes: 10e3, // 10KB
+			MaxBytes: 10e6, // 10MB
+		}),
+	}
+}
+
+// Run - основной цикл чтения дельт.
+func (s *KafkaDeltaSource) Run(ctx context.Context, sink DeltaSink) error {
+	for {
+		select {
+		case <-ctx.Done(): // Если контекст отменен, завершаем работу
+			log.Println("INFO: Delta consumer shutting down.")
+			return nil
+		default:
+			msg, err := s.reader.ReadMessage(ctx)
+			if err != nil {
+				// Контекст был отменен во время чтения
+				if errors.Is(err, context.Canceled) {
+					return nil
+				}
+				sink.Error(fmt.Errorf("failed to read delta message from Kafka: %w", err))
+				continue
+			}
+
+			delta, err := parseDeltaMessage(msg)
+			if err != nil {
+				sink.Error(fmt.Errorf("failed to unmarshal delta payload: %w", err))
+				continue // Пропускаем битое сообщение
+			}
+
+			sink.Apply(delta)
+		}
+	}
+}
+
+func (s *KafkaDeltaSource) Close() error {
+	return s.reader.Close()
+}
+
+// parseDeltaMessage разбирает сообщение outbox-worker.
+// Сообщения без заголовков (старые издатели) считаются UPSERT без номера изменения.
+func parseDeltaMessage(msg kafka.Message) (*Delta, error) {
+	d := &Delta{Type: ab_types.EventUpsert}
+	for _, header := range msg.Headers {
+		switch header.Key {
+		case ab_types.DeltaHeaderSeq:
+			seq, err := strconv.ParseInt(string(header.Value), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s header: %w", ab_types.DeltaHeaderSeq, err)
+			}
+			d.Seq = seq
+		case ab_types.DeltaHeaderEventType:
+			d.Type = string(header.Value)
+		case ab_types.DeltaHeaderEnvironment:
+			d.Environment = string(header.Value)
+		}
+	}
+
+	switch d.Type {
+	case ab_types.EventFlagDelete:
+		var payload ab_types.FlagDeletePayload
+		if err := json.Unmarshal(msg.Value, &payload); err != nil {
+			return nil, err
+		}
+		d.FlagKey = payload.Key
+	case ab_types.EventFlagUpsert:
+		var flag ab_types.Flag
+		if err := json.Unmarshal(msg.Value, &flag); err != nil {
+			return nil, err
+		}
+		d.FlagKey = flag.Key
+		d.Flag = &flag
+	case ab_types.EventSegmentDelete:
+		var payload ab_types.SegmentDeletePayload
+		if err := json.Unmarshal(msg.Value, &payload); err != nil {
+			return nil, err
+		}
+		d.SegmentKey = payload.Key
+	case ab_types.EventSegmentUpsert:
+		var segment ab_types.Segment
+		if err := json.Unmarshal(msg.Value, &segment); err != nil {
+			return nil, err
+		}
+		d.SegmentKey = segment.Key
+		d.Segment = &segment
+	case ab_types.EventIDListDelete:
+		var payload ab_types.IDListDeletePayload
+		if err := json.Unmarshal(msg.Value, &payload); err != nil {
+			return nil, err
+		}
+		d.IDListID = payload.ID
+	case ab_types.EventIDListUpsert:
+		var list ab_types.IDList
+		if err := json.Unmarshal(msg.Value, &list); err != nil {
+			return nil, err
+		}
+		d.IDListID = list.ID
+		d.IDList = &list
+	case ab_types.EventDelete:
+		var payload ab_types.DeletePayload
+		if err := json.Unmarshal(msg.Value, &payload); err != nil {
+			return nil, err
+		}
+		d.ExperimentID = payload.ID
+	default:
+		var exp ab_types.Experiment
+		if err := json.Unmarshal(msg.Value, &exp); err != nil {
+			return nil, err
+		}
+		d.ExperimentID = exp.ID
+		d.Experiment = &exp
+		// Издатели без заголовка окружения: окружение берется из самого эксперимента.
+		if d.Environment == "" {
+			d.Environment = exp.EnvironmentOrDefault()
+		}
+	}
+	return d, nil
+}
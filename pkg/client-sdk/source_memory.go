@@ -0,0 +1,195 @@
+package client_sdk
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+// MemorySource - источник снэпшотов и дельт в памяти, предназначенный для тестов.
+// Каждое изменение получает следующий номер seq и сразу передается запущенным клиентам.
+type MemorySource struct {
+	mu          sync.Mutex
+	seq         int64
+	experiments []ab_types.Experiment
+	flags       []ab_types.Flag
+	segments    []ab_types.Segment
+	idLists     []ab_types.IDList
+	sinks       []DeltaSink
+
+	// contentMu защищает содержимое списков отдельно от mu: клиент читает его
+	// из FetchIDList, пока publish удерживает mu.
+	contentMu sync.RWMutex
+	contents  map[string][]byte
+}
+
+// NewMemorySource создает источник с начальным набором экспериментов.
+func NewMemorySource(experiments ...ab_types.Experiment) *MemorySource {
+	return &MemorySource{experiments: slices.Clone(experiments)}
+}
+
+// FetchSnapshot возвращает текущее состояние источника.
+func (s *MemorySource) FetchSnapshot(_ context.Context) (*SnapshotPayload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return &SnapshotPayload{Snapshot: &ab_types.Snapshot{
+		SchemaVersion: ab_types.SnapshotSchemaVersion,
+		Seq:           s.seq,
+		CreatedAt:     time.Now().UTC().Format(time.RFC3339),
+		Experiments:   slices.Clone(s.experiments),
+		Flags:         slices.Clone(s.flags),
+		Segments:      slices.Clone(s.segments),
+		IDLists:       slices.Clone(s.idLists),
+	}}, nil
+}
+
+// Upsert добавляет или заменяет эксперимент.
+func (s *MemorySource) Upsert(exp ab_types.Experiment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i := slices.IndexFunc(s.experiments, func(e ab_types.Experiment) bool { return e.ID == exp.ID }); i >= 0 {
+		s.experiments[i] = exp
+	} else {
+		s.experiments = append(s.experiments, exp)
+	}
+	s.seq++
+	s.publish(&Delta{Type: ab_types.EventUpsert, Seq: s.seq, ExperimentID: exp.ID, Experiment: &exp, Environment: exp.EnvironmentOrDefault()})
+}
+
+// Delete удаляет эксперимент.
+func (s *MemorySource) Delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.experiments = slices.DeleteFunc(s.experiments, func(e ab_types.Experiment) bool { return e.ID == id })
+	s.seq++
+	s.publish(&Delta{Type: ab_types.EventDelete, Seq: s.seq, ExperimentID: id})
+}
+
+// UpsertFlag добавляет или заменяет флаг.
+func (s *MemorySource) UpsertFlag(flag ab_types.Flag) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i := slices.IndexFunc(s.flags, func(f ab_types.Flag) bool { return f.Key == flag.Key }); i >= 0 {
+		s.flags[i] = flag
+	} else {
+		s.flags = append(s.flags, flag)
+	}
+	s.seq++
+	s.publish(&Delta{Type: ab_types.EventFlagUpsert, Seq: s.seq, FlagKey: flag.Key, Flag: &flag})
+}
+
+// DeleteFlag удаляет флаг.
+func (s *MemorySource) DeleteFlag(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.flags = slices.DeleteFunc(s.flags, func(f ab_types.Flag) bool { return f.Key == key })
+	s.seq++
+	s.publish(&Delta{Type: ab_types.EventFlagDelete, Seq: s.seq, FlagKey: key})
+}
+
+// UpsertSegment добавляет или заменяет сегмент.
+func (s *MemorySource) UpsertSegment(segment ab_types.Segment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i := slices.IndexFunc(s.segments, func(other ab_types.Segment) bool { return other.Key == segment.Key }); i >= 0 {
+		s.segments[i] = segment
+	} else {
+		s.segments = append(s.segments, segment)
+	}
+	s.seq++
+	s.publish(&Delta{Type: ab_types.EventSegmentUpsert, Seq: s.seq, SegmentKey: segment.Key, Segment: &segment})
+}
+
+// DeleteSegment удаляет сегмент.
+func (s *MemorySource) DeleteSegment(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.segments = slices.DeleteFunc(s.segments, func(other ab_types.Segment) bool { return other.Key == key })
+	s.seq++
+	s.publish(&Delta{Type: ab_types.EventSegmentDelete, Seq: s.seq, SegmentKey: key})
+}
+
+// PutIDList добавляет список идентификаторов или заменяет его содержимое на ids.
+// Размер, контрольная сумма и объект содержимого вычисляются источником.
+func (s *MemorySource) PutIDList(list ab_types.IDList, ids []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	data := ab_types.EncodeIDs(ids)
+	list.Size = len(ab_types.ParseIDs(data))
+	list.Checksum = ab_types.IDListChecksum(data)
+	list.ObjectKey = ab_types.IDListObjectKey(list.ProjectID, list.ID, strconv.FormatInt(s.seq, 10))
+	s.contentMu.Lock()
+	if s.contents == nil {
+		s.contents = make(map[string][]byte)
+	}
+	s.contents[list.ObjectKey] = data
+	s.contentMu.Unlock()
+
+	if i := slices.IndexFunc(s.idLists, func(other ab_types.IDList) bool { return other.ID == list.ID }); i >= 0 {
+		s.idLists[i] = list
+	} else {
+		s.idLists = append(s.idLists, list)
+	}
+	s.publish(&Delta{Type: ab_types.EventIDListUpsert, Seq: s.seq, IDListID: list.ID, IDList: &list})
+}
+
+// DeleteIDList удаляет список идентификаторов.
+func (s *MemorySource) DeleteIDList(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.idLists = slices.DeleteFunc(s.idLists, func(other ab_types.IDList) bool { return other.ID == id })
+	s.seq++
+	s.publish(&Delta{Type: ab_types.EventIDListDelete, Seq: s.seq, IDListID: id})
+}
+
+// FetchIDList возвращает содержимое списка, сохраненное PutIDList.
+func (s *MemorySource) FetchIDList(_ context.Context, list *ab_types.IDList) ([]byte, error) {
+	s.contentMu.RLock()
+	defer s.contentMu.RUnlock()
+
+	data, ok := s.contents[list.ObjectKey]
+	if !ok {
+		return nil, fmt.Errorf("id list object %s not found", list.ObjectKey)
+	}
+	return data, nil
+}
+
+// publish синхронно передает дельту всем подписчикам. Вызывается под блокировкой.
+func (s *MemorySource) publish(delta *Delta) {
+	for _, sink := range s.sinks {
+		sink.Apply(delta)
+	}
+}
+
+// Run подписывает sink на изменения до отмены ctx.
+func (s *MemorySource) Run(ctx context.Context, sink DeltaSink) error {
+	s.mu.Lock()
+	s.sinks = append(s.sinks, sink)
+	s.mu.Unlock()
+
+	<-ctx.Done()
+
+	s.mu.Lock()
+	s.sinks = slices.DeleteFunc(s.sinks, func(other DeltaSink) bool { return other == sink })
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemorySource) Close() error {
+	return nil
+}
@@ -0,0 +1,156 @@
+package client_sdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// MinIOSnapshotSource загружает снэпшоты, созданные snapshot-generator, из бакета MinIO.
+type MinIOSnapshotSource struct {
+	client *minio.Client
+	bucket string
+	// prefix - префикс объектов окружения в бакете (см. ab_types.SnapshotPrefix).
+	prefix string
+}
+
+// NewMinIOSnapshotSource создает источник снэпшотов из MinIO.
+func NewMinIOSnapshotSource(endpoint, accessKey, secretKey string, useSSL bool, bucket string) (*MinIOSnapshotSource, error) {
+	minioClient, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: useSSL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MinIO client: %w", err)
+	}
+	return &MinIOSnapshotSource{client: minioClient, bucket: bucket}, nil
+}
+
+// WithPrefix задает префикс, под которым snapshot-generator хранит снэпшоты проекта и окружения.
+func (s *MinIOSnapshotSource) WithPrefix(prefix string) *MinIOSnapshotSource {
+	s.prefix = prefix
+	return s
+}
+
+// FetchSnapshot находит и загружает самый последний снэпшот и его манифест.
+// Сначала читается указатель latest.json (один GET); листинг бакета используется
+// только если указатель отсутствует или поврежден.
+func (s *MinIOSnapshotSource) FetchSnapshot(ctx context.Context) (*SnapshotPayload, error) {
+	meta, err := s.resolveLatestSnapshotPointer(ctx)
+	if err != nil {
+		log.Printf("WARN: Could not resolve %s: %v. Falling back to bucket listing.", s.prefix+ab_types.LatestSnapshotPointer, err)
+		name, err := s.findLatestSnapshotByListing(ctx)
+		if err != nil {
+			return nil, err
+		}
+		meta = &ab_types.SnapshotMeta{Path: name, ManifestPath: ab_types.ManifestPathFor(name)}
+	}
+	log.Printf("INFO: Found latest snapshot: %s", meta.Path)
+
+	data, contentType, err := s.getObject(ctx, meta.Path)
+	if err != nil {
+		return nil, err
+	}
+	if contentType == "" {
+		contentType = meta.ContentType
+	}
+	payload := &SnapshotPayload{Data: data, ContentType: contentType}
+
+	// Обязательность манифеста проверяет клиент: она зависит от SnapshotPublicKey.
+	payload.Manifest, err = s.fetchManifest(ctx, meta.ManifestPath)
+	if err != nil {
+		log.Printf("WARN: Snapshot %s has no readable manifest: %v", meta.Path, err)
+		return payload, nil
+	}
+	if err := payload.Manifest.Describes(meta); err != nil {
+		return nil, fmt.Errorf("snapshot %s: %w", meta.Path, err)
+	}
+	return payload, nil
+}
+
+// fetchManifest загружает манифест снэпшота.
+func (s *MinIOSnapshotSource) fetchManifest(ctx context.Context, path string) (*ab_types.SnapshotManifest, error) {
+	if path == "" {
+		return nil, errors.New("manifest path is empty")
+	}
+	data, _, err := s.getObject(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	var manifest ab_types.SnapshotManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal snapshot manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// resolveLatestSnapshotPointer читает latest.json и возвращает метаданные актуального снэпшота.
+func (s *MinIOSnapshotSource) resolveLatestSnapshotPointer(ctx context.Context) (*ab_types.SnapshotMeta, error) {
+	data, _, err := s.getObject(ctx, s.prefix+ab_types.LatestSnapshotPointer)
+	if err != nil {
+		return nil, err
+	}
+	var meta ab_types.SnapshotMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal snapshot pointer: %w", err)
+	}
+	if meta.Path == "" {
+		return nil, errors.New("snapshot pointer has empty path")
+	}
+	return &meta, nil
+}
+
+// findLatestSnapshotByListing находит последний снэпшот полным листингом бакета.
+func (s *MinIOSnapshotSource) findLatestSnapshotByListing(ctx context.Context) (string, error) {
+	objectCh := s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: s.prefix + ab_types.SnapshotObjectPrefix})
+	var objectNames []string
+	for object := range objectCh {
+		if object.Err != nil {
+			return "", object.Err
+		}
+		objectNames = append(objectNames, object.Key)
+	}
+
+	if len(objectNames) == 0 {
+		return "", errors.New("no snapshots found in bucket")
+	}
+
+	// Сортируем имена файлов. Т.к. версия - это UUIDv7, лексикографическая сортировка верна.
+	sort.Strings(objectNames)
+	return objectNames[len(objectNames)-1], nil
+}
+
+// FetchIDList загружает содержимое списка идентификаторов из того же бакета.
+func (s *MinIOSnapshotSource) FetchIDList(ctx context.Context, list *ab_types.IDList) ([]byte, error) {
+	data, _, err := s.getObject(ctx, list.ObjectKey)
+	return data, err
+}
+
+// getObject читает объект из бакета снэпшотов целиком и возвращает его content type.
+func (s *MinIOSnapshotSource) getObject(ctx context.Context, objectName string) ([]byte, string, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, "", err
+	}
+	defer obj.Close()
+
+	buf := new(bytes.Buffer)
+	if _, err := io.Copy(buf, obj); err != nil {
+		return nil, "", err
+	}
+
+	var contentType string
+	if info, err := obj.Stat(); err == nil {
+		contentType = info.ContentType
+	}
+	return buf.Bytes(), contentType, nil
+}
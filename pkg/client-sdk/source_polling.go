@@ -0,0 +1,72 @@
+package client_sdk
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// PollingDeltaSource периодически перечитывает снэпшот из SnapshotSource и передает его
+// клиенту целиком, если он изменился. Позволяет работать без Kafka: например,
+// в паре с HTTPSnapshotSource или FileSnapshotSource.
+type PollingDeltaSource struct {
+	source   SnapshotSource
+	interval time.Duration
+}
+
+// NewPollingDeltaSource создает источник, опрашивающий source с периодом interval.
+func NewPollingDeltaSource(source SnapshotSource, interval time.Duration) *PollingDeltaSource {
+	return &PollingDeltaSource{source: source, interval: interval}
+}
+
+func (s *PollingDeltaSource) Run(ctx context.Context, sink DeltaSink) error {
+	if s.interval <= 0 {
+		return fmt.Errorf("invalid polling interval: %v", s.interval)
+	}
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	var last *SnapshotPayload
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("INFO: Snapshot poller shutting down.")
+			return nil
+		case <-ticker.C:
+		}
+
+		payload, err := s.source.FetchSnapshot(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			sink.Error(fmt.Errorf("failed to poll snapshot: %w", err))
+			continue
+		}
+		if unchanged(last, payload) {
+			continue
+		}
+		last = payload
+		sink.Snapshot(payload)
+	}
+}
+
+func (s *PollingDeltaSource) Close() error {
+	return nil
+}
+
+// unchanged сообщает, что источник вернул тот же снэпшот, что и в прошлый раз.
+func unchanged(prev, next *SnapshotPayload) bool {
+	if prev == nil {
+		return false
+	}
+	if prev == next {
+		return true
+	}
+	if next.Snapshot != nil {
+		return prev.Snapshot == next.Snapshot
+	}
+	return prev.Snapshot == nil && bytes.Equal(prev.Data, next.Data)
+}
@@ -0,0 +1,115 @@
+package client_sdk
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+// SnapshotSource загружает полный снэпшот конфигурации.
+// Реализации по умолчанию: MinIOSnapshotSource; также доступны FileSnapshotSource,
+// HTTPSnapshotSource и MemorySource.
+type SnapshotSource interface {
+	// FetchSnapshot возвращает последний доступный снэпшот.
+	FetchSnapshot(ctx context.Context) (*SnapshotPayload, error)
+}
+
+// DeltaSource доставляет инкрементальные изменения конфигурации.
+// Реализации по умолчанию: KafkaDeltaSource; также доступны PollingDeltaSource и MemorySource.
+type DeltaSource interface {
+	// Run передает дельты в sink, пока ctx не отменен. Ошибки отдельных сообщений
+	// сообщаются через sink.Error и не прерывают чтение.
+	Run(ctx context.Context, sink DeltaSink) error
+	// Close освобождает ресурсы источника.
+	Close() error
+}
+
+// DeltaSink принимает изменения от DeltaSource. Реализуется клиентом.
+type DeltaSink interface {
+	// Apply применяет изменение одного эксперимента.
+	Apply(delta *Delta)
+	// Snapshot заменяет конфигурацию целиком. Используется источниками,
+	// которые не умеют выделять отдельные изменения (например, PollingDeltaSource).
+	Snapshot(payload *SnapshotPayload)
+	Error(err error)
+}
+
+// SnapshotPayload - снэпшот, полученный из SnapshotSource.
+// Источник заполняет либо Data (закодированный снэпшот, который клиент проверит по манифесту
+// и разберет), либо Snapshot (уже разобранный снэпшот из доверенного источника, например, из памяти).
+type SnapshotPayload struct {
+	Data []byte
+	// ContentType - MIME-тип Data; если пустой или неспецифичный, формат определяется по манифесту или содержимому.
+	ContentType string
+	// Manifest - манифест снэпшота, если источник его поддерживает.
+	Manifest *ab_types.SnapshotManifest
+
+	Snapshot *ab_types.Snapshot
+}
+
+// format определяет формат снэпшота: по content type, затем по манифесту,
+// и в последнюю очередь по содержимому.
+func (p *SnapshotPayload) format() ab_types.SnapshotFormat {
+	if format, ok := ab_types.ParseSnapshotContentType(p.ContentType); ok {
+		return format
+	}
+	if p.Manifest != nil {
+		if format, ok := ab_types.ParseSnapshotContentType(p.Manifest.ContentType); ok {
+			return format
+		}
+	}
+	return ab_types.DetectSnapshotFormat(p.Data)
+}
+
+// Delta - изменение одного эксперимента, флага, сегмента или списка идентификаторов.
+type Delta struct {
+	// Type - ab_types.EventUpsert, ab_types.EventDelete (эксперименты),
+	// ab_types.EventFlagUpsert, ab_types.EventFlagDelete (флаги),
+	// ab_types.EventSegmentUpsert, ab_types.EventSegmentDelete (сегменты),
+	// ab_types.EventIDListUpsert или ab_types.EventIDListDelete (списки идентификаторов).
+	Type string
+	// Seq - номер изменения проекта; 0, если источник его не знает.
+	Seq          int64
+	ExperimentID string
+	// Experiment заполнен только для ab_types.EventUpsert.
+	Experiment *ab_types.Experiment
+	FlagKey    string
+	// Flag заполнен только для ab_types.EventFlagUpsert.
+	Flag       *ab_types.Flag
+	SegmentKey string
+	// Segment заполнен только для ab_types.EventSegmentUpsert.
+	Segment  *ab_types.Segment
+	IDListID string
+	// IDList заполнен только для ab_types.EventIDListUpsert; содержимое списка клиент
+	// загружает из IDListSource.
+	IDList *ab_types.IDList
+	// Environment - окружение измененного эксперимента; пусто, если изменение относится
+	// ко всем окружениям или источник окружения не знает.
+	Environment string
+}
+
+// clientDeltaSink передает дельты от источника в клиент.
+type clientDeltaSink struct {
+	client *Client
+}
+
+func (s clientDeltaSink) Apply(delta *Delta) {
+	s.client.applyDelta(delta)
+}
+
+func (s clientDeltaSink) Snapshot(payload *SnapshotPayload) {
+	snapshot, err := s.client.decodeSnapshot(payload)
+	if err != nil {
+		s.Error(fmt.Errorf("failed to decode polled snapshot: %w", err))
+		return
+	}
+	s.client.populateCache(snapshot)
+	s.client.saveToLocalCache(payload)
+}
+
+func (s clientDeltaSink) Error(err error) {
+	s.client.metrics.errors.WithLabelValues("delta_source_error").Inc()
+	log.Printf("ERROR: Delta source error: %v", err)
+}
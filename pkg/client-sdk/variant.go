@@ -0,0 +1,130 @@
+package client_sdk
+
+import (
+	"context"
+
+	"github.com/goriiin/go-ab-service/pkg/ab_types"
+)
+
+// Reason объясняет результат GetVariant.
+type Reason string
+
+const (
+	// ReasonAssigned - пользователь попал в вариант по бакетированию.
+	ReasonAssigned Reason = "assigned"
+	// ReasonSticky - вариант закреплен за пользователем ранее (Experiment.Sticky).
+	ReasonSticky Reason = "sticky"
+	// ReasonForcedIncluded - пользователь в списке force_include эксперимента.
+	ReasonForcedIncluded Reason = "forced-included"
+	// ReasonOverridden - вариант задан локальным файлом оверрайдов (OverridesFilePath).
+	ReasonOverridden Reason = "overridden"
+	// ReasonForcedExcluded - пользователь в списке force_exclude эксперимента.
+	ReasonForcedExcluded Reason = "forced-excluded"
+	// ReasonTargetedOut - пользователь не прошел правила таргетинга.
+	ReasonTargetedOut Reason = "targeted-out"
+	// ReasonNotInBuckets - бакет пользователя не покрыт ни одним вариантом.
+	ReasonNotInBuckets Reason = "not-in-buckets"
+	// ReasonLayerExcluded - пользователь уже назначен в другой эксперимент того же слоя.
+	ReasonLayerExcluded Reason = "layer-excluded"
+	// ReasonInactive - эксперимент не активен или уже завершен.
+	ReasonInactive Reason = "inactive"
+	// ReasonUnknownExperiment - эксперимента нет в кэше клиента (в том числе вне RelevantLayerIDs).
+	ReasonUnknownExperiment Reason = "unknown-experiment"
+	// ReasonNotReady - конфигурация еще не загружена; возвращается вариант из DefaultVariants.
+	ReasonNotReady Reason = "not-ready"
+	// ReasonMissingBucketKey - не передан идентификатор, по которому рандомизируется эксперимент (BucketBy).
+	ReasonMissingBucketKey Reason = "missing-bucket-key"
+	// ReasonInvalidUser - не указан ни UserID, ни один из Identifiers.
+	ReasonInvalidUser Reason = "invalid-user"
+)
+
+// GetVariant вычисляет вариант пользователя в одном эксперименте.
+// Пустая строка означает, что пользователь не участвует в эксперименте; причина - в Reason.
+// Результат согласован с Decide, включая взаимное исключение экспериментов в слое.
+func (c *Client) GetVariant(_ context.Context, experimentID string, user DecisionContext) (string, Reason) {
+	c.enrichContext(&user)
+	resolved := c.resolveVariant(experimentID, &user)
+	if resolved.assigned() {
+		c.recordAssignment(&user, resolved.experiment, resolved.variantName, resolved.reason)
+	}
+	return resolved.variantName, resolved.reason
+}
+
+// resolvedVariant - результат вычисления одного эксперимента.
+type resolvedVariant struct {
+	variantName string
+	reason      Reason
+	// experiment - копия эксперимента из кэша, сделанная под блокировкой: элементы слоя
+	// сдвигаются при применении дельт. nil для неготового клиента и неизвестного эксперимента.
+	experiment *ab_types.Experiment
+}
+
+// assigned сообщает, что вариант назначен по конфигурации эксперимента (а не оверрайдом или по умолчанию).
+func (r resolvedVariant) assigned() bool {
+	return r.variantName != "" && (r.reason == ReasonAssigned || r.reason == ReasonSticky || r.reason == ReasonForcedIncluded)
+}
+
+// variant возвращает описание назначенного варианта, если оно известно.
+func (r resolvedVariant) variant() *ab_types.Variant {
+	if r.experiment == nil || r.variantName == "" {
+		return nil
+	}
+	for i := range r.experiment.Variants {
+		if r.experiment.Variants[i].Name == r.variantName {
+			return &r.experiment.Variants[i]
+		}
+	}
+	return nil
+}
+
+// resolveVariant вычисляет вариант пользователя в эксперименте без побочных эффектов.
+func (c *Client) resolveVariant(experimentID string, user *DecisionContext) resolvedVariant {
+	if !user.hasIdentity() {
+		return resolvedVariant{reason: ReasonInvalidUser}
+	}
+
+	c.cache.rwMutex.RLock()
+	defer c.cache.rwMutex.RUnlock()
+
+	position := c.locateCachedExperiment(experimentID)
+	var exp *ab_types.Experiment
+	if position.index >= 0 {
+		// Дельты заменяют эксперимент целиком и не меняют его вложенные срезы,
+		// поэтому достаточно копии структуры.
+		cached := c.cache.experiments[position.layerID][position.index]
+		exp = &cached
+	}
+
+	if variantName, ok := c.overrides[experimentID]; ok {
+		return resolvedVariant{variantName: variantName, reason: ReasonOverridden, experiment: exp}
+	}
+	if !c.Ready() {
+		return resolvedVariant{variantName: c.config.DefaultVariants[experimentID], reason: ReasonNotReady}
+	}
+	if exp == nil {
+		return resolvedVariant{reason: ReasonUnknownExperiment}
+	}
+
+	variantName, reason := c.evaluateExperiment(user, exp)
+	if variantName == "" {
+		return resolvedVariant{reason: reason}
+	}
+
+	// Эксперименты, стоящие в слое раньше, имеют приоритет (так же, как в Decide).
+	layerExperiments := c.cache.experiments[position.layerID]
+	for i := range layerExperiments[:position.index] {
+		if earlier, _ := c.evaluateExperiment(user, &layerExperiments[i]); earlier != "" {
+			return resolvedVariant{reason: ReasonLayerExcluded}
+		}
+	}
+	return resolvedVariant{variantName: variantName, reason: reason, experiment: exp}
+}
+
+// GetVariantOr возвращает вариант пользователя в эксперименте или defaultVariant,
+// если пользователь в эксперимент не попал.
+func (c *Client) GetVariantOr(experimentID string, user DecisionContext, defaultVariant string) string {
+	if variantName, _ := c.GetVariant(context.Background(), experimentID, user); variantName != "" {
+		return variantName
+	}
+	return defaultVariant
+}
@@ -0,0 +1,93 @@
+package geoip
+
+import "net/netip"
+
+// Атрибуты, которые Enricher добавляет к атрибутам пользователя.
+const (
+	AttrCountry   = "country"   // ISO 3166-1 alpha-2, например "DE"
+	AttrRegion    = "region"    // код первого уровня деления страны (ISO 3166-2 без страны), например "BY"
+	AttrCity      = "city"      // название города на английском
+	AttrContinent = "continent" // код континента, например "EU"
+)
+
+// Location - местоположение IP-адреса. Пустое поле означает, что в базе его нет.
+type Location struct {
+	Country   string
+	Region    string
+	City      string
+	Continent string
+}
+
+// Locate возвращает местоположение адреса ip. ok равен false, если адреса нет в базе.
+func (r *Reader) Locate(ip netip.Addr) (Location, bool, error) {
+	record, ok, err := r.Lookup(ip)
+	if err != nil || !ok {
+		return Location{}, false, err
+	}
+
+	var location Location
+	location.Country = nestedString(record, "country", "iso_code")
+	if location.Country == "" {
+		location.Country = nestedString(record, "registered_country", "iso_code")
+	}
+	location.Continent = nestedString(record, "continent", "code")
+	location.City = nestedString(record, "city", "names", "en")
+	if subdivisions, ok := record["subdivisions"].([]any); ok && len(subdivisions) > 0 {
+		if first, ok := subdivisions[0].(map[string]any); ok {
+			location.Region = nestedString(first, "iso_code")
+		}
+	}
+	return location, true, nil
+}
+
+// Enricher дополняет атрибуты пользователя местоположением его IP-адреса.
+type Enricher struct {
+	reader *Reader
+}
+
+// NewEnricher создает Enricher по базе reader.
+func NewEnricher(reader *Reader) *Enricher {
+	return &Enricher{reader: reader}
+}
+
+// Enrich добавляет в attributes атрибуты AttrCountry, AttrRegion, AttrCity и AttrContinent
+// для адреса ip. Атрибуты, уже переданные вызывающим кодом, не перезаписываются.
+// Некорректный или отсутствующий в базе адрес оставляет attributes без изменений.
+// Сигнатура совпадает с хуками обогащения central-api и SDK.
+func (e *Enricher) Enrich(ip string, attributes map[string]any) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return
+	}
+	location, ok, err := e.reader.Locate(addr)
+	if err != nil || !ok {
+		return
+	}
+	setIfAbsent(attributes, AttrCountry, location.Country)
+	setIfAbsent(attributes, AttrRegion, location.Region)
+	setIfAbsent(attributes, AttrCity, location.City)
+	setIfAbsent(attributes, AttrContinent, location.Continent)
+}
+
+func setIfAbsent(attributes map[string]any, name, value string) {
+	if value == "" {
+		return
+	}
+	if _, ok := attributes[name]; !ok {
+		attributes[name] = value
+	}
+}
+
+// nestedString возвращает строку по пути path во вложенных картах записи.
+func nestedString(record map[string]any, path ...string) string {
+	var current any = record
+	for _, key := range path {
+		fields, ok := current.(map[string]any)
+		if !ok {
+			return ""
+		}
+		current = fields[key]
+	}
+	value, _ := current.(string)
+	return value
+}
@@ -0,0 +1,371 @@
+// Package geoip определяет страну и регион по IP-адресу из локального файла базы
+// в формате MaxMind DB (GeoLite2/GeoIP2 Country и City).
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/netip"
+	"os"
+)
+
+// metadataStartMarker предшествует метаданным в конце файла MaxMind DB.
+var metadataStartMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// dataSectionSeparator - нулевые байты между деревом поиска и секцией данных.
+const dataSectionSeparator = 16
+
+// maxDecodeDepth ограничивает вложенность значений, чтобы поврежденный файл не вызвал переполнение стека.
+const maxDecodeDepth = 32
+
+// Типы значений секции данных MaxMind DB.
+const (
+	typeExtended  = 0
+	typePointer   = 1
+	typeString    = 2
+	typeDouble    = 3
+	typeBytes     = 4
+	typeUint16    = 5
+	typeUint32    = 6
+	typeMap       = 7
+	typeInt32     = 8
+	typeUint64    = 9
+	typeUint128   = 10
+	typeArray     = 11
+	typeContainer = 12
+	typeEndMarker = 13
+	typeBool      = 14
+	typeFloat     = 15
+)
+
+// Metadata - метаданные базы.
+type Metadata struct {
+	DatabaseType string
+	IPVersion    uint
+	NodeCount    uint
+	RecordSize   uint
+	BuildEpoch   uint64
+}
+
+// Reader - база MaxMind DB, загруженная в память. Безопасен для конкурентного использования.
+type Reader struct {
+	metadata Metadata
+	tree     []byte
+	data     decoder
+	// ipv4Start - узел дерева, с которого начинается поиск IPv4-адресов в базе IPv6.
+	ipv4Start uint
+}
+
+// Open загружает базу из файла path.
+func Open(path string) (*Reader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read geoip database: %w", err)
+	}
+	reader, err := FromBytes(buf)
+	if err != nil {
+		return nil, fmt.Errorf("invalid geoip database %s: %w", path, err)
+	}
+	return reader, nil
+}
+
+// FromBytes разбирает базу, уже загруженную в память.
+func FromBytes(buf []byte) (*Reader, error) {
+	start := bytes.LastIndex(buf, metadataStartMarker)
+	if start < 0 {
+		return nil, errors.New("metadata section not found")
+	}
+	raw, _, err := decoder{buf: buf[start+len(metadataStartMarker):]}.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode metadata: %w", err)
+	}
+	fields, ok := raw.(map[string]any)
+	if !ok {
+		return nil, errors.New("metadata is not a map")
+	}
+	metadata := Metadata{
+		DatabaseType: stringField(fields, "database_type"),
+		IPVersion:    uint(uintField(fields, "ip_version")),
+		NodeCount:    uint(uintField(fields, "node_count")),
+		RecordSize:   uint(uintField(fields, "record_size")),
+		BuildEpoch:   uintField(fields, "build_epoch"),
+	}
+	if metadata.RecordSize != 24 && metadata.RecordSize != 28 && metadata.RecordSize != 32 {
+		return nil, fmt.Errorf("unsupported record size %d", metadata.RecordSize)
+	}
+	if metadata.IPVersion != 4 && metadata.IPVersion != 6 {
+		return nil, fmt.Errorf("unsupported ip version %d", metadata.IPVersion)
+	}
+
+	treeSize := metadata.NodeCount * metadata.RecordSize / 4
+	if treeSize+dataSectionSeparator > uint(start) {
+		return nil, errors.New("search tree exceeds file size")
+	}
+	reader := &Reader{
+		metadata: metadata,
+		tree:     buf[:treeSize],
+		data:     decoder{buf: buf[treeSize+dataSectionSeparator : start]},
+	}
+	if metadata.IPVersion == 6 {
+		// IPv4-адреса хранятся в базе IPv6 как ::a.b.c.d: перед ними 96 нулевых бит.
+		for i := 0; i < 96 && reader.ipv4Start < metadata.NodeCount; i++ {
+			reader.ipv4Start = reader.readNode(reader.ipv4Start, 0)
+		}
+	}
+	return reader, nil
+}
+
+// Metadata возвращает метаданные базы.
+func (r *Reader) Metadata() Metadata {
+	return r.metadata
+}
+
+// Lookup возвращает запись базы для адреса ip. ok равен false, если адрес не найден.
+func (r *Reader) Lookup(ip netip.Addr) (record map[string]any, ok bool, err error) {
+	ip = ip.Unmap()
+	var (
+		addr []byte
+		node uint
+	)
+	switch {
+	case ip.Is4():
+		a4 := ip.As4()
+		addr = a4[:]
+		if r.metadata.IPVersion == 6 {
+			node = r.ipv4Start
+		}
+	case ip.Is6():
+		if r.metadata.IPVersion == 4 {
+			return nil, false, fmt.Errorf("cannot look up IPv6 address %s in an IPv4-only database", ip)
+		}
+		a16 := ip.As16()
+		addr = a16[:]
+	default:
+		return nil, false, errors.New("invalid ip address")
+	}
+
+	nodeCount := r.metadata.NodeCount
+	for i := 0; i < len(addr)*8 && node < nodeCount; i++ {
+		bit := (addr[i>>3] >> (7 - uint(i)%8)) & 1
+		node = r.readNode(node, bit)
+	}
+	if node == nodeCount {
+		return nil, false, nil
+	}
+	if node < nodeCount {
+		return nil, false, errors.New("search tree is corrupt: address bits exhausted")
+	}
+
+	value, _, err := r.data.decode(node-nodeCount-dataSectionSeparator, 0)
+	if err != nil {
+		return nil, false, err
+	}
+	record, ok = value.(map[string]any)
+	if !ok {
+		return nil, false, errors.New("record is not a map")
+	}
+	return record, true, nil
+}
+
+// readNode возвращает левую (bit == 0) или правую запись узла дерева поиска.
+func (r *Reader) readNode(node uint, bit byte) uint {
+	switch r.metadata.RecordSize {
+	case 24:
+		b := r.tree[node*6:]
+		if bit == 1 {
+			b = b[3:]
+		}
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := r.tree[node*7:]
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		b := r.tree[node*8:]
+		if bit == 1 {
+			b = b[4:]
+		}
+		return uint(binary.BigEndian.Uint32(b))
+	}
+}
+
+// decoder разбирает значения секции данных. Указатели отсчитываются от начала buf.
+type decoder struct {
+	buf []byte
+}
+
+// decode разбирает значение по смещению offset и возвращает смещение следующего значения.
+func (d decoder) decode(offset uint, depth int) (any, uint, error) {
+	if depth > maxDecodeDepth {
+		return nil, 0, errors.New("data structure is nested too deeply")
+	}
+	if offset >= uint(len(d.buf)) {
+		return nil, 0, errors.New("unexpected end of data section")
+	}
+	ctrl := d.buf[offset]
+	offset++
+	kind := uint(ctrl >> 5)
+
+	if kind == typePointer {
+		pointer, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(pointer, depth+1)
+		return value, next, err
+	}
+	if kind == typeExtended {
+		if offset >= uint(len(d.buf)) {
+			return nil, 0, errors.New("unexpected end of data section")
+		}
+		kind = 7 + uint(d.buf[offset])
+		offset++
+	}
+
+	size, offset, err := d.size(ctrl, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch kind {
+	case typeMap:
+		values := make(map[string]any, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			keyStr, ok := key.(string)
+			if !ok {
+				return nil, 0, errors.New("map key is not a string")
+			}
+			values[keyStr], offset, err = d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		return values, offset, nil
+	case typeArray:
+		values := make([]any, 0, min(size, 1024))
+		for i := uint(0); i < size; i++ {
+			var value any
+			value, offset, err = d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			values = append(values, value)
+		}
+		return values, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	case typeContainer, typeEndMarker:
+		return nil, 0, fmt.Errorf("unsupported data type %d", kind)
+	}
+
+	if offset+size > uint(len(d.buf)) {
+		return nil, 0, errors.New("value exceeds data section")
+	}
+	raw := d.buf[offset : offset+size]
+	next := offset + size
+	switch kind {
+	case typeString:
+		return string(raw), next, nil
+	case typeBytes:
+		return bytes.Clone(raw), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid double size %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(raw)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid float size %d", size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(raw))), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("invalid unsigned integer size %d", size)
+		}
+		var value uint64
+		for _, b := range raw {
+			value = value<<8 | uint64(b)
+		}
+		return value, next, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("invalid int32 size %d", size)
+		}
+		var value uint32
+		for _, b := range raw {
+			value = value<<8 | uint32(b)
+		}
+		return int64(int32(value)), next, nil
+	case typeUint128:
+		if size > 16 {
+			return nil, 0, fmt.Errorf("invalid uint128 size %d", size)
+		}
+		return new(big.Int).SetBytes(raw), next, nil
+	default:
+		return nil, 0, fmt.Errorf("unknown data type %d", kind)
+	}
+}
+
+// pointer разбирает указатель с управляющим байтом ctrl.
+func (d decoder) pointer(ctrl byte, offset uint) (uint, uint, error) {
+	n := uint(ctrl>>3)&0x3 + 1
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, errors.New("pointer exceeds data section")
+	}
+	b := d.buf[offset : offset+n]
+	high := uint(ctrl & 0x7)
+	var pointer uint
+	switch n {
+	case 1:
+		pointer = high<<8 | uint(b[0])
+	case 2:
+		pointer = (high<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+	case 3:
+		pointer = (high<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+	default:
+		pointer = uint(binary.BigEndian.Uint32(b))
+	}
+	return pointer, offset + n, nil
+}
+
+// size разбирает размер значения с управляющим байтом ctrl.
+func (d decoder) size(ctrl byte, offset uint) (uint, uint, error) {
+	size := uint(ctrl & 0x1f)
+	if size < 29 {
+		return size, offset, nil
+	}
+	n := size - 28
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, errors.New("size exceeds data section")
+	}
+	b := d.buf[offset : offset+n]
+	switch n {
+	case 1:
+		size = 29 + uint(b[0])
+	case 2:
+		size = 285 + (uint(b[0])<<8 | uint(b[1]))
+	default:
+		size = 65821 + (uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]))
+	}
+	return size, offset + n, nil
+}
+
+func stringField(fields map[string]any, name string) string {
+	value, _ := fields[name].(string)
+	return value
+}
+
+func uintField(fields map[string]any, name string) uint64 {
+	value, _ := fields[name].(uint64)
+	return value
+}
@@ -43,9 +43,10 @@ echo "\n--- Создание эксперимента для сортировк
 CREATE_PAYLOAD='{
     "layer_id": "sorting_layer",
     "targeting_rules": [{"attribute": "use_sort_test", "operator": "EQUALS", "value": true}],
+    "parameter_schema": {"sort_order": {"type": "string", "required": true}},
     "variants": [
-        {"name": "variant-a-asc", "bucket_range": [0, 499]},
-        {"name": "variant-b-desc", "bucket_range": [500, 999]}
+        {"name": "variant-a-asc", "bucket_range": [0, 499], "parameters": {"sort_order": "asc"}},
+        {"name": "variant-b-desc", "bucket_range": [500, 999], "parameters": {"sort_order": "desc"}}
     ]
 }'
 RESPONSE_BODY=$(curl -s -X POST ${API_HOST}/experiments -H "Content-Type: application/json" -d "$CREATE_PAYLOAD")
@@ -63,9 +64,10 @@ ACTIVATE_PAYLOAD='{
     "layer_id": "sorting_layer",
     "status": "ACTIVE",
     "targeting_rules": [{"attribute": "use_sort_test", "operator": "EQUALS", "value": true}],
+    "parameter_schema": {"sort_order": {"type": "string", "required": true}},
     "variants": [
-        {"name": "variant-a-asc", "bucket_range": [0, 499]},
-        {"name": "variant-b-desc", "bucket_range": [500, 999]}
+        {"name": "variant-a-asc", "bucket_range": [0, 499], "parameters": {"sort_order": "asc"}},
+        {"name": "variant-b-desc", "bucket_range": [500, 999], "parameters": {"sort_order": "desc"}}
     ],
     "override_lists": {
         "force_include": {
@@ -86,7 +88,7 @@ echo "\n--- Проверка работы example-sort-app ---"
 echo "Проверка варианта 'variant-a-asc' для 'user-for-asc'..."
 SORT_RESPONSE_ASC=$(curl -s -X POST ${SORT_APP_HOST}/sort \
   -H "Content-Type: application/json" \
-  -d '{"user_id": "user-for-asc", "numbers": [5,1,4,2,3]}')
+  -d "{\"user_id\": \"user-for-asc\", \"experiment_id\": \"${EXPERIMENT_ID}\", \"numbers\": [5,1,4,2,3]}")
 
 VARIANT_ASC=$(echo "$SORT_RESPONSE_ASC" | jq -r .variant_used)
 SORTED_NUMS_ASC=$(echo "$SORT_RESPONSE_ASC" | jq -r .sorted_numbers | tr -d ' \n')
@@ -101,7 +103,7 @@ echo "УСПЕХ: Вариант 'variant-a-asc' отработал коррек
 echo "Проверка варианта 'variant-b-desc' для 'user-for-desc'..."
 SORT_RESPONSE_DESC=$(curl -s -X POST ${SORT_APP_HOST}/sort \
   -H "Content-Type: application/json" \
-  -d '{"user_id": "user-for-desc", "numbers": [5,1,4,2,3]}')
+  -d "{\"user_id\": \"user-for-desc\", \"experiment_id\": \"${EXPERIMENT_ID}\", \"numbers\": [5,1,4,2,3]}")
 
 VARIANT_DESC=$(echo "$SORT_RESPONSE_DESC" | jq -r .variant_used)
 SORTED_NUMS_DESC=$(echo "$SORT_RESPONSE_DESC" | jq -r .sorted_numbers | tr -d ' \n')